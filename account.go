@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neghoda/quiet_hn/accounts"
+)
+
+const (
+	loginPath     = "/login"
+	signupPath    = "/signup"
+	logoutPath    = "/logout"
+	bookmarksPath = "/bookmarks"
+	sessionCookie = "session"
+
+	// maxBookmarksShown bounds the stories fetched for the bookmarks page
+	maxBookmarksShown = 100
+)
+
+// session is the visitor logged in, with the settings of their profile.
+type session struct {
+	user     accounts.User
+	settings settings
+}
+
+type sessionKey struct{}
+
+// sessionOf returns the visitor logged in, nil if they aren't or there are
+// no accounts.
+func sessionOf(r *http.Request) *session {
+	a, _ := r.Context().Value(sessionKey{}).(*session)
+	return a
+}
+
+// withAccounts looks the session of a request up once, for the handlers and
+// the settings to find with sessionOf.
+func (cfg config) withAccounts(h http.Handler) http.Handler {
+	if cfg.accounts == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(sessionCookie)
+		if err != nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		a, err := cfg.loadSession(cookie.Value)
+		switch {
+		case errors.Is(err, accounts.ErrNoSession):
+			cfg.setSession(w, r, "")
+		case err != nil:
+			log.Printf("failed to look the session up: %s", err)
+		default:
+			r = r.WithContext(context.WithValue(r.Context(), sessionKey{}, a))
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (cfg config) loadSession(token string) (*session, error) {
+	u, err := cfg.accounts.Session(token)
+	if err != nil {
+		return nil, err
+	}
+	a := &session{user: u}
+	b, err := cfg.accounts.Settings(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if b != nil {
+		if err := json.Unmarshal(b, &a.settings); err != nil {
+			log.Printf("failed to read the settings of %s: %s", u.Name, err)
+		}
+	}
+	return a, nil
+}
+
+// setSession sets the session cookie, or deletes it if token is empty.
+func (cfg config) setSession(w http.ResponseWriter, r *http.Request, token string) {
+	cookie := &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(cfg.PublicURL, "https:"),
+		SameSite: http.SameSiteLaxMode,
+	}
+	if token == "" {
+		cookie.MaxAge = -1
+	} else {
+		cookie.MaxAge = int(cfg.SessionTTL.Seconds())
+	}
+	http.SetCookie(w, cookie)
+}
+
+// saveProfileSettings keeps the settings in the profile of the visitor.
+func (cfg config) saveProfileSettings(a *session, s settings) error {
+	var b []byte
+	if !s.unset() {
+		b, _ = json.Marshal(s)
+	}
+	return cfg.accounts.SaveSettings(a.user.ID, b)
+}
+
+// markStories sets which of the stories the visitor logged in saved and
+// read. The stories are copies made for the request.
+func (cfg config) markStories(r *http.Request, stories []item) {
+	a := sessionOf(r)
+	if a == nil || len(stories) == 0 {
+		return
+	}
+	ids := make([]int, len(stories))
+	for i, s := range stories {
+		ids[i] = s.ID
+	}
+	saved, read, err := cfg.accounts.Marks(a.user.ID, ids)
+	if err != nil {
+		log.Printf("failed to look the bookmarks of %s up: %s", a.user.Name, err)
+		return
+	}
+	for i := range stories {
+		// bookmarks are of HN stories, the ids of other sources may be
+		// the same
+		if stories[i].Source == "" {
+			stories[i].Saved, stories[i].Read = saved[stories[i].ID], read[stories[i].ID]
+		}
+	}
+}
+
+type loginTemplateData struct {
+	// Signup is set on the page that makes an account, SignupOpen if there
+	// is one
+	Signup     bool
+	SignupOpen bool
+	// Providers are the services to log in with instead
+	Providers []loginProvider
+	Name      string
+	// Error is the message key of what went wrong
+	Error string
+	pageData
+}
+
+// loginHandler logs visitors in, or makes their account when signup is set.
+// Settings made before logging in are kept when the profile has none.
+func loginHandler(cfg config, tpls *templates, signup bool) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		data := loginTemplateData{Signup: signup, SignupOpen: cfg.Signup}
+		for _, p := range cfg.oauth {
+			data.Providers = append(data.Providers, loginProvider{Path: loginPath + "/" + p.name, Label: p.label})
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost:
+			if !sameOrigin(r) {
+				http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+				return
+			}
+			data.Name = strings.TrimSpace(r.PostFormValue("name"))
+			password := r.PostFormValue("password")
+			var u accounts.User
+			var err error
+			if signup {
+				u, err = cfg.accounts.Create(data.Name, password)
+			} else {
+				u, err = cfg.accounts.Login(data.Name, password)
+			}
+			status := http.StatusBadRequest
+			switch {
+			case err == nil:
+			case errors.Is(err, accounts.ErrBadLogin):
+				data.Error, status = "login_failed", http.StatusUnauthorized
+			case errors.Is(err, accounts.ErrNameTaken):
+				data.Error = "signup_name_taken"
+			case errors.Is(err, accounts.ErrInvalidName):
+				data.Error = "signup_invalid_name"
+			case errors.Is(err, accounts.ErrShortPassword):
+				data.Error = "signup_short_password"
+			default:
+				log.Printf("failed to log %s in: %s", data.Name, err)
+				http.Error(w, "Failed to log in", http.StatusInternalServerError)
+				return
+			}
+			if err == nil {
+				if err := cfg.logIn(w, r, u); err != nil {
+					log.Printf("failed to log %s in: %s", u.Name, err)
+					http.Error(w, "Failed to log in", http.StatusInternalServerError)
+					return
+				}
+				http.Redirect(w, r, "/", http.StatusSeeOther)
+				return
+			}
+			w.WriteHeader(status)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		data.pageData = cfg.pageData(r, start)
+		err := tpls.execute(w, "login.gohtml", data)
+		if err != nil {
+			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// logIn starts a session of u, moving the settings of the cookie to the
+// profile if it has none yet.
+func (cfg config) logIn(w http.ResponseWriter, r *http.Request, u accounts.User) error {
+	token, err := cfg.accounts.NewSession(u.ID)
+	if err != nil {
+		return err
+	}
+	if s := cfg.settings(r); !s.unset() {
+		if b, err := cfg.accounts.Settings(u.ID); err == nil && b == nil {
+			if err := cfg.saveProfileSettings(&session{user: u}, s); err != nil {
+				return err
+			}
+		}
+		cfg.saveSettings(w, r, settings{})
+	}
+	cfg.setSession(w, r, token)
+	return nil
+}
+
+// logoutHandler ends the session of the visitor.
+func logoutHandler(cfg config) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", "POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !sameOrigin(r) {
+			http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+			return
+		}
+		if cookie, err := r.Cookie(sessionCookie); err == nil {
+			if err := cfg.accounts.EndSession(cookie.Value); err != nil {
+				log.Printf("failed to end a session: %s", err)
+			}
+		}
+		cfg.setSession(w, r, "")
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+}
+
+type bookmarksTemplateData struct {
+	Stories []item
+	// Token is the API token just made, only ever shown once
+	Token string
+	pageData
+}
+
+// bookmarksHandler lists the stories the visitor saved, and saves or removes
+// one on POST, or makes a new API token for the bookmarks API.
+func bookmarksHandler(c *cach, cfg config, tpls *templates) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		a := sessionOf(r)
+		if a == nil {
+			http.Redirect(w, r, loginPath, http.StatusSeeOther)
+			return
+		}
+		var token string
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost:
+			if !sameOrigin(r) {
+				http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+				return
+			}
+			if r.PostFormValue("token") != "" {
+				var err error
+				if token, err = cfg.accounts.NewToken(a.user.ID); err != nil {
+					log.Printf("failed to make an API token for %s: %s", a.user.Name, err)
+					http.Error(w, "Failed to make an API token", http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Cache-Control", "no-store")
+				break
+			}
+			id, err := strconv.Atoi(r.PostFormValue("id"))
+			if err != nil {
+				http.Error(w, "Invalid story id", http.StatusBadRequest)
+				return
+			}
+			if r.PostFormValue("saved") != "" {
+				err = cfg.accounts.Bookmark(a.user.ID, id, time.Now())
+			} else {
+				err = cfg.accounts.Unbookmark(a.user.ID, id, time.Now())
+			}
+			if err != nil {
+				log.Printf("failed to save the bookmark of %s: %s", a.user.Name, err)
+				http.Error(w, "Failed to save the bookmark", http.StatusInternalServerError)
+				return
+			}
+			http.Redirect(w, r, backTo(r, id), http.StatusSeeOther)
+			return
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bookmarks, err := cfg.accounts.Bookmarks(a.user.ID)
+		if err != nil {
+			log.Printf("failed to load the bookmarks of %s: %s", a.user.Name, err)
+			http.Error(w, "Failed to load the bookmarks", http.StatusInternalServerError)
+			return
+		}
+		data := bookmarksTemplateData{
+			Stories:  bookmarkedStories(r.Context(), c, bookmarks[:min(len(bookmarks), maxBookmarksShown)]),
+			Token:    token,
+			pageData: cfg.pageData(r, start),
+		}
+		cfg.markStories(r, data.Stories)
+		err = tpls.execute(w, "bookmarks.gohtml", data)
+		if err != nil {
+			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// bookmarkedStories returns the saved stories in order, from the cache when
+// they are on the front page. Stories that fail to load are left out.
+func bookmarkedStories(ctx context.Context, c *cach, bookmarks []accounts.Bookmark) []item {
+	stories := make([]item, len(bookmarks))
+	var wg sync.WaitGroup
+	for i, b := range bookmarks {
+		if s, ok := c.lookup(b.StoryID); ok {
+			stories[i] = s
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if hnItem, err := fetchItem(ctx, hnSource{}, b.StoryID); err == nil {
+				stories[i] = parseHNItem(hnItem)
+			}
+		}()
+	}
+	wg.Wait()
+	ret := stories[:0]
+	for _, s := range stories {
+		if s.ID != 0 {
+			s.Rank = len(ret) + 1
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// backTo returns the page of this instance a story was saved from, at the
+// story, or the bookmarks if the browser didn't say.
+func backTo(r *http.Request, id int) string {
+	ref, err := url.Parse(r.Referer())
+	if err != nil || ref.Host != r.Host || ref.Path == "" {
+		return bookmarksPath
+	}
+	return fmt.Sprintf("%s#story-%d", ref.RequestURI(), id)
+}
+
+// adduserCommand adds an account, with the password read from the first line
+// of stdin so it stays out of the shell history, for instances without
+// -signup.
+func adduserCommand(args []string) error {
+	fs := flag.NewFlagSet("adduser", flag.ExitOnError)
+	path := fs.String("accounts", "", "the SQLite database of the accounts, created if needed")
+	name := fs.String("name", "", "the name of the account")
+	reset := fs.Bool("reset", false, "set the password of an account that exists, logging it out everywhere")
+	fs.Parse(args)
+	if *path == "" || *name == "" {
+		return errors.New("adduser: -accounts and -name are required")
+	}
+	store, err := accounts.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	fmt.Fprintf(os.Stderr, "password for %s: ", *name)
+	password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && password != "") {
+		return fmt.Errorf("adduser: reading the password: %w", err)
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if *reset {
+		return store.SetPassword(*name, password)
+	}
+	_, err = store.Create(*name, password)
+	return err
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neghoda/quiet_hn/accounts"
+)
+
+func TestAccounts(t *testing.T) {
+	setupHN(t, map[int]string{1: storyJSON(1), 2: storyJSON(2), 3: storyJSON(3)})
+	store, err := accounts.Open(filepath.Join(t.TempDir(), "accounts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{CookieSecret: "secret", Lang: "en", NumStories: 3, Signup: true, SessionTTL: accounts.DefaultSessionTTL, accounts: store}
+	f, err := newFilters(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCach(cfg.NumStories, f, cachOptions{pages: newPageCach()})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handler(c, cfg, tpls))
+	mux.HandleFunc(settingsPath, settingsHandler(cfg, tpls))
+	mux.HandleFunc(loginPath, loginHandler(cfg, tpls, false))
+	mux.HandleFunc(signupPath, loginHandler(cfg, tpls, true))
+	mux.HandleFunc(logoutPath, logoutHandler(cfg))
+	mux.HandleFunc(bookmarksPath, bookmarksHandler(c, cfg, tpls))
+	h := cfg.withAccounts(mux)
+
+	var cookies []*http.Cookie
+	do := func(method, path string, form url.Values) *httptest.ResponseRecorder {
+		var r *http.Request
+		if form != nil {
+			r = httptest.NewRequest(method, "http://example.com"+path, strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			r = httptest.NewRequest(method, "http://example.com"+path, nil)
+		}
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		for _, c := range rec.Result().Cookies() {
+			cookies = withoutCookie(cookies, c.Name)
+			if c.MaxAge >= 0 {
+				cookies = append(cookies, c)
+			}
+		}
+		return rec
+	}
+
+	// the settings made before signing up move to the profile
+	do("POST", settingsPath, url.Values{"words": {"/Story 1$/"}, "theme": {"dark"}})
+	if rec := do("POST", signupPath, url.Values{"name": {"alice"}, "password": {"short"}}); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "too short") {
+		t.Errorf("short password: want 400 with the error, got %d", rec.Code)
+	}
+	if rec := do("POST", signupPath, url.Values{"name": {"alice"}, "password": {"correct horse"}}); rec.Code != http.StatusSeeOther {
+		t.Fatalf("signup: want %d, got %d", http.StatusSeeOther, rec.Code)
+	}
+	for _, c := range cookies {
+		if c.Name == settingsCookie {
+			t.Error("signup: want the settings cookie dropped")
+		}
+	}
+	rec := do("GET", "/", nil)
+	if body := rec.Body.String(); !strings.Contains(body, `<html lang="en" data-theme="dark">`) || strings.Contains(body, "Story 1") {
+		t.Errorf("front page: want the settings of the profile applied")
+	}
+
+	do("POST", bookmarksPath, url.Values{"id": {"2"}, "saved": {"1"}})
+	rec = do("GET", "/", nil)
+	if !strings.Contains(rec.Body.String(), "saved ✓") {
+		t.Error("front page: want story 2 marked saved")
+	}
+	rec = do("GET", bookmarksPath, nil)
+	if body := rec.Body.String(); !strings.Contains(body, "Story 2") || strings.Contains(body, "Story 3") {
+		t.Errorf("bookmarks: want story 2 only, got %s", body)
+	}
+	rec = do("POST", bookmarksPath, url.Values{"token": {"new"}})
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "no-store" || !strings.Contains(rec.Body.String(), "not shown again") {
+		t.Errorf("new token: want it shown once, got %d", rec.Code)
+	}
+
+	// a new device logs in and finds the same profile
+	cookies = nil
+	if rec := do("POST", loginPath, url.Values{"name": {"alice"}, "password": {"wrong horse"}}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: want %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+	do("POST", loginPath, url.Values{"name": {"Alice"}, "password": {"correct horse"}})
+	if rec := do("GET", "/", nil); !strings.Contains(rec.Body.String(), `<html lang="en" data-theme="dark">`) {
+		t.Error("second device: want the settings of the profile")
+	}
+
+	if rec := do("POST", logoutPath, url.Values{}); rec.Code != http.StatusSeeOther {
+		t.Errorf("logout: want %d, got %d", http.StatusSeeOther, rec.Code)
+	}
+	if rec := do("GET", bookmarksPath, nil); rec.Code != http.StatusSeeOther {
+		t.Errorf("logged out bookmarks: want a redirect to the login, got %d", rec.Code)
+	}
+	if rec := do("GET", "/", nil); strings.Contains(rec.Body.String(), `<html lang="en" data-theme="dark">`) {
+		t.Error("logged out: want the default settings")
+	}
+}
+
+func withoutCookie(cookies []*http.Cookie, name string) []*http.Cookie {
+	ret := cookies[:0]
+	for _, c := range cookies {
+		if c.Name != name {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+func TestBackTo(t *testing.T) {
+	tests := []struct {
+		referer string
+		want    string
+	}{
+		{"http://example.com/tag/go?x=1", "/tag/go?x=1#story-7"},
+		{"http://evil.example/", bookmarksPath},
+		{"", bookmarksPath},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "http://example.com/bookmarks", nil)
+		r.Header.Set("Referer", tt.referer)
+		if got := backTo(r, 7); got != tt.want {
+			t.Errorf("backTo(%q): want %q, got %q", tt.referer, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,434 @@
+// Package accounts keeps the accounts of an instance in a SQLite database:
+// their passwords, sessions and profiles, so the settings, bookmarks and read
+// stories of a visitor follow them across devices.
+package accounts
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+const (
+	// DefaultSessionTTL is how long a login lasts by default.
+	DefaultSessionTTL = 30 * 24 * time.Hour
+	// MinPassword is the least number of characters of a password.
+	MinPassword = 8
+	// readKept is how long a story is remembered as read.
+	readKept = 90 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidName   = errors.New("accounts: a name has 1 to 32 letters, digits, - or _")
+	ErrShortPassword = fmt.Errorf("accounts: a password has at least %d characters", MinPassword)
+	ErrNameTaken     = errors.New("accounts: the name is taken")
+	ErrBadLogin      = errors.New("accounts: wrong name or password")
+	ErrNoSession     = errors.New("accounts: no such session, or it expired")
+	ErrNoIdentity    = errors.New("accounts: no account has the identity")
+	ErrNoToken       = errors.New("accounts: no such API token")
+)
+
+var (
+	validName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,32}$`)
+	nameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+)
+
+// Store is a set of accounts backed by a SQLite database file.
+type Store struct {
+	db *sql.DB
+	// SessionTTL is how long a session lasts after login.
+	SessionTTL time.Duration
+}
+
+// User is an account.
+type User struct {
+	ID      int64
+	Name    string
+	Created time.Time
+}
+
+// Bookmark is a story saved by a user. A story is saved if it was last
+// added after it was last removed, so devices that merge their bookmarks
+// agree whatever order they sync in.
+type Bookmark struct {
+	StoryID int
+	// Added is when the story was last saved, Removed when it was last
+	// removed, zero if never
+	Added   time.Time
+	Removed time.Time
+}
+
+// Saved reports whether the story is saved.
+func (b Bookmark) Saved() bool {
+	return b.Added.After(b.Removed)
+}
+
+// Open opens the accounts database at path, creating it if needed, and
+// brings its schema up to date.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer anyway, one connection avoids busy
+	// errors between our own goroutines
+	db.SetMaxOpenConns(1)
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("accounts %s: %w", path, err)
+	}
+	return &Store{db: db, SessionTTL: DefaultSessionTTL}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Create adds an account. Names are unique regardless of case.
+func (s *Store) Create(name, password string) (User, error) {
+	if !validName.MatchString(name) {
+		return User{}, ErrInvalidName
+	}
+	if len([]rune(password)) < MinPassword {
+		return User{}, ErrShortPassword
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return User{}, err
+	}
+	u := User{Name: name, Created: time.Now().Truncate(time.Second)}
+	res, err := s.db.Exec(`INSERT INTO users (name, password, created) VALUES (?, ?, ?) ON CONFLICT (name) DO NOTHING`, name, hash, u.Created.Unix())
+	if err != nil {
+		return User{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return User{}, ErrNameTaken
+	}
+	u.ID, err = res.LastInsertId()
+	return u, err
+}
+
+// Identity returns the account an identity of an external provider, like a
+// GitHub user id, is linked to.
+func (s *Store) Identity(provider, subject string) (User, error) {
+	var u User
+	var created int64
+	err := s.db.QueryRow(`SELECT users.id, users.name, users.created FROM identities JOIN users ON users.id = identities.user_id
+		WHERE identities.provider = ? AND identities.subject = ?`, provider, subject).Scan(&u.ID, &u.Name, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNoIdentity
+	}
+	if err != nil {
+		return User{}, err
+	}
+	u.Created = time.Unix(created, 0)
+	return u, nil
+}
+
+// CreateLinked adds an account linked to an identity of an external
+// provider. It has no password until one is set, and is named after name,
+// with a number added if the name is taken.
+func (s *Store) CreateLinked(provider, subject, name string) (User, error) {
+	base := strings.Trim(nameChars.ReplaceAllString(name, "-"), "-")
+	if base == "" {
+		base = "user"
+	}
+	base = base[:min(len(base), 28)]
+	tx, err := s.db.Begin()
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+	u := User{Created: time.Now().Truncate(time.Second)}
+	for i := 1; u.ID == 0; i++ {
+		u.Name = base
+		if i > 1 {
+			u.Name = fmt.Sprintf("%s-%d", base, i)
+		}
+		err := tx.QueryRow(`INSERT INTO users (name, password, created) VALUES (?, '', ?) ON CONFLICT (name) DO NOTHING RETURNING id`,
+			u.Name, u.Created.Unix()).Scan(&u.ID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return User{}, err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO identities (provider, subject, user_id) VALUES (?, ?, ?)`, provider, subject, u.ID); err != nil {
+		return User{}, err
+	}
+	return u, tx.Commit()
+}
+
+// SetPassword changes the password of an account and ends its sessions.
+func (s *Store) SetPassword(name, password string) error {
+	if len([]rune(password)) < MinPassword {
+		return ErrShortPassword
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var id int64
+	if err := tx.QueryRow(`UPDATE users SET password = ? WHERE name = ? RETURNING id`, hash, name).Scan(&id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("accounts: no user %s", name)
+		}
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM sessions WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM tokens WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Login returns the account with the name if the password is right.
+func (s *Store) Login(name, password string) (User, error) {
+	var u User
+	var hash string
+	var created int64
+	err := s.db.QueryRow(`SELECT id, name, password, created FROM users WHERE name = ?`, name).Scan(&u.ID, &u.Name, &hash, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		// take as long as a wrong password, not to tell which names exist
+		checkPassword(dummyHash, password)
+		return User{}, ErrBadLogin
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if !checkPassword(hash, password) {
+		return User{}, ErrBadLogin
+	}
+	u.Created = time.Unix(created, 0)
+	return u, nil
+}
+
+// NewSession starts a session of the user and returns its token, which is
+// only kept hashed. Expired sessions of all users are dropped on the way.
+func (s *Store) NewSession(userID int64) (string, error) {
+	token := newToken()
+	now := time.Now()
+	if _, err := s.db.Exec(`DELETE FROM sessions WHERE expires <= ?`, now.Unix()); err != nil {
+		return "", err
+	}
+	_, err := s.db.Exec(`INSERT INTO sessions (token, user_id, expires) VALUES (?, ?, ?)`, tokenKey(token), userID, now.Add(s.SessionTTL).Unix())
+	return token, err
+}
+
+// Session returns the user of the session token.
+func (s *Store) Session(token string) (User, error) {
+	var u User
+	var created int64
+	err := s.db.QueryRow(`SELECT users.id, users.name, users.created FROM sessions JOIN users ON users.id = sessions.user_id
+		WHERE sessions.token = ? AND sessions.expires > ?`, tokenKey(token), time.Now().Unix()).Scan(&u.ID, &u.Name, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNoSession
+	}
+	if err != nil {
+		return User{}, err
+	}
+	u.Created = time.Unix(created, 0)
+	return u, nil
+}
+
+// EndSession logs the session out.
+func (s *Store) EndSession(token string) error {
+	_, err := s.db.Exec(`DELETE FROM sessions WHERE token = ?`, tokenKey(token))
+	return err
+}
+
+// NewToken returns a new API token of the user, for programs to act on
+// their behalf. It replaces the one they had, and lasts until the next one or
+// a new password.
+func (s *Store) NewToken(userID int64) (string, error) {
+	token := newToken()
+	_, err := s.db.Exec(`INSERT INTO tokens (token, user_id, created) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET token = excluded.token, created = excluded.created`, tokenKey(token), userID, time.Now().Unix())
+	return token, err
+}
+
+// Token returns the user of the API token.
+func (s *Store) Token(token string) (User, error) {
+	var u User
+	var created int64
+	err := s.db.QueryRow(`SELECT users.id, users.name, users.created FROM tokens JOIN users ON users.id = tokens.user_id
+		WHERE tokens.token = ?`, tokenKey(token)).Scan(&u.ID, &u.Name, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNoToken
+	}
+	if err != nil {
+		return User{}, err
+	}
+	u.Created = time.Unix(created, 0)
+	return u, nil
+}
+
+func newToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// tokenKey is what a session or API token is kept as, so a leaked database
+// holds no usable ones.
+func tokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Settings returns the settings saved by the user, nil if there are none.
+// They are opaque to the store.
+func (s *Store) Settings(userID int64) ([]byte, error) {
+	var b []byte
+	err := s.db.QueryRow(`SELECT settings FROM users WHERE id = ?`, userID).Scan(&b)
+	return b, err
+}
+
+// SaveSettings replaces the settings of the user, nil clears them.
+func (s *Store) SaveSettings(userID int64, settings []byte) error {
+	_, err := s.db.Exec(`UPDATE users SET settings = ? WHERE id = ?`, settings, userID)
+	return err
+}
+
+// Bookmark saves a story for the user.
+func (s *Store) Bookmark(userID int64, storyID int, at time.Time) error {
+	return s.Merge(userID, []Bookmark{{StoryID: storyID, Added: at}})
+}
+
+// Unbookmark removes a story from the saved ones of the user.
+func (s *Store) Unbookmark(userID int64, storyID int, at time.Time) error {
+	return s.Merge(userID, []Bookmark{{StoryID: storyID, Removed: at}})
+}
+
+// Merge brings the bookmarks of the user up to date with ones kept
+// elsewhere: each story takes the latest time it was added and removed of
+// both.
+func (s *Store) Merge(userID int64, bookmarks []Bookmark) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, b := range bookmarks {
+		_, err := tx.Exec(`INSERT INTO bookmarks (user_id, story_id, added, removed) VALUES (?, ?, ?, ?)
+			ON CONFLICT DO UPDATE SET added = max(added, excluded.added), removed = max(removed, excluded.removed)`,
+			userID, b.StoryID, millis(b.Added), millis(b.Removed))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Bookmarks returns the stories saved by the user, last saved first.
+func (s *Store) Bookmarks(userID int64) ([]Bookmark, error) {
+	return s.bookmarks(`SELECT story_id, added, removed FROM bookmarks WHERE user_id = ? AND added > removed ORDER BY added DESC, story_id DESC`, userID)
+}
+
+// AllBookmarks returns the stories saved by the user and the ones they
+// removed, by story, for another device to merge.
+func (s *Store) AllBookmarks(userID int64) ([]Bookmark, error) {
+	return s.bookmarks(`SELECT story_id, added, removed FROM bookmarks WHERE user_id = ? ORDER BY story_id`, userID)
+}
+
+func (s *Store) bookmarks(query string, args ...any) ([]Bookmark, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ret []Bookmark
+	for rows.Next() {
+		var b Bookmark
+		var added, removed int64
+		if err := rows.Scan(&b.StoryID, &added, &removed); err != nil {
+			return nil, err
+		}
+		b.Added, b.Removed = fromMillis(added), fromMillis(removed)
+		ret = append(ret, b)
+	}
+	return ret, rows.Err()
+}
+
+// millis is how bookmark times are kept, 0 for the zero time.
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromMillis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+// MarkRead notes that the user read a story, and forgets the stories they
+// read longer than readKept ago.
+func (s *Store) MarkRead(userID int64, storyID int, at time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`INSERT INTO reads (user_id, story_id, at) VALUES (?, ?, ?) ON CONFLICT DO UPDATE SET at = excluded.at`, userID, storyID, at.Unix()); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM reads WHERE user_id = ? AND at < ?`, userID, at.Add(-readKept).Unix()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Marks returns which of the stories the user saved and which they read.
+func (s *Store) Marks(userID int64, storyIDs []int) (saved, read map[int]bool, err error) {
+	saved, read = make(map[int]bool), make(map[int]bool)
+	if len(storyIDs) == 0 {
+		return saved, read, nil
+	}
+	// the ids are numbered, so both lists take the same arguments
+	args := []any{userID}
+	params := make([]string, len(storyIDs))
+	for i, id := range storyIDs {
+		args = append(args, id)
+		params[i] = "?" + strconv.Itoa(i+2)
+	}
+	in := strings.Join(params, ",")
+	rows, err := s.db.Query(`SELECT story_id, 1 FROM bookmarks WHERE user_id = ?1 AND added > removed AND story_id IN (`+in+`)
+		UNION ALL SELECT story_id, 0 FROM reads WHERE user_id = ?1 AND story_id IN (`+in+`)`, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var bookmark bool
+		if err := rows.Scan(&id, &bookmark); err != nil {
+			return nil, nil, err
+		}
+		if bookmark {
+			saved[id] = true
+		} else {
+			read[id] = true
+		}
+	}
+	return saved, read, rows.Err()
+}
@@ -0,0 +1,212 @@
+package accounts
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTest(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "accounts.db"))
+	if err != nil {
+		t.Fatalf("Open() received an error: %s", err.Error())
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStore_Login(t *testing.T) {
+	s := openTest(t)
+	u, err := s.Create("alice", "correct horse")
+	if err != nil {
+		t.Fatalf("Create() received an error: %s", err.Error())
+	}
+	tests := []struct {
+		name     string
+		password string
+		want     error
+	}{
+		{"alice", "correct horse", nil},
+		{"ALICE", "correct horse", nil},
+		{"alice", "wrong horse", ErrBadLogin},
+		{"bob", "correct horse", ErrBadLogin},
+	}
+	for _, tt := range tests {
+		got, err := s.Login(tt.name, tt.password)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s/%s: want %v, got %v", tt.name, tt.password, tt.want, err)
+		}
+		if err == nil && got.ID != u.ID {
+			t.Errorf("%s/%s: want user %d, got %d", tt.name, tt.password, u.ID, got.ID)
+		}
+	}
+
+	for name, want := range map[string]error{"Alice": ErrNameTaken, "no spaces": ErrInvalidName, "": ErrInvalidName} {
+		if _, err := s.Create(name, "long enough"); !errors.Is(err, want) {
+			t.Errorf("Create(%q): want %v, got %v", name, want, err)
+		}
+	}
+	if _, err := s.Create("carol", "short"); !errors.Is(err, ErrShortPassword) {
+		t.Errorf("short password: want %v, got %v", ErrShortPassword, err)
+	}
+}
+
+func TestStore_Session(t *testing.T) {
+	s := openTest(t)
+	u, _ := s.Create("alice", "correct horse")
+	token, err := s.NewSession(u.ID)
+	if err != nil {
+		t.Fatalf("NewSession() received an error: %s", err.Error())
+	}
+	if got, err := s.Session(token); err != nil || got.Name != "alice" {
+		t.Errorf("session: want alice, got %+v and %v", got, err)
+	}
+	var stored string
+	s.db.QueryRow("SELECT token FROM sessions").Scan(&stored)
+	if strings.Contains(stored, token) {
+		t.Error("stored token: want it hashed, got the token")
+	}
+
+	if err := s.SetPassword("alice", "battery staple"); err != nil {
+		t.Fatalf("SetPassword() received an error: %s", err.Error())
+	}
+	if _, err := s.Session(token); !errors.Is(err, ErrNoSession) {
+		t.Errorf("after a new password: want %v, got %v", ErrNoSession, err)
+	}
+	if _, err := s.Login("alice", "battery staple"); err != nil {
+		t.Errorf("new password: want no error, got %v", err)
+	}
+
+	s.SessionTTL = -time.Second
+	expired, _ := s.NewSession(u.ID)
+	if _, err := s.Session(expired); !errors.Is(err, ErrNoSession) {
+		t.Errorf("expired: want %v, got %v", ErrNoSession, err)
+	}
+	s.SessionTTL = time.Hour
+	token, _ = s.NewSession(u.ID)
+	s.EndSession(token)
+	if _, err := s.Session(token); !errors.Is(err, ErrNoSession) {
+		t.Errorf("ended: want %v, got %v", ErrNoSession, err)
+	}
+}
+
+func TestStore_Profile(t *testing.T) {
+	s := openTest(t)
+	u, _ := s.Create("alice", "correct horse")
+	other, _ := s.Create("bob", "correct horse")
+	if b, err := s.Settings(u.ID); err != nil || b != nil {
+		t.Errorf("no settings: want nil, got %q and %v", b, err)
+	}
+	s.SaveSettings(u.ID, []byte(`{"t":"dark"}`))
+	if b, _ := s.Settings(u.ID); string(b) != `{"t":"dark"}` {
+		t.Errorf("settings: want them back, got %q", b)
+	}
+
+	now := time.Now().Truncate(time.Second)
+	s.Bookmark(u.ID, 1, now.Add(-time.Hour))
+	s.Bookmark(u.ID, 2, now)
+	s.Bookmark(u.ID, 1, now.Add(-2*time.Hour))
+	s.Bookmark(other.ID, 3, now)
+	want := []Bookmark{{StoryID: 2, Added: now}, {StoryID: 1, Added: now.Add(-time.Hour)}}
+	if got, _ := s.Bookmarks(u.ID); !reflect.DeepEqual(got, want) {
+		t.Errorf("bookmarks: want %v, got %v", want, got)
+	}
+
+	s.MarkRead(u.ID, 2, now.Add(-100*24*time.Hour))
+	s.MarkRead(u.ID, 3, now)
+	saved, read, err := s.Marks(u.ID, []int{1, 2, 3, 4})
+	if err != nil {
+		t.Fatalf("Marks() received an error: %s", err.Error())
+	}
+	if want := map[int]bool{1: true, 2: true}; !reflect.DeepEqual(saved, want) {
+		t.Errorf("saved: want %v, got %v", want, saved)
+	}
+	// the first read is older than readKept
+	if want := map[int]bool{3: true}; !reflect.DeepEqual(read, want) {
+		t.Errorf("read: want %v, got %v", want, read)
+	}
+
+	s.Unbookmark(u.ID, 2, now.Add(time.Millisecond))
+	if got, _ := s.Bookmarks(u.ID); len(got) != 1 || got[0].StoryID != 1 {
+		t.Errorf("unbookmarked: want story 1 only, got %v", got)
+	}
+}
+
+func TestStore_CreateLinked(t *testing.T) {
+	s := openTest(t)
+	s.Create("alice", "correct horse")
+	u, err := s.CreateLinked("github", "42", "Alice")
+	if err != nil {
+		t.Fatalf("CreateLinked() received an error: %s", err.Error())
+	}
+	if u.Name != "Alice-2" {
+		t.Errorf("taken name: want Alice-2, got %s", u.Name)
+	}
+	if got, err := s.Identity("github", "42"); err != nil || got.ID != u.ID {
+		t.Errorf("identity: want user %d, got %+v and %v", u.ID, got, err)
+	}
+	if _, err := s.Identity("oidc", "42"); !errors.Is(err, ErrNoIdentity) {
+		t.Errorf("other provider: want %v, got %v", ErrNoIdentity, err)
+	}
+	if u, _ := s.CreateLinked("oidc", "x", "Bob Smith <bob@example.com>"); u.Name != "Bob-Smith-bob-example-com" {
+		t.Errorf("name: want the invalid characters replaced, got %s", u.Name)
+	}
+	// a linked account has no password to log in with
+	if _, err := s.Login("Alice-2", ""); !errors.Is(err, ErrBadLogin) {
+		t.Errorf("empty password: want %v, got %v", ErrBadLogin, err)
+	}
+}
+
+func TestStore_Merge(t *testing.T) {
+	at := func(minutes int) time.Time {
+		return time.Date(2024, 5, 1, 12, minutes, 0, 0, time.UTC)
+	}
+	phone := []Bookmark{{StoryID: 1, Added: at(1), Removed: at(3)}, {StoryID: 2, Added: at(2)}}
+	laptop := []Bookmark{{StoryID: 1, Added: at(4)}, {StoryID: 2, Added: at(1), Removed: at(5)}, {StoryID: 3, Added: at(1)}}
+	want := []Bookmark{{StoryID: 1, Added: at(4), Removed: at(3)}, {StoryID: 3, Added: at(1)}}
+
+	// whichever device syncs first, they end up with the same bookmarks
+	for _, order := range [][][]Bookmark{{phone, laptop}, {laptop, phone}, {phone, laptop, phone}} {
+		s := openTest(t)
+		u, _ := s.Create("alice", "correct horse")
+		for _, bs := range order {
+			if err := s.Merge(u.ID, bs); err != nil {
+				t.Fatalf("Merge() received an error: %s", err.Error())
+			}
+		}
+		got, _ := s.Bookmarks(u.ID)
+		for i := range got {
+			got[i].Added, got[i].Removed = got[i].Added.UTC(), got[i].Removed.UTC()
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("bookmarks: want %v, got %v", want, got)
+		}
+		if all, _ := s.AllBookmarks(u.ID); len(all) != 3 || all[1].Saved() {
+			t.Errorf("all bookmarks: want story 2 kept removed, got %v", all)
+		}
+	}
+}
+
+func TestStore_Token(t *testing.T) {
+	s := openTest(t)
+	u, _ := s.Create("alice", "correct horse")
+	first, err := s.NewToken(u.ID)
+	if err != nil {
+		t.Fatalf("NewToken() received an error: %s", err.Error())
+	}
+	second, _ := s.NewToken(u.ID)
+	if _, err := s.Token(first); !errors.Is(err, ErrNoToken) {
+		t.Errorf("replaced token: want %v, got %v", ErrNoToken, err)
+	}
+	if got, err := s.Token(second); err != nil || got.ID != u.ID {
+		t.Errorf("token: want alice, got %+v and %v", got, err)
+	}
+	s.SetPassword("alice", "battery staple")
+	if _, err := s.Token(second); !errors.Is(err, ErrNoToken) {
+		t.Errorf("after a new password: want %v, got %v", ErrNoToken, err)
+	}
+}
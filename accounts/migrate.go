@@ -0,0 +1,83 @@
+package accounts
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations are applied in order, each one once. The number of migrations
+// a database has seen is kept in its user_version, so new ones must only
+// ever be appended.
+var migrations = []string{
+	`CREATE TABLE users (
+		id INTEGER PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+		password TEXT NOT NULL,
+		created INTEGER NOT NULL,
+		settings BLOB
+	);
+	CREATE TABLE sessions (
+		token TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		expires INTEGER NOT NULL
+	) WITHOUT ROWID;
+	CREATE INDEX sessions_expires ON sessions (expires);
+	CREATE TABLE bookmarks (
+		user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		story_id INTEGER NOT NULL,
+		added INTEGER NOT NULL,
+		PRIMARY KEY (user_id, story_id)
+	) WITHOUT ROWID;
+	CREATE TABLE reads (
+		user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		story_id INTEGER NOT NULL,
+		at INTEGER NOT NULL,
+		PRIMARY KEY (user_id, story_id)
+	) WITHOUT ROWID;
+	CREATE INDEX reads_at ON reads (user_id, at);`,
+	`CREATE TABLE identities (
+		provider TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+		PRIMARY KEY (provider, subject)
+	) WITHOUT ROWID;`,
+	// a bookmark removed is kept as a tombstone, for syncing devices to
+	// agree on; times move to milliseconds so a quick save and removal
+	// stay in order
+	`ALTER TABLE bookmarks ADD COLUMN removed INTEGER NOT NULL DEFAULT 0;
+	UPDATE bookmarks SET added = added * 1000;
+	CREATE TABLE tokens (
+		token TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL UNIQUE REFERENCES users (id) ON DELETE CASCADE,
+		created INTEGER NOT NULL
+	) WITHOUT ROWID;`,
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than this binary knows", version)
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version+1, err)
+		}
+		// PRAGMA doesn't take parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neghoda/quiet_hn/cron"
+)
+
+const (
+	adminPath       = "/admin"
+	adminConfigPath = "/admin/config"
+)
+
+// errSaveConfig is returned when the -config file can't be written.
+var errSaveConfig = errors.New("failed to save the config file")
+
+// liveConfig is the configuration of the running instance, of which /admin
+// shows the flags and /admin/config changes the runtimeFlags.
+type liveConfig struct {
+	// mutex guards cfg and the values of fs, and serializes changes
+	mutex sync.Mutex
+	cfg   config
+	fs    *flag.FlagSet
+	// caches are those of cfg.sourceNames, in order, their refresh jobs
+	// are on jobs
+	caches  []*cach
+	filters *filters
+	jobs    *scheduler
+}
+
+func (l *liveConfig) entries() []configEntry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return configEntries(l.fs)
+}
+
+// values returns the runtimeFlags as they are.
+func (l *liveConfig) values() map[string]string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	values := make(map[string]string)
+	for _, name := range runtimeFlags {
+		values[name] = l.fs.Lookup(name).Value.String()
+	}
+	return values
+}
+
+// set applies the values of runtimeFlags to the caches, the filters and
+// the refresh jobs, from their next refresh on. Nothing changes if one of
+// the values is invalid. With persist the values are saved to the
+// -config file as well.
+func (l *liveConfig) set(values map[string]string, persist bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if persist && l.cfg.ConfigFile == "" {
+		return errors.New("there is no -config file to save the values to")
+	}
+	next := l.cfg
+	for name, value := range values {
+		if err := next.setRuntime(name, value); err != nil {
+			return err
+		}
+	}
+	if err := next.validate(); err != nil {
+		return err
+	}
+	f, err := readFilters(next)
+	if err != nil {
+		return err
+	}
+	schedule, err := cron.Parse(next.RefreshSchedule)
+	if err != nil {
+		return err
+	}
+	if persist {
+		if err := saveConfigFile(l.cfg.ConfigFile, values); err != nil {
+			return fmt.Errorf("%w: %w", errSaveConfig, err)
+		}
+	}
+	for name, value := range values {
+		l.fs.Set(name, value)
+	}
+	l.filters.set(f)
+	for i, c := range l.caches {
+		c.tune(next.NumStories, next.CacheTTL)
+		if next.RefreshSchedule != l.cfg.RefreshSchedule {
+			l.jobs.reschedule(refreshJob(l.cfg.sourceNames(), i), schedule)
+		}
+	}
+	l.cfg = next
+	log.Printf("changed %s at runtime", strings.Join(slices.Sorted(maps.Keys(values)), ", "))
+	return nil
+}
+
+// refreshJob is the name of the job refreshing the cache of the i-th of
+// names.
+func refreshJob(names []string, i int) string {
+	if i == 0 {
+		return "refresh"
+	}
+	return "refresh " + names[i]
+}
+
+// cacheStatus is what the admin dashboard shows of the cache of a source.
+type cacheStatus struct {
+	Source        string
+	Stories       int
+	RefreshedAt   time.Time
+	FetchDuration time.Duration
+	ExpiresIn     time.Duration
+	// Requests and Failed count the item requests of the last refresh
+	Requests, Failed int
+	// Error is the last refresh that failed, at ErrorAt, empty if none did
+	Error   string
+	ErrorAt time.Time
+	// Health is the locale key of how the source is doing: admin_ok,
+	// admin_degraded while it is slow or loses items, or admin_failing when
+	// the last refresh failed or the breaker around the HN API is open
+	Health string
+}
+
+func (c *cach) status(source string) cacheStatus {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+	s := cacheStatus{
+		Source:        source,
+		Stories:       len(c.cashedItems),
+		RefreshedAt:   c.refreshedAt,
+		FetchDuration: c.fetchDuration.Round(time.Millisecond),
+		ExpiresIn:     time.Until(c.expiration).Round(time.Second),
+		Requests:      c.lastFetch.requests,
+		Failed:        c.lastFetch.failed,
+		Health:        "admin_ok",
+	}
+	if c.lastErr != nil {
+		s.Error, s.ErrorAt = c.lastErr.Error(), c.lastErrAt
+	}
+	switch {
+	case c.outage, c.lastErr != nil && !c.lastErrAt.Before(c.refreshedAt):
+		s.Health = "admin_failing"
+	case c.degraded || c.lastFetch.failed > 0:
+		s.Health = "admin_degraded"
+	}
+	return s
+}
+
+// forceRefresh refreshes the cache now, whatever the shedder and idleness
+// would say.
+func (c *cach) forceRefresh() {
+	c.cachMutex.Lock()
+	defer c.cachMutex.Unlock()
+	c.refresh()
+}
+
+// refreshAll refreshes the caches at once and waits for them.
+func refreshAll(caches []*cach) {
+	var wg sync.WaitGroup
+	for _, c := range caches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.forceRefresh()
+		}()
+	}
+	wg.Wait()
+}
+
+// tune changes the number of stories and how long they are served, from the
+// next refresh on.
+func (c *cach) tune(numStories int, lifeDuration time.Duration) {
+	c.cachMutex.Lock()
+	defer c.cachMutex.Unlock()
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+	c.numStories, c.lifeDuration = numStories, lifeDuration
+}
+
+// configEntry is a flag in effect, as the admin dashboard lists it.
+type configEntry struct {
+	Name  string
+	Value string
+	// Default is set when the flag has its default value, Hidden when it is
+	// a secret, whose value isn't shown
+	Default bool
+	Hidden  bool
+}
+
+// configEntries lists the flags of fs, after the command line and -config
+// were parsed into it.
+func configEntries(fs *flag.FlagSet) []configEntry {
+	var entries []configEntry
+	fs.VisitAll(func(f *flag.Flag) {
+		e := configEntry{Name: f.Name, Value: f.Value.String(), Default: f.Value.String() == f.DefValue}
+		if secretFlag.MatchString(f.Name) {
+			e.Value, e.Hidden = "", true
+		}
+		entries = append(entries, e)
+	})
+	return entries
+}
+
+type adminTemplateData struct {
+	Caches     []cacheStatus
+	Goroutines int
+	Build      buildInfo
+	Config     []configEntry
+	// Done is the locale key of what the last button did, Error what went
+	// wrong reloading the templates
+	Done  string
+	Error string
+	pageData
+}
+
+// adminHandler serves the status dashboard of the instance, with buttons to
+// refresh the caches and reload the templates.
+func adminHandler(l *liveConfig, cfg config, tpls *templates) http.HandlerFunc {
+	names := cfg.sourceNames()
+	return withAdminAuth(cfg.AdminPassword, func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		w.Header().Set("Cache-Control", "no-store")
+		data := adminTemplateData{Build: build(), Config: l.entries()}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+			data.Done = map[string]string{"refresh": "admin_refresh_done", "templates": "admin_reload_done"}[r.FormValue("done")]
+		case http.MethodPost:
+			if !sameOrigin(r) {
+				http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+				return
+			}
+			switch r.PostFormValue("action") {
+			case "refresh":
+				refreshAll(l.caches)
+				http.Redirect(w, r, adminPath+"?done=refresh", http.StatusSeeOther)
+				return
+			case "templates":
+				if err := tpls.reload(); err != nil {
+					log.Printf("failed to reload the templates: %s", err)
+					data.Error = err.Error()
+					break
+				}
+				// the cached pages were rendered with the old ones
+				for _, c := range l.caches {
+					if c.pages != nil {
+						c.pages.rerender()
+					}
+				}
+				http.Redirect(w, r, adminPath+"?done=templates", http.StatusSeeOther)
+				return
+			default:
+				http.Error(w, "Unknown action", http.StatusBadRequest)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		for i, c := range l.caches {
+			data.Caches = append(data.Caches, c.status(names[i]))
+		}
+		data.Goroutines = runtime.NumGoroutine()
+		data.pageData = cfg.pageData(r, start)
+		if err := tpls.execute(w, "admin.gohtml", data); err != nil {
+			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+		}
+	})
+}
+
+// adminConfigHandler serves the runtimeFlags as a JSON object of their
+// values, and changes them on a PATCH of such an object, whose values may be
+// strings like on the command line or JSON numbers. With ?persist=1 the
+// values are saved to the -config file too.
+func adminConfigHandler(l *liveConfig, cfg config) http.HandlerFunc {
+	return withAdminAuth(cfg.AdminPassword, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPatch:
+			var patch map[string]json.RawMessage
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&patch); err != nil {
+				http.Error(w, "Invalid JSON object of settings", http.StatusBadRequest)
+				return
+			}
+			values := make(map[string]string)
+			for name, raw := range patch {
+				var value string
+				if json.Unmarshal(raw, &value) != nil {
+					value = string(raw)
+				}
+				values[name] = value
+			}
+			err := l.set(values, r.FormValue("persist") != "")
+			if errors.Is(err, errSaveConfig) {
+				log.Print(err)
+				http.Error(w, "Failed to save the config file", http.StatusInternalServerError)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			// the stories there are were fetched with the old values
+			refreshAll(l.caches)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PATCH")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(l.values()); err != nil {
+			http.Error(w, "Failed to encode the settings", http.StatusInternalServerError)
+		}
+	})
+}
+
+// withAdminAuth asks for the admin password with HTTP basic auth, whatever
+// the user name.
+func withAdminAuth(password string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, got, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="quiet_hn admin", charset="UTF-8"`)
+			http.Error(w, "The admin password is required", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
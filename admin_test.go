@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminHandler(t *testing.T) {
+	setupHN(t, map[int]string{1: storyJSON(1)})
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := parseFlags(fs, []string{"-cookie_secret", "s3cret", "-admin_password", "pw", "-num_stories", "1"})
+	f, err := newFilters(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCach(cfg.NumStories, f, cachOptions{})
+	h := adminHandler(&liveConfig{cfg: cfg, fs: fs, caches: []*cach{c}, filters: f, jobs: newScheduler()}, cfg, tpls)
+
+	do := func(method, body, password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, adminPath, strings.NewReader(body))
+		if body != "" {
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if password != "" {
+			r.SetBasicAuth("admin", password)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, r)
+		return rec
+	}
+
+	if rec := do("GET", "", ""); rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("no password: want 401 with WWW-Authenticate, got %d", rec.Code)
+	}
+	if rec := do("GET", "", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong password: want 401, got %d", rec.Code)
+	}
+
+	rec := do("GET", "", "pw")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "never") {
+		t.Fatalf("dashboard: want 200 with a cache never refreshed, got %d", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "s3cret") {
+		t.Error("dashboard: want the cookie secret hidden")
+	}
+
+	rec = do("POST", url.Values{"action": {"refresh"}}.Encode(), "pw")
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("refresh: want 303, got %d", rec.Code)
+	}
+	if s := c.status("hn"); s.Stories != 1 || s.Health != "admin_ok" {
+		t.Errorf("refresh: want 1 story ok, got %d %s", s.Stories, s.Health)
+	}
+	if rec := do("POST", url.Values{"action": {"templates"}}.Encode(), "pw"); rec.Code != http.StatusSeeOther {
+		t.Errorf("templates: want 303, got %d", rec.Code)
+	}
+	if rec := do("POST", url.Values{"action": {"nope"}}.Encode(), "pw"); rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown action: want 400, got %d", rec.Code)
+	}
+}
+
+func TestCachStatus_Failing(t *testing.T) {
+	setupHN(t, map[int]string{1: storyJSON(1)})
+	f, err := newFilters(config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCach(1, f, cachOptions{})
+	c.forceRefresh()
+	c.source = brokenSource{}
+	c.forceRefresh()
+	s := c.status("hn")
+	if s.Health != "admin_failing" || s.Error == "" || s.Stories != 1 {
+		t.Errorf("want failing with an error and the story kept, got %+v", s)
+	}
+}
+
+func TestAdminConfigHandler(t *testing.T) {
+	setupHN(t, map[int]string{1: storyJSON(1), 2: storyJSON(2), 3: storyJSON(3)})
+	file := filepath.Join(t.TempDir(), "quiet_hn.conf")
+	if err := os.WriteFile(file, []byte("# tuned\nnum_stories = 1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := parseFlags(fs, []string{"-config", file, "-admin_password", "pw"})
+	f, err := newFilters(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCach(cfg.NumStories, f, cachOptions{})
+	jobs := newScheduler()
+	jobs.add("refresh", mustParseSchedule(cfg.RefreshSchedule), false, func(time.Time) {})
+	h := adminConfigHandler(&liveConfig{cfg: cfg, fs: fs, caches: []*cach{c}, filters: f, jobs: jobs}, cfg)
+
+	patch := func(query, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("PATCH", adminConfigPath+query, strings.NewReader(body))
+		r.SetBasicAuth("admin", "pw")
+		rec := httptest.NewRecorder()
+		h(rec, r)
+		return rec
+	}
+
+	for _, body := range []string{`{"num_stories": 0}`, `{"port": 80}`, `{"mute": "/(/"}`, `{"cache_ttl": "soon"}`, `[]`} {
+		if rec := patch("", body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: want 400, got %d", body, rec.Code)
+		}
+	}
+	if s := c.status("hn"); s.Stories != 0 {
+		t.Errorf("rejected: want the cache unchanged, got %d stories", s.Stories)
+	}
+
+	rec := patch("?persist=1", `{"num_stories": 2, "block_domains": "example.org", "refresh_schedule": "@every 1m"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("patch: want 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var values map[string]string
+	if err := json.Unmarshal(rec.Body.Bytes(), &values); err != nil {
+		t.Fatal(err)
+	}
+	if values["num_stories"] != "2" || values["block_domains"] != "example.org" {
+		t.Errorf("patch: want the new values, got %v", values)
+	}
+	if stories, err := c.getTopStories(context.Background(), view{}); err != nil || len(stories) != 2 {
+		t.Errorf("patch: want 2 stories, got %d, %v", len(stories), err)
+	}
+	b, _ := os.ReadFile(file)
+	want := "# tuned\nnum_stories = \"2\"\nblock_domains = \"example.org\"\nrefresh_schedule = \"@every 1m\"\n"
+	if string(b) != want {
+		t.Errorf("persist: want %q, got %q", want, b)
+	}
+
+	rec = patch("", `{"block_users": "dang"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("patch: want 200, got %d", rec.Code)
+	}
+	if b2, _ := os.ReadFile(file); string(b2) != want {
+		t.Errorf("no persist: want the file unchanged, got %q", b2)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/neghoda/quiet_hn/accounts"
+)
+
+const (
+	bookmarksAPIPath = "/api/v1/bookmarks"
+	// maxSyncBody bounds the bookmarks a device can send at once
+	maxSyncBody = 1 << 20
+)
+
+// apiBookmarks is the body of the bookmarks API, both ways.
+type apiBookmarks struct {
+	Bookmarks []apiBookmark `json:"bookmarks"`
+}
+
+// apiBookmark is a story a device saved or removed. Saved is derived from
+// the times and ignored in requests.
+type apiBookmark struct {
+	ID      int       `json:"id"`
+	Saved   bool      `json:"saved"`
+	Added   time.Time `json:"added,omitzero"`
+	Removed time.Time `json:"removed,omitzero"`
+}
+
+// bookmarksAPIHandler lets programs holding an API token of the visitor sync
+// their bookmarks: GET lists the stories saved and removed, PUT merges the
+// ones of the device and answers with the result. A story ends up saved if
+// it was last added after it was last removed, on whichever device.
+func bookmarksAPIHandler(cfg config) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="bookmarks"`)
+			http.Error(w, "An API token is required", http.StatusUnauthorized)
+			return
+		}
+		u, err := cfg.accounts.Token(token)
+		if errors.Is(err, accounts.ErrNoToken) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="bookmarks", error="invalid_token"`)
+			http.Error(w, "Invalid API token", http.StatusUnauthorized)
+			return
+		}
+		if err != nil {
+			log.Printf("failed to check an API token: %s", err)
+			http.Error(w, "Failed to check the API token", http.StatusInternalServerError)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPut:
+			var body apiBookmarks
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSyncBody)).Decode(&body); err != nil {
+				http.Error(w, "Invalid bookmarks", http.StatusBadRequest)
+				return
+			}
+			now := time.Now()
+			bookmarks := make([]accounts.Bookmark, 0, len(body.Bookmarks))
+			for _, b := range body.Bookmarks {
+				if b.ID <= 0 {
+					http.Error(w, "Invalid story id", http.StatusBadRequest)
+					return
+				}
+				// a device with its clock ahead would otherwise win every
+				// merge until the time came
+				bookmarks = append(bookmarks, accounts.Bookmark{StoryID: b.ID, Added: earliest(b.Added, now), Removed: earliest(b.Removed, now)})
+			}
+			if err := cfg.accounts.Merge(u.ID, bookmarks); err != nil {
+				log.Printf("failed to merge the bookmarks of %s: %s", u.Name, err)
+				http.Error(w, "Failed to save the bookmarks", http.StatusInternalServerError)
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, HEAD, PUT")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bookmarks, err := cfg.accounts.AllBookmarks(u.ID)
+		if err != nil {
+			log.Printf("failed to load the bookmarks of %s: %s", u.Name, err)
+			http.Error(w, "Failed to load the bookmarks", http.StatusInternalServerError)
+			return
+		}
+		ret := apiBookmarks{Bookmarks: make([]apiBookmark, len(bookmarks))}
+		for i, b := range bookmarks {
+			ret.Bookmarks[i] = apiBookmark{ID: b.StoryID, Saved: b.Saved(), Added: b.Added.UTC(), Removed: b.Removed.UTC()}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if err := json.NewEncoder(w).Encode(ret); err != nil {
+			http.Error(w, "Failed to encode the bookmarks", http.StatusInternalServerError)
+		}
+	})
+}
+
+// earliest returns t, or now if t is later.
+func earliest(t, now time.Time) time.Time {
+	if t.After(now) {
+		return now
+	}
+	return t
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neghoda/quiet_hn/accounts"
+)
+
+func TestBookmarksAPI(t *testing.T) {
+	store, err := accounts.Open(filepath.Join(t.TempDir(), "accounts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	u, _ := store.Create("alice", "correct horse")
+	token, _ := store.NewToken(u.ID)
+	saved := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	store.Bookmark(u.ID, 1, saved)
+	h := bookmarksAPIHandler(config{accounts: store})
+
+	do := func(method, auth, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "http://example.com"+bookmarksAPIPath, strings.NewReader(body))
+		if auth != "" {
+			r.Header.Set("Authorization", "Bearer "+auth)
+		}
+		rec := httptest.NewRecorder()
+		h(rec, r)
+		return rec
+	}
+	if rec := do("GET", "", ""); rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("no token: want %d with a challenge, got %d", http.StatusUnauthorized, rec.Code)
+	}
+	if rec := do("GET", "wrong", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong token: want %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+	if rec := do("PUT", token, `{"bookmarks":[{"id":-1}]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid id: want %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+
+	// the device removed story 1 after it was saved here, and saved story 2
+	// with its clock ahead
+	rec := do("PUT", token, `{"bookmarks":[
+		{"id":1,"added":"2024-05-01T11:00:00Z","removed":"2024-05-01T13:00:00Z"},
+		{"id":2,"added":"2999-01-01T00:00:00Z"}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("put: want %d, got %d: %s", http.StatusOK, rec.Code, rec.Body.String())
+	}
+	var got apiBookmarks
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Bookmarks) != 2 {
+		t.Fatalf("put: want 2 bookmarks, got %+v", got)
+	}
+	want := apiBookmark{ID: 1, Added: saved, Removed: saved.Add(time.Hour)}
+	if !reflect.DeepEqual(got.Bookmarks[0], want) {
+		t.Errorf("story 1: want %+v, got %+v", want, got.Bookmarks[0])
+	}
+	if b := got.Bookmarks[1]; !b.Saved || b.Added.After(time.Now()) {
+		t.Errorf("story 2: want saved no later than now, got %+v", b)
+	}
+
+	rec = do("GET", token, "")
+	if body := rec.Body.String(); !strings.Contains(body, `"id":1,"saved":false`) || !strings.Contains(body, `"id":2,"saved":true`) {
+		t.Errorf("get: want the merged bookmarks, got %s", body)
+	}
+	if rec := do("DELETE", token, ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("delete: want %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+}
@@ -0,0 +1,590 @@
+// Package archive keeps a record of the stories seen on the quiet front page
+// and snapshots of their score and comments in a SQLite database, so pages
+// can refer to what was there before.
+package archive
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	_ "modernc.org/sqlite"
+)
+
+// DefaultSnapshotEvery is how often the score and comments of a story are
+// recorded by default.
+const DefaultSnapshotEvery = 10 * time.Minute
+
+// Store is an archive backed by a SQLite database file.
+type Store struct {
+	db *sql.DB
+	// SnapshotEvery is the least time between two snapshots of a story.
+	SnapshotEvery time.Duration
+}
+
+// Story is an archived story and when it was seen.
+type Story struct {
+	ID       int
+	Type     string
+	Title    string
+	URL      string
+	By       string
+	Posted   time.Time
+	Score    int
+	Comments int
+	// Rank is the position of the story among the stories recorded with it,
+	// starting at 1
+	Rank      int
+	FirstSeen time.Time
+	LastSeen  time.Time
+}
+
+// Snapshot is the score and comments of a story at some point.
+type Snapshot struct {
+	At       time.Time `json:"at"`
+	Rank     int       `json:"rank"`
+	Score    int       `json:"score"`
+	Comments int       `json:"comments"`
+}
+
+// Open opens the archive at path, creating it if needed, and brings its
+// schema up to date.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer anyway, one connection avoids busy
+	// errors between our own goroutines
+	db.SetMaxOpenConns(1)
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("archive %s: %w", path, err)
+	}
+	return &Store{db: db, SnapshotEvery: DefaultSnapshotEvery}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Record notes that the stories were seen at the given time, and takes a
+// snapshot of their score and comments unless there is a recent one.
+func (s *Store) Record(stories []Story, at time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	story, err := tx.Prepare(`INSERT INTO stories (id, type, title, url, url_key, title_key, author, posted, score, comments, first_seen, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET type = excluded.type, title = excluded.title, url = excluded.url,
+			url_key = excluded.url_key, title_key = excluded.title_key, author = excluded.author,
+			posted = excluded.posted, score = excluded.score, comments = excluded.comments,
+			last_seen = excluded.last_seen`)
+	if err != nil {
+		return err
+	}
+	defer story.Close()
+	snapshot, err := tx.Prepare(`INSERT INTO snapshots (story_id, at, rank, score, comments)
+		SELECT ?1, ?2, ?3, ?4, ?5 WHERE NOT EXISTS (SELECT 1 FROM snapshots WHERE story_id = ?1 AND at > ?6)`)
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+	// the text of a story is kept when its title changes
+	title, err := tx.Prepare(`UPDATE search SET title = ?2 WHERE rowid = ?1 AND title != ?2`)
+	if err != nil {
+		return err
+	}
+	defer title.Close()
+	search, err := tx.Prepare(`INSERT INTO search (rowid, title, text) SELECT ?1, ?2, '' WHERE NOT EXISTS (SELECT 1 FROM search WHERE rowid = ?1)`)
+	if err != nil {
+		return err
+	}
+	defer search.Close()
+	for _, st := range stories {
+		_, err := story.Exec(st.ID, st.Type, st.Title, st.URL, URLKey(st.URL), TitleKey(st.Title), st.By, st.Posted.Unix(), st.Score, st.Comments, at.Unix(), at.Unix())
+		if err != nil {
+			return err
+		}
+		_, err = snapshot.Exec(st.ID, at.Unix(), st.Rank, st.Score, st.Comments, at.Add(-s.SnapshotEvery).Unix())
+		if err != nil {
+			return err
+		}
+		if _, err := title.Exec(st.ID, st.Title); err != nil {
+			return err
+		}
+		if _, err := search.Exec(st.ID, st.Title); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SetText sets the article text a story is found by in searches.
+func (s *Store) SetText(id int, text string) error {
+	_, err := s.db.Exec(`UPDATE search SET text = ? WHERE rowid = ?`, text, id)
+	return err
+}
+
+// SetSummary keeps the summary of the article of an archived story.
+func (s *Store) SetSummary(id int, summary string) error {
+	_, err := s.db.Exec(`INSERT INTO summaries (story_id, summary) SELECT ?1, ?2 WHERE EXISTS (SELECT 1 FROM stories WHERE id = ?1)
+		ON CONFLICT (story_id) DO UPDATE SET summary = excluded.summary`, id, summary)
+	return err
+}
+
+// Summaries returns the summaries kept of the stories with the given ids,
+// by id. Stories without one are left out.
+func (s *Store) Summaries(ids []int) (map[int]string, error) {
+	b, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(`SELECT story_id, summary FROM summaries WHERE story_id IN (SELECT value FROM json_each(?))`, string(b))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	summaries := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var summary string
+		if err := rows.Scan(&id, &summary); err != nil {
+			return nil, err
+		}
+		summaries[id] = summary
+	}
+	return summaries, rows.Err()
+}
+
+// Result is a story found by Search.
+type Result struct {
+	Story
+	// Snippet is the part of the article text that matched, empty if only
+	// the title did
+	Snippet string
+}
+
+// Search returns the n stories that best match the words of query, in their
+// title or their text. Every word has to match, the last one may be the
+// start of a word.
+func (s *Store) Search(query string, n int) ([]Result, error) {
+	match := matchQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+	// matches in the title weigh more than ones in the text
+	rows, err := s.db.Query(`SELECT `+storyColumns+`, snippet(search, 1, '', '', '…', 24) FROM search
+		JOIN stories ON stories.id = search.rowid
+		WHERE search MATCH ? ORDER BY bm25(search, 10.0, 1.0) LIMIT ?`, match, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var results []Result
+	for rows.Next() {
+		var r Result
+		if err := rows.Scan(append(r.fields(), &r.Snippet)...); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// matchQuery turns the words of a query into an FTS5 query that matches all
+// of them, so text typed by users can't be a syntax error.
+func matchQuery(query string) string {
+	words := strings.FieldsFunc(query, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for i, w := range words {
+		words[i] = `"` + w + `"`
+	}
+	if len(words) > 0 {
+		words[len(words)-1] += "*"
+	}
+	return strings.Join(words, " ")
+}
+
+// Snapshots returns the snapshots of a story, oldest first.
+func (s *Store) Snapshots(id int) ([]Snapshot, error) {
+	rows, err := s.db.Query(`SELECT at, rank, score, comments FROM snapshots WHERE story_id = ? ORDER BY at`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var snapshots []Snapshot
+	for rows.Next() {
+		var sn Snapshot
+		var at int64
+		if err := rows.Scan(&at, &sn.Rank, &sn.Score, &sn.Comments); err != nil {
+			return nil, err
+		}
+		sn.At = time.Unix(at, 0)
+		snapshots = append(snapshots, sn)
+	}
+	return snapshots, rows.Err()
+}
+
+// Recent returns the snapshots taken after since, by story and oldest first.
+func (s *Store) Recent(since time.Time) (map[int][]Snapshot, error) {
+	rows, err := s.db.Query(`SELECT story_id, at, rank, score, comments FROM snapshots WHERE at > ? ORDER BY at`, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	snapshots := make(map[int][]Snapshot)
+	for rows.Next() {
+		var id int
+		var sn Snapshot
+		if err := rows.Scan(&id, (*unixTime)(&sn.At), &sn.Rank, &sn.Score, &sn.Comments); err != nil {
+			return nil, err
+		}
+		snapshots[id] = append(snapshots[id], sn)
+	}
+	return snapshots, rows.Err()
+}
+
+// Seen returns the stories first seen after since, the first seen first.
+func (s *Store) Seen(since time.Time) ([]Story, error) {
+	rows, err := s.db.Query(`SELECT `+storyColumns+` FROM stories WHERE first_seen > ? ORDER BY first_seen`, since.Unix())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var stories []Story
+	for rows.Next() {
+		var st Story
+		if err := rows.Scan(st.fields()...); err != nil {
+			return nil, err
+		}
+		stories = append(stories, st)
+	}
+	return stories, rows.Err()
+}
+
+// Day returns the first n stories seen between from and to, ordered by the
+// best rank they had in that time. Their score and comments are the highest
+// seen then.
+func (s *Store) Day(from, to time.Time, n int) ([]Story, error) {
+	return s.best(from, to, "best.rank, best.score DESC", n)
+}
+
+// Top returns the n stories with the highest score seen between from and
+// to, highest first. Their rank, score and comments are the best seen then.
+func (s *Store) Top(from, to time.Time, n int) ([]Story, error) {
+	return s.best(from, to, "best.score DESC, best.rank", n)
+}
+
+// best returns the stories with snapshots between from and to, with the
+// best rank, score and comments of these, in the given order.
+func (s *Store) best(from, to time.Time, order string, n int) ([]Story, error) {
+	rows, err := s.db.Query(`SELECT `+storyColumns+`, best.rank, best.score, best.comments FROM stories
+		JOIN (SELECT story_id, min(rank) AS rank, max(score) AS score, max(comments) AS comments
+			FROM snapshots WHERE at >= ? AND at < ? GROUP BY story_id) AS best ON best.story_id = stories.id
+		ORDER BY `+order+` LIMIT ?`, from.Unix(), to.Unix(), n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var stories []Story
+	for rows.Next() {
+		var st Story
+		if err := rows.Scan(append(st.fields(), &st.Rank, &st.Score, &st.Comments)...); err != nil {
+			return nil, err
+		}
+		stories = append(stories, st)
+	}
+	return stories, rows.Err()
+}
+
+// Click counts a click on the link of an archived story, at the given time.
+// Only the number of clicks of each story and day is kept, nothing about who
+// clicked. Clicks on stories that aren't archived are not counted.
+func (s *Store) Click(id int, at time.Time) error {
+	_, err := s.db.Exec(`INSERT INTO clicks (story_id, day, clicks) SELECT ?1, ?2, 1 WHERE EXISTS (SELECT 1 FROM stories WHERE id = ?1)
+		ON CONFLICT (story_id, day) DO UPDATE SET clicks = clicks + 1`, id, day(at))
+	return err
+}
+
+// Clicked is a story and the clicks on its link counted in some time.
+type Clicked struct {
+	Story
+	Clicks int
+}
+
+// MostClicked returns the n stories with the most clicks counted on the
+// days from from to to, most first. The days are those of UTC.
+func (s *Store) MostClicked(from, to time.Time, n int) ([]Clicked, error) {
+	rows, err := s.db.Query(`SELECT `+storyColumns+`, sum(clicks.clicks) AS total FROM stories
+		JOIN clicks ON clicks.story_id = stories.id
+		WHERE clicks.day >= ? AND clicks.day <= ?
+		GROUP BY stories.id ORDER BY total DESC, stories.score DESC LIMIT ?`, day(from), day(to), n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var stories []Clicked
+	for rows.Next() {
+		var c Clicked
+		if err := rows.Scan(append(c.fields(), &c.Clicks)...); err != nil {
+			return nil, err
+		}
+		stories = append(stories, c)
+	}
+	return stories, rows.Err()
+}
+
+// day is the number of the UTC day of t since the epoch, clicks are counted
+// by day.
+func day(t time.Time) int64 {
+	return t.Unix() / (24 * 60 * 60)
+}
+
+// Around returns the times of the last snapshot before t and the first one
+// at or after until, zero if there is none. They are used to skip days with
+// nothing archived.
+func (s *Store) Around(t, until time.Time) (before, after time.Time, err error) {
+	var b, a sql.NullInt64
+	err = s.db.QueryRow(`SELECT (SELECT max(at) FROM snapshots WHERE at < ?), (SELECT min(at) FROM snapshots WHERE at >= ?)`,
+		t.Unix(), until.Unix()).Scan(&b, &a)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if b.Valid {
+		before = time.Unix(b.Int64, 0)
+	}
+	if a.Valid {
+		after = time.Unix(a.Int64, 0)
+	}
+	return before, after, nil
+}
+
+// First returns the time of the oldest snapshot, zero if there is none.
+func (s *Store) First() (time.Time, error) {
+	var first sql.NullInt64
+	if err := s.db.QueryRow(`SELECT min(at) FROM snapshots`).Scan(&first); err != nil || !first.Valid {
+		return time.Time{}, err
+	}
+	return time.Unix(first.Int64, 0), nil
+}
+
+// Count is the number of stories that share a domain or submitter.
+type Count struct {
+	Key     string
+	Stories int
+}
+
+// Stats are figures about the archived stories, job ads left out.
+type Stats struct {
+	Stories int
+	// Domains and Submitters are the ones with most stories, most first
+	Domains    []Count
+	Submitters []Count
+	// Hours is the number of stories submitted in each hour of the day
+	Hours [24]int
+	// Weekdays is the average score of the stories submitted on each day
+	// of the week, Sunday first
+	Weekdays [7]float64
+}
+
+// Stats returns the figures of the archived stories, with the n top
+// domains and submitters. Hours and days are those of loc.
+func (s *Store) Stats(n int, loc *time.Location) (Stats, error) {
+	var st Stats
+	rows, err := s.db.Query(`SELECT url, author, posted, score FROM stories WHERE type = 'story'`)
+	if err != nil {
+		return st, err
+	}
+	defer rows.Close()
+	domains, submitters := make(map[string]int), make(map[string]int)
+	var scores, days [7]int
+	for rows.Next() {
+		var link, author string
+		var posted time.Time
+		var score int
+		if err := rows.Scan(&link, &author, (*unixTime)(&posted), &score); err != nil {
+			return st, err
+		}
+		st.Stories++
+		if u, err := url.Parse(link); err == nil && u.Host != "" {
+			domains[strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")]++
+		}
+		if author != "" {
+			submitters[author]++
+		}
+		// stories archived before the submission time was kept have none
+		if posted.Unix() > 0 {
+			posted = posted.In(loc)
+			st.Hours[posted.Hour()]++
+			scores[posted.Weekday()] += score
+			days[posted.Weekday()]++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return st, err
+	}
+	for d := range days {
+		if days[d] > 0 {
+			st.Weekdays[d] = float64(scores[d]) / float64(days[d])
+		}
+	}
+	st.Domains, st.Submitters = topCounts(domains, n), topCounts(submitters, n)
+	return st, nil
+}
+
+// topCounts returns the n keys with the most stories, ties in alphabetical
+// order.
+func topCounts(counts map[string]int, n int) []Count {
+	top := make([]Count, 0, len(counts))
+	for k, c := range counts {
+		top = append(top, Count{Key: k, Stories: c})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Stories != top[j].Stories {
+			return top[i].Stories > top[j].Stories
+		}
+		return top[i].Key < top[j].Key
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// Earlier returns the most recent story other than the one with id that had
+// the same link or nearly the same title, was on the front page before it and
+// was last seen after since. ok is false if there is none.
+func (s *Store) Earlier(id int, link, title string, since time.Time) (story Story, ok bool, err error) {
+	err = s.db.QueryRow(`SELECT `+storyColumns+` FROM stories
+		WHERE id != ? AND last_seen >= ?
+			AND first_seen < coalesce((SELECT first_seen FROM stories WHERE id = ?), unixepoch())
+			AND ((url_key != '' AND url_key = ?) OR title_key = ?)
+		ORDER BY last_seen DESC LIMIT 1`,
+		id, since.Unix(), id, URLKey(link), TitleKey(title),
+	).Scan(story.fields()...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Story{}, false, nil
+	}
+	if err != nil {
+		return Story{}, false, err
+	}
+	return story, true, nil
+}
+
+// storyColumns are the columns scanned by Story.fields.
+const storyColumns = `stories.id, stories.type, stories.title, stories.url, stories.author, stories.posted,
+	stories.score, stories.comments, stories.first_seen, stories.last_seen`
+
+func (st *Story) fields() []interface{} {
+	return []interface{}{&st.ID, &st.Type, &st.Title, &st.URL, &st.By, (*unixTime)(&st.Posted),
+		&st.Score, &st.Comments, (*unixTime)(&st.FirstSeen), (*unixTime)(&st.LastSeen)}
+}
+
+// unixTime scans the seconds since the epoch the times are stored as.
+type unixTime time.Time
+
+func (t *unixTime) Scan(v interface{}) error {
+	sec, ok := v.(int64)
+	if !ok {
+		return fmt.Errorf("archive: can't scan %T as a time", v)
+	}
+	*t = unixTime(time.Unix(sec, 0))
+	return nil
+}
+
+// Prune deletes the snapshots taken before t and the stories last seen
+// before it. It returns how many stories were deleted.
+func (s *Store) Prune(t time.Time) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`DELETE FROM snapshots WHERE at < ?`, t.Unix())
+	if err != nil {
+		return 0, err
+	}
+	snapshots, _ := res.RowsAffected()
+	res, err = tx.Exec(`DELETE FROM stories WHERE last_seen < ?`, t.Unix())
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	// the search index has no foreign key to cascade from
+	if _, err := tx.Exec(`DELETE FROM search WHERE rowid NOT IN (SELECT id FROM stories)`); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE maintenance SET pruned = pruned + ?`, snapshots+n); err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// Vacuum rebuilds the database file, giving the space of deleted rows back
+// to the file system. It needs as much free disk space as the file takes.
+func (s *Store) Vacuum() error {
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(`UPDATE maintenance SET vacuumed_at = ?, pruned = 0`, time.Now().Unix())
+	return err
+}
+
+// Vacuumed returns when the database was last vacuumed, the zero time if
+// never, and how many rows were pruned since.
+func (s *Store) Vacuumed() (at time.Time, pruned int64, err error) {
+	var vacuumedAt int64
+	err = s.db.QueryRow(`SELECT vacuumed_at, pruned FROM maintenance`).Scan(&vacuumedAt, &pruned)
+	if err != nil || vacuumedAt == 0 {
+		return time.Time{}, pruned, err
+	}
+	return time.Unix(vacuumedAt, 0), pruned, nil
+}
+
+// trackingParams are query parameters that don't change what a link points
+// to.
+var trackingParams = regexp.MustCompile(`^(utm_.*|ref|fbclid|gclid)$`)
+
+// URLKey returns the form of a link used to compare it with others: without
+// scheme, "www.", fragment, tracking parameters and trailing slash.
+func URLKey(link string) string {
+	u, err := url.Parse(link)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	q := u.Query()
+	for name := range q {
+		if trackingParams.MatchString(name) {
+			q.Del(name)
+		}
+	}
+	key := strings.TrimPrefix(strings.ToLower(u.Host), "www.") + strings.TrimSuffix(u.EscapedPath(), "/")
+	if len(q) > 0 {
+		key += "?" + q.Encode()
+	}
+	return key
+}
+
+// yearSuffix matches the "(2019)" or "[pdf]" HN appends to some titles.
+var yearSuffix = regexp.MustCompile(`\s*[(\[]([0-9]{4}|pdf|video)[)\]]\s*$`)
+
+// TitleKey returns the form of a title used to find near-identical ones: in
+// lower case, with only letters and numbers separated by single spaces.
+func TitleKey(title string) string {
+	title = yearSuffix.ReplaceAllString(strings.ToLower(title), "")
+	return strings.Join(strings.FieldsFunc(title, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}), " ")
+}
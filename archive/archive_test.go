@@ -0,0 +1,344 @@
+package archive
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTest(t *testing.T) *Store {
+	t.Helper()
+	s, err := Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatalf("Open() received an error: %s", err.Error())
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestOpen_migrated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.db")
+	for i := 0; i < 2; i++ {
+		s, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open() #%d received an error: %s", i+1, err.Error())
+		}
+		var version int
+		s.db.QueryRow("PRAGMA user_version").Scan(&version)
+		if version != len(migrations) {
+			t.Errorf("user_version: want %d, got %d", len(migrations), version)
+		}
+		s.Close()
+	}
+}
+
+func TestStore_Earlier(t *testing.T) {
+	s := openTest(t)
+	day := 24 * time.Hour
+	now := time.Now()
+	err := s.Record([]Story{
+		{ID: 1, Title: "A Thing (2019)", URL: "https://www.example.com/thing/?utm_source=hn"},
+		{ID: 2, Title: "Something else", URL: "https://example.org/"},
+	}, now.Add(-3*day))
+	if err != nil {
+		t.Fatalf("Record() received an error: %s", err.Error())
+	}
+	s.Record([]Story{{ID: 3, Title: "Brand new", URL: "http://example.com/thing"}}, now.Add(-time.Minute))
+	s.Record([]Story{{ID: 4, Title: "something, else!", URL: "https://other.example/"}}, now.Add(-time.Minute))
+
+	tests := []struct {
+		id     int
+		link   string
+		title  string
+		since  time.Duration
+		wantID int
+	}{
+		{3, "http://example.com/thing", "Brand new", 7 * day, 1},
+		{4, "https://other.example/", "something, else!", 7 * day, 2},
+		{4, "https://other.example/", "something, else!", day, 0},
+		{1, "https://www.example.com/thing", "A Thing", 7 * day, 0},
+		{5, "", "Brand new", 7 * day, 3},
+	}
+	for _, tc := range tests {
+		story, ok, err := s.Earlier(tc.id, tc.link, tc.title, now.Add(-tc.since))
+		if err != nil {
+			t.Fatalf("Earlier() received an error: %s", err.Error())
+		}
+		if got := story.ID; ok != (tc.wantID != 0) || got != tc.wantID {
+			t.Errorf("Earlier(%d, %s): want %d, got %d", tc.id, tc.link, tc.wantID, got)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	if a, b := URLKey("https://www.Example.com/a/?utm_medium=x#top"), URLKey("http://example.com/a"); a != b {
+		t.Errorf("URLKey: want %s, got %s", b, a)
+	}
+	if a, b := TitleKey("Show HN: My — new thing [pdf]"), TitleKey("show hn my new thing"); a != b {
+		t.Errorf("TitleKey: want %s, got %s", b, a)
+	}
+}
+
+func TestStore_Snapshots(t *testing.T) {
+	s := openTest(t)
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 6; i++ {
+		story := Story{ID: 1, Title: "A", URL: "https://example.com/", Rank: 6 - i, Score: 10 * i, Comments: i, Posted: start}
+		if err := s.Record([]Story{story}, start.Add(time.Duration(i)*5*time.Minute)); err != nil {
+			t.Fatalf("Record() received an error: %s", err.Error())
+		}
+	}
+	snapshots, err := s.Snapshots(1)
+	if err != nil {
+		t.Fatalf("Snapshots() received an error: %s", err.Error())
+	}
+	// one every 10 minutes
+	if len(snapshots) != 3 {
+		t.Fatalf("len(snapshots): want %d, got %d", 3, len(snapshots))
+	}
+	if last := snapshots[2]; last.Score != 40 || last.Rank != 2 || last.Comments != 4 {
+		t.Errorf("snapshots[2]: want score 40, rank 2 and 4 comments, got %+v", last)
+	}
+	story, ok, _ := s.Earlier(2, "https://example.com/", "", time.Time{})
+	if !ok || story.Score != 50 || !story.Posted.Equal(start.Truncate(time.Second)) {
+		t.Errorf("Earlier(): want the latest score and the posted time, got %+v", story)
+	}
+}
+
+func TestStore_Day(t *testing.T) {
+	s := openTest(t)
+	day := time.Date(2024, 5, 12, 0, 0, 0, 0, time.UTC)
+	s.Record([]Story{{ID: 1, Title: "One", Rank: 3, Score: 5}, {ID: 2, Title: "Two", Rank: 1, Score: 50}}, day.Add(-time.Hour))
+	s.Record([]Story{{ID: 1, Title: "One", Rank: 1, Score: 10}, {ID: 2, Title: "Two", Rank: 2, Score: 90}}, day.Add(time.Hour))
+	s.Record([]Story{{ID: 3, Title: "Three", Rank: 1, Score: 7}, {ID: 1, Title: "One", Rank: 2, Score: 30}}, day.Add(3*time.Hour))
+	s.Record([]Story{{ID: 4, Title: "Four", Rank: 1}}, day.Add(50*time.Hour))
+
+	stories, err := s.Day(day, day.AddDate(0, 0, 1), 10)
+	if err != nil {
+		t.Fatalf("Day() received an error: %s", err.Error())
+	}
+	var ids []int
+	for _, st := range stories {
+		ids = append(ids, st.ID)
+	}
+	if len(ids) != 3 || ids[0] != 1 || ids[1] != 3 || ids[2] != 2 {
+		t.Errorf("Day(): want stories 1, 3 and 2, got %v", ids)
+	}
+	if stories[0].Score != 30 || stories[0].Rank != 1 {
+		t.Errorf("stories[0]: want score 30 and rank 1, got %d and %d", stories[0].Score, stories[0].Rank)
+	}
+
+	top, err := s.Top(day.Add(-2*time.Hour), day.AddDate(0, 0, 1), 2)
+	if err != nil {
+		t.Fatalf("Top() received an error: %s", err.Error())
+	}
+	if len(top) != 2 || top[0].ID != 2 || top[0].Score != 90 || top[1].ID != 1 {
+		t.Errorf("Top(): want stories 2 with 90 points and 1, got %+v", top)
+	}
+
+	before, after, err := s.Around(day, day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Around() received an error: %s", err.Error())
+	}
+	if !before.Equal(day.Add(-time.Hour)) || !after.Equal(day.Add(50*time.Hour)) {
+		t.Errorf("Around(): want %s and %s, got %s and %s", day.Add(-time.Hour), day.Add(50*time.Hour), before, after)
+	}
+	if first, _ := s.First(); !first.Equal(day.Add(-time.Hour)) {
+		t.Errorf("First(): want %s, got %s", day.Add(-time.Hour), first)
+	}
+}
+
+func TestStore_Recent(t *testing.T) {
+	s := openTest(t)
+	now := time.Now()
+	s.Record([]Story{{ID: 1, Score: 1}, {ID: 2, Score: 2}}, now.Add(-2*time.Hour))
+	s.Record([]Story{{ID: 1, Score: 5}}, now.Add(-30*time.Minute))
+	s.Record([]Story{{ID: 1, Score: 8}, {ID: 3, Score: 3}}, now.Add(-10*time.Minute))
+
+	recent, err := s.Recent(now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("Recent() received an error: %s", err.Error())
+	}
+	if len(recent) != 2 || len(recent[1]) != 2 || len(recent[3]) != 1 {
+		t.Fatalf("Recent(): want 2 snapshots of story 1 and 1 of story 3, got %v", recent)
+	}
+	if first := recent[1][0]; first.Score != 5 || !first.At.Equal(now.Add(-30*time.Minute).Truncate(time.Second)) {
+		t.Errorf("recent[1][0]: want score 5 at %s, got %+v", now.Add(-30*time.Minute), first)
+	}
+}
+
+func TestStore_Seen(t *testing.T) {
+	s := openTest(t)
+	now := time.Now()
+	s.Record([]Story{{ID: 1}, {ID: 2}}, now.Add(-3*time.Hour))
+	s.Record([]Story{{ID: 2}, {ID: 3}}, now.Add(-time.Hour))
+	s.Record([]Story{{ID: 4}}, now)
+
+	stories, err := s.Seen(now.Add(-2 * time.Hour))
+	if err != nil {
+		t.Fatalf("Seen() received an error: %s", err.Error())
+	}
+	if len(stories) != 2 || stories[0].ID != 3 || stories[1].ID != 4 {
+		t.Fatalf("Seen(): want stories 3 and 4, got %+v", stories)
+	}
+	if !stories[0].FirstSeen.Equal(now.Add(-time.Hour).Truncate(time.Second)) {
+		t.Errorf("FirstSeen: want %s, got %s", now.Add(-time.Hour), stories[0].FirstSeen)
+	}
+}
+
+func TestStore_Search(t *testing.T) {
+	s := openTest(t)
+	now := time.Now()
+	s.Record([]Story{
+		{ID: 1, Title: "Writing a compiler in Go"},
+		{ID: 2, Title: "Café culture"},
+		{ID: 3, Title: "Something else"},
+	}, now)
+	if err := s.SetText(3, "A long article about compilers and the Go runtime."); err != nil {
+		t.Fatalf("SetText() received an error: %s", err.Error())
+	}
+	// a new title keeps the text
+	s.Record([]Story{{ID: 3, Title: "Something else entirely"}}, now)
+
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"compiler", []int{1, 3}},
+		{"go compil", []int{1, 3}},
+		{"cafe", []int{2}},
+		{"entirely runtime", []int{3}},
+		{`"unbalanced ( AND`, nil},
+		{"", nil},
+	}
+	for _, tc := range tests {
+		results, err := s.Search(tc.query, 10)
+		if err != nil {
+			t.Fatalf("Search(%q) received an error: %s", tc.query, err.Error())
+		}
+		var got []int
+		for _, r := range results {
+			got = append(got, r.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("Search(%q): want %v, got %v", tc.query, tc.want, got)
+		}
+	}
+	results, _ := s.Search("runtime", 10)
+	if len(results) != 1 || !strings.Contains(results[0].Snippet, "runtime") {
+		t.Errorf("Search(runtime): want a snippet of the text, got %+v", results)
+	}
+}
+
+func TestStore_Stats(t *testing.T) {
+	s := openTest(t)
+	monday := time.Date(2024, 5, 13, 9, 30, 0, 0, time.UTC)
+	s.Record([]Story{
+		{ID: 1, Type: "story", URL: "https://www.example.com/a", By: "alice", Posted: monday, Score: 10},
+		{ID: 2, Type: "story", URL: "https://example.com/b", By: "bob", Posted: monday.Add(time.Hour), Score: 30},
+		{ID: 3, Type: "story", URL: "https://other.example/", By: "alice", Posted: monday.AddDate(0, 0, 1), Score: 7},
+		{ID: 4, Type: "story", By: "carol"},
+		{ID: 5, Type: "job", URL: "https://jobs.example/", Posted: monday},
+	}, time.Now())
+
+	st, err := s.Stats(2, time.UTC)
+	if err != nil {
+		t.Fatalf("Stats() received an error: %s", err.Error())
+	}
+	if st.Stories != 4 {
+		t.Errorf("Stories: want %d, got %d", 4, st.Stories)
+	}
+	if len(st.Domains) != 2 || st.Domains[0] != (Count{"example.com", 2}) || st.Domains[1] != (Count{"other.example", 1}) {
+		t.Errorf("Domains: want example.com and other.example, got %v", st.Domains)
+	}
+	if len(st.Submitters) != 2 || st.Submitters[0] != (Count{"alice", 2}) || st.Submitters[1].Key != "bob" {
+		t.Errorf("Submitters: want alice and bob, got %v", st.Submitters)
+	}
+	if st.Hours[9] != 2 || st.Hours[10] != 1 {
+		t.Errorf("Hours: want 2 at 9 and 1 at 10, got %v", st.Hours)
+	}
+	if st.Weekdays[time.Monday] != 20 || st.Weekdays[time.Tuesday] != 7 || st.Weekdays[time.Sunday] != 0 {
+		t.Errorf("Weekdays: want 20 on Monday and 7 on Tuesday, got %v", st.Weekdays)
+	}
+}
+
+func TestStore_Prune(t *testing.T) {
+	s := openTest(t)
+	now := time.Now()
+	s.Record([]Story{{ID: 1, Title: "Old"}, {ID: 2, Title: "Still there"}}, now.Add(-48*time.Hour))
+	s.Record([]Story{{ID: 2, Title: "Still there"}}, now)
+
+	n, err := s.Prune(now.Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatalf("Prune() received an error: %s", err.Error())
+	}
+	if n != 1 {
+		t.Errorf("Prune(): want %d story deleted, got %d", 1, n)
+	}
+	if results, _ := s.Search("old", 10); len(results) != 0 {
+		t.Errorf("Search(old): want no results, got %v", results)
+	}
+	if snapshots, _ := s.Snapshots(2); len(snapshots) != 1 {
+		t.Errorf("Snapshots(2): want %d, got %d", 1, len(snapshots))
+	}
+	// the story and the snapshot of each day
+	if at, pruned, _ := s.Vacuumed(); !at.IsZero() || pruned != 3 {
+		t.Errorf("Vacuumed(): want never and %d rows pruned, got %s and %d", 3, at, pruned)
+	}
+	if err := s.Vacuum(); err != nil {
+		t.Errorf("Vacuum() received an error: %s", err.Error())
+	}
+	if at, pruned, _ := s.Vacuumed(); at.IsZero() || pruned != 0 {
+		t.Errorf("Vacuumed(): want now and %d rows pruned, got %s and %d", 0, at, pruned)
+	}
+}
+
+func TestStore_MostClicked(t *testing.T) {
+	s := openTest(t)
+	now := time.Now()
+	week := 7 * 24 * time.Hour
+	s.Record([]Story{{ID: 1, Title: "One"}, {ID: 2, Title: "Two"}, {ID: 3, Title: "Three"}}, now)
+	for _, c := range []struct {
+		id int
+		at time.Time
+	}{
+		{1, now}, {2, now}, {2, now.Add(-time.Hour)}, {3, now.Add(-2 * week)}, {3, now.Add(-2 * week)}, {3, now.Add(-2 * week)},
+		// not archived
+		{4, now},
+	} {
+		if err := s.Click(c.id, c.at); err != nil {
+			t.Fatalf("Click() received an error: %s", err.Error())
+		}
+	}
+	top, err := s.MostClicked(now.Add(-week), now, 10)
+	if err != nil {
+		t.Fatalf("MostClicked() received an error: %s", err.Error())
+	}
+	var got []string
+	for _, c := range top {
+		got = append(got, fmt.Sprintf("%d:%d", c.ID, c.Clicks))
+	}
+	if want := "2:2 1:1"; strings.Join(got, " ") != want {
+		t.Errorf("clicks: want %s, got %s", want, strings.Join(got, " "))
+	}
+}
+
+func TestStore_Summaries(t *testing.T) {
+	s := openTest(t)
+	s.Record([]Story{{ID: 1, Title: "One"}, {ID: 2, Title: "Two"}}, time.Now())
+	for _, id := range []int{1, 3} {
+		if err := s.SetSummary(id, fmt.Sprintf("Summary %d.", id)); err != nil {
+			t.Fatalf("SetSummary() received an error: %s", err.Error())
+		}
+	}
+	s.SetSummary(1, "Better one.")
+	got, err := s.Summaries([]int{1, 2, 3})
+	if err != nil {
+		t.Fatalf("Summaries() received an error: %s", err.Error())
+	}
+	if len(got) != 1 || got[1] != "Better one." {
+		t.Errorf("summaries: want only the one of 1, got %v", got)
+	}
+}
@@ -0,0 +1,161 @@
+package archive
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Entry is a story with everything the archive knows about it, the unit of
+// exports and imports.
+type Entry struct {
+	ID        int        `json:"id"`
+	Type      string     `json:"type"`
+	Title     string     `json:"title"`
+	URL       string     `json:"url,omitempty"`
+	By        string     `json:"by,omitempty"`
+	Posted    time.Time  `json:"posted"`
+	Score     int        `json:"score"`
+	Comments  int        `json:"comments"`
+	FirstSeen time.Time  `json:"first_seen"`
+	LastSeen  time.Time  `json:"last_seen"`
+	Text      string     `json:"text,omitempty"`
+	Snapshots []Snapshot `json:"snapshots,omitempty"`
+}
+
+// Export calls fn with each story last seen at or after since, in the order
+// of their IDs, along with its snapshots taken since then.
+func (s *Store) Export(since time.Time, fn func(Entry) error) error {
+	rows, err := s.db.Query(`SELECT `+storyColumns+`, coalesce(search.text, ''), snapshots.at, snapshots.rank, snapshots.score, snapshots.comments
+		FROM stories LEFT JOIN search ON search.rowid = stories.id
+			LEFT JOIN snapshots ON snapshots.story_id = stories.id AND snapshots.at >= ?1
+		WHERE stories.last_seen >= ?1 ORDER BY stories.id, snapshots.at`, since.Unix())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var e Entry
+	for rows.Next() {
+		var st Story
+		var text string
+		var at, rank, score, comments sql.NullInt64
+		if err := rows.Scan(append(st.fields(), &text, &at, &rank, &score, &comments)...); err != nil {
+			return err
+		}
+		if st.ID != e.ID {
+			if e.ID != 0 {
+				if err := fn(e); err != nil {
+					return err
+				}
+			}
+			e = Entry{ID: st.ID, Type: st.Type, Title: st.Title, URL: st.URL, By: st.By, Posted: st.Posted,
+				Score: st.Score, Comments: st.Comments, FirstSeen: st.FirstSeen, LastSeen: st.LastSeen, Text: text}
+		}
+		if at.Valid {
+			e.Snapshots = append(e.Snapshots, Snapshot{At: time.Unix(at.Int64, 0), Rank: int(rank.Int64),
+				Score: int(score.Int64), Comments: int(comments.Int64)})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if e.ID != 0 {
+		return fn(e)
+	}
+	return nil
+}
+
+// Import adds the entries read by next to the archive, until it returns
+// io.EOF, and returns how many were added. Stories that are already there
+// are merged: they keep the earliest first_seen and the latest last_seen,
+// and gain the snapshots they didn't have. Everything is imported in one
+// transaction, so nothing is if there is an error.
+func (s *Store) Import(next func(*Entry) error) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	story, err := tx.Prepare(`INSERT INTO stories (id, type, title, url, url_key, title_key, author, posted, score, comments, first_seen, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET first_seen = min(first_seen, excluded.first_seen),
+			last_seen = max(last_seen, excluded.last_seen)`)
+	if err != nil {
+		return 0, err
+	}
+	defer story.Close()
+	snapshot, err := tx.Prepare(`INSERT OR IGNORE INTO snapshots (story_id, at, rank, score, comments) VALUES (?, ?, ?, ?, ?)`)
+	if err != nil {
+		return 0, err
+	}
+	defer snapshot.Close()
+	search, err := tx.Prepare(`INSERT INTO search (rowid, title, text) SELECT ?1, ?2, ?3 WHERE NOT EXISTS (SELECT 1 FROM search WHERE rowid = ?1)`)
+	if err != nil {
+		return 0, err
+	}
+	defer search.Close()
+	text, err := tx.Prepare(`UPDATE search SET text = ?2 WHERE rowid = ?1 AND text = ''`)
+	if err != nil {
+		return 0, err
+	}
+	defer text.Close()
+	n := 0
+	for {
+		var e Entry
+		err := next(&e)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if e.ID == 0 {
+			return 0, errors.New("archive: entry without an id")
+		}
+		if e.Type == "" {
+			e.Type = "story"
+		}
+		// a missing first or last seen is taken from the snapshots, a merge
+		// would otherwise keep the zero time over a good one
+		for _, sn := range e.Snapshots {
+			if sn.At.IsZero() {
+				return 0, fmt.Errorf("archive: entry %d: snapshot without a time", e.ID)
+			}
+			if e.FirstSeen.IsZero() || sn.At.Before(e.FirstSeen) {
+				e.FirstSeen = sn.At
+			}
+			if e.LastSeen.IsZero() || sn.At.After(e.LastSeen) {
+				e.LastSeen = sn.At
+			}
+		}
+		if e.FirstSeen.IsZero() || e.LastSeen.IsZero() {
+			return 0, fmt.Errorf("archive: entry %d without first_seen, last_seen or snapshots", e.ID)
+		}
+		posted := int64(0)
+		if !e.Posted.IsZero() {
+			posted = e.Posted.Unix()
+		}
+		_, err = story.Exec(e.ID, e.Type, e.Title, e.URL, URLKey(e.URL), TitleKey(e.Title), e.By, posted,
+			e.Score, e.Comments, e.FirstSeen.Unix(), e.LastSeen.Unix())
+		if err != nil {
+			return 0, err
+		}
+		for _, sn := range e.Snapshots {
+			if _, err := snapshot.Exec(e.ID, sn.At.Unix(), sn.Rank, sn.Score, sn.Comments); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := search.Exec(e.ID, e.Title, e.Text); err != nil {
+			return 0, err
+		}
+		if e.Text != "" {
+			if _, err := text.Exec(e.ID, e.Text); err != nil {
+				return 0, err
+			}
+		}
+		n++
+	}
+	return n, tx.Commit()
+}
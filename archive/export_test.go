@@ -0,0 +1,92 @@
+package archive
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestStore_ExportImport(t *testing.T) {
+	src := openTest(t)
+	day := time.Date(2024, 5, 12, 0, 0, 0, 0, time.UTC)
+	src.Record([]Story{{ID: 1, Type: "story", Title: "Old", Score: 1}}, day.AddDate(0, -1, 0))
+	src.Record([]Story{{ID: 2, Type: "story", Title: "A compiler", URL: "https://example.com/", By: "alice", Posted: day, Score: 5}}, day)
+	src.Record([]Story{{ID: 2, Type: "story", Title: "A compiler", URL: "https://example.com/", By: "alice", Posted: day, Score: 9}}, day.Add(time.Hour))
+	src.SetText(2, "all about parsers")
+
+	var entries []Entry
+	err := src.Export(day.AddDate(0, 0, -1), func(e Entry) error {
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Export() received an error: %s", err.Error())
+	}
+	if len(entries) != 1 || entries[0].ID != 2 || len(entries[0].Snapshots) != 2 || entries[0].Text != "all about parsers" {
+		t.Fatalf("Export(): want story 2 with 2 snapshots and its text, got %+v", entries)
+	}
+
+	dst := openTest(t)
+	// the story is already there, seen later
+	dst.Record([]Story{{ID: 2, Type: "story", Title: "A compiler", Score: 20}}, day.AddDate(0, 0, 2))
+	for i := 0; i < 2; i++ {
+		next := entries
+		n, err := dst.Import(func(e *Entry) error {
+			if len(next) == 0 {
+				return io.EOF
+			}
+			*e, next = next[0], next[1:]
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Import() received an error: %s", err.Error())
+		}
+		if n != 1 {
+			t.Errorf("Import(): want %d entry, got %d", 1, n)
+		}
+	}
+	if snapshots, _ := dst.Snapshots(2); len(snapshots) != 3 {
+		t.Errorf("Snapshots(2): want %d, got %d", 3, len(snapshots))
+	}
+	results, _ := dst.Search("parsers", 10)
+	if len(results) != 1 {
+		t.Fatalf("Search(parsers): want 1 result, got %d", len(results))
+	}
+	if got := results[0]; !got.FirstSeen.Equal(day) || !got.LastSeen.Equal(day.AddDate(0, 0, 2)) {
+		t.Errorf("imported story: want seen from %s to %s, got %s to %s", day, day.AddDate(0, 0, 2), got.FirstSeen, got.LastSeen)
+	}
+}
+
+func TestStore_ImportTimes(t *testing.T) {
+	s := openTest(t)
+	day := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.Record([]Story{{ID: 1, Title: "Seen"}}, day)
+	importOne := func(e Entry) error {
+		done := false
+		_, err := s.Import(func(out *Entry) error {
+			if done {
+				return io.EOF
+			}
+			*out, done = e, true
+			return nil
+		})
+		return err
+	}
+
+	// the times of the snapshots stand in for missing ones
+	err := importOne(Entry{ID: 1, Title: "Seen", Snapshots: []Snapshot{{At: day.Add(-time.Hour)}, {At: day.Add(-2 * time.Hour)}}})
+	if err != nil {
+		t.Fatalf("Import() received an error: %s", err.Error())
+	}
+	results, _ := s.Search("seen", 10)
+	if len(results) != 1 || !results[0].FirstSeen.Equal(day.Add(-2*time.Hour)) || !results[0].LastSeen.Equal(day) {
+		t.Errorf("imported story: want seen from %s to %s, got %+v", day.Add(-2*time.Hour), day, results)
+	}
+
+	if err := importOne(Entry{ID: 2, Title: "No times"}); err == nil {
+		t.Errorf("Import(): want an error for an entry without times")
+	}
+	if err := importOne(Entry{ID: 3, Title: "Zero snapshot", FirstSeen: day, LastSeen: day, Snapshots: []Snapshot{{}}}); err == nil {
+		t.Errorf("Import(): want an error for a snapshot without a time")
+	}
+}
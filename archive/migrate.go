@@ -0,0 +1,86 @@
+package archive
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations are applied in order, each one once. The number of migrations
+// a database has seen is kept in its user_version, so new ones must only
+// ever be appended.
+var migrations = []string{
+	`CREATE TABLE stories (
+		id INTEGER PRIMARY KEY,
+		title TEXT NOT NULL,
+		url TEXT NOT NULL,
+		url_key TEXT NOT NULL,
+		title_key TEXT NOT NULL,
+		first_seen INTEGER NOT NULL,
+		last_seen INTEGER NOT NULL
+	);
+	CREATE INDEX stories_url_key ON stories (url_key);
+	CREATE INDEX stories_title_key ON stories (title_key);`,
+	`ALTER TABLE stories ADD COLUMN type TEXT NOT NULL DEFAULT 'story';
+	ALTER TABLE stories ADD COLUMN author TEXT NOT NULL DEFAULT '';
+	ALTER TABLE stories ADD COLUMN posted INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE stories ADD COLUMN score INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE stories ADD COLUMN comments INTEGER NOT NULL DEFAULT 0;
+	CREATE INDEX stories_last_seen ON stories (last_seen);
+	CREATE TABLE snapshots (
+		story_id INTEGER NOT NULL REFERENCES stories (id) ON DELETE CASCADE,
+		at INTEGER NOT NULL,
+		rank INTEGER NOT NULL,
+		score INTEGER NOT NULL,
+		comments INTEGER NOT NULL,
+		PRIMARY KEY (story_id, at)
+	) WITHOUT ROWID;
+	CREATE INDEX snapshots_at ON snapshots (at);`,
+	`CREATE VIRTUAL TABLE search USING fts5 (title, text, tokenize = 'unicode61 remove_diacritics 2');
+	INSERT INTO search (rowid, title, text) SELECT id, title, '' FROM stories;`,
+	`CREATE TABLE maintenance (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		vacuumed_at INTEGER NOT NULL,
+		pruned INTEGER NOT NULL
+	);
+	INSERT INTO maintenance VALUES (1, 0, 0);`,
+	`CREATE TABLE clicks (
+		story_id INTEGER NOT NULL REFERENCES stories (id) ON DELETE CASCADE,
+		day INTEGER NOT NULL,
+		clicks INTEGER NOT NULL,
+		PRIMARY KEY (story_id, day)
+	) WITHOUT ROWID;
+	CREATE INDEX clicks_day ON clicks (day);`,
+	`CREATE TABLE summaries (
+		story_id INTEGER PRIMARY KEY REFERENCES stories (id) ON DELETE CASCADE,
+		summary TEXT NOT NULL
+	);`,
+}
+
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than this binary knows", version)
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version+1, err)
+		}
+		// PRAGMA doesn't take parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
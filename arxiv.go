@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	paperCachLifeDuration = 7 * 24 * time.Hour
+	// paperRetryAfter is how long the papers of a failed request are left
+	// alone
+	paperRetryAfter = 30 * time.Minute
+	// arxivBatch is the most papers asked for in one request, arXiv asks
+	// for few requests rather than many
+	arxivBatch = 50
+)
+
+// arxivAPI is the arXiv query API, tests point it elsewhere.
+var arxivAPI = "https://export.arxiv.org/api/query"
+
+var arxivClient = &http.Client{Timeout: 30 * time.Second}
+
+// paperCach holds the abstracts of the arXiv papers stories link to, by
+// paper ID.
+type paperCach struct {
+	papers map[string]cachedPaper
+	mutex  sync.Mutex
+	// busy is held while abstracts are fetched, refreshes that come along
+	// in the meantime leave theirs to the next batch
+	busy sync.Mutex
+}
+
+type cachedPaper struct {
+	abstract   string
+	expiration time.Time
+}
+
+func newPaperCach() *paperCach {
+	return &paperCach{papers: make(map[string]cachedPaper)}
+}
+
+// arxivPath matches the pages of a paper, like /abs/2301.01234v2,
+// /pdf/2301.01234.pdf or /abs/hep-th/9901001, the ID without its version is
+// the first group.
+var arxivPath = regexp.MustCompile(`^/(?:abs|pdf|html)/([0-9]{4}\.[0-9]{4,5}|[a-z-]+(?:\.[A-Z]{2})?/[0-9]{7})(?:v[0-9]+)?(?:\.pdf)?/?$`)
+
+// arxivID returns the ID of the arXiv paper a story links to, empty if it
+// doesn't link to one.
+func arxivID(s item) string {
+	if s.Host != "arxiv.org" {
+		return ""
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return ""
+	}
+	m := arxivPath.FindStringSubmatch(u.Path)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// annotate sets the Abstract of the stories linking to a cached paper. The
+// missing and expired ones are fetched in the background, and show up on
+// the next refresh.
+func (p *paperCach) annotate(stories []item) {
+	var missing []string
+	now := time.Now()
+	p.mutex.Lock()
+	for i, s := range stories {
+		id := arxivID(s)
+		if id == "" {
+			continue
+		}
+		cached, ok := p.papers[id]
+		if !ok || now.After(cached.expiration) {
+			missing = append(missing, id)
+		}
+		stories[i].Abstract = cached.abstract
+	}
+	p.mutex.Unlock()
+	if len(missing) == 0 || !p.busy.TryLock() {
+		return
+	}
+	go func() {
+		defer p.busy.Unlock()
+		for len(missing) > 0 {
+			batch := missing[:min(arxivBatch, len(missing))]
+			missing = missing[len(batch):]
+			p.fetchPapers(batch)
+		}
+		p.prune()
+	}()
+}
+
+// fetchPapers fetches the abstracts of the papers in one request. Papers
+// arXiv doesn't know are cached without one.
+func (p *paperCach) fetchPapers(ids []string) {
+	abstracts, err := fetchAbstracts(ids)
+	expiration := time.Now().Add(paperCachLifeDuration)
+	if err != nil {
+		expiration = time.Now().Add(paperRetryAfter)
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, id := range ids {
+		p.papers[id] = cachedPaper{abstract: abstracts[id], expiration: expiration}
+	}
+}
+
+// arxivVersion is the version at the end of the IDs of the arXiv API.
+var arxivVersion = regexp.MustCompile(`v[0-9]+$`)
+
+func fetchAbstracts(ids []string) (map[string]string, error) {
+	q := url.Values{"id_list": {strings.Join(ids, ",")}, "max_results": {fmt.Sprint(len(ids))}}
+	resp, err := arxivClient.Get(arxivAPI + "?" + q.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("arxiv: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("arxiv: unexpected status %s", resp.Status)
+	}
+	var feed struct {
+		Entries []struct {
+			ID      string `xml:"id"`
+			Summary string `xml:"summary"`
+		} `xml:"http://www.w3.org/2005/Atom entry"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
+		return nil, fmt.Errorf("arxiv: %w", err)
+	}
+	abstracts := make(map[string]string)
+	for _, e := range feed.Entries {
+		_, id, ok := strings.Cut(e.ID, "/abs/")
+		if !ok {
+			continue
+		}
+		// abstracts come wrapped at some column
+		abstracts[arxivVersion.ReplaceAllString(id, "")] = strings.Join(strings.Fields(e.Summary), " ")
+	}
+	return abstracts, nil
+}
+
+// prune drops the expired abstracts.
+func (p *paperCach) prune() {
+	now := time.Now()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for k, v := range p.papers {
+		if now.After(v.expiration) {
+			delete(p.papers, k)
+		}
+	}
+}
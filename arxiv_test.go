@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestArxivID(t *testing.T) {
+	tests := map[string]string{
+		"https://arxiv.org/abs/2301.01234":         "2301.01234",
+		"https://arxiv.org/abs/2301.01234v3":       "2301.01234",
+		"https://www.arxiv.org/pdf/2301.01234.pdf": "2301.01234",
+		"https://arxiv.org/pdf/2301.01234v2":       "2301.01234",
+		"https://arxiv.org/abs/hep-th/9901001v1":   "hep-th/9901001",
+		"https://arxiv.org/list/cs.AI/recent":      "",
+		"https://example.com/abs/2301.01234":       "",
+	}
+	for link, want := range tests {
+		if got := arxivID(testStory(1, "Title", link, 1)); got != want {
+			t.Errorf("%s: want %q, got %q", link, want, got)
+		}
+	}
+}
+
+func TestPaperCach_Annotate(t *testing.T) {
+	arxiv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.FormValue("id_list"); got != "2301.01234,hep-th/9901001" {
+			t.Errorf("id_list: want both papers, got %q", got)
+		}
+		w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <entry>
+    <id>http://arxiv.org/abs/2301.01234v2</id>
+    <title>A Paper</title>
+    <summary>  We show that
+  things hold.
+</summary>
+  </entry>
+</feed>`))
+	}))
+	defer arxiv.Close()
+	old := arxivAPI
+	arxivAPI = arxiv.URL
+	defer func() { arxivAPI = old }()
+
+	p := newPaperCach()
+	stories := []item{
+		testStory(1, "A Paper", "https://arxiv.org/pdf/2301.01234v2", 1),
+		testStory(2, "Old", "https://arxiv.org/abs/hep-th/9901001", 1),
+		testStory(3, "Other", "https://example.com/", 1),
+	}
+	p.annotate(stories)
+	// the abstracts are fetched in the background, for the next refresh
+	p.busy.Lock()
+	p.busy.Unlock()
+	p.annotate(stories)
+	for i, want := range []string{"We show that things hold.", "", ""} {
+		if stories[i].Abstract != want {
+			t.Errorf("%s: want %q, got %q", stories[i].Title, want, stories[i].Abstract)
+		}
+	}
+}
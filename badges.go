@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	badgeCachLifeDuration = 24 * time.Hour
+	badgeWorkers          = 8
+	// badgeTimeout bounds the HEAD requests of a refresh, the links that
+	// don't answer in time get no badge until the next one
+	badgeTimeout = 5 * time.Second
+)
+
+// badgeCach holds what kind of file the links of stories point at, found
+// with HEAD requests, so readers know when a link opens a PDF, a video or
+// audio rather than a page.
+type badgeCach struct {
+	badges map[string]badge
+	mutex  sync.Mutex
+	client *http.Client
+}
+
+type badge struct {
+	// kind is pdf, video, audio or empty for anything else
+	kind       string
+	expiration time.Time
+}
+
+func newBadgeCach() *badgeCach {
+	return &badgeCach{badges: make(map[string]badge), client: newReadClient()}
+}
+
+// annotate sets the Badge of the stories, asking the links that aren't
+// cached yet with a bounded number of workers.
+func (b *badgeCach) annotate(stories []item) {
+	var missing []string
+	now := time.Now()
+	b.mutex.Lock()
+	for _, s := range stories {
+		if cached, ok := b.badges[s.URL]; s.URL != "" && (!ok || now.After(cached.expiration)) {
+			missing = append(missing, s.URL)
+		}
+	}
+	b.mutex.Unlock()
+	if len(missing) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), badgeTimeout)
+		defer cancel()
+		b.fetchBadges(ctx, missing)
+		b.prune()
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for i, s := range stories {
+		stories[i].Badge = b.badges[s.URL].kind
+	}
+}
+
+func (b *badgeCach) fetchBadges(ctx context.Context, urls []string) {
+	next := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < badgeWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rawURL := range next {
+				kind, err := b.fetchBadge(ctx, rawURL)
+				// a link that timed out is asked again on the next refresh,
+				// other failures are cached so broken sites aren't retried
+				// on every one
+				if ctx.Err() != nil && err != nil {
+					continue
+				}
+				b.mutex.Lock()
+				b.badges[rawURL] = badge{kind: kind, expiration: time.Now().Add(badgeCachLifeDuration)}
+				b.mutex.Unlock()
+			}
+		}()
+	}
+	for _, rawURL := range urls {
+		next <- rawURL
+	}
+	close(next)
+	wg.Wait()
+}
+
+func (b *badgeCach) fetchBadge(ctx context.Context, rawURL string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil
+	}
+	return badgeKind(resp.Header.Get("Content-Type")), nil
+}
+
+// badgeKind is the badge of a link served with the given Content-Type.
+func badgeKind(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case mediaType == "application/pdf":
+		return "pdf"
+	case strings.HasPrefix(mediaType, "video/"):
+		return "video"
+	case strings.HasPrefix(mediaType, "audio/"):
+		return "audio"
+	}
+	return ""
+}
+
+// prune drops the expired badges.
+func (b *badgeCach) prune() {
+	now := time.Now()
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for k, v := range b.badges {
+		if now.After(v.expiration) {
+			delete(b.badges, k)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBadgeKind(t *testing.T) {
+	tests := map[string]string{
+		"application/pdf":          "pdf",
+		"video/mp4":                "video",
+		"audio/mpeg; charset=utf8": "audio",
+		"text/html; charset=utf-8": "",
+		"":                         "",
+	}
+	for contentType, want := range tests {
+		if got := badgeKind(contentType); got != want {
+			t.Errorf("%q: want %q, got %q", contentType, want, got)
+		}
+	}
+}
+
+func TestBadgeCach_Annotate(t *testing.T) {
+	var heads atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("method: want HEAD, got %s", r.Method)
+		}
+		heads.Add(1)
+		switch r.URL.Path {
+		case "/paper.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+		case "/talk":
+			w.Header().Set("Content-Type", "video/webm")
+		case "/gone":
+			w.Header().Set("Content-Type", "video/webm")
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	b := newBadgeCach()
+	b.client = srv.Client()
+	stories := []item{
+		testStory(1, "Paper", srv.URL+"/paper.pdf", 1),
+		testStory(2, "Talk", srv.URL+"/talk", 1),
+		testStory(3, "Gone", srv.URL+"/gone", 1),
+		testStory(4, "Page", srv.URL+"/", 1),
+		testStory(5, "Ask HN", "", 1),
+	}
+	for range 2 {
+		b.annotate(stories)
+	}
+	for i, want := range []string{"pdf", "video", "", "", ""} {
+		if stories[i].Badge != want {
+			t.Errorf("%s: want %q, got %q", stories[i].Title, want, stories[i].Badge)
+		}
+	}
+	if n := heads.Load(); n != 4 {
+		t.Errorf("requests: want 4, cached after the first refresh, got %d", n)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// sharedCaching sets the headers that let a CDN in front of the instance keep
+// a response for -s_maxage, and serve it stale for -stale_while_revalidate
+// while it fetches it again. keys are the surrogate keys the response can be
+// purged by. Browsers always ask again, and responses personal to the visitor
+// stay out of shared caches.
+func (cfg config) sharedCaching(w http.ResponseWriter, r *http.Request, keys ...string) {
+	if cfg.SMaxAge <= 0 {
+		return
+	}
+	h := w.Header()
+	// the language comes from the browser and the settings from a cookie
+	h.Set("Vary", "Accept-Language, Cookie")
+	_, err := r.Cookie(settingsCookie)
+	_, noSession := r.Cookie(sessionCookie)
+	if err == nil || noSession == nil || cfg.Dev || cfg.Diagnostics {
+		h.Set("Cache-Control", "private, no-cache")
+		return
+	}
+	cc := fmt.Sprintf("public, max-age=0, s-maxage=%d", int(cfg.SMaxAge.Seconds()))
+	if cfg.StaleWhileRevalidate > 0 {
+		cc += fmt.Sprintf(", stale-while-revalidate=%d", int(cfg.StaleWhileRevalidate.Seconds()))
+	}
+	h.Set("Cache-Control", cc)
+	if cfg.SurrogateKeyHeader != "" && len(keys) > 0 {
+		h.Set(cfg.SurrogateKeyHeader, strings.Join(keys, " "))
+	}
+}
+
+// frontPageKeys are the surrogate keys of the front page of a tag, or of the
+// whole front page if tag is empty.
+func frontPageKeys(tag string) []string {
+	if tag == "" {
+		return []string{"front"}
+	}
+	return []string{"front", "tag-" + tag}
+}
+
+// itemKeys are the surrogate keys of the detail page of a story.
+func itemKeys(id int) []string {
+	return []string{"item", "item-" + strconv.Itoa(id)}
+}
+
+// feedKeys are the surrogate keys of the feeds of the front page.
+var feedKeys = []string{"front", "feed"}
+
+// uncached undoes sharedCaching for an error response, which no cache should
+// keep for long.
+func uncached(w http.ResponseWriter) {
+	w.Header().Del("Cache-Control")
+	w.Header().Del("Vary")
+}
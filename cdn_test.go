@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSharedCaching(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    config
+		cookie bool
+		cc     string
+		keys   string
+	}{
+		{"off", config{}, false, "", ""},
+		{"public", config{SMaxAge: time.Minute, StaleWhileRevalidate: time.Hour, SurrogateKeyHeader: "Surrogate-Key"}, false, "public, max-age=0, s-maxage=60, stale-while-revalidate=3600", "front tag-go"},
+		{"no stale", config{SMaxAge: 30 * time.Second}, false, "public, max-age=0, s-maxage=30", ""},
+		{"settings cookie", config{SMaxAge: time.Minute, SurrogateKeyHeader: "Surrogate-Key"}, true, "private, no-cache", ""},
+		{"diagnostics", config{SMaxAge: time.Minute, Diagnostics: true}, false, "private, no-cache", ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/tag/go", nil)
+		if tt.cookie {
+			r.AddCookie(&http.Cookie{Name: settingsCookie, Value: "x"})
+		}
+		rec := httptest.NewRecorder()
+		tt.cfg.sharedCaching(rec, r, frontPageKeys("go")...)
+		if got := rec.Header().Get("Cache-Control"); got != tt.cc {
+			t.Errorf("%s: want Cache-Control %q, got %q", tt.name, tt.cc, got)
+		}
+		if got := rec.Header().Get("Surrogate-Key"); got != tt.keys {
+			t.Errorf("%s: want Surrogate-Key %q, got %q", tt.name, tt.keys, got)
+		}
+		if vary := rec.Header().Get("Vary"); tt.cc != "" && vary != "Accept-Language, Cookie" {
+			t.Errorf("%s: want Vary on the language and cookie, got %q", tt.name, vary)
+		}
+	}
+}
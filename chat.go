@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/neghoda/quiet_hn/i18n"
+)
+
+// chatFormat is how a chat service wants links and text written.
+type chatFormat struct {
+	// link writes a link that the service won't unfurl into a preview
+	link   func(url, text string) string
+	escape func(string) string
+	bold   func(string) string
+	// limit is the longest message the service takes
+	limit int
+}
+
+var (
+	slackFormat = chatFormat{
+		link:   func(url, text string) string { return "<" + url + "|" + text + ">" },
+		escape: strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace,
+		bold:   func(s string) string { return "*" + s + "*" },
+		limit:  40000,
+	}
+	discordFormat = chatFormat{
+		// the angle brackets keep Discord from embedding the link
+		link:   func(url, text string) string { return "[" + text + "](<" + url + ">)" },
+		escape: strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "|", `\|`, "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`).Replace,
+		bold:   func(s string) string { return "**" + s + "**" },
+		limit:  2000,
+	}
+)
+
+// line describes a story on a single line: its linked title, host, points
+// and linked comments.
+func (f chatFormat) line(l *i18n.Locale, s item) string {
+	link := s.URL
+	if link == "" {
+		link = s.CommentsURL()
+	}
+	line := f.link(link, f.escape(s.Title))
+	if s.Host != "" {
+		line += " (" + f.escape(s.Host) + ")"
+	}
+	return line + " · " + l.N("points", s.Score) + " · " + f.link(s.CommentsURL(), l.N("comments", s.Descendants))
+}
+
+// digest describes the stories as a numbered list under a title, leaving
+// out the last ones if they don't fit in a message.
+func (f chatFormat) digest(l *i18n.Locale, title string, stories []item) string {
+	msg := f.bold(f.escape(title))
+	for i, s := range stories {
+		line := fmt.Sprintf("\n%d. %s", i+1, f.line(l, s))
+		if len(msg)+len(line) > f.limit {
+			break
+		}
+		msg += line
+	}
+	return msg
+}
+
+// slackWebhook posts to a Slack incoming webhook.
+type slackWebhook struct {
+	url    string
+	brand  branding
+	locale *i18n.Locale
+}
+
+type slackMessage struct {
+	Text        string `json:"text"`
+	UnfurlLinks bool   `json:"unfurl_links"`
+	UnfurlMedia bool   `json:"unfurl_media"`
+}
+
+func (w slackWebhook) notify(rule string, s item) error {
+	return postJSON(w.url, slackMessage{Text: slackFormat.bold(rule) + " " + slackFormat.line(w.locale, s)})
+}
+
+func (w slackWebhook) sendDigest(stories []item, at time.Time) error {
+	title := w.locale.T("digest_subject", w.brand.Title, at.Format(dateLayout))
+	return postJSON(w.url, slackMessage{Text: slackFormat.digest(w.locale, title, stories)})
+}
+
+// discordWebhook posts to a Discord webhook.
+type discordWebhook struct {
+	url    string
+	brand  branding
+	locale *i18n.Locale
+}
+
+// ping fetches the webhook, which Discord answers with its channel without
+// posting.
+func (d discordWebhook) ping() error { return get(d.url, nil) }
+
+func (d discordWebhook) target() string { return "discord webhook" }
+
+// discordSuppressEmbeds is the message flag that turns off link previews.
+const discordSuppressEmbeds = 1 << 2
+
+type discordMessage struct {
+	Content string `json:"content"`
+	Flags   int    `json:"flags"`
+	// AllowedMentions is empty, so an @everyone in a title pings no one
+	AllowedMentions struct {
+		Parse []string `json:"parse"`
+	} `json:"allowed_mentions"`
+}
+
+func newDiscordMessage(content string) discordMessage {
+	m := discordMessage{Content: content, Flags: discordSuppressEmbeds}
+	m.AllowedMentions.Parse = []string{}
+	return m
+}
+
+func (w discordWebhook) notify(rule string, s item) error {
+	return postJSON(w.url, newDiscordMessage(discordFormat.bold(rule)+" "+discordFormat.line(w.locale, s)))
+}
+
+func (w discordWebhook) sendDigest(stories []item, at time.Time) error {
+	title := w.locale.T("digest_subject", w.brand.Title, at.Format(dateLayout))
+	return postJSON(w.url, newDiscordMessage(discordFormat.digest(w.locale, title, stories)))
+}
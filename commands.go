@@ -0,0 +1,415 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/neghoda/quiet_hn/archive"
+)
+
+// command is a subcommand of quiet_hn, like "quiet_hn export -archive hn.db".
+type command struct {
+	run   func(args []string) error
+	about string
+}
+
+// commands are the subcommands by name. Running quiet_hn without one, or
+// with flags only, serves as it always did.
+var commands = map[string]command{
+	"serve":        {serveCommand, "run the web server, the default"},
+	"top":          {topCommand, "print the quiet front page and exit"},
+	"tui":          {tuiCommand, "browse the quiet front page in the terminal"},
+	"export":       {exportCommand, "write the stories of an archive as JSON lines or CSV"},
+	"import":       {importCommand, "add the stories of a JSON lines export to an archive"},
+	"generate":     {generateCommand, "write the front page, its item pages and feeds as a static site"},
+	"check-config": {checkConfigCommand, "check the flags and -config file of the server and print them"},
+	"loadtest":     {loadtestCommand, "send requests at a steady rate to an instance and report the latencies"},
+	"adduser":      {adduserCommand, "add an account to -accounts, or set its password with -reset"},
+	"version":      {versionCommand, "print the version"},
+}
+
+// usage lists the commands, "quiet_hn <command> -h" shows their flags.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: quiet_hn [command] [flags]")
+	fmt.Fprintln(w)
+	names := slices.Sorted(maps.Keys(commands))
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-14s %s\n", name, commands[name].about)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `run "quiet_hn <command> -h" for the flags of a command`)
+}
+
+// topCommand fetches the front page once, through the same filters as the
+// server, and prints it, for scripts and cron mails.
+func topCommand(args []string) error {
+	fs := flag.NewFlagSet("top", flag.ExitOnError)
+	n := fs.Int("n", 0, "the number of stories to print, -num_stories if 0")
+	format := fs.String("format", "table", "the output format, table, json or md")
+	cfg := parseFlags(fs, args)
+	if *n > 0 {
+		cfg.NumStories = *n
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	write, ok := topFormats[*format]
+	if !ok {
+		return fmt.Errorf("top: unknown format %s, want table, json or md", *format)
+	}
+	f, err := newFilters(cfg)
+	if err != nil {
+		return err
+	}
+	c := newCach(cfg.NumStories, f, cachOptions{})
+	stories, err := c.getTopStories(context.Background(), cfg.defaultView())
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(os.Stdout)
+	if err := write(w, stories); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// topFormats write the stories printed by the top command.
+var topFormats = map[string]func(w io.Writer, stories []item) error{
+	"table": writeTopTable,
+	"json":  writeTopJSON,
+	"md":    writeTopMarkdown,
+}
+
+// topStory is a story in the JSON output of the top command.
+type topStory struct {
+	Rank       int       `json:"rank"`
+	ID         int       `json:"id"`
+	Title      string    `json:"title"`
+	URL        string    `json:"url"`
+	Host       string    `json:"host,omitempty"`
+	By         string    `json:"by"`
+	Score      int       `json:"score"`
+	Comments   int       `json:"comments"`
+	Posted     time.Time `json:"posted"`
+	Discussion string    `json:"discussion_url"`
+}
+
+func writeTopTable(w io.Writer, stories []item) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tPOINTS\tCOMMENTS\tTITLE\tHOST")
+	for i, s := range stories {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%s\t%s\n", i+1, s.Score, s.Descendants, s.Title, s.Host)
+	}
+	return tw.Flush()
+}
+
+func writeTopJSON(w io.Writer, stories []item) error {
+	out := make([]topStory, 0, len(stories))
+	for i, s := range stories {
+		link := s.URL
+		if link == "" {
+			link = s.CommentsURL()
+		}
+		out = append(out, topStory{
+			Rank:       i + 1,
+			ID:         s.ID,
+			Title:      s.Title,
+			URL:        link,
+			Host:       s.Host,
+			By:         s.By,
+			Score:      s.Score,
+			Comments:   s.Descendants,
+			Posted:     s.Posted().UTC(),
+			Discussion: s.CommentsURL(),
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// markdownEscaper keeps titles from turning into markup of their own.
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, "*", `\*`, "_", `\_`, "`", "\\`", "<", `\<`)
+
+func writeTopMarkdown(w io.Writer, stories []item) error {
+	for i, s := range stories {
+		link := s.URL
+		if link == "" {
+			link = s.CommentsURL()
+		}
+		line := fmt.Sprintf("%d. [%s](%s)", i+1, markdownEscaper.Replace(s.Title), link)
+		if s.Host != "" {
+			line += " (" + s.Host + ")"
+		}
+		line += fmt.Sprintf(" - %d points, [%d comments](%s)", s.Score, s.Descendants, s.CommentsURL())
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkConfigCommand validates the flags, the -config file and the files
+// they point to, so a deploy can fail before the server is restarted, and
+// prints the configuration in effect. With -ping the notifiers, digest
+// targets and accounts check their credentials without sending anything.
+func checkConfigCommand(args []string) error {
+	fs := flag.NewFlagSet("check-config", flag.ExitOnError)
+	ping := fs.Bool("ping", false, "also check the credentials of the notifiers, digest targets and accounts")
+	quiet := fs.Bool("q", false, "don't print the configuration")
+	own := make(map[string]bool)
+	fs.VisitAll(func(f *flag.Flag) { own[f.Name] = true })
+	cfg := parseFlags(fs, args)
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	if cfg.TemplatesDir != "" {
+		info, err := os.Stat(cfg.TemplatesDir)
+		if err != nil {
+			return fmt.Errorf("templates_dir: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("templates_dir: %s is not a directory", cfg.TemplatesDir)
+		}
+	}
+	if _, err := loadTemplates(cfg.TemplatesDir, false); err != nil {
+		return err
+	}
+	if _, err := newFilters(cfg); err != nil {
+		return err
+	}
+	if _, err := cfg.robotsTxt(); err != nil {
+		return fmt.Errorf("robots_file: %w", err)
+	}
+	if _, err := loadIcons(cfg.IconsDir); err != nil {
+		return err
+	}
+	if cfg.TagRules != "" {
+		if _, err := newTagger(cfg.TagRules); err != nil {
+			return err
+		}
+	}
+	if _, err := newOrder(cfg); err != nil {
+		return err
+	}
+	if cfg.DailyAt != "" {
+		if _, err := newDaily(cfg.DailyAt, cfg.DailyStories); err != nil {
+			return err
+		}
+	}
+	var targets []any
+	if cfg.WatchRules != "" {
+		w, err := newWatcher(cfg)
+		if err != nil {
+			return err
+		}
+		for _, r := range w.rules {
+			for _, n := range r.notifiers {
+				targets = append(targets, n)
+			}
+		}
+	}
+	if cfg.DigestSchedule != "" {
+		for _, t := range cfg.digestTargets() {
+			targets = append(targets, t)
+		}
+	}
+	if cfg.MastodonServer != "" || cfg.BlueskyHandle != "" {
+		p, err := newPoster(cfg)
+		if err != nil {
+			return err
+		}
+		for _, a := range p.accounts {
+			targets = append(targets, a)
+		}
+	}
+
+	if !*quiet {
+		printConfig(os.Stdout, fs, own)
+	}
+	if *ping {
+		pinged, failed := make(map[string]bool), 0
+		for _, t := range targets {
+			p, ok := t.(pinger)
+			if !ok || pinged[p.target()] {
+				continue
+			}
+			pinged[p.target()] = true
+			if err := p.ping(); err != nil {
+				failed++
+				fmt.Printf("FAIL %s: %s\n", p.target(), err)
+				continue
+			}
+			fmt.Printf("ok   %s\n", p.target())
+		}
+		if failed > 0 {
+			return fmt.Errorf("check-config: %d of %d pings failed", failed, len(pinged))
+		}
+	}
+	fmt.Println("config ok")
+	return nil
+}
+
+// secretFlag matches the names of the flags whose values are not printed.
+var secretFlag = regexp.MustCompile(`token|password|secret`)
+
+// printConfig writes the value of every flag of fs but the skipped ones, in
+// the format of a -config file, with secrets masked.
+func printConfig(w io.Writer, fs *flag.FlagSet, skip map[string]bool) {
+	fs.VisitAll(func(f *flag.Flag) {
+		if skip[f.Name] || f.Name == "config" {
+			return
+		}
+		value := f.Value.String()
+		if value != "" && secretFlag.MatchString(f.Name) {
+			value = "********"
+		}
+		fmt.Fprintf(w, "%s = %s\n", f.Name, strconv.Quote(value))
+	})
+}
+
+// versionCommand prints the version quiet_hn was built as, with -json the
+// build info served at /version.
+func versionCommand(args []string) error {
+	fs := flag.NewFlagSet("version", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print the build info as JSON")
+	fs.Parse(args)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(build())
+	}
+	printVersion()
+	return nil
+}
+
+func printVersion() {
+	b := build()
+	fmt.Println("quiet_hn", version())
+	if b.Date != "" {
+		fmt.Println("built", b.Date, "with", b.Go)
+	} else {
+		fmt.Println("built with", b.Go)
+	}
+}
+
+// exportCommand writes the stories of an archive to stdout or a file, as
+// JSON lines with their snapshots and text, or as CSV without these.
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	path := fs.String("archive", "", "the SQLite archive to export")
+	since := fs.String("since", "", "only export the stories seen on or after this day, like 2024-01-01")
+	format := fs.String("format", "jsonl", "the output format, jsonl or csv")
+	out := fs.String("o", "", "the file to write to (defaults to stdout)")
+	fs.Parse(args)
+	if *path == "" {
+		return errors.New("export: -archive is required")
+	}
+	var from time.Time
+	if *since != "" {
+		var err error
+		if from, err = time.ParseInLocation(dateLayout, *since, time.Local); err != nil {
+			return fmt.Errorf("export: -since must be a day like 2024-01-01")
+		}
+	}
+	a, err := archive.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	var write func(archive.Entry) error
+	var flush func() error
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	buf := bufio.NewWriter(w)
+	switch *format {
+	case "jsonl":
+		enc := json.NewEncoder(buf)
+		write = func(e archive.Entry) error { return enc.Encode(e) }
+		flush = buf.Flush
+	case "csv":
+		cw := csv.NewWriter(buf)
+		cw.Write([]string{"id", "type", "title", "url", "by", "posted", "score", "comments", "first_seen", "last_seen"})
+		write = func(e archive.Entry) error {
+			return cw.Write([]string{strconv.Itoa(e.ID), e.Type, e.Title, e.URL, e.By, e.Posted.UTC().Format(time.RFC3339),
+				strconv.Itoa(e.Score), strconv.Itoa(e.Comments), e.FirstSeen.UTC().Format(time.RFC3339), e.LastSeen.UTC().Format(time.RFC3339)})
+		}
+		flush = func() error {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+			return buf.Flush()
+		}
+	default:
+		return fmt.Errorf("export: unknown format %s, want jsonl or csv", *format)
+	}
+	if err := a.Export(from, write); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// importCommand adds the stories of a JSON lines export, read from the
+// files given or stdin, to an archive.
+func importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	path := fs.String("archive", "", "the SQLite archive to import into, created if needed")
+	fs.Parse(args)
+	if *path == "" {
+		return errors.New("import: -archive is required")
+	}
+	a, err := archive.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	for _, name := range files {
+		n, err := importFile(a, name)
+		if err != nil {
+			return fmt.Errorf("import %s: %w", name, err)
+		}
+		fmt.Fprintf(os.Stderr, "imported %d stories from %s\n", n, name)
+	}
+	return nil
+}
+
+// importFile imports a JSON Lines export, from stdin for "-".
+func importFile(a *archive.Store, name string) (int, error) {
+	r := io.Reader(os.Stdin)
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		r = f
+	}
+	dec := json.NewDecoder(bufio.NewReader(r))
+	return a.Import(func(e *archive.Entry) error { return dec.Decode(e) })
+}
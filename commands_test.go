@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTopFormats(t *testing.T) {
+	stories := []item{
+		testStory(1, "Show HN: [beta] *fast*", "https://www.example.com/a", 120),
+		testStory(2, "Ask HN: Why?", "", 40),
+	}
+	stories[0].Descendants = 7
+
+	var b bytes.Buffer
+	if err := writeTopTable(&b, stories); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("table: want 3 lines, got %q", lines)
+	}
+	if want := "1  120     7         Show HN: [beta] *fast*  example.com"; lines[1] != want {
+		t.Errorf("table: want %q, got %q", want, lines[1])
+	}
+
+	b.Reset()
+	if err := writeTopJSON(&b, stories); err != nil {
+		t.Fatal(err)
+	}
+	var got []topStory
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[1].Rank != 2 || got[1].URL != discussionURL(2) || got[0].Comments != 7 {
+		t.Errorf("json: got %+v", got)
+	}
+
+	b.Reset()
+	if err := writeTopMarkdown(&b, stories); err != nil {
+		t.Fatal(err)
+	}
+	want := "1. [Show HN: \\[beta\\] \\*fast\\*](https://www.example.com/a) (example.com) - 120 points, [7 comments](" + discussionURL(1) + ")\n" +
+		"2. [Ask HN: Why?](" + discussionURL(2) + ") - 40 points, [0 comments](" + discussionURL(2) + ")\n"
+	if b.String() != want {
+		t.Errorf("md: want %q, got %q", want, b.String())
+	}
+}
+
+func TestCheckConfigCommand_Ping(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		if r.URL.Path == "/xrpc/com.atproto.server.createSession" || r.Header.Get("Authorization") != "Bearer good" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, "{}")
+	}))
+	defer server.Close()
+
+	err := checkConfigCommand([]string{"-q", "-ping",
+		"-mastodon_server", server.URL, "-mastodon_token", "good",
+		"-bluesky_server", server.URL, "-bluesky_handle", "me.bsky.social", "-bluesky_password", "wrong"})
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 pings failed") {
+		t.Errorf("want 1 of 2 pings failed, got %v", err)
+	}
+	want := []string{"GET /api/v1/accounts/verify_credentials", "POST /xrpc/com.atproto.server.createSession"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("requests: want %q, got %q", want, paths)
+	}
+}
@@ -0,0 +1,701 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"maps"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neghoda/quiet_hn/accounts"
+	"github.com/neghoda/quiet_hn/archive"
+	"github.com/neghoda/quiet_hn/cron"
+	"github.com/neghoda/quiet_hn/i18n"
+)
+
+// minRefresh is the shortest auto-refresh interval in seconds, anything lower
+// would only hammer the server with requests the cache answers anyway.
+const minRefresh = 10
+
+// cssColor matches the accent colors we accept: hex notations and keywords.
+var cssColor = regexp.MustCompile(`^(#([0-9a-fA-F]{3,4}|[0-9a-fA-F]{6}|[0-9a-fA-F]{8})|[a-zA-Z]+)$`)
+
+// config holds the settings of an instance.
+type config struct {
+	ConfigFile   string
+	Port         int
+	Mode         string
+	DebugAddr    string
+	DebugToken   string
+	DebugLog     bool
+	NumStories   int
+	ReadMaxBytes int64
+	Previews     bool
+	Badges       bool
+	GitHubRepos  bool
+	Arxiv        bool
+	CheckLinks   time.Duration
+	Hiring       bool
+	ShowGallery  bool
+	GitHubToken  string
+	NewTab       bool
+	OutLinks     bool
+	RewriteLinks string
+	HostLabels   string
+	Refresh      int
+	Lang         string
+	TZ           string
+	SiteTitle    string
+	HeaderText   string
+	FooterHTML   string
+	AccentColor  string
+	TemplatesDir string
+	IconsDir     string
+	Dev          bool
+	PublicURL    string
+	Description  string
+	ShareImage   string
+	Robots       string
+	RobotsFile   string
+	Diagnostics  bool
+	CookieSecret string
+	// AdminPassword opens the /admin dashboard, which is off without it
+	AdminPassword string
+	// Accounts is the database of the accounts visitors log in to, Signup
+	// lets visitors make their own
+	Accounts   string
+	Signup     bool
+	SessionTTL time.Duration
+	// GitHub and OIDC logins, OAuthAllow lists who gets an account without
+	// -signup
+	GitHubClientID     string
+	GitHubClientSecret string
+	OIDCIssuer         string
+	OIDCClientID       string
+	OIDCClientSecret   string
+	OIDCLabel          string
+	OAuthAllow         string
+
+	// Sources are where stories come from, the first of them fills the
+	// front page
+	Sources    string
+	Merge      string
+	Subreddits string
+
+	BlockDomains     string
+	BlockDomainsFile string
+	Mute             string
+	MuteFile         string
+	BlockUsers       string
+	BlockUsersFile   string
+	MinKarma         int
+	MinScore         int
+	MinComments      int
+	IncludeTextPosts bool
+	ShowJobs         bool
+	MaxAge           time.Duration
+	TagRules         string
+	Rank             string
+	DailyAt          string
+	DailyStories     int
+	DomainReputation string
+
+	Archive       string
+	SnapshotEvery time.Duration
+	RepostWindow  time.Duration
+	HideReposts   bool
+	GroupHosts    bool
+	IndexText     bool
+	ClickStats    bool
+	Retention     time.Duration
+	VacuumEvery   time.Duration
+
+	// SummarizeURL or SummarizeCommand is the summarizer of the articles
+	SummarizeURL     string
+	SummarizeToken   string
+	SummarizeModel   string
+	SummarizeCommand string
+	// TranslateURL or TranslateCommand translates the titles into
+	// TranslateTo
+	TranslateTo      string
+	TranslateURL     string
+	TranslateToken   string
+	TranslateCommand string
+
+	SMTPAddr       string
+	SMTPUser       string
+	SMTPPassword   string
+	DigestSchedule string
+	// RefreshSchedule and PruneSchedule are the cron schedules of the
+	// background jobs
+	RefreshSchedule string
+	PruneSchedule   string
+	// CacheTTL is how long a refresh is served before a request refreshes
+	// the cache itself, IdleAfter and IdleRefresh slow background refreshes
+	// down while there are no requests
+	CacheTTL    time.Duration
+	IdleAfter   time.Duration
+	IdleRefresh time.Duration
+	// CountsEvery is how often the points and comments of the stories on
+	// the front page are brought up to date between refreshes
+	CountsEvery time.Duration
+	// Snapshot is a file keeping the stories of the last refresh, for a
+	// start to serve right away
+	Snapshot string
+	// RequestTimeout is how long a request may wait on the HN API
+	RequestTimeout time.Duration
+	// StaleAfter is how long after the last refresh that succeeded
+	// /healthz fails, 0 if it never does, it doesn't while IdleAfter holds
+	// the refreshes off
+	StaleAfter time.Duration
+	// ShedLatency and ShedMaxInterval tune the back off from a degraded HN
+	// API
+	ShedLatency     time.Duration
+	ShedMaxInterval time.Duration
+	// BreakerErrorRate, BreakerLatency and BreakerCooldown tune the circuit
+	// breaker around the HN API
+	BreakerErrorRate float64
+	BreakerLatency   time.Duration
+	BreakerCooldown  time.Duration
+	// SMaxAge, StaleWhileRevalidate and SurrogateKeyHeader are for a CDN in
+	// front of the instance
+	SMaxAge              time.Duration
+	StaleWhileRevalidate time.Duration
+	SurrogateKeyHeader   string
+	DigestTo             string
+	DigestFrom           string
+	DigestStories        int
+
+	DigestSlack   string
+	DigestDiscord string
+	DigestMatrix  string
+
+	WatchRules   string
+	WatchWebhook string
+	WatchSlack   string
+	WatchDiscord string
+	WatchMatrix  string
+
+	MatrixHomeserver string
+	MatrixToken      string
+
+	WatchNtfy     string
+	NtfyToken     string
+	WatchPushover string
+	PushoverToken string
+
+	PostMinScore    int
+	PostEvery       time.Duration
+	PostTemplate    string
+	PostState       string
+	MastodonServer  string
+	MastodonToken   string
+	BlueskyServer   string
+	BlueskyHandle   string
+	BlueskyPassword string
+
+	// static is set when the pages are rendered to files by the generate
+	// command, which leaves out what only works against a server
+	static bool
+	// accounts is opened from Accounts by the server, oauth are the
+	// providers visitors can log in with instead
+	accounts *accounts.Store
+	oauth    []*oauthProvider
+}
+
+// branding is what the templates need to render an instance under its own
+// name.
+type branding struct {
+	Title  string
+	Header string
+	// Footer replaces the default footer when set. It comes from the operator,
+	// so it is trusted markup.
+	Footer template.HTML
+	Accent string
+	// URL is the base URL of the instance without a trailing slash, used for
+	// feeds and share metadata.
+	URL         string
+	Description string
+	Image       string
+}
+
+// parseFlags adds the settings of the server to fs, next to the flags of
+// the command it belongs to, and parses args.
+func parseFlags(fs *flag.FlagSet, args []string) config {
+	var cfg config
+	fs.StringVar(&cfg.ConfigFile, "config", "", "a file of flag values, one \"name = value\" a line, the command line overrides")
+	fs.IntVar(&cfg.Port, "port", 3000, "the port to start the web server on (defaults to $PORT if set)")
+	fs.StringVar(&cfg.DebugAddr, "debug_addr", "", "an address like localhost:6060 to serve /debug/pprof and /debug/vars on, apart from the site (disabled if empty)")
+	fs.StringVar(&cfg.DebugToken, "debug_token", "", "with -debug_addr, a bearer token the debug endpoints ask for, to serve them on a public address (defaults to $DEBUG_TOKEN)")
+	fs.BoolVar(&cfg.DebugLog, "debug_log", false, "log debug messages too, like the duration, items and retries of every refresh")
+	fs.StringVar(&cfg.Mode, "mode", "http", "how requests come in: http on -port, fcgi for FastCGI on -port or on stdin with -port 0, cgi for the one request of a CGI process, or lambda for AWS Lambda function URLs and HTTP APIs")
+	fs.IntVar(&cfg.NumStories, "num_stories", 30, "the number of top stories to display")
+	fs.Int64Var(&cfg.ReadMaxBytes, "read_max_bytes", 2<<20, "the maximum number of bytes read from an article in reader mode")
+	fs.BoolVar(&cfg.Previews, "previews", false, "fetch Open Graph previews of story links for the cards view")
+	fs.BoolVar(&cfg.GitHubRepos, "github_repos", false, "show the stars, language and description of the GitHub repositories stories link to, from the GitHub API")
+	fs.StringVar(&cfg.GitHubToken, "github_token", "", "with -github_repos, a GitHub token for a higher rate limit of the API, it needs no scopes (defaults to $GITHUB_TOKEN)")
+	fs.BoolVar(&cfg.Arxiv, "arxiv", false, "fetch the abstracts of the arXiv papers stories link to, which the front page and the detail pages can expand")
+	fs.DurationVar(&cfg.CheckLinks, "check_links", 0, "check the story links for 404 and 410 at most this often, like 6h, badging the ones that are gone and linking them to their copy on the Wayback Machine (0 disables it)")
+	fs.BoolVar(&cfg.ShowGallery, "show_gallery", false, "show the Show HN stories as cards with the images of their link previews at /show/gallery, the images proxied and cached like those of -previews")
+	fs.BoolVar(&cfg.Hiring, "hiring", false, "fetch the postings of the monthly Ask HN: Who is hiring? thread every hour, to browse them at /hiring by remote, keyword and location and follow the new ones at /hiring/rss")
+	fs.BoolVar(&cfg.Badges, "badges", false, "ask the story links for their Content-Type with HEAD requests on refresh, and badge the ones that open a PDF, a video or audio")
+	fs.BoolVar(&cfg.NewTab, "new_tab", false, "open the links and discussions of stories in a new tab, with rel=\"noopener noreferrer\" so the site can't see or script the front page")
+	fs.BoolVar(&cfg.OutLinks, "out_links", false, "link stories through /out/{id}, which redirects to them without telling the site the page they were found on")
+	fs.StringVar(&cfg.HostLabels, "host_labels", defaultHostLabels, "the sites of many tenants, comma separated, whose stories are labeled with the tenant: *.domain for the subdomain under the domain, like user.github.io, domain/* for the first path segment, like medium.com/@user")
+	fs.StringVar(&cfg.RewriteLinks, "rewrite_links", "", "domain=frontend pairs, comma separated, sending the story links of a site to a privacy-respecting frontend, like youtube.com=yewtu.be,twitter.com=nitter.net,reddit.com=redlib.example.org")
+	fs.IntVar(&cfg.Refresh, "refresh", 0, "reload the front page every N seconds, 0 disables it (overridden by ?refresh=N)")
+	fs.StringVar(&cfg.TZ, "tz", "", "the IANA time zone, like Europe/Berlin, that times are shown in for visitors who picked none in the settings (the one of the server if empty)")
+	fs.StringVar(&cfg.Lang, "lang", i18n.Default, "the interface language used when the browser asks for none of the bundled ones ("+strings.Join(i18n.Tags(), ", ")+")")
+	fs.StringVar(&cfg.SiteTitle, "site_title", "Quiet Hacker News", "the title of the site shown in the browser tab")
+	fs.StringVar(&cfg.HeaderText, "header_text", "", "the heading at the top of the front page (defaults to the site title)")
+	fs.StringVar(&cfg.FooterHTML, "footer_html", "", "an HTML snippet that replaces the default footer text")
+	fs.StringVar(&cfg.AccentColor, "accent_color", "", "the CSS color used for headings and focus outlines (defaults to the text color)")
+	fs.StringVar(&cfg.TemplatesDir, "templates_dir", "", "a directory of .gohtml files overriding the built-in templates")
+	fs.StringVar(&cfg.IconsDir, "icons_dir", "", "a directory with a favicon.ico, favicon.svg or apple-touch-icon.png overriding the built-in icons")
+	fs.BoolVar(&cfg.Dev, "dev", false, "development mode: re-parse templates on every request and show template errors in the browser")
+	fs.StringVar(&cfg.PublicURL, "public_url", "", "the public base URL of the instance, like https://hn.example.com (defaults to the host of each request)")
+	fs.StringVar(&cfg.Description, "site_description", "A quiet version of the Hacker News front page.", "the description used in feeds and link previews")
+	fs.StringVar(&cfg.ShareImage, "share_image", "", "the URL of an image shown in link previews of the instance")
+	fs.StringVar(&cfg.Robots, "robots", "index", "whether search engines may index the instance: index, or noindex for a personal instance, whose robots.txt disallows everything and whose responses carry X-Robots-Tag: noindex")
+	fs.StringVar(&cfg.RobotsFile, "robots_file", "", "a robots.txt file served instead of the one -robots makes")
+	fs.BoolVar(&cfg.Diagnostics, "diagnostics", false, "show cache and fetch diagnostics in the footer of the front page")
+	fs.StringVar(&cfg.AdminPassword, "admin_password", "", "the password of the /admin status dashboard and the /debug/cache dump, asked for with HTTP basic auth (defaults to $ADMIN_PASSWORD, the dashboard is off if empty)")
+	fs.StringVar(&cfg.CookieSecret, "cookie_secret", "", "the key used to sign the settings cookie of visitors (defaults to a random key, so settings are lost on restart)")
+	fs.StringVar(&cfg.Accounts, "accounts", "", "a SQLite database file of accounts, so the settings, bookmarks and read stories of visitors who log in follow them across devices (disabled if empty, add accounts with quiet_hn adduser)")
+	fs.BoolVar(&cfg.Signup, "signup", false, "with -accounts, let visitors make their own account at /signup")
+	fs.DurationVar(&cfg.SessionTTL, "session_ttl", accounts.DefaultSessionTTL, "with -accounts, how long a login lasts")
+	fs.StringVar(&cfg.GitHubClientID, "github_client_id", "", "with -accounts, the client id of a GitHub OAuth app to log in with, its callback URL is <public URL>/login/github/callback")
+	fs.StringVar(&cfg.GitHubClientSecret, "github_client_secret", "", "the client secret of -github_client_id (defaults to $GITHUB_CLIENT_SECRET)")
+	fs.StringVar(&cfg.OIDCIssuer, "oidc_issuer", "", "with -accounts, the URL of an OpenID Connect provider to log in with, like https://accounts.google.com, the redirect URI is <public URL>/login/oidc/callback")
+	fs.StringVar(&cfg.OIDCClientID, "oidc_client_id", "", "the client id of the instance at -oidc_issuer")
+	fs.StringVar(&cfg.OIDCClientSecret, "oidc_client_secret", "", "the client secret of -oidc_client_id (defaults to $OIDC_CLIENT_SECRET)")
+	fs.StringVar(&cfg.OIDCLabel, "oidc_label", "single sign-on", "the name of -oidc_issuer on the login page")
+	fs.StringVar(&cfg.OAuthAllow, "oauth_allow", "", "a comma separated list of the GitHub users, OIDC usernames or emails and @email.domains whose first login makes them an account, without -signup")
+	fs.StringVar(&cfg.BlockDomains, "block_domains", "", "a comma separated list of domains whose stories are never shown, subdomains included")
+	fs.StringVar(&cfg.BlockDomainsFile, "block_domains_file", "", "a file with one blocked domain per line, # starts a comment line, reloaded when it changes")
+	fs.StringVar(&cfg.Sources, "sources", "hn", "a comma separated list of story sources out of "+strings.Join(sourceKindNames(), ", ")+", the first one is the front page and each one is at /NAME and /?source=NAME")
+	fs.StringVar(&cfg.Subreddits, "subreddits", "programming", "a comma separated list of the subreddits the reddit source of -sources shows the hot posts of")
+	fs.StringVar(&cfg.Merge, "merge", "round-robin", "how the front page of all sources at /all mixes them: "+strings.Join(mergeStrategies, " or "))
+	fs.StringVar(&cfg.Mute, "mute", "", "a comma separated list of title keywords whose stories are never shown")
+	fs.StringVar(&cfg.MuteFile, "mute_file", "", "a file with one muted title keyword or /regexp/ per line, reloaded when it changes")
+	fs.StringVar(&cfg.BlockUsers, "block_users", "", "a comma separated list of HN users whose submissions are never shown")
+	fs.StringVar(&cfg.BlockUsersFile, "block_users_file", "", "a file with one blocked HN user per line, # starts a comment line, reloaded when it changes")
+	fs.IntVar(&cfg.MinKarma, "min_karma", 0, "hide stories submitted by users with less karma")
+	fs.IntVar(&cfg.MinScore, "min_score", 0, "hide stories with fewer points")
+	fs.IntVar(&cfg.MinComments, "min_comments", 0, "hide stories with fewer comments")
+	fs.BoolVar(&cfg.IncludeTextPosts, "include_text_posts", false, "show text posts like Ask HN, linked to their detail page (overridden by ?text_posts=)")
+	fs.BoolVar(&cfg.ShowJobs, "show_jobs", false, "show YC job ads on the front page where HN has them, and list them all at /jobs")
+	fs.DurationVar(&cfg.MaxAge, "max_age", 0, "hide stories submitted longer ago than this, like 24h (0 shows all)")
+	fs.StringVar(&cfg.TagRules, "tag_rules", "", "a file of topic tagging rules, one tag and title keyword, /regexp/ or site:domain per line")
+	fs.StringVar(&cfg.Rank, "rank", "", "a formula ordering the front page, highest first, over "+strings.Join(rankingVars, ", ")+", like (score-1)/(age+2)^1.8 (empty keeps the HN order)")
+	fs.StringVar(&cfg.DomainReputation, "domain_reputation", "", "a file with a domain and a weight per line, the reputation variable of -rank")
+	fs.StringVar(&cfg.DailyAt, "daily_at", "", "freeze the front page to one snapshot a day, taken at this local time like 07:30 (disabled if empty)")
+	fs.IntVar(&cfg.DailyStories, "daily_stories", 10, "the number of stories in the daily snapshot of -daily_at")
+	fs.StringVar(&cfg.Archive, "archive", "", "a SQLite database file to keep a record of the stories and their scores in (disabled if empty)")
+	fs.DurationVar(&cfg.SnapshotEvery, "snapshot_every", archive.DefaultSnapshotEvery, "with -archive, how often to record the score and comments of the stories")
+	fs.DurationVar(&cfg.RepostWindow, "repost_window", 30*24*time.Hour, "with -archive, mark stories that were on the front page under another ID within this time")
+	fs.BoolVar(&cfg.GroupHosts, "group_hosts", false, "fold the front page stories that follow one of the same site under it, with a control to expand them (overridden by ?group_hosts=)")
+	fs.BoolVar(&cfg.HideReposts, "hide_reposts", false, "with -archive, hide the stories marked as reposts instead")
+	fs.BoolVar(&cfg.ClickStats, "click_stats", false, "with -archive, count the clicks on the links of the front page stories, by story and day and without anything about who clicked, and show the most clicked of the week at /top/clicked; implies -out_links")
+	fs.StringVar(&cfg.SummarizeURL, "summarize_url", "", "with -archive, the base URL of an OpenAI-compatible API, like https://api.openai.com/v1 or http://localhost:11434/v1, whose model summarizes the articles of new stories in two sentences shown under their title")
+	fs.StringVar(&cfg.SummarizeToken, "summarize_token", "", "the API key of -summarize_url (defaults to $SUMMARIZE_TOKEN)")
+	fs.StringVar(&cfg.SummarizeModel, "summarize_model", "gpt-4o-mini", "the model of -summarize_url")
+	fs.StringVar(&cfg.SummarizeCommand, "summarize_command", "", "with -archive, a local command that summarizes the articles of new stories instead of -summarize_url, it gets the title and the text on stdin and prints the summary")
+	fs.StringVar(&cfg.TranslateTo, "translate_to", "", "the language code, like de or uk, to translate the titles of stories into with -translate_url or -translate_command, shown under the original (disabled if empty)")
+	fs.StringVar(&cfg.TranslateURL, "translate_url", "", "the base URL of a LibreTranslate API, like https://libretranslate.com or http://localhost:5000, that translates the titles")
+	fs.StringVar(&cfg.TranslateToken, "translate_token", "", "the API key of -translate_url, if it needs one (defaults to $TRANSLATE_TOKEN)")
+	fs.StringVar(&cfg.TranslateCommand, "translate_command", "", "a local command that translates the titles instead of -translate_url, it gets them on stdin one per line and the language in $TRANSLATE_TO, and prints their translations the same way")
+	fs.DurationVar(&cfg.Retention, "retention", 0, "with -archive, delete stories and snapshots older than this, like 4320h for 180 days (0 keeps everything)")
+	fs.DurationVar(&cfg.VacuumEvery, "vacuum_every", 7*24*time.Hour, "with -archive, the least time between two compactions of the database file, which only happen once -retention pruned something (0 never compacts)")
+	fs.BoolVar(&cfg.IndexText, "index_text", false, "with -archive, fetch the articles of new stories so /archive/search finds them by their text too")
+	fs.StringVar(&cfg.SMTPAddr, "smtp_addr", "localhost:25", "the host:port of the SMTP server digests are sent through")
+	fs.StringVar(&cfg.SMTPUser, "smtp_user", "", "the user to log in to the SMTP server as (no login if empty)")
+	fs.StringVar(&cfg.SMTPPassword, "smtp_password", "", "the password of -smtp_user (defaults to $SMTP_PASSWORD)")
+	fs.StringVar(&cfg.DigestSchedule, "digest_schedule", "", "a cron expression for when to email the top stories, like \"30 7 * * *\" (disabled if empty)")
+	fs.StringVar(&cfg.DigestTo, "digest_to", "", "a comma separated list of addresses the digest is sent to")
+	fs.StringVar(&cfg.DigestFrom, "digest_from", "", "the sender address of the digest")
+	fs.IntVar(&cfg.DigestStories, "digest_stories", 10, "the number of stories in the digest")
+	fs.StringVar(&cfg.WatchRules, "watch_rules", "", "a JSON file of watch rules, each with a name and the keywords, domains and min_score of the stories to notify about and list in the feed at /rss/rule/{name}, which starts empty on every restart unless -archive is set")
+	fs.StringVar(&cfg.WatchWebhook, "watch_webhook", "", "the URL the stories matching a watch rule are POSTed to as JSON, unless the rule has its own webhook")
+	fs.StringVar(&cfg.WatchSlack, "watch_slack", "", "a Slack incoming webhook URL the stories matching a watch rule are posted to, unless the rule has its own")
+	fs.StringVar(&cfg.WatchDiscord, "watch_discord", "", "a Discord webhook URL the stories matching a watch rule are posted to, unless the rule has its own")
+	fs.StringVar(&cfg.DigestSlack, "digest_slack", "", "a Slack incoming webhook URL the digest of -digest_schedule is posted to")
+	fs.StringVar(&cfg.DigestDiscord, "digest_discord", "", "a Discord webhook URL the digest of -digest_schedule is posted to")
+	fs.StringVar(&cfg.MatrixHomeserver, "matrix_homeserver", "", "the URL of the Matrix homeserver of -matrix_token, like https://matrix.org")
+	fs.StringVar(&cfg.MatrixToken, "matrix_token", "", "the access token of the Matrix user that sends to the rooms, which it must have joined (defaults to $MATRIX_TOKEN)")
+	fs.StringVar(&cfg.WatchMatrix, "watch_matrix", "", "the id of a Matrix room the stories matching a watch rule are sent to, like !abc:matrix.org, unless the rule has its own")
+	fs.StringVar(&cfg.DigestMatrix, "digest_matrix", "", "the id of a Matrix room the digest of -digest_schedule is sent to")
+	fs.StringVar(&cfg.WatchNtfy, "watch_ntfy", "", "an ntfy topic, or the URL of a topic on another server than ntfy.sh, the stories matching a watch rule are pushed to, unless the rule has its own")
+	fs.StringVar(&cfg.NtfyToken, "ntfy_token", "", "an access token for the ntfy topics (defaults to $NTFY_TOKEN)")
+	fs.StringVar(&cfg.WatchPushover, "watch_pushover", "", "a Pushover user or group key the stories matching a watch rule are pushed to, unless the rule has its own")
+	fs.StringVar(&cfg.PushoverToken, "pushover_token", "", "the API token of the Pushover application (defaults to $PUSHOVER_TOKEN)")
+	fs.IntVar(&cfg.PostMinScore, "post_min_score", 100, "the points a front page story needs to be posted to -mastodon_server or -bluesky_handle")
+	fs.DurationVar(&cfg.PostEvery, "post_every", 30*time.Minute, "the least time between two posted stories")
+	fs.StringVar(&cfg.PostTemplate, "post_template", defaultPostTemplate, "the text/template of posts, with the .Title, .Link, .Host, .Points, .Comments and .Discussion of the story")
+	fs.StringVar(&cfg.PostState, "post_state", "", "the file the ids of posted stories are kept in, so they are not posted again after a restart")
+	fs.StringVar(&cfg.MastodonServer, "mastodon_server", "", "the URL of the Mastodon server of the account stories are posted to")
+	fs.StringVar(&cfg.MastodonToken, "mastodon_token", "", "an access token of the Mastodon account, with the write:statuses scope (defaults to $MASTODON_TOKEN)")
+	fs.StringVar(&cfg.BlueskyServer, "bluesky_server", "https://bsky.social", "the URL of the PDS of -bluesky_handle")
+	fs.StringVar(&cfg.BlueskyHandle, "bluesky_handle", "", "the handle of the Bluesky account stories are posted to")
+	fs.StringVar(&cfg.BlueskyPassword, "bluesky_password", "", "an app password of -bluesky_handle (defaults to $BLUESKY_PASSWORD)")
+	fs.StringVar(&cfg.RefreshSchedule, "refresh_schedule", "@every "+(cachLifeDuration/2).String(), "the cron schedule the cache is refreshed on in the background, or @every and a duration")
+	fs.DurationVar(&cfg.CountsEvery, "counts_every", 0, "how often the points and comments of the HN stories on the front page are brought up to date from the recent updates of the HN API, without fetching the top stories again, worth it with a long -refresh_schedule (0 disables it)")
+	fs.DurationVar(&cfg.CacheTTL, "cache_ttl", cachLifeDuration, "how long the stories of a refresh are served before a request waits for fresh ones, when -refresh_schedule didn't refresh them in time")
+	fs.StringVar(&cfg.Snapshot, "snapshot", "", "a file to keep the stories of the last refresh in, which fill the front page right after a start if they are less than "+snapshotMaxAge.String()+" old, for platforms that start instances on demand (disabled if empty)")
+	fs.DurationVar(&cfg.RequestTimeout, "request_timeout", 5*time.Second, "how long a request waits for the HN API before it gets a timeout page, when there are no stories to serve yet (0 waits as long as it takes)")
+	fs.DurationVar(&cfg.StaleAfter, "stale_after", 0, "how long after the last refresh that succeeded /healthz answers 503, so a load balancer takes an instance that can't reach the HN API out, not while -idle_after puts the refreshes off (0 keeps it healthy)")
+	fs.DurationVar(&cfg.IdleAfter, "idle_after", 0, "put background refreshes off after no requests for this long, like 30m, which pauses watch rules, posting and archive snapshots too (0 disables it)")
+	fs.DurationVar(&cfg.IdleRefresh, "idle_refresh", 0, "with -idle_after, how often the cache is still refreshed while idle (0 waits for the next request)")
+	fs.DurationVar(&cfg.ShedLatency, "shed_latency", 5*time.Second, "back off from the HN API while refreshes take longer than this or lose items, 0 disables it")
+	fs.DurationVar(&cfg.ShedMaxInterval, "shed_max_interval", 5*time.Minute, "with -shed_latency, how far apart refreshes get at most while the HN API is degraded")
+	fs.Float64Var(&cfg.BreakerErrorRate, "breaker_error_rate", 0.5, "stop asking the HN API for -breaker_cooldown once this share of its requests in a minute failed or were slower than -breaker_latency, skipping refreshes and serving the stories there are (0 disables the breaker)")
+	fs.DurationVar(&cfg.BreakerLatency, "breaker_latency", 10*time.Second, "with -breaker_error_rate, how long a request to the HN API may take before it counts as failed (0 only counts errors)")
+	fs.DurationVar(&cfg.BreakerCooldown, "breaker_cooldown", 30*time.Second, "with -breaker_error_rate, how long the breaker stays open before one request tries the HN API again")
+	fs.DurationVar(&cfg.SMaxAge, "s_maxage", 0, "how long a CDN in front of the instance may serve the front page, story pages and feeds without asking again, 0 keeps them out of shared caches")
+	fs.DurationVar(&cfg.StaleWhileRevalidate, "stale_while_revalidate", time.Minute, "with -s_maxage, how long a CDN may serve a page stale while it fetches it again")
+	fs.StringVar(&cfg.SurrogateKeyHeader, "surrogate_key_header", "Surrogate-Key", "with -s_maxage, the header listing the keys to purge a page by from the CDN, space separated (none if empty)")
+	fs.StringVar(&cfg.PruneSchedule, "prune_schedule", "@hourly", "with -retention, the cron schedule the archive is pruned on")
+	fs.Parse(args)
+	if cfg.ConfigFile != "" {
+		if err := loadConfigFile(fs, cfg.ConfigFile); err != nil {
+			fmt.Fprintln(fs.Output(), err)
+			os.Exit(2)
+		}
+	}
+	// validate reports a list that doesn't parse
+	linkRewrites, _ = parseRewrites(cfg.RewriteLinks)
+	hostLabels, _ = parseHostLabels(cfg.HostLabels)
+	debugLog = cfg.DebugLog
+	// platforms like Cloud Run and Heroku say which port to listen on
+	if port := os.Getenv("PORT"); port != "" && !flagSet(fs, "port") {
+		n, err := strconv.Atoi(port)
+		if err != nil {
+			fmt.Fprintf(fs.Output(), "invalid $PORT %q\n", port)
+			os.Exit(2)
+		}
+		cfg.Port = n
+	}
+	if cfg.MastodonToken == "" {
+		cfg.MastodonToken = os.Getenv("MASTODON_TOKEN")
+	}
+	if cfg.AdminPassword == "" {
+		cfg.AdminPassword = os.Getenv("ADMIN_PASSWORD")
+	}
+	if cfg.DebugToken == "" {
+		cfg.DebugToken = os.Getenv("DEBUG_TOKEN")
+	}
+	if cfg.BlueskyPassword == "" {
+		cfg.BlueskyPassword = os.Getenv("BLUESKY_PASSWORD")
+	}
+	if cfg.SMTPPassword == "" {
+		cfg.SMTPPassword = os.Getenv("SMTP_PASSWORD")
+	}
+	if cfg.MatrixToken == "" {
+		cfg.MatrixToken = os.Getenv("MATRIX_TOKEN")
+	}
+	if cfg.GitHubClientSecret == "" {
+		cfg.GitHubClientSecret = os.Getenv("GITHUB_CLIENT_SECRET")
+	}
+	if cfg.GitHubToken == "" {
+		cfg.GitHubToken = os.Getenv("GITHUB_TOKEN")
+	}
+	if cfg.OIDCClientSecret == "" {
+		cfg.OIDCClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+	}
+	if cfg.NtfyToken == "" {
+		cfg.NtfyToken = os.Getenv("NTFY_TOKEN")
+	}
+	if cfg.SummarizeToken == "" {
+		cfg.SummarizeToken = os.Getenv("SUMMARIZE_TOKEN")
+	}
+	if cfg.TranslateToken == "" {
+		cfg.TranslateToken = os.Getenv("TRANSLATE_TOKEN")
+	}
+	if cfg.PushoverToken == "" {
+		cfg.PushoverToken = os.Getenv("PUSHOVER_TOKEN")
+	}
+	return cfg
+}
+
+// flagSet reports whether the flag was given, on the command line or in
+// the config file.
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
+
+// loadConfigFile sets the flags of fs from a file of "name = value" lines,
+// skipping the ones given on the command line. Lines starting with # are
+// comments, values may be quoted like Go strings and a bool flag without a
+// value is true.
+func loadConfigFile(fs *flag.FlagSet, name string) error {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	for i, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		key, value = strings.TrimLeft(strings.TrimSpace(key), "-"), strings.TrimSpace(value)
+		f := fs.Lookup(key)
+		if f == nil || key == "config" {
+			return fmt.Errorf("%s:%d: unknown flag %s", name, i+1, key)
+		}
+		if given[key] {
+			continue
+		}
+		if !found {
+			value = "true"
+		}
+		if strings.HasPrefix(value, `"`) {
+			if value, err = strconv.Unquote(value); err != nil {
+				return fmt.Errorf("%s:%d: %s: %w", name, i+1, key, err)
+			}
+		}
+		if err := fs.Set(key, value); err != nil {
+			return fmt.Errorf("%s:%d: %s: %w", name, i+1, key, err)
+		}
+	}
+	return nil
+}
+
+// saveConfigFile writes values of flags to the file read by loadConfigFile,
+// in place of the lines that set them or after the others. As the command
+// line wins over the file, a flag given there keeps its value on restart.
+func saveConfigFile(name string, values map[string]string) error {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	if len(b) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+	}
+	written := make(map[string]bool)
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, _, _ := strings.Cut(line, "=")
+		key = strings.TrimLeft(strings.TrimSpace(key), "-")
+		if value, ok := values[key]; ok {
+			lines[i] = key + " = " + strconv.Quote(value)
+			written[key] = true
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		if !written[key] {
+			lines = append(lines, key+" = "+strconv.Quote(values[key]))
+		}
+	}
+	// the file may hold secrets, it keeps its permissions
+	tmp := name + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), info.Mode().Perm()); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// runtimeFlags are the flags /admin/config can change without a restart.
+var runtimeFlags = []string{"num_stories", "cache_ttl", "refresh_schedule", "min_score", "min_comments", "max_age", "block_domains", "block_users", "mute"}
+
+// setRuntime sets one of runtimeFlags to value, parsed like on the command
+// line.
+func (cfg *config) setRuntime(name, value string) error {
+	var err error
+	switch name {
+	case "num_stories":
+		cfg.NumStories, err = strconv.Atoi(value)
+	case "cache_ttl":
+		cfg.CacheTTL, err = time.ParseDuration(value)
+	case "refresh_schedule":
+		cfg.RefreshSchedule = value
+	case "min_score":
+		cfg.MinScore, err = strconv.Atoi(value)
+	case "min_comments":
+		cfg.MinComments, err = strconv.Atoi(value)
+	case "max_age":
+		cfg.MaxAge, err = time.ParseDuration(value)
+	case "block_domains":
+		cfg.BlockDomains = value
+	case "block_users":
+		cfg.BlockUsers = value
+	case "mute":
+		cfg.Mute = value
+	default:
+		return fmt.Errorf("%s can't be changed at runtime", name)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: invalid value %q", name, value)
+	}
+	return nil
+}
+
+func (cfg config) validate() error {
+	if cfg.NumStories <= 0 {
+		return errors.New("num_stories must be positive")
+	}
+	if cfg.AccentColor != "" && !cssColor.MatchString(cfg.AccentColor) {
+		return errors.New("accent_color must be a hex color like #f60 or a CSS color keyword")
+	}
+	if err := cfg.validateSources(); err != nil {
+		return err
+	}
+	if _, err := parseRewrites(cfg.RewriteLinks); err != nil {
+		return err
+	}
+	if _, err := parseHostLabels(cfg.HostLabels); err != nil {
+		return err
+	}
+	switch cfg.Robots {
+	case "", "index", "noindex":
+	default:
+		return errors.New("robots must be index or noindex")
+	}
+	if cfg.TZ != "" {
+		if _, err := loadZone(cfg.TZ); err != nil {
+			return fmt.Errorf("tz: %w", err)
+		}
+	}
+	if cfg.StaleAfter < 0 {
+		return errors.New("stale_after must not be negative")
+	}
+	if cfg.CheckLinks < 0 {
+		return errors.New("check_links must not be negative")
+	}
+	if cfg.ClickStats && cfg.Archive == "" {
+		return errors.New("click_stats needs archive")
+	}
+	if cfg.SummarizeURL != "" && cfg.SummarizeCommand != "" {
+		return errors.New("summarize_url and summarize_command can't both be set")
+	}
+	if (cfg.SummarizeURL != "" || cfg.SummarizeCommand != "") && cfg.Archive == "" {
+		return errors.New("summarize_url and summarize_command need archive")
+	}
+	if cfg.TranslateURL != "" && cfg.TranslateCommand != "" {
+		return errors.New("translate_url and translate_command can't both be set")
+	}
+	if (cfg.TranslateTo != "") != (cfg.TranslateURL != "" || cfg.TranslateCommand != "") {
+		return errors.New("translate_to needs translate_url or translate_command, and they need translate_to")
+	}
+	if cfg.DebugToken != "" && cfg.DebugAddr == "" {
+		return errors.New("debug_token needs debug_addr")
+	}
+	if !slices.Contains(modes, cfg.Mode) {
+		return fmt.Errorf("mode must be %s", strings.Join(modes, ", "))
+	}
+	if !slices.Contains(mergeStrategies, cfg.Merge) {
+		return fmt.Errorf("merge must be %s", strings.Join(mergeStrategies, " or "))
+	}
+	for name, expr := range map[string]string{"refresh_schedule": cfg.RefreshSchedule, "prune_schedule": cfg.PruneSchedule} {
+		if _, err := cron.Parse(expr); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if cfg.DigestSchedule != "" {
+		if _, err := cron.Parse(cfg.DigestSchedule); err != nil {
+			return fmt.Errorf("digest_schedule: %w", err)
+		}
+		if (cfg.DigestTo == "") != (cfg.DigestFrom == "") {
+			return errors.New("digest_to and digest_from go together")
+		}
+		if cfg.DigestTo == "" && cfg.DigestSlack == "" && cfg.DigestDiscord == "" && cfg.DigestMatrix == "" {
+			return errors.New("digest_schedule needs digest_to, digest_slack, digest_discord or digest_matrix")
+		}
+	}
+	if (cfg.WatchMatrix != "" || cfg.DigestMatrix != "") && (cfg.MatrixHomeserver == "" || cfg.MatrixToken == "") {
+		return errors.New("watch_matrix and digest_matrix need matrix_homeserver and matrix_token")
+	}
+	if cfg.BreakerErrorRate < 0 || cfg.BreakerErrorRate > 1 {
+		return errors.New("breaker_error_rate must be between 0 and 1")
+	}
+	if cfg.BreakerLatency < 0 || cfg.BreakerCooldown < 0 {
+		return errors.New("breaker_latency and breaker_cooldown must not be negative")
+	}
+	if cfg.ShedLatency < 0 {
+		return errors.New("shed_latency can't be negative, 0 turns load shedding off")
+	}
+	if cfg.CacheTTL <= 0 {
+		return errors.New("cache_ttl must be positive")
+	}
+	if cfg.CountsEvery < 0 {
+		return errors.New("counts_every can't be negative, 0 turns it off")
+	}
+	if cfg.RequestTimeout < 0 {
+		return errors.New("request_timeout can't be negative")
+	}
+	if cfg.IdleAfter < 0 || cfg.IdleRefresh < 0 {
+		return errors.New("idle_after and idle_refresh can't be negative")
+	}
+	if cfg.ShedLatency > 0 && cfg.ShedMaxInterval < cfg.CacheTTL {
+		return fmt.Errorf("shed_max_interval must be at least -cache_ttl, %s", cfg.CacheTTL)
+	}
+	if cfg.SMaxAge < 0 || cfg.StaleWhileRevalidate < 0 {
+		return errors.New("s_maxage and stale_while_revalidate can't be negative")
+	}
+	if cfg.Signup && cfg.Accounts == "" {
+		return errors.New("signup needs accounts")
+	}
+	if cfg.SessionTTL <= 0 {
+		return errors.New("session_ttl must be positive")
+	}
+	if (cfg.GitHubClientID != "" || cfg.OIDCIssuer != "") && cfg.Accounts == "" {
+		return errors.New("github_client_id and oidc_issuer need accounts")
+	}
+	if cfg.GitHubClientID != "" && cfg.GitHubClientSecret == "" {
+		return errors.New("github_client_id needs github_client_secret")
+	}
+	if cfg.OIDCIssuer != "" && (cfg.OIDCClientID == "" || cfg.OIDCClientSecret == "") {
+		return errors.New("oidc_issuer needs oidc_client_id and oidc_client_secret")
+	}
+	if cfg.MastodonServer != "" && cfg.MastodonToken == "" {
+		return errors.New("mastodon_server needs mastodon_token")
+	}
+	if cfg.BlueskyHandle != "" && cfg.BlueskyPassword == "" {
+		return errors.New("bluesky_handle needs bluesky_password")
+	}
+	return nil
+}
+
+func (cfg config) brand(r *http.Request) branding {
+	b := branding{
+		Title:       cfg.SiteTitle,
+		Header:      cfg.HeaderText,
+		Footer:      template.HTML(cfg.FooterHTML),
+		Accent:      cfg.AccentColor,
+		URL:         strings.TrimSuffix(cfg.PublicURL, "/"),
+		Description: cfg.Description,
+		Image:       cfg.ShareImage,
+	}
+	if b.Header == "" {
+		b.Header = b.Title
+	}
+	// without a request, like in digests, there is nothing to fall back on,
+	// and a generated site is put on a host we don't know
+	if b.URL == "" && r != nil && !cfg.static {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		b.URL = scheme + "://" + r.Host
+	}
+	return b
+}
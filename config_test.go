@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	name := filepath.Join(t.TempDir(), "quiet_hn.conf")
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	name := writeConfigFile(t, `
+# comments and blank lines are skipped
+num_stories = 12
+-site_title = "Quiet \"HN\""
+hide_reposts
+port = 9000
+`)
+	cfg := parseFlags(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", name, "-port", "8000"})
+	if cfg.NumStories != 12 {
+		t.Errorf("num_stories: want 12, got %d", cfg.NumStories)
+	}
+	if cfg.SiteTitle != `Quiet "HN"` {
+		t.Errorf("site_title: want %q, got %q", `Quiet "HN"`, cfg.SiteTitle)
+	}
+	if !cfg.HideReposts {
+		t.Error("hide_reposts: want true, got false")
+	}
+	if cfg.Port != 8000 {
+		t.Errorf("port: want the command line 8000, got %d", cfg.Port)
+	}
+
+	for content, want := range map[string]string{
+		"nope = 1":          "quiet_hn.conf:1: unknown flag nope",
+		"\nport = x":        "quiet_hn.conf:2: port: parse error",
+		`site_title = "un`:  "quiet_hn.conf:1: site_title: invalid syntax",
+		"config = other.cf": "quiet_hn.conf:1: unknown flag config",
+	} {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		parseFlags(fs, nil)
+		err := loadConfigFile(fs, writeConfigFile(t, content))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: want an error with %q, got %v", content, want, err)
+		}
+	}
+}
+
+func TestParseFlags_PORT(t *testing.T) {
+	t.Setenv("PORT", "8080")
+	if cfg := parseFlags(flag.NewFlagSet("test", flag.ContinueOnError), nil); cfg.Port != 8080 {
+		t.Errorf("$PORT: want 8080, got %d", cfg.Port)
+	}
+	if cfg := parseFlags(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-port", "9000"}); cfg.Port != 9000 {
+		t.Errorf("-port and $PORT: want the flag 9000, got %d", cfg.Port)
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg := parseFlags(fs, []string{"-site_title", "a = b", "-cookie_secret", "hunter2", "-num_stories", "7"})
+	var b bytes.Buffer
+	printConfig(&b, fs, nil)
+	out := b.String()
+	if strings.Contains(out, "hunter2") || !strings.Contains(out, `cookie_secret = "********"`) {
+		t.Errorf("want the cookie secret masked, got %s", out)
+	}
+
+	// the output, without the masked secret, is a config file again
+	out = strings.ReplaceAll(out, `cookie_secret = "********"`, "")
+	again := parseFlags(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-config", writeConfigFile(t, out)})
+	if again.SiteTitle != cfg.SiteTitle || again.NumStories != 7 {
+		t.Errorf("reloaded: want %q and 7 stories, got %q and %d", cfg.SiteTitle, again.SiteTitle, again.NumStories)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/neghoda/quiet_hn/hn"
+)
+
+// countsTimeout bounds a refresh of the counts.
+const countsTimeout = 10 * time.Second
+
+// refreshCounts fetches the stories of the cache that the HN API lists among
+// its recent updates again and takes their points and comments, without
+// fetching the top stories or running them through the filters and -rank.
+// It returns the number of stories updated. Only caches of HN have counts
+// to refresh, and none are while the API is degraded or nobody visits.
+func (c *cach) refreshCounts(ctx context.Context) (int, error) {
+	if _, ok := c.source.(hnSource); !ok || c.idle.quiet(time.Now()) {
+		return 0, nil
+	}
+	c.dataMutex.RLock()
+	degraded := c.degraded
+	c.dataMutex.RUnlock()
+	if degraded {
+		return 0, nil
+	}
+	updates, err := hnClient.UpdatesContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	changed := make(map[int]bool, len(updates.Items))
+	for _, id := range updates.Items {
+		changed[id] = true
+	}
+	var ids []int
+	c.dataMutex.RLock()
+	for _, s := range c.cashedItems {
+		if changed[s.ID] {
+			ids = append(ids, s.ID)
+		}
+	}
+	c.dataMutex.RUnlock()
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	var mutex sync.Mutex
+	fetched := make(map[int]hn.Item, len(ids))
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// a story that fails keeps the counts it has
+			if it, err := fetchItem(ctx, hnSource{}, id); err == nil && it.ID == id {
+				mutex.Lock()
+				fetched[id] = it
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// a refresh may have replaced the stories meanwhile, the counts go to
+	// the ones there are now, in a copy as requests may still be reading
+	// the old ones
+	c.dataMutex.Lock()
+	stories := slices.Clone(c.cashedItems)
+	for i, s := range stories {
+		if it, ok := fetched[s.ID]; ok {
+			stories[i].Score, stories[i].Descendants = it.Score, it.Descendants
+		}
+	}
+	c.cashedItems = stories
+	c.dataMutex.Unlock()
+	if c.pages != nil {
+		c.pages.rerender()
+	}
+	return len(fetched), nil
+}
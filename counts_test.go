@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCach_RefreshCounts(t *testing.T) {
+	var mutex sync.Mutex
+	score := map[int]int{1: 10, 2: 20}
+	var updated []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch r.URL.Path {
+		case "/topstories.json":
+			fmt.Fprint(w, "[1,2]")
+		case "/updates.json":
+			json.NewEncoder(w).Encode(map[string][]int{"items": updated})
+		default:
+			var id int
+			fmt.Sscanf(strings.TrimPrefix(r.URL.Path, "/item/"), "%d.json", &id)
+			fmt.Fprintf(w, `{"id":%d,"type":"story","title":"Story %[1]d","url":"https://example.com/%[1]d","score":%d,"descendants":%[2]d}`, id, score[id])
+		}
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	old := hnClient
+	hnClient.HTTPClient = &http.Client{Transport: hnTransport{server: u, next: http.DefaultTransport}}
+	defer func() { hnClient = old }()
+
+	f, err := newFilters(config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCach(2, f, cachOptions{})
+	c.forceRefresh()
+
+	mutex.Lock()
+	score[1], score[2] = 15, 25
+	updated = []int{2, 99}
+	mutex.Unlock()
+	n, err := c.refreshCounts(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("refreshCounts: want 1 story updated, got %d, %v", n, err)
+	}
+	for id, want := range map[int]int{1: 10, 2: 25} {
+		s, _ := c.lookup(id)
+		if s.Score != want || s.Descendants != want {
+			t.Errorf("%d: want %d points and comments, got %d and %d", id, want, s.Score, s.Descendants)
+		}
+	}
+
+	c.source = fakeSource{}
+	if n, _ := c.refreshCounts(context.Background()); n != 0 {
+		t.Errorf("other source: want no counts refreshed, got %d", n)
+	}
+}
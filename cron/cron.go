@@ -0,0 +1,208 @@
+// Package cron parses cron expressions and tells when they next fire. An
+// expression has the five usual fields
+//
+//	minute hour day-of-month month day-of-week
+//
+// each of which is *, a number, a range like 1-5, a list like 1,15 or any of
+// these with a step like */10. Months and days of the week may be written
+// as jan-dec and sun-sat. As in cron, a day matches if either the day of
+// the month or the day of the week does when both are restricted. The
+// shortcuts @hourly, @daily, @weekly and @monthly are accepted too, and
+// @every followed by a duration like 5m fires that long after the last time.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	src                                 string
+	minutes, hours, days, months, weeks uint64
+	// anyDay and anyWeekday are true when the field was *, then only
+	// the other one decides which days match
+	anyDay, anyWeekday bool
+	// every is set for @every, the fields are unused then
+	every time.Duration
+}
+
+var shortcuts = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+var (
+	monthNames   = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	weekdayNames = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+type field struct {
+	name     string
+	min, max int
+	// names of the values from min on, if any
+	names []string
+}
+
+var fields = []field{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, monthNames},
+	// 7 is Sunday too
+	{"day of week", 0, 7, weekdayNames},
+}
+
+// Parse parses a cron expression.
+func Parse(expr string) (*Schedule, error) {
+	src := expr
+	if d, ok := strings.CutPrefix(strings.TrimSpace(expr), "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || every < time.Second {
+			return nil, fmt.Errorf("cron: %q: want a duration of at least 1s", src)
+		}
+		return &Schedule{src: src, every: every}, nil
+	}
+	if s, ok := shortcuts[strings.TrimSpace(expr)]; ok {
+		expr = s
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron: %q: want %d fields, got %d", src, len(fields), len(parts))
+	}
+	var sets [5]uint64
+	for i, f := range fields {
+		set, err := f.parse(parts[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron: %q: %s", src, err)
+		}
+		sets[i] = set
+	}
+	s := &Schedule{
+		src:        src,
+		minutes:    sets[0],
+		hours:      sets[1],
+		days:       sets[2],
+		months:     sets[3],
+		weeks:      sets[4],
+		anyDay:     parts[2] == "*",
+		anyWeekday: parts[4] == "*",
+	}
+	if s.weeks&(1<<7) != 0 {
+		s.weeks |= 1
+	}
+	return s, nil
+}
+
+func (f field) parse(expr string) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(expr, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+			rng = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("bad step in %s %q", f.name, part)
+			}
+		}
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			from, to, isRange := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(from); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = f.value(to); err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// 5/15 is 5-59/15
+				hi = f.max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("bad range in %s %q", f.name, part)
+			}
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func (f field) value(s string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(s, name) {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("bad %s %q, want %d-%d", f.name, s, f.min, f.max)
+	}
+	return v, nil
+}
+
+// Every returns the schedule of "@every d".
+func Every(d time.Duration) *Schedule {
+	return &Schedule{src: "@every " + d.String(), every: d}
+}
+
+// Next returns the first time after t the schedule fires, in the location
+// of t. It returns the zero time if it never does, like on February 30.
+func (s *Schedule) Next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Add(s.every)
+	}
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// a schedule that fires at all does so within a few years, leap days
+	// included
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if s.months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hours&(1<<uint(t.Hour())) == 0 {
+			// not Truncate, it would go by UTC hours in places that are
+			// half an hour off
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *Schedule) dayMatches(t time.Time) bool {
+	day := s.days&(1<<uint(t.Day())) != 0
+	weekday := s.weeks&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDay && s.anyWeekday:
+		return true
+	case s.anyDay:
+		return weekday
+	case s.anyWeekday:
+		return day
+	default:
+		return day || weekday
+	}
+}
+
+func (s *Schedule) String() string {
+	return s.src
+}
@@ -0,0 +1,55 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse_errors(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *", "* * * foo *", "@yearly", "@every", "@every 5", "@every 10ms"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q): want an error, got none", expr)
+		}
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	// a Sunday
+	start := time.Date(2024, 5, 12, 10, 17, 30, 0, time.UTC)
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, 5, 12, 10, 18, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2024, 5, 12, 10, 30, 0, 0, time.UTC)},
+		{"30 7 * * *", time.Date(2024, 5, 13, 7, 30, 0, 0, time.UTC)},
+		{"@daily", time.Date(2024, 5, 13, 0, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", time.Date(2024, 5, 13, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2024, 5, 19, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 12 29 2 *", time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC)},
+		// either the day of the month or the weekday
+		{"0 8 20 * 3", time.Date(2024, 5, 15, 8, 0, 0, 0, time.UTC)},
+		{"5,40 10-11 * * *", time.Date(2024, 5, 12, 10, 40, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+		{"@every 90s", time.Date(2024, 5, 12, 10, 19, 0, 0, time.UTC)},
+	}
+	for _, tc := range tests {
+		s, err := Parse(tc.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q) received an error: %s", tc.expr, err.Error())
+		}
+		if got := s.Next(start); !got.Equal(tc.want) {
+			t.Errorf("Next(%q): want %s, got %s", tc.expr, tc.want, got)
+		}
+	}
+}
+
+func TestSchedule_Next_halfHourZone(t *testing.T) {
+	india := time.FixedZone("IST", 5*3600+1800)
+	s, _ := Parse("0 * * * *")
+	start := time.Date(2024, 5, 12, 10, 17, 0, 0, india)
+	if got, want := s.Next(start), time.Date(2024, 5, 12, 11, 0, 0, 0, india); !got.Equal(want) {
+		t.Errorf("Next(): want %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// daily freezes the front page to one snapshot a day, taken at a fixed time
+// of day, for the -daily_at mode.
+type daily struct {
+	hour, minute int
+	numStories   int
+
+	// guarded by the dataMutex of the cache
+	stories []item
+	takenAt time.Time
+}
+
+// dailySnapshot is what the front page shows about the snapshot.
+type dailySnapshot struct {
+	Taken time.Time
+	Next  time.Time
+}
+
+// newDaily parses a time of day like 07:30, in the local time zone of the
+// server.
+func newDaily(at string, numStories int) (*daily, error) {
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return nil, fmt.Errorf("daily_at must be a time of day like 07:30: %w", err)
+	}
+	return &daily{hour: t.Hour(), minute: t.Minute(), numStories: numStories}, nil
+}
+
+// last returns the latest time of day the snapshot is taken at that is not
+// after now.
+func (d *daily) last(now time.Time) time.Time {
+	t := time.Date(now.Year(), now.Month(), now.Day(), d.hour, d.minute, 0, 0, now.Location())
+	if t.After(now) {
+		t = t.AddDate(0, 0, -1)
+	}
+	return t
+}
+
+// next returns the time the next snapshot is due.
+func (d *daily) next(now time.Time) time.Time {
+	return d.last(now).AddDate(0, 0, 1)
+}
+
+// due reports whether a snapshot has to be taken, which is also the case
+// before the first one.
+func (d *daily) due(now time.Time) bool {
+	return d.takenAt.Before(d.last(now))
+}
+
+// take makes the first numStories links of the ranked stories the snapshot,
+// along with the text posts among them.
+func (d *daily) take(stories []item, now time.Time) {
+	var snapshot []item
+	links := 0
+	for _, s := range stories {
+		if links == d.numStories {
+			break
+		}
+		if isStoryLink(s) {
+			links++
+		}
+		snapshot = append(snapshot, s)
+	}
+	d.stories = snapshot
+	d.takenAt = now
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	linkCheckWorkers = 4
+	// waybackURL is where the copy of a page on the Wayback Machine is,
+	// followed by its URL
+	waybackURL = "https://web.archive.org/web/"
+)
+
+// linkChecker finds the story links that are gone, which answer 404 or 410
+// after their redirects, and checks each one again at most every -check_links.
+type linkChecker struct {
+	every time.Duration
+	links map[string]checkedLink
+	mutex sync.Mutex
+	// busy is held while links are checked, refreshes that come along in
+	// the meantime leave theirs to the next batch
+	busy   sync.Mutex
+	client *http.Client
+}
+
+type checkedLink struct {
+	dead       bool
+	expiration time.Time
+}
+
+func newLinkChecker(every time.Duration) *linkChecker {
+	return &linkChecker{every: every, links: make(map[string]checkedLink), client: newReadClient()}
+}
+
+// annotate marks the stories whose link was found dead. The links that
+// weren't checked lately are checked in the background, and show up on the
+// next refresh.
+func (l *linkChecker) annotate(stories []item) {
+	var missing []string
+	now := time.Now()
+	l.mutex.Lock()
+	for i, s := range stories {
+		if s.URL == "" {
+			continue
+		}
+		checked, ok := l.links[s.URL]
+		if !ok || now.After(checked.expiration) {
+			missing = append(missing, s.URL)
+		}
+		// a link that was gone is taken as gone until it is checked again
+		stories[i].Dead = checked.dead
+	}
+	l.mutex.Unlock()
+	if len(missing) == 0 || !l.busy.TryLock() {
+		return
+	}
+	go func() {
+		defer l.busy.Unlock()
+		l.checkLinks(missing)
+		l.prune()
+	}()
+}
+
+func (l *linkChecker) checkLinks(urls []string) {
+	next := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < linkCheckWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rawURL := range next {
+				// a site that fails to answer isn't taken as gone, it may
+				// just be down for a while
+				dead := l.gone(rawURL)
+				l.mutex.Lock()
+				l.links[rawURL] = checkedLink{dead: dead, expiration: time.Now().Add(l.every)}
+				l.mutex.Unlock()
+			}
+		}()
+	}
+	for _, rawURL := range urls {
+		next <- rawURL
+	}
+	close(next)
+	wg.Wait()
+}
+
+// gone reports whether the link answers 404 or 410. Some servers get HEAD
+// wrong, so that is only believed once a GET says the same.
+func (l *linkChecker) gone(rawURL string) bool {
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequest(method, rawURL, nil)
+		if err != nil {
+			return false
+		}
+		req.Header.Set("Range", "bytes=0-0")
+		resp, err := l.client.Do(req)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusGone {
+			return false
+		}
+	}
+	return true
+}
+
+// prune drops the links checked longer ago than every.
+func (l *linkChecker) prune() {
+	now := time.Now()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for k, v := range l.links {
+		if now.After(v.expiration) {
+			delete(l.links, k)
+		}
+	}
+}
+
+// ArchiveURL is the copy of the link of the story on the Wayback Machine.
+func (i item) ArchiveURL() string {
+	return waybackURL + i.URL
+}
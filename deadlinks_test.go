@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLinkChecker_Annotate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/gone", http.StatusMovedPermanently)
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		case "/nohead":
+			// a server that gets HEAD wrong
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case "/missing":
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	l := newLinkChecker(time.Hour)
+	l.client = srv.Client()
+	stories := []item{
+		testStory(1, "Moved", srv.URL+"/moved", 1),
+		testStory(2, "No HEAD", srv.URL+"/nohead", 1),
+		testStory(3, "Missing", srv.URL+"/missing", 1),
+		testStory(4, "Fine", srv.URL+"/", 1),
+	}
+	l.annotate(stories)
+	// the links are checked in the background, for the next refresh
+	l.busy.Lock()
+	l.busy.Unlock()
+	l.annotate(stories)
+	for i, want := range []bool{true, false, true, false} {
+		if stories[i].Dead != want {
+			t.Errorf("%s: want dead %t, got %t", stories[i].Title, want, stories[i].Dead)
+		}
+	}
+	if want := "https://web.archive.org/web/" + srv.URL + "/moved"; stories[0].Link() != want {
+		t.Errorf("link: want %s, got %s", want, stories[0].Link())
+	}
+	if stories[3].Link() != srv.URL+"/" {
+		t.Errorf("link: want the URL, got %s", stories[3].Link())
+	}
+}
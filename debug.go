@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"log"
+	"net/http"
+	_ "net/http/pprof"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// debugHandler serves /debug/pprof and /debug/vars, which register on the
+// default mux, for -debug_addr. With a token, requests need it as a bearer
+// token, so the address doesn't have to stay private.
+func debugHandler(token string) http.Handler {
+	if token == "" {
+		return http.DefaultServeMux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="debug"`)
+			http.Error(w, "A debug token is required", http.StatusUnauthorized)
+			return
+		}
+		http.DefaultServeMux.ServeHTTP(w, r)
+	})
+}
+
+// debugLog is set with -debug_log.
+var debugLog bool
+
+// debugf logs a debug message, only with -debug_log.
+func debugf(format string, args ...any) {
+	if debugLog {
+		log.Printf("debug: "+format, args...)
+	}
+}
+
+// publishVars adds the goroutines and the state of the cache to
+// /debug/vars, next to the memory stats expvar has.
+func publishVars(c *cach) {
+	// a leak of the fetches shows as goroutines growing between refreshes
+	expvar.Publish("goroutines", expvar.Func(func() any { return runtime.NumGoroutine() }))
+	expvar.Publish("cache", expvar.Func(func() any {
+		c.dataMutex.RLock()
+		defer c.dataMutex.RUnlock()
+		return map[string]any{
+			"stories":        len(c.cashedItems),
+			"refreshed_at":   c.refreshedAt,
+			"fetch_duration": c.fetchDuration.String(),
+			"expires_in":     time.Until(c.expiration).Round(time.Second).String(),
+			"last_refresh": map[string]any{
+				"duration":       c.lastFetch.duration.String(),
+				"items_fetched":  c.lastFetch.requests,
+				"items_failed":   c.lastFetch.failed,
+				"items_filtered": c.lastFetch.filtered,
+				"retries":        c.lastFetch.retries,
+				"list_latency":   c.lastFetch.latency.String(),
+				"slowest_item":   c.lastFetch.slowest.String(),
+			},
+		}
+	}))
+}
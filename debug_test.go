@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDebugHandler(t *testing.T) {
+	c := newCach(1, nil, cachOptions{})
+	publishVars(c)
+
+	tests := []struct {
+		token, auth, path string
+		code              int
+	}{
+		{"", "", "/debug/pprof/", http.StatusOK},
+		{"", "", "/debug/vars", http.StatusOK},
+		{"secret", "", "/debug/vars", http.StatusUnauthorized},
+		{"secret", "Bearer wrong", "/debug/vars", http.StatusUnauthorized},
+		{"secret", "Bearer secret", "/debug/pprof/goroutine?debug=1", http.StatusOK},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		if tt.auth != "" {
+			r.Header.Set("Authorization", tt.auth)
+		}
+		rec := httptest.NewRecorder()
+		debugHandler(tt.token).ServeHTTP(rec, r)
+		if rec.Code != tt.code {
+			t.Errorf("%s with %q: want %d, got %d", tt.path, tt.auth, tt.code, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	debugHandler("").ServeHTTP(rec, httptest.NewRequest("GET", "/debug/vars", nil))
+	var vars struct {
+		Goroutines int            `json:"goroutines"`
+		Cache      map[string]any `json:"cache"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &vars); err != nil {
+		t.Fatal(err)
+	}
+	if vars.Goroutines == 0 {
+		t.Errorf("goroutines: want some, got %d", vars.Goroutines)
+	}
+	if _, ok := vars.Cache["stories"]; !ok {
+		t.Errorf("cache: want stories, got %v", vars.Cache)
+	}
+}
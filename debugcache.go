@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const debugCachePath = "/debug/cache"
+
+// refreshHistory is how many refreshes a cache remembers for /debug/cache.
+const refreshHistory = 20
+
+// refreshRecord is a refresh of a cache as /debug/cache shows it.
+type refreshRecord struct {
+	At       time.Time `json:"at"`
+	Duration string    `json:"duration,omitempty"`
+	// Stories is the number of stories fetched, before the front page
+	// was cut to -num_stories
+	Stories  int    `json:"stories"`
+	Requests int    `json:"items_fetched"`
+	Failed   int    `json:"items_failed"`
+	Filtered int    `json:"items_filtered"`
+	Retries  int    `json:"retries"`
+	Error    string `json:"error,omitempty"`
+	// Kept is set when the refresh lost too many items and the stories
+	// there were stayed, Skipped when the breaker around the HN API was
+	// open and the refresh didn't ask it
+	Kept    bool `json:"kept,omitempty"`
+	Skipped bool `json:"skipped,omitempty"`
+}
+
+func newRefreshRecord(start time.Time, stats fetchStats, stories int, err error, kept bool) refreshRecord {
+	r := refreshRecord{
+		At:       start,
+		Duration: stats.duration.Round(time.Millisecond).String(),
+		Stories:  stories,
+		Requests: stats.requests,
+		Failed:   stats.failed,
+		Filtered: stats.filtered,
+		Retries:  stats.retries,
+		Kept:     kept,
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// recordRefresh adds r to the history, dropping the oldest refresh past
+// refreshHistory. The caller holds dataMutex.
+func (c *cach) recordRefresh(r refreshRecord) {
+	if len(c.history) == refreshHistory {
+		c.history = append(c.history[:0], c.history[1:]...)
+	}
+	c.history = append(c.history, r)
+}
+
+// cacheDump is the state of the cache of a source for /debug/cache.
+type cacheDump struct {
+	Source      string          `json:"source"`
+	RefreshedAt time.Time       `json:"refreshed_at"`
+	Expiration  time.Time       `json:"expiration"`
+	Items       []item          `json:"items"`
+	History     []refreshRecord `json:"history"`
+}
+
+func (c *cach) dump(source string) cacheDump {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+	return cacheDump{
+		Source:      source,
+		RefreshedAt: c.refreshedAt,
+		Expiration:  c.expiration,
+		// copies, the cache changes them once the lock is released
+		Items:   append([]item{}, c.cashedItems...),
+		History: append([]refreshRecord{}, c.history...),
+	}
+}
+
+// debugCacheHandler dumps the caches of the sources as JSON, with the
+// stories as they are cached, before any visitor's settings, and the last
+// refreshes, to find out why a story is missing from the front page.
+// ?source= dumps only the cache of that source.
+func debugCacheHandler(caches []*cach, cfg config) http.HandlerFunc {
+	names := cfg.sourceNames()
+	return withAdminAuth(cfg.AdminPassword, func(w http.ResponseWriter, r *http.Request) {
+		source := r.FormValue("source")
+		dumps := []cacheDump{}
+		for i, c := range caches {
+			if source == "" || source == names[i] {
+				dumps = append(dumps, c.dump(names[i]))
+			}
+		}
+		if len(dumps) == 0 {
+			http.Error(w, "Unknown source", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(dumps); err != nil {
+			http.Error(w, "Failed to encode the caches", http.StatusInternalServerError)
+		}
+	})
+}
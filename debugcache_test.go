@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDebugCache(t *testing.T) {
+	setupHN(t, map[int]string{1: storyJSON(1), 2: storyJSON(2), 3: `{"id":3,"type":"story","title":"Muted","url":"https://muted.com/3"}`})
+	domains := filepath.Join(t.TempDir(), "domains.txt")
+	if err := os.WriteFile(domains, []byte("muted.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := newFilters(config{BlockDomainsFile: domains})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCach(2, f, cachOptions{})
+	for i := 0; i < refreshHistory+2; i++ {
+		c.forceRefresh()
+	}
+	cfg := config{Sources: "hn", AdminPassword: "pw"}
+	h := debugCacheHandler([]*cach{c}, cfg)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", debugCachePath, nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("without the password: want 401, got %d", rec.Code)
+	}
+
+	r := httptest.NewRequest("GET", debugCachePath, nil)
+	r.SetBasicAuth("admin", "pw")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	var dumps []struct {
+		Source  string          `json:"source"`
+		Items   []item          `json:"items"`
+		History []refreshRecord `json:"history"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &dumps); err != nil {
+		t.Fatalf("want JSON, got %v in %q", err, rec.Body.String())
+	}
+	if len(dumps) != 1 || dumps[0].Source != "hn" || len(dumps[0].Items) != 2 {
+		t.Fatalf("want the 2 cached stories of hn, got %+v", dumps)
+	}
+	history := dumps[0].History
+	if len(history) != refreshHistory {
+		t.Fatalf("want the last %d refreshes, got %d", refreshHistory, len(history))
+	}
+	last := history[len(history)-1]
+	if last.Requests != 3 || last.Filtered != 1 || last.Stories != 2 || last.Error != "" || last.At.Before(history[0].At) {
+		t.Errorf("want the last refresh with 3 items fetched and 1 filtered, got %+v", last)
+	}
+
+	r = httptest.NewRequest("GET", debugCachePath+"?source=reddit", nil)
+	r.SetBasicAuth("admin", "pw")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown source: want 404, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/neghoda/quiet_hn/i18n"
+)
+
+// mailer sends mail through the SMTP server of -smtp_addr.
+type mailer struct {
+	addr     string
+	user     string
+	password string
+	from     string
+}
+
+// send sends a message to the recipients. The server is asked for STARTTLS
+// if it supports it, and credentials are only sent over TLS.
+func (m mailer) send(to []string, msg []byte) error {
+	var auth smtp.Auth
+	if m.user != "" {
+		host, _, _ := net.SplitHostPort(m.addr)
+		auth = smtp.PlainAuth("", m.user, m.password, host)
+	}
+	return smtp.SendMail(m.addr, auth, m.from, to, msg)
+}
+
+// ping logs in to the server without sending a message.
+func (m mailer) ping() error {
+	host, _, _ := net.SplitHostPort(m.addr)
+	c, err := smtp.Dial(m.addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.Hello("localhost"); err != nil {
+		return err
+	}
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if m.user != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.user, m.password, host)); err != nil {
+			return err
+		}
+	}
+	return c.Quit()
+}
+
+func (m mailer) target() string { return "smtp server " + m.addr }
+
+// digest sends the top stories to its targets, when the digest job of the
+// scheduler runs.
+type digest struct {
+	numStories int
+	stories    func() ([]item, error)
+	targets    []digestTarget
+}
+
+// digestTarget is somewhere a digest is sent to.
+type digestTarget interface {
+	sendDigest(stories []item, at time.Time) error
+}
+
+// digestTargets returns the targets the digest is sent to, from the digest_
+// flags.
+func (cfg config) digestTargets() []digestTarget {
+	var targets []digestTarget
+	brand, locale := cfg.brand(nil), i18n.Lookup(cfg.Lang)
+	if cfg.DigestTo != "" {
+		targets = append(targets, mailDigest{
+			mailer: mailer{addr: cfg.SMTPAddr, user: cfg.SMTPUser, password: cfg.SMTPPassword, from: cfg.DigestFrom},
+			to:     strings.Split(cfg.DigestTo, ","),
+			brand:  brand,
+			locale: locale,
+		})
+	}
+	if cfg.DigestSlack != "" {
+		targets = append(targets, slackWebhook{url: cfg.DigestSlack, brand: brand, locale: locale})
+	}
+	if cfg.DigestDiscord != "" {
+		targets = append(targets, discordWebhook{url: cfg.DigestDiscord, brand: brand, locale: locale})
+	}
+	if cfg.DigestMatrix != "" {
+		targets = append(targets, cfg.matrixRoom(cfg.DigestMatrix))
+	}
+	return targets
+}
+
+// mailDigest emails the digest to a list of recipients.
+type mailDigest struct {
+	mailer mailer
+	to     []string
+	brand  branding
+	locale *i18n.Locale
+}
+
+// digestLine is a story as the digest templates see it.
+type digestLine struct {
+	Title      string
+	Link       string
+	Host       string
+	Points     string
+	Comments   string
+	Discussion string
+}
+
+func newDigestLine(l *i18n.Locale, s item) digestLine {
+	link := s.URL
+	if link == "" {
+		link = s.CommentsURL()
+	}
+	return digestLine{
+		Title:      s.Title,
+		Link:       link,
+		Host:       s.Host,
+		Points:     l.N("points", s.Score),
+		Comments:   l.N("comments", s.Descendants),
+		Discussion: s.CommentsURL(),
+	}
+}
+
+type digestData struct {
+	Subject string
+	Brand   branding
+	Stories []digestLine
+}
+
+var digestText = texttemplate.Must(texttemplate.New("text").Parse(`{{.Subject}}
+{{range $i, $s := .Stories}}
+{{$s.Title}}{{with $s.Host}} ({{.}}){{end}}
+{{$s.Link}}
+{{$s.Points}}, {{$s.Comments}}: {{$s.Discussion}}
+{{end}}{{with .Brand.URL}}
+{{.}}
+{{end}}`))
+
+var digestHTML = htmltemplate.Must(htmltemplate.New("html").Parse(`<!doctype html>
+<html>
+<body style="font-family: sans-serif; line-height: 1.4; color: #222;">
+<h1 style="font-size: 1.3em;">{{.Subject}}</h1>
+<ol style="padding-left: 1.5em;">
+{{range .Stories}}<li style="margin-bottom: 10px;">
+<a href="{{.Link}}" style="color: #222;">{{.Title}}</a>{{with .Host}} <span style="color: #888;">({{.}})</span>{{end}}<br>
+<span style="color: #888; font-size: 0.9em;">{{.Points}} &middot; <a href="{{.Discussion}}" style="color: #888;">{{.Comments}}</a></span>
+</li>
+{{end}}</ol>
+{{with .Brand.URL}}<p style="color: #888; font-size: 0.9em;"><a href="{{.}}/" style="color: #888;">{{$.Brand.Title}}</a></p>{{end}}
+</body>
+</html>
+`))
+
+// send sends the current top stories to every target.
+func (d *digest) send(at time.Time) error {
+	stories, err := d.stories()
+	if err != nil {
+		return err
+	}
+	if len(stories) > d.numStories {
+		stories = stories[:d.numStories]
+	}
+	for _, t := range d.targets {
+		if err := t.sendDigest(stories, at); err != nil {
+			log.Printf("failed to send the digest: %s", err)
+		}
+	}
+	return nil
+}
+
+func (d mailDigest) sendDigest(stories []item, at time.Time) error {
+	msg, err := d.message(stories, at)
+	if err != nil {
+		return err
+	}
+	return d.mailer.send(d.to, msg)
+}
+
+// message returns the digest of the stories as a multipart mail with a
+// plain text and an HTML version.
+func (d mailDigest) message(stories []item, at time.Time) ([]byte, error) {
+	data := digestData{
+		Subject: d.locale.T("digest_subject", d.brand.Title, at.Format(dateLayout)),
+		Brand:   d.brand,
+	}
+	for _, s := range stories {
+		data.Stories = append(data.Stories, newDigestLine(d.locale, s))
+	}
+
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", d.mailer.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(d.to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", data.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", at.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+
+	// the last part is the preferred one
+	render := []struct {
+		contentType string
+		execute     func(*quotedprintable.Writer) error
+	}{
+		{"text/plain", func(w *quotedprintable.Writer) error { return digestText.Execute(w, data) }},
+		{"text/html", func(w *quotedprintable.Writer) error { return digestHTML.Execute(w, data) }},
+	}
+	for _, r := range render {
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {r.contentType + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(part)
+		if err := r.execute(qp); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+	buf.Write(body.Bytes())
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// feedCach keeps the feeds serialized for the refresh of the cache they were
+// rendered from, and renders a feed once for all the requests that ask for it
+// at the same time, which feed readers polling on the hour tend to do.
+type feedCach struct {
+	group singleflight.Group
+	mutex sync.Mutex
+	feeds map[string]renderedFeed
+}
+
+// renderedFeed is a serialized feed and the refresh it shows.
+type renderedFeed struct {
+	body        []byte
+	refreshedAt time.Time
+}
+
+func newFeedCach() *feedCach {
+	return &feedCach{feeds: make(map[string]renderedFeed)}
+}
+
+// feedKey identifies a feed by its format, the view and the base URL its
+// links are made absolute against. Feeds of a visitor's own filters are not
+// kept.
+func feedKey(format string, v view, brand branding) (string, bool) {
+	if v.filters != nil {
+		return "", false
+	}
+	return fmt.Sprintf("%s %t %q %q %t %d %q %s", format, v.TextPosts, v.Tag, strings.Join(v.ExcludeTags, ","), v.HideReposts, v.numStories, v.sort, brand.URL), true
+}
+
+// get returns the feed kept for the refresh at refreshedAt, or renders it,
+// once for everyone asking while it renders.
+func (f *feedCach) get(key string, refreshedAt time.Time, render func() ([]byte, error)) ([]byte, error) {
+	if f == nil {
+		return render()
+	}
+	f.mutex.Lock()
+	feed, ok := f.feeds[key]
+	f.mutex.Unlock()
+	if ok && feed.refreshedAt.Equal(refreshedAt) {
+		return feed.body, nil
+	}
+	body, err, _ := f.group.Do(key+" "+refreshedAt.String(), func() (interface{}, error) {
+		body, err := render()
+		if err != nil {
+			return nil, err
+		}
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		if _, ok := f.feeds[key]; ok || len(f.feeds) < maxPages {
+			f.feeds[key] = renderedFeed{body: body, refreshedAt: refreshedAt}
+		}
+		return body, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return body.([]byte), nil
+}
+
+// feedHandler serves a feed of the front page, encode serializes the stories
+// of the view into it.
+func feedHandler(c *cach, cfg config, format, contentType string, encode func(stories []item, brand branding) ([]byte, error)) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := c.ready(r.Context()); err != nil {
+			storiesError(w, err)
+			return
+		}
+		v := cfg.view(r)
+		brand := cfg.brand(r)
+		render := func() ([]byte, error) {
+			stories, err := c.getTopStories(r.Context(), v)
+			if err != nil {
+				return nil, err
+			}
+			return encode(stories, brand)
+		}
+		var body []byte
+		var err error
+		if key, ok := feedKey(format, v, brand); ok {
+			body, err = c.feeds.get(key, c.refreshed(), render)
+		} else {
+			body, err = render()
+		}
+		if err != nil {
+			http.Error(w, "Failed to encode the feed", http.StatusInternalServerError)
+			return
+		}
+		cfg.sharedCaching(w, r, feedKeys...)
+		w.Header().Set("Content-Type", contentType)
+		w.Write(body)
+	})
+}
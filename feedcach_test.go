@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFeedCach_Get(t *testing.T) {
+	f := newFeedCach()
+	var renders atomic.Int32
+	release := make(chan struct{})
+	render := func() ([]byte, error) {
+		renders.Add(1)
+		<-release
+		return []byte("feed"), nil
+	}
+	refreshed := time.Now()
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if body, err := f.get("rss", refreshed, render); err != nil || string(body) != "feed" {
+				t.Errorf("get: want feed, got %q %v", body, err)
+			}
+		}()
+	}
+	// let the requests pile up on the first render
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := renders.Load(); n != 1 {
+		t.Errorf("concurrent requests: want 1 render, got %d", n)
+	}
+
+	f.get("rss", refreshed, render)
+	if n := renders.Load(); n != 1 {
+		t.Errorf("same refresh: want the feed kept, got %d renders", n)
+	}
+	f.get("rss", refreshed.Add(time.Second), render)
+	if n := renders.Load(); n != 2 {
+		t.Errorf("next refresh: want the feed rendered again, got %d renders", n)
+	}
+}
+
+func TestRSSHandler_FeedCach(t *testing.T) {
+	cfg := config{SiteTitle: "Quiet", CookieSecret: "secret"}
+	c := newCach(2, nil, cachOptions{feeds: newFeedCach()})
+	c.cashedItems = []item{testStory(1, "First", "https://a.com/1", 10)}
+	c.refreshedAt, c.expiration = time.Now(), time.Now().Add(time.Hour)
+	h := rssHandler(c, cfg)
+	get := func(target string) string {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", target, nil))
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/rss+xml") {
+			t.Errorf("%s: want an RSS feed, got %s", target, ct)
+		}
+		return rec.Body.String()
+	}
+
+	if body := get("/rss"); !strings.Contains(body, "First") || !strings.HasPrefix(body, "<?xml") {
+		t.Fatalf("first request: want the story, got %s", body)
+	}
+	c.cashedItems = []item{testStory(2, "Second", "https://a.com/2", 10)}
+	if body := get("/rss"); !strings.Contains(body, "First") {
+		t.Error("same refresh: want the feed kept")
+	}
+	if body := get("/rss?text_posts=true"); !strings.Contains(body, "Second") {
+		t.Error("other view: want a feed of its own")
+	}
+	c.refreshedAt = time.Now().Add(time.Second)
+	if body := get("/rss"); !strings.Contains(body, "Second") {
+		t.Error("after a refresh: want the feed rendered again")
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// feed paths, also used for the autodiscovery links in the layout
+const (
+	rssPath      = "/rss"
+	atomPath     = "/atom"
+	jsonFeedPath = "/feed.json"
+	// rulePath is followed by the name of a watch rule
+	rulePath = rssPath + "/rule/"
+)
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Comments    string  `xml:"comments"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Description string  `xml:"description,omitempty"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	Title   string     `xml:"title"`
+	ID      string     `xml:"id"`
+	Updated string     `xml:"updated"`
+	Links   []atomLink `xml:"link"`
+	Author  atomAuthor `xml:"author"`
+	Summary string     `xml:"summary,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	ExternalURL   string           `json:"external_url"`
+	Title         string           `json:"title"`
+	Summary       string           `json:"summary,omitempty"`
+	DatePublished string           `json:"date_published"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+// discussionURL returns the HN comment page of a story.
+func discussionURL(id int) string {
+	return fmt.Sprintf("https://news.ycombinator.com/item?id=%d", id)
+}
+
+func rssHandler(c *cach, cfg config) http.HandlerFunc {
+	return feedHandler(c, cfg, "rss", "application/rss+xml; charset=utf-8", func(stories []item, brand branding) ([]byte, error) {
+		feed := newRSS(brand, brand.Title)
+		for _, s := range stories {
+			feed.Channel.Items = append(feed.Channel.Items, newRSSItem(brand, s, s.Posted()))
+		}
+		return marshalXML(feed)
+	})
+}
+
+// ruleFeedHandler serves the stories that matched a watch rule as RSS, at
+// /rss/rule/{name}. Stories are dated by when they matched, which is when
+// they made it to the front page.
+func ruleFeedHandler(watch *watcher, cfg config) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, rulePath)
+		matches, ok := watch.feed(name)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		brand := cfg.brand(r)
+		feed := newRSS(brand, brand.Title+": "+name)
+		for _, m := range matches {
+			feed.Channel.Items = append(feed.Channel.Items, newRSSItem(brand, m.Story, m.At))
+		}
+		writeXML(w, "application/rss+xml; charset=utf-8", feed)
+	})
+}
+
+func newRSS(brand branding, title string) rss {
+	return rss{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         title,
+			Link:          brand.URL + "/",
+			Description:   brand.Description,
+			LastBuildDate: time.Now().UTC().Format(time.RFC1123Z),
+			Items:         []rssItem{},
+		},
+	}
+}
+
+func newRSSItem(brand branding, s item, date time.Time) rssItem {
+	return rssItem{
+		Title:       s.Title,
+		Link:        absolute(brand, s.Link()),
+		Comments:    s.CommentsURL(),
+		GUID:        rssGUID{Value: s.CommentsURL(), IsPermaLink: true},
+		PubDate:     date.UTC().Format(time.RFC1123Z),
+		Description: s.Description,
+	}
+}
+
+func atomHandler(c *cach, cfg config) http.HandlerFunc {
+	return feedHandler(c, cfg, "atom", "application/atom+xml; charset=utf-8", func(stories []item, brand branding) ([]byte, error) {
+		feed := atomFeed{
+			Title:   brand.Title,
+			ID:      brand.URL + "/",
+			Updated: time.Now().UTC().Format(time.RFC3339),
+			Links: []atomLink{
+				{Href: brand.URL + "/", Rel: "alternate", Type: "text/html"},
+				{Href: brand.URL + atomPath, Rel: "self", Type: "application/atom+xml"},
+			},
+		}
+		for _, s := range stories {
+			feed.Entries = append(feed.Entries, atomEntry{
+				Title:   s.Title,
+				ID:      s.CommentsURL(),
+				Updated: s.Posted().UTC().Format(time.RFC3339),
+				Links: []atomLink{
+					{Href: absolute(brand, s.Link()), Rel: "alternate"},
+					{Href: s.CommentsURL(), Rel: "replies", Type: "text/html"},
+				},
+				Author:  atomAuthor{Name: s.By},
+				Summary: s.Description,
+			})
+		}
+		return marshalXML(feed)
+	})
+}
+
+func jsonFeedHandler(c *cach, cfg config) http.HandlerFunc {
+	return feedHandler(c, cfg, "json", "application/feed+json; charset=utf-8", func(stories []item, brand branding) ([]byte, error) {
+		feed := jsonFeed{
+			Version:     "https://jsonfeed.org/version/1.1",
+			Title:       brand.Title,
+			HomePageURL: brand.URL + "/",
+			FeedURL:     brand.URL + jsonFeedPath,
+			Description: brand.Description,
+			Items:       []jsonFeedItem{},
+		}
+		for _, s := range stories {
+			feed.Items = append(feed.Items, jsonFeedItem{
+				ID:            s.CommentsURL(),
+				URL:           s.CommentsURL(),
+				ExternalURL:   absolute(brand, s.Link()),
+				Title:         s.Title,
+				Summary:       s.Description,
+				DatePublished: s.Posted().UTC().Format(time.RFC3339),
+				Authors:       []jsonFeedAuthor{{Name: s.By}},
+			})
+		}
+		out, err := json.MarshalIndent(feed, "", "  ")
+		return append(out, '\n'), err
+	})
+}
+
+// absolute turns a link to a local page into an absolute URL.
+func absolute(brand branding, link string) string {
+	if strings.HasPrefix(link, "/") {
+		return brand.URL + link
+	}
+	return link
+}
+
+func writeXML(w http.ResponseWriter, contentType string, v interface{}) {
+	out, err := marshalXML(v)
+	if err != nil {
+		http.Error(w, "Failed to encode the feed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(out)
+}
+
+// marshalXML encodes a feed as an XML document.
+func marshalXML(v interface{}) ([]byte, error) {
+	out, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
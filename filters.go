@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// listReloadDelay is how long the watch on the list files waits for more
+// events before reloading, editors write a file in several steps.
+const listReloadDelay = 200 * time.Millisecond
+
+// filters decides which items make it onto the front page.
+type filters struct {
+	showJobs bool
+	// minKarma is the karma a submitter needs, looked up through karma
+	minKarma int
+	karma    *karmaCach
+
+	// mutex guards the rules below, which /admin/config can change and
+	// which are made again when a list file of cfg changes. listsAt holds
+	// the modification times of the list files the rules were read from,
+	// muteEntries the entries muted holds the patterns of
+	mutex          sync.RWMutex
+	cfg            config
+	listsAt        map[string]time.Time
+	blockedDomains map[string]bool
+	blockedUsers   map[string]bool
+	minScore       int
+	minComments    int
+	maxAge         time.Duration
+	muteEntries    []string
+	muted          []*regexp.Regexp
+}
+
+func newFilters(cfg config) (*filters, error) {
+	f, err := readFilters(cfg)
+	if err != nil {
+		return nil, err
+	}
+	f.showJobs, f.minKarma = cfg.ShowJobs, cfg.MinKarma
+	if f.minKarma > 0 {
+		f.karma = newKarmaCach()
+	}
+	return f, nil
+}
+
+// readFilters makes the rules of cfg, from its flags and list files.
+func readFilters(cfg config) (*filters, error) {
+	f := &filters{
+		cfg:            cfg,
+		listsAt:        make(map[string]time.Time),
+		blockedDomains: make(map[string]bool),
+		blockedUsers:   make(map[string]bool),
+		minScore:       cfg.MinScore,
+		minComments:    cfg.MinComments,
+		maxAge:         cfg.MaxAge,
+	}
+	// read the times first, so a file written while it is read is read
+	// again
+	for _, path := range cfg.listFiles() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		f.listsAt[path] = info.ModTime()
+	}
+	domains, err := listOf(cfg.BlockDomains, cfg.BlockDomainsFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range domains {
+		f.blockDomain(d)
+	}
+	users, err := listOf(cfg.BlockUsers, cfg.BlockUsersFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range users {
+		f.blockUser(u)
+	}
+	mute, err := listOf(cfg.Mute, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range mute {
+		re, err := compileMute(m)
+		if err != nil {
+			return nil, err
+		}
+		f.muteEntries, f.muted = append(f.muteEntries, m), append(f.muted, re)
+	}
+	if cfg.MuteFile != "" {
+		lines, err := readListFile(cfg.MuteFile)
+		if err != nil {
+			return nil, err
+		}
+		for i, line := range lines {
+			re, err := compileMute(line)
+			if err != nil {
+				return nil, fmt.Errorf("%s: pattern %d: %w", cfg.MuteFile, i+1, err)
+			}
+			f.muteEntries, f.muted = append(f.muteEntries, line), append(f.muted, re)
+		}
+	}
+	return f, nil
+}
+
+// listFiles are the files of the filter lists, which are reloaded when they
+// change.
+func (cfg config) listFiles() []string {
+	var files []string
+	for _, path := range []string{cfg.BlockDomainsFile, cfg.BlockUsersFile, cfg.MuteFile} {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// listOf returns the entries of a comma separated flag and of a list file,
+// if there is one.
+func listOf(flag, file string) ([]string, error) {
+	var entries []string
+	for _, e := range strings.Split(flag, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			entries = append(entries, e)
+		}
+	}
+	if file == "" {
+		return entries, nil
+	}
+	lines, err := readListFile(file)
+	return append(entries, lines...), err
+}
+
+// reload makes the rules again if a list file changed since they were read.
+// On error the rules there are stay in effect.
+func (f *filters) reload() error {
+	f.mutex.RLock()
+	listsAt := f.listsAt
+	f.mutex.RUnlock()
+	changed := false
+	for path, at := range listsAt {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		changed = changed || !info.ModTime().Equal(at)
+	}
+	if !changed {
+		return nil
+	}
+	return f.reread()
+}
+
+// reread makes the rules again from the list files, whether or not their
+// modification times moved, which they don't on every save on file systems
+// with coarse times.
+func (f *filters) reread() error {
+	f.mutex.RLock()
+	cfg := f.cfg
+	f.mutex.RUnlock()
+	g, err := readFilters(cfg)
+	if err != nil {
+		return err
+	}
+	f.set(g)
+	return nil
+}
+
+// watch reloads the rules as soon as a list file is saved, rather than on
+// the next refresh, and calls changed after, until the returned function is
+// called. The directories of the files are watched, as editors save by
+// replacing the file.
+func (f *filters) watch(changed func()) (func() error, error) {
+	f.mutex.RLock()
+	files := f.cfg.listFiles()
+	f.mutex.RUnlock()
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	watched := make(map[string]bool)
+	for _, path := range files {
+		watched[filepath.Clean(path)] = true
+		if err := w.Add(filepath.Dir(path)); err != nil {
+			w.Close()
+			return nil, err
+		}
+	}
+	go func() {
+		timer := time.NewTimer(listReloadDelay)
+		timer.Stop()
+		for {
+			select {
+			case ev, ok := <-w.Events:
+				if !ok {
+					timer.Stop()
+					return
+				}
+				if watched[filepath.Clean(ev.Name)] && !ev.Has(fsnotify.Chmod) {
+					timer.Reset(listReloadDelay)
+				}
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("failed to watch the filter lists: %s", err)
+			case <-timer.C:
+				if err := f.reread(); err != nil {
+					log.Printf("failed to reload filters: %s", err)
+					break
+				}
+				changed()
+			}
+		}
+	}()
+	return w.Close, nil
+}
+
+// set takes the rules of g, made by readFilters, and logs what changed in
+// the lists. The karma and jobs settings stay as they are.
+func (f *filters) set(g *filters) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for _, l := range []struct {
+		name     string
+		old, new []string
+	}{
+		{"blocked domains", slices.Sorted(maps.Keys(f.blockedDomains)), slices.Sorted(maps.Keys(g.blockedDomains))},
+		{"blocked users", slices.Sorted(maps.Keys(f.blockedUsers)), slices.Sorted(maps.Keys(g.blockedUsers))},
+		{"muted titles", f.muteEntries, g.muteEntries},
+	} {
+		if d := listDiff(l.old, l.new); d != "" {
+			log.Printf("%s changed: %s", l.name, d)
+		}
+	}
+	f.cfg, f.listsAt = g.cfg, g.listsAt
+	f.blockedDomains, f.blockedUsers = g.blockedDomains, g.blockedUsers
+	f.minScore, f.minComments, f.maxAge = g.minScore, g.minComments, g.maxAge
+	f.muteEntries, f.muted = g.muteEntries, g.muted
+}
+
+// listDiff describes the entries added to and removed from a list, like
+// "+a +b -c", empty if none were.
+func listDiff(old, new []string) string {
+	var d []string
+	for _, e := range new {
+		if !slices.Contains(old, e) {
+			d = append(d, "+"+e)
+		}
+	}
+	for _, e := range old {
+		if !slices.Contains(new, e) {
+			d = append(d, "-"+e)
+		}
+	}
+	return strings.Join(d, " ")
+}
+
+// compileMute turns a mute list entry into a case-insensitive pattern. An
+// entry like /regexp/ is used as is, anything else is a keyword that has to
+// appear as a whole word.
+func compileMute(entry string) (*regexp.Regexp, error) {
+	if len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+		return regexp.Compile("(?i)" + entry[1:len(entry)-1])
+	}
+	return regexp.Compile(`(?i)(^|[^\p{L}\p{N}])` + regexp.QuoteMeta(entry) + `($|[^\p{L}\p{N}])`)
+}
+
+func (f *filters) blockDomain(domain string) {
+	// in punycode, like the hosts blockedDomains are looked up with
+	domain = strings.TrimPrefix(asciiHost(strings.TrimSpace(domain)), "www.")
+	if domain != "" {
+		f.blockedDomains[domain] = true
+	}
+}
+
+func (f *filters) blockUser(user string) {
+	if user = strings.ToLower(strings.TrimSpace(user)); user != "" {
+		f.blockedUsers[user] = true
+	}
+}
+
+// keep reports whether an item belongs on the front page. It is called for
+// many items at once. Job ads are only kept with -show_jobs, and as they have
+// no votes or comments, the thresholds don't apply to them.
+func (f *filters) keep(item item) bool {
+	// the karma is looked up without the lock, which would hold up a change
+	// of the rules for as long
+	return f.allowed(item) &&
+		// karma is a thing of HN users alone
+		(isJob(item) || item.Source != "" || f.enoughKarma(item.By))
+}
+
+// allowed applies the rules guarded by mutex to an item.
+func (f *filters) allowed(item item) bool {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+	switch {
+	case isJob(item):
+		if !f.showJobs {
+			return false
+		}
+	case isStory(item):
+		if item.Score < f.minScore || item.Descendants < f.minComments {
+			return false
+		}
+	default:
+		return false
+	}
+	return (f.maxAge == 0 || time.Since(item.Posted()) <= f.maxAge) &&
+		!f.domainBlocked(item.Host) &&
+		!f.blockedUsers[strings.ToLower(item.By)] &&
+		!f.titleMuted(item.Title)
+}
+
+// enoughKarma reports whether user has at least the karma required. If it
+// can't be looked up the story is kept, rather than emptying the front page
+// whenever the API has trouble.
+func (f *filters) enoughKarma(user string) bool {
+	if f.minKarma <= 0 {
+		return true
+	}
+	karma, err := f.karma.get(user)
+	if err != nil {
+		log.Printf("failed to look up the karma of %s: %s", user, err)
+		return true
+	}
+	return karma >= f.minKarma
+}
+
+// titleMuted reports whether a title matches a muted pattern, mutex must be
+// held.
+func (f *filters) titleMuted(title string) bool {
+	for _, re := range f.muted {
+		if re.MatchString(title) {
+			return true
+		}
+	}
+	return false
+}
+
+// domainBlocked reports whether host or any of its parent domains is
+// blocked, so blocking example.com also blocks blog.example.com. mutex must
+// be held.
+func (f *filters) domainBlocked(host string) bool {
+	host = asciiHost(host)
+	for host != "" {
+		if f.blockedDomains[host] {
+			return true
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return false
+}
+
+// readListFile returns the trimmed, non-empty lines of a file, skipping
+// comment lines that start with #.
+func readListFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFilters_Watch(t *testing.T) {
+	dir := t.TempDir()
+	domains := filepath.Join(dir, "domains.txt")
+	if err := os.WriteFile(domains, []byte("example.org\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := newFilters(config{BlockDomainsFile: domains})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := make(chan bool, 1)
+	stop, err := f.watch(func() { changed <- true })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	story := item{Host: "example.com"}
+	story.Type, story.Time = "story", int(time.Now().Unix())
+	if !f.keep(story) {
+		t.Fatalf("example.com: want it kept before it is blocked")
+	}
+
+	// save the way editors do, replacing the file
+	tmp := domains + ".swp"
+	if err := os.WriteFile(tmp, []byte("example.org\nexample.com\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, domains); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("watch: want the change reported after the file was saved")
+	}
+	if f.keep(story) {
+		t.Errorf("example.com: want it blocked after the file was saved")
+	}
+}
+
+func TestFilters_ReloadInvalid(t *testing.T) {
+	mute := filepath.Join(t.TempDir(), "mute.txt")
+	if err := os.WriteFile(mute, []byte("crypto\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := newFilters(config{MuteFile: mute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(mute, []byte("/(/\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// make sure the modification time moves on coarse file systems
+	later := time.Now().Add(time.Second)
+	os.Chtimes(mute, later, later)
+	if err := f.reload(); err == nil {
+		t.Errorf("reload: want the invalid pattern rejected")
+	}
+	var story item
+	story.Type, story.Title = "story", "All about crypto"
+	if f.keep(story) {
+		t.Errorf("reload: want the patterns before kept")
+	}
+}
+
+func TestListDiff(t *testing.T) {
+	tests := []struct {
+		old, new []string
+		want     string
+	}{
+		{nil, nil, ""},
+		{[]string{"a"}, []string{"a", "b"}, "+b"},
+		{[]string{"a", "c"}, []string{"b"}, "+b -a -c"},
+	}
+	for _, tt := range tests {
+		if got := listDiff(tt.old, tt.new); got != tt.want {
+			t.Errorf("%v to %v: want %q, got %q", tt.old, tt.new, tt.want, got)
+		}
+	}
+}
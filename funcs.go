@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// templateFuncs are the functions every template can call, the built-in ones
+// and those of -templates_dir. templates/README.md documents them.
+var templateFuncs = template.FuncMap{
+	"humanizeTime": humanizeTime,
+	"pluralize":    pluralize,
+	"truncate":     truncateWords,
+	"host":         urlHost,
+	"commaize":     commaize,
+	"markdownSafe": markdownSafe,
+}
+
+// humanizeTime returns the age of t in its largest whole unit, like 5m, 3h
+// or 2d, and the date for times older than a month, in no language so it
+// reads the same in all of them. .L.Ago says it in words.
+func humanizeTime(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Hour:
+		return strconv.Itoa(max(int(d/time.Minute), 1)) + "m"
+	case d < 24*time.Hour:
+		return strconv.Itoa(int(d/time.Hour)) + "h"
+	case d < 30*24*time.Hour:
+		return strconv.Itoa(int(d/(24*time.Hour))) + "d"
+	}
+	return t.Format("2006-01-02")
+}
+
+// pluralize returns n, commaized, with one or other after it, as English
+// has it. .L.N has the plurals of every language.
+func pluralize(n int, one, other string) string {
+	if n == 1 {
+		return "1 " + one
+	}
+	return commaize(n) + " " + other
+}
+
+// truncateWords shortens s to at most n characters, cut at the last space in
+// the second half and ending in an ellipsis. n comes first, so it pipes:
+// {{.Title | truncate 40}}.
+func truncateWords(n int, s string) string {
+	runes := []rune(s)
+	if n <= 0 || len(runes) <= n {
+		return s
+	}
+	cut := n - 1
+	for i := cut; i > n/2; i-- {
+		if runes[i] == ' ' {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimRight(string(runes[:cut]), " ,.;:") + "…"
+}
+
+// urlHost returns the host of a link the way .Host is: without "www." and
+// internationalized hosts in Unicode unless they pass for another.
+func urlHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return ""
+	}
+	display, _ := displayHost(strings.TrimPrefix(u.Hostname(), "www."))
+	return display
+}
+
+// commaize writes n with a comma between each group of three digits.
+func commaize(n int) string {
+	s := strconv.Itoa(n)
+	sign := ""
+	if n < 0 {
+		sign, s = "-", s[1:]
+	}
+	var b strings.Builder
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(c)
+	}
+	return sign + b.String()
+}
+
+var (
+	markdownCode   = regexp.MustCompile("`([^`\n]+)`")
+	markdownStrong = regexp.MustCompile(`\*\*([^*\n]+)\*\*`)
+	markdownEm     = regexp.MustCompile(`\*([^*\n]+)\*`)
+	markdownLink   = regexp.MustCompile(`\[([^\]\n]+)\]\((https?://[^\s)]+)\)`)
+	markdownBreak  = regexp.MustCompile(`\n\s*\n`)
+)
+
+// markdownSafe renders the little Markdown of a text written by hand, like
+// a footer or a setting: paragraphs on blank lines, `code`, **bold**,
+// *italics* and [links](https://…) to http and https URLs. The rest is
+// escaped, so no markup gets through but what this makes.
+func markdownSafe(s string) template.HTML {
+	var paragraphs []string
+	for _, p := range markdownBreak.Split(strings.TrimSpace(s), -1) {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		// code goes first and keeps its stars, the other spans can't see
+		// into it once it is replaced by a placeholder
+		var codes []string
+		p = markdownCode.ReplaceAllStringFunc(html.EscapeString(p), func(m string) string {
+			codes = append(codes, "<code>"+markdownCode.FindStringSubmatch(m)[1]+"</code>")
+			return fmt.Sprintf("\x00%d\x00", len(codes)-1)
+		})
+		p = markdownLink.ReplaceAllString(p, `<a href="$2">$1</a>`)
+		p = markdownStrong.ReplaceAllString(p, "<strong>$1</strong>")
+		p = markdownEm.ReplaceAllString(p, "<em>$1</em>")
+		for i, c := range codes {
+			p = strings.Replace(p, fmt.Sprintf("\x00%d\x00", i), c, 1)
+		}
+		paragraphs = append(paragraphs, "<p>"+strings.ReplaceAll(p, "\n", "<br>")+"</p>")
+	}
+	return template.HTML(strings.Join(paragraphs, "\n"))
+}
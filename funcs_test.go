@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	now := time.Now()
+	for _, tt := range []struct {
+		got, want string
+	}{
+		{humanizeTime(now), "1m"},
+		{humanizeTime(now.Add(-90 * time.Minute)), "1h"},
+		{humanizeTime(now.Add(-50 * time.Hour)), "2d"},
+		{humanizeTime(time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC)), "2020-03-04"},
+		{pluralize(1, "point", "points"), "1 point"},
+		{pluralize(1234, "point", "points"), "1,234 points"},
+		{truncateWords(12, "A short title"), "A short…"},
+		{truncateWords(20, "A short title"), "A short title"},
+		{urlHost("https://www.example.com/a"), "example.com"},
+		{urlHost("https://xn--bcher-kva.de/"), "bücher.de"},
+		{urlHost("not a url"), ""},
+		{commaize(999), "999"},
+		{commaize(1234567), "1,234,567"},
+		{commaize(-1000), "-1,000"},
+		{string(markdownSafe("Hi *you* and **all**,\nsee `a*b*` at [this](https://a.com/?x=1&y=2).\n\n<script>")),
+			"<p>Hi <em>you</em> and <strong>all</strong>,<br>see <code>a*b*</code> at <a href=\"https://a.com/?x=1&amp;y=2\">this</a>.</p>\n<p>&lt;script&gt;</p>"},
+		{string(markdownSafe("[x](javascript:alert(1))")), "<p>[x](javascript:alert(1))</p>"},
+	} {
+		if tt.got != tt.want {
+			t.Errorf("want %q, got %q", tt.want, tt.got)
+		}
+	}
+}
+
+func TestTemplateFuncs_Custom(t *testing.T) {
+	dir := t.TempDir()
+	custom := `{{define "content"}}{{range .Stories}}{{.Title | truncate 10}} {{host .URL}} {{pluralize .Score "point" "points"}};{{end}}{{end}}`
+	if err := os.WriteFile(filepath.Join(dir, "index.gohtml"), []byte(custom), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tpls, err := loadTemplates(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{Lang: "en", CookieSecret: "secret"}
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	data := templateData{Stories: []item{testStory(1, "A rather long title", "https://www.a.com/x", 1200)}, pageData: cfg.pageData(req, time.Now())}
+	if err := tpls.execute(rec, "index.gohtml", data); err != nil {
+		t.Fatal(err)
+	}
+	if want := "A rather… a.com 1,200 points;"; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("want the custom template to use the functions, %q, got %q", want, rec.Body.String())
+	}
+}
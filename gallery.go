@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const galleryPath = "/show/gallery"
+
+// galleryLifeDuration is how long the Show HN stories of the gallery are
+// cached, their previews are filled in on every request as they come in.
+const galleryLifeDuration = 10 * time.Minute
+
+// galleryCach holds the current Show HN stories for the gallery.
+type galleryCach struct {
+	mutex      sync.Mutex
+	numStories int
+	filters    *filters
+	previews   *previewCach
+	stories    []item
+	expiration time.Time
+}
+
+func newGalleryCach(numStories int, filters *filters, previews *previewCach) *galleryCach {
+	return &galleryCach{numStories: numStories, filters: filters, previews: previews}
+}
+
+// get returns a copy of the stories with the previews there are so far, the
+// missing ones are fetched in the background.
+func (g *galleryCach) get(ctx context.Context) ([]item, error) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if time.Now().After(g.expiration) {
+		ids, err := hnClient.ShowItemsContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		stories, _ := fetchItems(ctx, hnSource{}, ids, g.numStories, g.filters.keep, isStory, nil)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		g.stories = stories
+		g.expiration = time.Now().Add(galleryLifeDuration)
+	}
+	stories := slices.Clone(g.stories)
+	g.previews.annotate(stories)
+	return stories, nil
+}
+
+// galleryCard is a story of the gallery, named without the "Show HN:" its
+// title starts with.
+type galleryCard struct {
+	item
+	Name string
+}
+
+func galleryCards(stories []item) []galleryCard {
+	cards := make([]galleryCard, len(stories))
+	for i, s := range stories {
+		name := s.Title
+		if len(name) > len("show hn:") && strings.EqualFold(name[:len("show hn:")], "show hn:") {
+			name = strings.TrimSpace(name[len("show hn:"):])
+		}
+		cards[i] = galleryCard{item: s, Name: name}
+	}
+	return cards
+}
+
+type galleryTemplateData struct {
+	Cards []galleryCard
+	pageData
+}
+
+// galleryHandler shows the Show HN stories as cards with the images of their
+// previews, proxied through /img.
+func galleryHandler(g *galleryCach, cfg config, tpls *templates) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		stories, err := g.get(r.Context())
+		if errors.Is(err, context.DeadlineExceeded) {
+			storiesError(w, err)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to load the Show HN stories", http.StatusInternalServerError)
+			return
+		}
+		data := galleryTemplateData{Cards: galleryCards(stories), pageData: cfg.pageData(r, start)}
+		if err := tpls.execute(w, "gallery.gohtml", data); err != nil {
+			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGallery(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/shot.png" {
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "png")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><head><meta property="og:image" content="http://%s/shot.png"><meta property="og:description" content="A widget maker"></head></html>`, r.Host)
+	}))
+	defer site.Close()
+	setupHN(t, map[int]string{
+		1: fmt.Sprintf(`{"id":1,"type":"story","title":"Show HN: Widget","url":"%s/widget","score":5}`, site.URL),
+		2: `{"id":2,"type":"story","title":"Show HN: A text post","text":"hi"}`,
+	})
+	p := newPreviewCach()
+	p.client = site.Client()
+	f, err := newFilters(config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := newGalleryCach(10, f, p)
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func() string {
+		rec := httptest.NewRecorder()
+		galleryHandler(g, config{}, tpls)(rec, httptest.NewRequest("GET", galleryPath, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: want 200, got %d", galleryPath, rec.Code)
+		}
+		return rec.Body.String()
+	}
+	if body := get(); !strings.Contains(body, ">Widget</a>") || !strings.Contains(body, ">A text post</a>") || strings.Contains(body, "/img?url=") {
+		t.Errorf("first request: want both cards without images, got %s", body)
+	}
+	p.busy.Lock()
+	p.busy.Unlock()
+	body := get()
+	if !strings.Contains(body, "/img?url=http") || !strings.Contains(body, "A widget maker") {
+		t.Errorf("second request: want the preview of the widget, got %s", body)
+	}
+	rec := httptest.NewRecorder()
+	imageHandler(p)(rec, httptest.NewRequest("GET", "/img?url="+site.URL+"/shot.png", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "png" {
+		t.Errorf("/img: want the proxied image, got %d %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// generateCommand renders the front page, and the detail pages and feeds it
+// links to, into a directory any static host can serve. The pages go through
+// the handlers of the server, only the links to dynamic pages change.
+func generateCommand(args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	out := fs.String("o", "public", "the directory to write the site to, created if needed")
+	items := fs.Bool("items", true, "also write the detail pages of text posts")
+	feeds := fs.Bool("feeds", true, "also write the RSS, Atom and JSON feeds, set -public_url for absolute links in them")
+	cfg := parseFlags(fs, args)
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	// there is no server for the jobs page and the visitor settings
+	cfg.static, cfg.ShowJobs = true, false
+	if cfg.CookieSecret == "" {
+		cfg.CookieSecret = randomSecret()
+	}
+	tpls, err := loadTemplates(cfg.TemplatesDir, false)
+	if err != nil {
+		return err
+	}
+	f, err := newFilters(cfg)
+	if err != nil {
+		return err
+	}
+	c := newCach(cfg.NumStories, f, cachOptions{})
+	stories, err := c.getTopStories(context.Background(), cfg.defaultView())
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handler(c, cfg, tpls))
+	mux.HandleFunc(itemPath, itemHandler(c, cfg, tpls))
+	mux.HandleFunc(rssPath, rssHandler(c, cfg))
+	mux.HandleFunc(atomPath, atomHandler(c, cfg))
+	mux.HandleFunc(jsonFeedPath, jsonFeedHandler(c, cfg))
+	robots, err := cfg.robotsTxt()
+	if err != nil {
+		return err
+	}
+	mux.HandleFunc(robotsPath, robotsHandler(robots))
+	pages := map[string]string{"/": "index.html", robotsPath: "robots.txt"}
+	if *feeds {
+		pages[rssPath] = "rss.xml"
+		pages[atomPath] = "atom.xml"
+		pages[jsonFeedPath] = "feed.json"
+	}
+	if *items {
+		for _, s := range stories {
+			if s.URL == "" {
+				pages[fmt.Sprintf("%s?id=%d", itemPath, s.ID)] = fmt.Sprintf("item/%d.html", s.ID)
+			}
+		}
+	}
+	links := newStaticLinks(cfg.brand(nil).URL, *items, *feeds)
+	for path, name := range pages {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK {
+			return fmt.Errorf("generate %s: %s", path, http.StatusText(rec.Code))
+		}
+		name = filepath.Join(*out, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(name, links.rewrite(rec.Body.Bytes()), 0644); err != nil {
+			return err
+		}
+	}
+	icons, err := loadIcons(cfg.IconsDir)
+	if err != nil {
+		return err
+	}
+	for name, icon := range icons {
+		if err := os.WriteFile(filepath.Join(*out, name), icon, 0644); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d pages to %s\n", len(pages), *out)
+	return nil
+}
+
+// staticLinks points the links to dynamic pages at the files written for
+// them instead. Only links that start with a quote, a tag or the instance URL
+// change, so the "item?id=" links to HN stay as they are.
+type staticLinks struct {
+	item, feed *regexp.Regexp
+}
+
+func newStaticLinks(base string, items, feeds bool) staticLinks {
+	start := `(["'>])`
+	if base != "" {
+		start = `(["'>]|` + regexp.QuoteMeta(base) + `)`
+	}
+	var l staticLinks
+	if items {
+		l.item = regexp.MustCompile(start + regexp.QuoteMeta(itemPath) + `\?id=(\d+)`)
+	}
+	if feeds {
+		l.feed = regexp.MustCompile(start + `(` + regexp.QuoteMeta(rssPath) + `|` + regexp.QuoteMeta(atomPath) + `)(["'<])`)
+	}
+	return l
+}
+
+func (l staticLinks) rewrite(page []byte) []byte {
+	if l.item != nil {
+		page = l.item.ReplaceAll(page, []byte("${1}"+itemPath+"/${2}.html"))
+	}
+	if l.feed != nil {
+		page = l.feed.ReplaceAll(page, []byte("${1}${2}.xml${3}"))
+	}
+	return page
+}
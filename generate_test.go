@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStaticLinks(t *testing.T) {
+	tests := []struct {
+		name, base, page, want string
+	}{
+		{"relative item", "", `<a href="/item?id=42">`, `<a href="/item/42.html">`},
+		{"absolute item", "https://q.example", `<link>https://q.example/item?id=42</link>`, `<link>https://q.example/item/42.html</link>`},
+		{"hn item", "", `<a href="https://news.ycombinator.com/item?id=42">`, `<a href="https://news.ycombinator.com/item?id=42">`},
+		{"feeds", "https://q.example", `href="https://q.example/rss" href="https://q.example/atom"`, `href="https://q.example/rss.xml" href="https://q.example/atom.xml"`},
+		{"rule feed", "", `href="/rss/rule/go"`, `href="/rss/rule/go"`},
+		{"json feed", "", `"url":"/item?id=7"`, `"url":"/item/7.html"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := string(newStaticLinks(tc.base, true, true).rewrite([]byte(tc.page)))
+			if got != tc.want {
+				t.Errorf("want %q, got %q", tc.want, got)
+			}
+		})
+	}
+	if got := string(newStaticLinks("", false, false).rewrite([]byte(`href="/item?id=1"`))); got != `href="/item?id=1"` {
+		t.Errorf("disabled: want the link unchanged, got %q", got)
+	}
+}
+
+func TestGenerateCommand(t *testing.T) {
+	setupHN(t, map[int]string{
+		1: storyJSON(1),
+		2: `{"id":2,"type":"story","title":"Ask HN: Two?","text":"<p>why"}`,
+		3: storyJSON(3),
+	})
+	dir := t.TempDir()
+	if err := generateCommand([]string{"-o", dir, "-include_text_posts", "-num_stories", "3"}); err != nil {
+		t.Fatal(err)
+	}
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`href="https://example.com/1"`, `href="/item/2.html"`, `href="/rss.xml"`} {
+		if !strings.Contains(string(index), want) {
+			t.Errorf("index.html: want %s in it", want)
+		}
+	}
+	for _, unwanted := range []string{`href="/settings"`, `href="/read?`} {
+		if strings.Contains(string(index), unwanted) {
+			t.Errorf("index.html: want no %s in it", unwanted)
+		}
+	}
+	for _, name := range []string{"item/2.html", "rss.xml", "atom.xml", "feed.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("%s: %s", name, err)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+// storyGroup is a run of stories next to each other from the same site, the
+// first shown and the More folded under it.
+type storyGroup struct {
+	First item
+	More  []item
+	// Site is the label of the site, or its host
+	Site string
+}
+
+// groupStories groups each run of stories of the same site, with -group_hosts
+// or ?group_hosts=1. Stories without a link stand alone.
+func groupStories(stories []item) []storyGroup {
+	var groups []storyGroup
+	for _, s := range stories {
+		site := s.Site
+		if site == "" {
+			site = s.Host
+		}
+		if n := len(groups); n > 0 && site != "" && groups[n-1].Site == site {
+			groups[n-1].More = append(groups[n-1].More, s)
+			continue
+		}
+		groups = append(groups, storyGroup{First: s, Site: site})
+	}
+	return groups
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGroupStories(t *testing.T) {
+	stories := []item{
+		testStory(1, "Launch", "https://a.com/1", 10),
+		testStory(2, "Docs", "https://docs.a.com/2", 10),
+		testStory(3, "Follow-up", "https://a.com/3", 10),
+		testStory(4, "Other", "https://b.com/4", 10),
+		testStory(5, "Pages", "https://someone.github.io/5", 10),
+		testStory(6, "More pages", "https://someone.github.io/6", 10),
+		testStory(7, "Ask", "", 10),
+		testStory(8, "Ask too", "", 10),
+	}
+	var got []string
+	for _, g := range groupStories(stories) {
+		got = append(got, g.First.Title+"+"+strings.Repeat("+", len(g.More)))
+	}
+	want := "Launch+ Docs+ Follow-up+ Other+ Pages++ Ask+ Ask too+"
+	if strings.Join(got, " ") != want {
+		t.Errorf("want %s, got %s", want, strings.Join(got, " "))
+	}
+
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCach(10, nil, cachOptions{})
+	c.cashedItems = stories
+	c.refreshedAt, c.expiration = time.Now(), time.Now().Add(time.Hour)
+	for target, grouped := range map[string]bool{"/?group_hosts=1": true, "/": false} {
+		rec := httptest.NewRecorder()
+		handler(c, config{Lang: "en", NumStories: 10, IncludeTextPosts: true}, tpls)(rec, httptest.NewRequest("GET", target, nil))
+		body := rec.Body.String()
+		if got := strings.Contains(body, "1 more <span class=\"host\">from someone.github.io</span>"); got != grouped {
+			t.Errorf("%s: want the github.io stories grouped %t, got %t", target, grouped, got)
+		}
+		if !strings.Contains(body, "More pages") {
+			t.Errorf("%s: want all the stories on the page", target)
+		}
+	}
+}
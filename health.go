@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+const healthPath = "/healthz"
+
+// sourceHealth is what /healthz reports of the cache of a source.
+type sourceHealth struct {
+	Source string `json:"source"`
+	// LastSuccess is the last refresh that succeeded, nil before the first
+	LastSuccess *time.Time `json:"last_success"`
+	// Failures counts the refreshes in a row that failed after it
+	Failures int `json:"consecutive_failures"`
+	// Latency is how long the list of stories took to come on the last
+	// refresh, failed or not
+	Latency   string `json:"latency"`
+	LastError string `json:"last_error,omitempty"`
+	Stale     bool   `json:"stale"`
+}
+
+type healthReport struct {
+	Status  string         `json:"status"`
+	Sources []sourceHealth `json:"sources"`
+}
+
+func (c *cach) health(source string, staleAfter time.Duration) sourceHealth {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+	h := sourceHealth{Source: source, Failures: c.failures, Latency: c.lastFetch.latency.Round(time.Millisecond).String()}
+	if !c.refreshedAt.IsZero() {
+		at := c.refreshedAt
+		h.LastSuccess = &at
+	}
+	if c.failures > 0 && c.lastErr != nil {
+		h.LastError = c.lastErr.Error()
+	}
+	// an idle instance puts its refreshes off on purpose, the stories get
+	// old without anything being wrong
+	now := time.Now()
+	h.Stale = staleAfter > 0 && now.Sub(c.refreshedAt) > staleAfter && !c.idle.quiet(now)
+	return h
+}
+
+// healthHandler reports how the refreshes of each source are doing. It
+// answers 503 once the stories of the front page, the first source, are
+// older than -stale_after, unless the instance is idle, the other sources
+// only show up in the body, an instance still serves its front page without
+// them.
+func healthHandler(caches []*cach, cfg config) http.HandlerFunc {
+	names := cfg.sourceNames()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := healthReport{Status: "ok"}
+		for i, c := range caches {
+			report.Sources = append(report.Sources, c.health(names[i], cfg.StaleAfter))
+		}
+		status := http.StatusOK
+		if len(report.Sources) > 0 && report.Sources[0].Stale {
+			report.Status, status = "stale", http.StatusServiceUnavailable
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	})
+}
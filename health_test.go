@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	var down atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Path == "/topstories.json" {
+			fmt.Fprint(w, "[1]")
+			return
+		}
+		fmt.Fprint(w, storyJSON(1))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	old := hnClient
+	hnClient.HTTPClient = &http.Client{Transport: hnTransport{server: u, next: http.DefaultTransport}}
+	defer func() { hnClient = old }()
+
+	f, err := newFilters(config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCach(1, f, cachOptions{})
+	cfg := config{Sources: "hn", StaleAfter: time.Hour}
+	h := healthHandler([]*cach{c}, cfg)
+	get := func() (int, healthReport) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", healthPath, nil))
+		var report healthReport
+		if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+			t.Fatalf("want a JSON report, got %v in %q", err, rec.Body.String())
+		}
+		return rec.Code, report
+	}
+
+	if code, report := get(); code != http.StatusServiceUnavailable || report.Sources[0].LastSuccess != nil {
+		t.Errorf("before the first refresh: want 503 without a last success, got %d and %+v", code, report)
+	}
+
+	c.forceRefresh()
+	code, report := get()
+	if code != http.StatusOK || report.Status != "ok" || len(report.Sources) != 1 {
+		t.Fatalf("after a refresh: want 200 and ok, got %d and %+v", code, report)
+	}
+	s := report.Sources[0]
+	if s.Source != "hn" || s.LastSuccess == nil || s.Failures != 0 || s.Latency == "" || s.Stale {
+		t.Errorf("after a refresh: want a last success and no failures, got %+v", s)
+	}
+
+	down.Store(true)
+	c.forceRefresh()
+	c.forceRefresh()
+	if code, report := get(); code != http.StatusOK || report.Sources[0].Failures != 2 || report.Sources[0].LastError == "" {
+		t.Errorf("failing within stale_after: want 200 with 2 failures and the error, got %d and %+v", code, report)
+	}
+
+	c.dataMutex.Lock()
+	c.refreshedAt = time.Now().Add(-2 * time.Hour)
+	c.dataMutex.Unlock()
+	if code, report := get(); code != http.StatusServiceUnavailable || report.Status != "stale" || !report.Sources[0].Stale {
+		t.Errorf("failing past stale_after: want 503 and stale, got %d and %+v", code, report)
+	}
+
+	c.idle = newIdleness(time.Minute, 0)
+	c.idle.lastRequest.Store(time.Now().Add(-time.Hour).UnixNano())
+	if code, report := get(); code != http.StatusOK || report.Sources[0].Stale {
+		t.Errorf("idle past stale_after: want 200, the refreshes are put off, got %d and %+v", code, report)
+	}
+	c.idle = nil
+
+	down.Store(false)
+	c.forceRefresh()
+	if code, report := get(); code != http.StatusOK || report.Sources[0].Failures != 0 {
+		t.Errorf("recovered: want 200 and the failures reset, got %d and %+v", code, report)
+	}
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neghoda/quiet_hn/hn"
+	"github.com/neghoda/quiet_hn/reader"
+)
+
+const (
+	hiringPath    = "/hiring"
+	hiringRSSPath = "/hiring/rss"
+	// hiringUser posts the monthly threads, hiringTitle starts the title of
+	// the one of job offers
+	hiringUser  = "whoishiring"
+	hiringTitle = "ask hn: who is hiring?"
+	// hiringEvery is how often the thread is fetched again for new postings
+	hiringEvery   = time.Hour
+	hiringTimeout = 2 * time.Minute
+	hiringWorkers = 8
+	// hiringLookback is how many of the latest submissions of hiringUser
+	// are looked at for the thread, it posts three threads a month
+	hiringLookback = 10
+	// hiringFeedItems is how many of the newest postings the feed has
+	hiringFeedItems = 50
+)
+
+// posting is a top-level comment of the Who is hiring thread, with what the
+// heuristics of parsePosting make of its first line.
+type posting struct {
+	ID       int
+	By       string
+	Posted   time.Time
+	Company  string
+	Role     string
+	Location string
+	Remote   bool
+	Text     template.HTML
+	// plain is the text in lower case, which keywords are looked up in
+	plain string
+}
+
+var (
+	roleWords    = regexp.MustCompile(`(?i)\b(engineers?|developers?|designers?|managers?|scientists?|analysts?|architects?|devops|sre|programmers?|researchers?|interns?|cto|head of|directors?|consultants?|administrators?|writers?|founding|staff|lead)\b`)
+	remoteWord   = regexp.MustCompile(`(?i)\bremote\b`)
+	noRemote     = regexp.MustCompile(`(?i)\b(no remote|not remote|remote: no|on-?site only)\b`)
+	otherSegment = regexp.MustCompile(`(?i)(https?://|www\.|[$€£]|\b\d+k\b|full[- ]time|part[- ]time|contract|visa|equity|salary)`)
+)
+
+// parsePosting reads the first line of a posting, which by the rules of the
+// thread is like "Company | Role | Location | REMOTE | ...". The first part
+// is the company, the first with a role word is the role and the first that
+// is nothing else, like a link, salary or kind of contract, is the location.
+func parsePosting(it hn.Item) posting {
+	p := posting{ID: it.ID, By: it.By, Posted: time.Unix(int64(it.Time), 0), Text: template.HTML(reader.SanitizeHN(it.Text))}
+	paras := paragraphs(it.Text)
+	p.plain = strings.ToLower(strings.Join(paras, "\n"))
+	if len(paras) == 0 {
+		return p
+	}
+	first := paras[0]
+	p.Remote = remoteWord.MatchString(first) && !noRemote.MatchString(first)
+	for i, seg := range strings.Split(first, "|") {
+		seg = strings.TrimSpace(seg)
+		switch {
+		case seg == "":
+		case i == 0:
+			p.Company = seg
+		case p.Role == "" && roleWords.MatchString(seg):
+			p.Role = seg
+		case p.Location == "" && !otherSegment.MatchString(seg) && !strings.EqualFold(seg, "remote"):
+			p.Location = seg
+		}
+	}
+	return p
+}
+
+// hiring keeps the postings of the latest Who is hiring thread.
+type hiring struct {
+	mutex    sync.RWMutex
+	thread   hn.Item
+	postings []posting
+	// known are the comments of the thread fetched so far, nil for the
+	// deleted ones
+	known       map[int]*posting
+	refreshedAt time.Time
+}
+
+func newHiring() *hiring {
+	return &hiring{known: make(map[int]*posting)}
+}
+
+// findHiringThread returns the latest Who is hiring thread.
+func findHiringThread(ctx context.Context) (hn.Item, error) {
+	user, err := hnClient.GetUserContext(ctx, hiringUser)
+	if err != nil {
+		return hn.Item{}, err
+	}
+	for _, id := range user.Submitted[:min(hiringLookback, len(user.Submitted))] {
+		it, err := hnClient.GetItemContext(ctx, id)
+		if err != nil {
+			return hn.Item{}, err
+		}
+		if strings.HasPrefix(strings.ToLower(it.Title), hiringTitle) {
+			return it, nil
+		}
+	}
+	return hn.Item{}, errNoHiringThread
+}
+
+// errNoHiringThread is returned when hiringUser has no recent thread of job
+// offers.
+var errNoHiringThread = errors.New("no recent Who is hiring thread")
+
+// refresh fetches the thread again, and the postings that are new since
+// the last time. A new thread starts over.
+func (h *hiring) refresh(ctx context.Context) error {
+	thread, err := findHiringThread(ctx)
+	if err != nil {
+		return err
+	}
+	h.mutex.RLock()
+	known := h.known
+	if thread.ID != h.thread.ID {
+		known = make(map[int]*posting)
+	}
+	var missing []int
+	for _, id := range thread.Kids {
+		if _, ok := known[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	h.mutex.RUnlock()
+
+	fetched := make(map[int]*posting)
+	var fetchedMutex sync.Mutex
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < hiringWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range next {
+				// the comments that fail to load are tried on the next refresh
+				it, err := hnClient.GetItemContext(ctx, id)
+				if err != nil || it.ID != id {
+					continue
+				}
+				var p *posting
+				if strings.TrimSpace(it.Text) != "" {
+					parsed := parsePosting(it)
+					p = &parsed
+				}
+				fetchedMutex.Lock()
+				fetched[id] = p
+				fetchedMutex.Unlock()
+			}
+		}()
+	}
+	for _, id := range missing {
+		next <- id
+	}
+	close(next)
+	wg.Wait()
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if thread.ID != h.thread.ID {
+		h.known = make(map[int]*posting)
+	}
+	for id, p := range fetched {
+		h.known[id] = p
+	}
+	// the kids are in the order HN ranks them
+	h.postings = h.postings[:0:0]
+	for _, id := range thread.Kids {
+		if p := h.known[id]; p != nil {
+			h.postings = append(h.postings, *p)
+		}
+	}
+	h.thread, h.refreshedAt = thread, time.Now()
+	return nil
+}
+
+// hiringFilter narrows the postings down to the remote ones, the ones with
+// all the words of Query in their text and the ones whose location has
+// Location in it.
+type hiringFilter struct {
+	Remote   bool
+	Query    string
+	Location string
+}
+
+func hiringFilterOf(r *http.Request) hiringFilter {
+	q := r.URL.Query()
+	return hiringFilter{
+		Remote:   q.Get("remote") != "",
+		Query:    strings.TrimSpace(q.Get("q")),
+		Location: strings.TrimSpace(q.Get("location")),
+	}
+}
+
+func (f hiringFilter) match(p posting) bool {
+	if f.Remote && !p.Remote {
+		return false
+	}
+	for _, word := range strings.Fields(strings.ToLower(f.Query)) {
+		if !strings.Contains(p.plain, word) {
+			return false
+		}
+	}
+	return f.Location == "" || strings.Contains(strings.ToLower(p.Location), strings.ToLower(f.Location))
+}
+
+// find returns the thread and its postings that f lets through, in the
+// order of the thread.
+func (h *hiring) find(f hiringFilter) (hn.Item, []posting, int) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	var found []posting
+	for _, p := range h.postings {
+		if f.match(p) {
+			found = append(found, p)
+		}
+	}
+	return h.thread, found, len(h.postings)
+}
+
+type hiringTemplateData struct {
+	Thread   hn.Item
+	Postings []posting
+	// Total is the number of postings in the thread, before the filter
+	Total int
+	hiringFilter
+	pageData
+}
+
+// hiringHandler lists the postings of the latest Who is hiring thread at
+// /hiring, filtered by ?remote=1, ?q= and ?location=.
+func hiringHandler(h *hiring, cfg config, tpls *templates) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		data := hiringTemplateData{hiringFilter: hiringFilterOf(r)}
+		data.Thread, data.Postings, data.Total = h.find(data.hiringFilter)
+		data.pageData = cfg.pageData(r, start)
+		if err := tpls.execute(w, "hiring.gohtml", data); err != nil {
+			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+		}
+	})
+}
+
+// hiringFeedHandler serves the newest postings as RSS at /hiring/rss, with
+// the same filters as the page.
+func hiringFeedHandler(h *hiring, cfg config) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		brand := cfg.brand(r)
+		_, postings, _ := h.find(hiringFilterOf(r))
+		slices.SortStableFunc(postings, func(a, b posting) int { return b.Posted.Compare(a.Posted) })
+		feed := newRSS(brand, brand.Title+": Who is hiring?")
+		feed.Channel.Link = brand.URL + hiringPath
+		for _, p := range postings[:min(hiringFeedItems, len(postings))] {
+			title := p.Company
+			if p.Role != "" {
+				title += ": " + p.Role
+			}
+			feed.Channel.Items = append(feed.Channel.Items, rssItem{
+				Title:       title,
+				Link:        discussionURL(p.ID),
+				Comments:    discussionURL(p.ID),
+				GUID:        rssGUID{Value: discussionURL(p.ID), IsPermaLink: true},
+				PubDate:     p.Posted.UTC().Format(time.RFC1123Z),
+				Description: string(p.Text),
+			})
+		}
+		writeXML(w, "application/rss+xml; charset=utf-8", feed)
+	})
+}
+
+// refreshHiring is the hiring job of the scheduler.
+func refreshHiring(h *hiring) {
+	ctx, cancel := context.WithTimeout(context.Background(), hiringTimeout)
+	defer cancel()
+	if err := h.refresh(ctx); err != nil {
+		log.Printf("failed to refresh the Who is hiring thread: %s", err)
+	}
+}
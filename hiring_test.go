@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/neghoda/quiet_hn/hn"
+)
+
+func TestParsePosting(t *testing.T) {
+	tests := []struct {
+		text                    string
+		company, role, location string
+		remote                  bool
+	}{
+		{"Acme | Senior Backend Engineer | Berlin, Germany | REMOTE (EU) | https://acme.example<p>We make things.", "Acme", "Senior Backend Engineer", "Berlin, Germany", true},
+		{"Initech | NYC | Full-time | $150k-$200k | Developers wanted<p>No remote.", "Initech", "Developers wanted", "NYC", false},
+		{"Hooli | ONSITE only, no remote | Staff SRE", "Hooli", "Staff SRE", "ONSITE only, no remote", false},
+		{"Just some text without pipes", "Just some text without pipes", "", "", false},
+	}
+	for _, tt := range tests {
+		p := parsePosting(hn.Item{ID: 1, Text: tt.text})
+		if p.Company != tt.company || p.Role != tt.role || p.Location != tt.location || p.Remote != tt.remote {
+			t.Errorf("%s: want %q %q %q %t, got %q %q %q %t", tt.text, tt.company, tt.role, tt.location, tt.remote, p.Company, p.Role, p.Location, p.Remote)
+		}
+	}
+}
+
+func TestHiring(t *testing.T) {
+	items := map[string]string{
+		"/user/whoishiring.json": `{"id":"whoishiring","submitted":[30,20,10]}`,
+		"/item/30.json":          `{"id":30,"type":"story","title":"Ask HN: Who wants to be hired? (May 2026)"}`,
+		"/item/20.json":          `{"id":20,"type":"story","title":"Ask HN: Who is hiring? (May 2026)","kids":[21,22,23]}`,
+		"/item/21.json":          `{"id":21,"type":"comment","by":"a","time":100,"text":"Acme | Backend Engineer | Berlin | REMOTE<p>Go and SQL."}`,
+		"/item/22.json":          `{"id":22,"type":"comment","by":"b","time":200,"text":"Initech | Designer | Paris | Onsite<p>Figma."}`,
+		"/item/23.json":          `{"id":23,"type":"comment","deleted":true}`,
+	}
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		body, ok := items[r.URL.Path]
+		if !ok {
+			fmt.Fprint(w, "null")
+			return
+		}
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	old := hnClient
+	hnClient.HTTPClient = &http.Client{Transport: hnTransport{server: u, next: http.DefaultTransport}}
+	defer func() { hnClient = old }()
+
+	h := newHiring()
+	if err := h.refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	thread, postings, total := h.find(hiringFilter{})
+	if thread.ID != 20 || total != 2 || len(postings) != 2 {
+		t.Fatalf("thread: want 20 with 2 postings, got %d with %d", thread.ID, total)
+	}
+	// the postings are only fetched once
+	requests = 0
+	h.refresh(context.Background())
+	if requests != 3 {
+		t.Errorf("second refresh: want 3 requests, for the user and the threads, got %d", requests)
+	}
+	for _, tt := range []struct {
+		f    hiringFilter
+		want int
+	}{
+		{hiringFilter{Remote: true}, 21},
+		{hiringFilter{Query: "figma"}, 22},
+		{hiringFilter{Location: "berlin"}, 21},
+		{hiringFilter{Query: "go sql", Location: "Berl"}, 21},
+	} {
+		_, found, _ := h.find(tt.f)
+		if len(found) != 1 || found[0].ID != tt.want {
+			t.Errorf("%+v: want %d, got %v", tt.f, tt.want, found)
+		}
+	}
+
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	hiringHandler(h, config{}, tpls)(rec, httptest.NewRequest("GET", "/hiring?remote=1", nil))
+	if body := rec.Body.String(); rec.Code != http.StatusOK || !strings.Contains(body, "Acme") || strings.Contains(body, "Initech") {
+		t.Errorf("/hiring?remote=1: want the remote posting, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	hiringFeedHandler(h, config{})(rec, httptest.NewRequest("GET", "/hiring/rss", nil))
+	body := rec.Body.String()
+	if i, j := strings.Index(body, "Initech: Designer"), strings.Index(body, "Acme: Backend Engineer"); i < 0 || j < 0 || i > j {
+		t.Errorf("/hiring/rss: want the newest posting first, got %s", body)
+	}
+}
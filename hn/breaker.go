@@ -0,0 +1,148 @@
+package hn
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned instead of making a request while the Breaker of the
+// client is open.
+var ErrOpen = errors.New("hn: the circuit breaker is open, the API is failing")
+
+// The defaults of the zero fields of a Breaker.
+const (
+	defaultWindow      = time.Minute
+	defaultMinRequests = 10
+	defaultCooldown    = 30 * time.Second
+)
+
+// Breaker stops the requests of a Client while the API fails, so an outage
+// doesn't pile up requests bound to time out. It opens when ErrorRate of the
+// requests in a Window failed or took longer than Latency, and after
+// Cooldown lets one request through to see if the API is back, which closes
+// it again or keeps it open for another Cooldown. A Breaker may be shared by
+// goroutines.
+type Breaker struct {
+	// ErrorRate is the share of failed requests that opens the breaker,
+	// like 0.5, any failure opens it if 0
+	ErrorRate float64
+	// Latency is how long a request may take before it counts as failed,
+	// 0 only counts errors
+	Latency time.Duration
+	// Window is how long the requests are counted over, a minute if 0, and
+	// MinRequests how many there have to be in it, 10 if 0
+	Window      time.Duration
+	MinRequests int
+	// Cooldown is how long the breaker stays open, 30 seconds if 0
+	Cooldown time.Duration
+
+	mutex       sync.Mutex
+	windowStart time.Time
+	requests    int
+	failures    int
+	open        bool
+	openedAt    time.Time
+	probing     bool
+}
+
+func (b *Breaker) window() time.Duration {
+	if b.Window <= 0 {
+		return defaultWindow
+	}
+	return b.Window
+}
+
+func (b *Breaker) minRequests() int {
+	if b.MinRequests <= 0 {
+		return defaultMinRequests
+	}
+	return b.MinRequests
+}
+
+func (b *Breaker) cooldown() time.Duration {
+	if b.Cooldown <= 0 {
+		return defaultCooldown
+	}
+	return b.Cooldown
+}
+
+// Open reports whether requests are stopped, not counting the one that
+// tries the API again once the Cooldown is over. A nil Breaker is never
+// open.
+func (b *Breaker) Open() bool {
+	if b == nil {
+		return false
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.open && (b.probing || time.Since(b.openedAt) < b.cooldown())
+}
+
+// OpenUntil returns when the Cooldown of an open breaker is over, the zero
+// time if it isn't open.
+func (b *Breaker) OpenUntil() time.Time {
+	if b == nil {
+		return time.Time{}
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.open {
+		return time.Time{}
+	}
+	return b.openedAt.Add(b.cooldown())
+}
+
+// allow returns ErrOpen if the request can't be made, and whether it is the
+// one trying the API again.
+func (b *Breaker) allow() (probe bool, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.open {
+		return false, nil
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown() {
+		return false, ErrOpen
+	}
+	b.probing = true
+	return true, nil
+}
+
+// record counts a request that was allowed, which took took and failed with
+// err, if not nil. Requests the caller gave up on count for nothing.
+func (b *Breaker) record(probe bool, took time.Duration, err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if errors.Is(err, context.Canceled) {
+		if probe {
+			b.probing = false
+		}
+		return
+	}
+	failed := err != nil || b.Latency > 0 && took > b.Latency
+	if probe {
+		b.probing = false
+		if failed {
+			b.openedAt = time.Now()
+			return
+		}
+		b.open = false
+		b.windowStart, b.requests, b.failures = time.Now(), 0, 0
+		return
+	}
+	if b.open {
+		// a request that was under way when the breaker opened
+		return
+	}
+	if now := time.Now(); now.Sub(b.windowStart) > b.window() {
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+	b.requests++
+	if failed {
+		b.failures++
+	}
+	if b.failures > 0 && b.requests >= b.minRequests() && float64(b.failures) >= b.ErrorRate*float64(b.requests) {
+		b.open, b.openedAt = true, time.Now()
+	}
+}
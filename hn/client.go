@@ -2,9 +2,14 @@
 package hn
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"time"
 )
 
 const (
@@ -13,16 +18,81 @@ const (
 
 // Client is an API client used to interact with the Hacker News API
 type Client struct {
+	// HTTPClient makes the requests, nil uses a client whose transport is
+	// tuned for fetching many items at once
+	HTTPClient *http.Client
+	// Breaker, if not nil, stops the requests while the API is failing,
+	// they return ErrOpen instead
+	Breaker *Breaker
+
 	// unexported fields...
 	apiBase string
 }
 
+// defaultHTTPClient keeps enough idle connections to the API for a whole
+// front page of items fetched at once, where the default transport keeps 2
+// and every refresh opened dozens of new TLS connections. Over HTTP/2 the
+// requests share one connection anyway.
+var defaultHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   64,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	},
+}
+
 // Making the Client zero value useful without forcing users to do something
-// like `NewClient()`
-func (c *Client) defaultify() {
+// like `NewClient()`. The defaults are looked up on every call instead of
+// being set on the client, so a client can be shared by goroutines.
+func (c *Client) base() string {
 	if c.apiBase == "" {
-		c.apiBase = apiBase
+		return apiBase
+	}
+	return c.apiBase
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return defaultHTTPClient
 	}
+	return c.HTTPClient
+}
+
+// get fetches path from the API and decodes the JSON response into v. The
+// body is read to the end, so the connection can be reused.
+func (c *Client) get(ctx context.Context, path string, v interface{}) (err error) {
+	if c.Breaker != nil {
+		probe, errOpen := c.Breaker.allow()
+		if errOpen != nil {
+			return errOpen
+		}
+		start := time.Now()
+		defer func() { c.Breaker.record(probe, time.Since(start), err) }()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.base()+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("hn: %s: unexpected status %s", path, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
 }
 
 // TopItems returns the ids of roughly 450 top items in decreasing order. These
@@ -32,36 +102,88 @@ func (c *Client) defaultify() {
 // TopItmes does not filter out job listings or anything else, as the type of
 // each item is unknown without further API calls.
 func (c *Client) TopItems() ([]int, error) {
-	c.defaultify()
-	resp, err := http.Get(fmt.Sprintf("%s/topstories.json", c.apiBase))
-	if err != nil {
+	return c.TopItemsContext(context.Background())
+}
+
+// TopItemsContext is TopItems, giving up when ctx is done.
+func (c *Client) TopItemsContext(ctx context.Context) ([]int, error) {
+	var ids []int
+	if err := c.get(ctx, "/topstories.json", &ids); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// JobItems returns the ids of the current job ads, newest first.
+func (c *Client) JobItems() ([]int, error) {
+	return c.JobItemsContext(context.Background())
+}
+
+// JobItemsContext is JobItems, giving up when ctx is done.
+func (c *Client) JobItemsContext(ctx context.Context) ([]int, error) {
+	var ids []int
+	if err := c.get(ctx, "/jobstories.json", &ids); err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
+	return ids, nil
+}
+
+// ShowItems returns the ids of the current Show HN stories, in the order of
+// their ranking.
+func (c *Client) ShowItems() ([]int, error) {
+	return c.ShowItemsContext(context.Background())
+}
+
+// ShowItemsContext is ShowItems, giving up when ctx is done.
+func (c *Client) ShowItemsContext(ctx context.Context) ([]int, error) {
 	var ids []int
-	dec := json.NewDecoder(resp.Body)
-	err = dec.Decode(&ids)
-	if err != nil {
+	if err := c.get(ctx, "/showstories.json", &ids); err != nil {
 		return nil, err
 	}
 	return ids, nil
 }
 
+// Updates are the items and profiles that changed lately.
+type Updates struct {
+	Items    []int    `json:"items"`
+	Profiles []string `json:"profiles"`
+}
+
+// UpdatesContext returns the items and profiles that changed lately, giving
+// up when ctx is done.
+func (c *Client) UpdatesContext(ctx context.Context) (Updates, error) {
+	var u Updates
+	err := c.get(ctx, "/updates.json", &u)
+	return u, err
+}
+
 // GetItem will return the Item defined by the provided ID.
 func (c *Client) GetItem(id int) (Item, error) {
-	c.defaultify()
+	return c.GetItemContext(context.Background(), id)
+}
+
+// GetItemContext is GetItem, giving up when ctx is done.
+func (c *Client) GetItemContext(ctx context.Context, id int) (Item, error) {
 	var item Item
-	resp, err := http.Get(fmt.Sprintf("%s/item/%d.json", c.apiBase, id))
-	if err != nil {
-		return item, err
+	err := c.get(ctx, fmt.Sprintf("/item/%d.json", id), &item)
+	return item, err
+}
+
+// GetUser will return the User with the provided username.
+func (c *Client) GetUser(name string) (User, error) {
+	return c.GetUserContext(context.Background(), name)
+}
+
+// GetUserContext is GetUser with a context.
+func (c *Client) GetUserContext(ctx context.Context, name string) (User, error) {
+	var user User
+	if err := c.get(ctx, fmt.Sprintf("/user/%s.json", url.PathEscape(name)), &user); err != nil {
+		return user, err
 	}
-	defer resp.Body.Close()
-	dec := json.NewDecoder(resp.Body)
-	err = dec.Decode(&item)
-	if err != nil {
-		return item, err
+	if user.ID == "" {
+		return user, fmt.Errorf("hn: no user %s", name)
 	}
-	return item, nil
+	return user, nil
 }
 
 // Item represents a single item returned by the HN API. This can have a type
@@ -84,3 +206,14 @@ type Item struct {
 	Text string `json:"text"`
 	URL  string `json:"url"`
 }
+
+// User represents a single user returned by the HN API.
+type User struct {
+	ID      string `json:"id"`
+	Created int    `json:"created"`
+	Karma   int    `json:"karma"`
+	About   string `json:"about"`
+	// Submitted are the ids of the stories, comments and polls of the user,
+	// the newest first
+	Submitted []int `json:"submitted"`
+}
@@ -1,10 +1,15 @@
 package hn
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 	"testing"
+	"time"
 )
 
 func setup() (string, func()) {
@@ -12,9 +17,24 @@ func setup() (string, func()) {
 	mux.HandleFunc("/topstories.json", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, "[0,1,2,3,4]")
 	})
+	mux.HandleFunc("/jobstories.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "[7,8]")
+	})
+	mux.HandleFunc("/showstories.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "[9,5,6]")
+	})
+	mux.HandleFunc("/updates.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"items":[1,16732999],"profiles":["test_user"]}`)
+	})
 	mux.HandleFunc("/item/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprint(w, "{\"by\":\"test_user\",\"descendants\":10,\"id\":1,\"kids\":[16732999,16729637,16729517,16729595],\"score\":34,\"time\":1522599083,\"title\":\"Test Story Title\",\"type\":\"story\",\"url\":\"https://www.test-story.com\"}")
 	})
+	mux.HandleFunc("/user/test_user.json", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "{\"about\":\"Hi\",\"created\":1173923446,\"id\":\"test_user\",\"karma\":2937,\"submitted\":[5,3]}")
+	})
+	mux.HandleFunc("/user/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "null")
+	})
 	server := httptest.NewServer(mux)
 	return server.URL, func() {
 		server.Close()
@@ -37,11 +57,61 @@ func TestClient_TopItems(t *testing.T) {
 	}
 }
 
-func TestClient_defaultify(t *testing.T) {
+func TestClient_JobItems(t *testing.T) {
+	baseURL, teardown := setup()
+	defer teardown()
+
+	c := Client{
+		apiBase: baseURL,
+	}
+	ids, err := c.JobItems()
+	if err != nil {
+		t.Errorf("client.JobItems() received an error: %s", err.Error())
+	}
+	if len(ids) != 2 {
+		t.Errorf("len(ids): want %d, got %d", 2, len(ids))
+	}
+}
+
+func TestClient_ShowItems(t *testing.T) {
+	baseURL, teardown := setup()
+	defer teardown()
+
+	c := Client{
+		apiBase: baseURL,
+	}
+	ids, err := c.ShowItems()
+	if err != nil {
+		t.Errorf("client.ShowItems() received an error: %s", err.Error())
+	}
+	if len(ids) != 3 {
+		t.Errorf("len(ids): want %d, got %d", 3, len(ids))
+	}
+}
+
+func TestClient_Updates(t *testing.T) {
+	baseURL, teardown := setup()
+	defer teardown()
+
+	c := Client{
+		apiBase: baseURL,
+	}
+	u, err := c.UpdatesContext(context.Background())
+	if err != nil {
+		t.Errorf("client.UpdatesContext() received an error: %s", err.Error())
+	}
+	if len(u.Items) != 2 || len(u.Profiles) != 1 {
+		t.Errorf("updates: want 2 items and 1 profile, got %v", u)
+	}
+}
+
+func TestClient_base(t *testing.T) {
 	var c Client
-	c.defaultify()
-	if c.apiBase != apiBase {
-		t.Errorf("c.apiBase: want %s, got %s", apiBase, c.apiBase)
+	if got := c.base(); got != apiBase {
+		t.Errorf("c.base(): want %s, got %s", apiBase, got)
+	}
+	if c.apiBase != "" {
+		t.Errorf("c.apiBase: want the zero value left alone, got %s", c.apiBase)
 	}
 }
 
@@ -62,3 +132,134 @@ func TestClient_GetItem(t *testing.T) {
 		t.Errorf("item.By: want %s, got %s", "test_user", item.By)
 	}
 }
+
+func TestClient_GetUser(t *testing.T) {
+	baseURL, teardown := setup()
+	defer teardown()
+
+	c := Client{
+		apiBase: baseURL,
+	}
+	user, err := c.GetUser("test_user")
+	if err != nil {
+		t.Errorf("client.GetUser() received an error: %s", err.Error())
+	}
+	if user.Karma != 2937 {
+		t.Errorf("user.Karma: want %d, got %d", 2937, user.Karma)
+	}
+	if len(user.Submitted) != 2 || user.Submitted[0] != 5 {
+		t.Errorf("user.Submitted: want [5 3], got %v", user.Submitted)
+	}
+	if _, err := c.GetUser("nobody"); err == nil {
+		t.Errorf("client.GetUser(nobody): want an error, got none")
+	}
+}
+
+func TestClient_reusesConnections(t *testing.T) {
+	var mutex sync.Mutex
+	conns := 0
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// slow enough that the requests overlap
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprint(w, `{"id":1,"type":"story"}`)
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mutex.Lock()
+			conns++
+			mutex.Unlock()
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	c := Client{apiBase: server.URL}
+	fetch := func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 40; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := c.GetItem(1); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	fetch()
+	mutex.Lock()
+	first := conns
+	mutex.Unlock()
+	fetch()
+	mutex.Lock()
+	defer mutex.Unlock()
+	if conns != first {
+		t.Errorf("second batch: want the %d connections reused, got %d new ones", first, conns-first)
+	}
+}
+
+func TestClient_status(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	c := Client{apiBase: server.URL}
+	if _, err := c.GetItem(1); err == nil {
+		t.Error("client.GetItem(): want an error for a 429, got none")
+	}
+}
+
+func TestClient_breaker(t *testing.T) {
+	var mutex sync.Mutex
+	requests, down := 0, true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests++
+		if down {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "[1]")
+	}))
+	defer server.Close()
+	b := &Breaker{ErrorRate: 0.5, MinRequests: 4, Cooldown: 50 * time.Millisecond}
+	c := Client{apiBase: server.URL, Breaker: b}
+
+	for i := 0; i < 4; i++ {
+		if _, err := c.TopItems(); err == nil || errors.Is(err, ErrOpen) {
+			t.Fatalf("request %d: want the error of the API, got %v", i, err)
+		}
+	}
+	if !b.Open() {
+		t.Fatal("want the breaker open after 4 failed requests")
+	}
+	if _, err := c.TopItems(); !errors.Is(err, ErrOpen) {
+		t.Errorf("open: want ErrOpen, got %v", err)
+	}
+	mutex.Lock()
+	if requests != 4 {
+		t.Errorf("open: want no request made, got %d in all", requests)
+	}
+	down = false
+	mutex.Unlock()
+
+	time.Sleep(60 * time.Millisecond)
+	if b.Open() {
+		t.Error("after the cooldown: want the breaker to let a request through")
+	}
+	if _, err := c.TopItems(); err != nil {
+		t.Fatalf("after the cooldown: want the request through, got %v", err)
+	}
+	if b.Open() || !b.OpenUntil().IsZero() {
+		t.Error("want the breaker closed after the request went through")
+	}
+
+	slow := &Breaker{ErrorRate: 0.5, MinRequests: 1, Latency: time.Nanosecond}
+	c = Client{apiBase: server.URL, Breaker: slow}
+	c.TopItems()
+	if !slow.Open() {
+		t.Error("want a request slower than Latency to count as failed")
+	}
+}
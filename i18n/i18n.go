@@ -0,0 +1,193 @@
+// Package i18n holds the message catalog of the user interface and picks the
+// locale a visitor should see.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default is the tag of the locale used when nothing better matches. Every
+// key must exist in its catalog.
+const Default = "en"
+
+//go:embed locales/*.json
+var files embed.FS
+
+// Locale is the message catalog of a single language.
+type Locale struct {
+	Tag      string
+	messages map[string]string
+	fallback *Locale
+}
+
+var locales = make(map[string]*Locale)
+
+func init() {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	for _, e := range entries {
+		data, err := files.ReadFile(path.Join("locales", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		l := &Locale{Tag: strings.TrimSuffix(e.Name(), ".json")}
+		if err := json.Unmarshal(data, &l.messages); err != nil {
+			panic(fmt.Sprintf("i18n: parsing %s: %s", e.Name(), err))
+		}
+		locales[l.Tag] = l
+	}
+	for tag, l := range locales {
+		if tag != Default {
+			l.fallback = locales[Default]
+		}
+	}
+}
+
+// Tags returns the tags of all bundled locales in alphabetical order.
+func Tags() []string {
+	tags := make([]string, 0, len(locales))
+	for tag := range locales {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// Lookup returns the locale for tag, matching "de-AT" to "de" if there is no
+// exact match. It returns nil if no bundled locale matches.
+func Lookup(tag string) *Locale {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if l, ok := locales[tag]; ok {
+		return l
+	}
+	if i := strings.IndexAny(tag, "-_"); i > 0 {
+		return locales[tag[:i]]
+	}
+	return nil
+}
+
+// Negotiate picks the best bundled locale for an Accept-Language header,
+// falling back to the def tag and then to Default.
+func Negotiate(acceptLanguage, def string) *Locale {
+	type candidate struct {
+		tag string
+		q   float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		fields := strings.Split(part, ";")
+		c := candidate{tag: strings.TrimSpace(fields[0]), q: 1}
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if q, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					c.q = q
+				}
+			}
+		}
+		if c.tag != "" && c.tag != "*" && c.q > 0 {
+			candidates = append(candidates, c)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+	for _, c := range candidates {
+		if l := Lookup(c.tag); l != nil {
+			return l
+		}
+	}
+	if l := Lookup(def); l != nil {
+		return l
+	}
+	return locales[Default]
+}
+
+// T returns the message for key formatted with args, in the manner of
+// fmt.Sprintf. Unknown keys are returned as is so they show up in the page.
+func (l *Locale) T(key string, args ...interface{}) string {
+	msg, ok := l.message(key)
+	if !ok {
+		return key
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// HTML returns a message that contains markup. Catalogs are bundled with the
+// binary, so their markup is trusted.
+func (l *Locale) HTML(key string) template.HTML {
+	msg, ok := l.message(key)
+	if !ok {
+		return template.HTML(template.HTMLEscapeString(key))
+	}
+	return template.HTML(msg)
+}
+
+// N returns the plural form of key that fits n, formatted with n.
+func (l *Locale) N(key string, n int) string {
+	if msg, ok := l.message(key + "." + l.plural(n)); ok {
+		return fmt.Sprintf(msg, n)
+	}
+	return l.T(key+".other", n)
+}
+
+// Ago describes the time that passed since t, like "3 hours ago".
+func (l *Locale) Ago(t time.Time) string {
+	d := time.Since(t)
+	switch {
+	case d < time.Minute:
+		return l.T("just_now")
+	case d < time.Hour:
+		return l.N("minutes_ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return l.N("hours_ago", int(d/time.Hour))
+	default:
+		return l.N("days_ago", int(d/(24*time.Hour)))
+	}
+}
+
+func (l *Locale) message(key string) (string, bool) {
+	for ; l != nil; l = l.fallback {
+		if msg, ok := l.messages[key]; ok {
+			return msg, true
+		}
+	}
+	return "", false
+}
+
+// plural returns the CLDR plural category of n for the locale.
+func (l *Locale) plural(n int) string {
+	switch l.Tag {
+	case "uk", "ru":
+		switch {
+		case n%10 == 1 && n%100 != 11:
+			return "one"
+		case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+	case "fr":
+		if n == 0 || n == 1 {
+			return "one"
+		}
+	default:
+		if n == 1 {
+			return "one"
+		}
+	}
+	return "other"
+}
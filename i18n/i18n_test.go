@@ -0,0 +1,69 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		header, def, want string
+	}{
+		{"de-AT,de;q=0.9,en;q=0.8", "", "de"},
+		{"fr;q=0.5, es;q=0.9", "", "es"},
+		{"ja, zh;q=0.5", "uk", "uk"},
+		{"ja", "nope", Default},
+		{"", "", Default},
+		{"*, uk;q=0", "fr", "fr"},
+	}
+	for _, tc := range tests {
+		if got := Negotiate(tc.header, tc.def).Tag; got != tc.want {
+			t.Errorf("Negotiate(%q, %q): want %s, got %s", tc.header, tc.def, tc.want, got)
+		}
+	}
+}
+
+func TestLocale_N(t *testing.T) {
+	uk := Lookup("uk")
+	tests := map[int]string{
+		1:  "1 годину тому",
+		3:  "3 години тому",
+		5:  "5 годин тому",
+		12: "12 годин тому",
+		21: "21 годину тому",
+	}
+	for n, want := range tests {
+		if got := uk.N("hours_ago", n); got != want {
+			t.Errorf("uk.N(hours_ago, %d): want %s, got %s", n, want, got)
+		}
+	}
+	if got := Lookup("en").Ago(time.Now().Add(-2 * time.Hour)); got != "2 hours ago" {
+		t.Errorf("en.Ago(): want %s, got %s", "2 hours ago", got)
+	}
+}
+
+// Every locale should translate every key of the default catalog, apart from
+// plural forms that a language does not use.
+func TestCatalogsComplete(t *testing.T) {
+	def := Lookup(Default)
+	for _, tag := range Tags() {
+		l := Lookup(tag)
+		for key := range def.messages {
+			if i := strings.LastIndex(key, "."); i > 0 {
+				key = key[:i]
+				if _, ok := l.messages[key+".other"]; ok {
+					continue
+				}
+				if _, ok := l.messages[key+".many"]; ok {
+					continue
+				}
+				t.Errorf("%s: missing plural forms of %s", tag, key)
+				continue
+			}
+			if _, ok := l.messages[key]; !ok {
+				t.Errorf("%s: missing %s", tag, key)
+			}
+		}
+	}
+}
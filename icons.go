@@ -0,0 +1,60 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultIcons are the icons of the instance, served at the root where
+// browsers look for them. -icons_dir replaces any of them.
+//
+//go:embed templates/icons
+var defaultIcons embed.FS
+
+// iconFiles are the icons by name, with their content types.
+var iconFiles = map[string]string{
+	"favicon.ico":          "image/x-icon",
+	"favicon.svg":          "image/svg+xml",
+	"apple-touch-icon.png": "image/png",
+}
+
+// iconsLifeDuration is how long browsers keep the icons, which rarely change
+// and aren't linked with the version.
+const iconsLifeDuration = 24 * time.Hour
+
+// loadIcons reads the iconFiles, preferring those in dir over the defaults.
+// dir may be empty to only use the defaults.
+func loadIcons(dir string) (map[string][]byte, error) {
+	icons := make(map[string][]byte)
+	for name := range iconFiles {
+		b, err := defaultIcons.ReadFile("templates/icons/" + name)
+		if err != nil {
+			return nil, err
+		}
+		if dir != "" {
+			custom, err := os.ReadFile(filepath.Join(dir, name))
+			switch {
+			case err == nil:
+				b = custom
+			case !errors.Is(err, fs.ErrNotExist):
+				return nil, fmt.Errorf("icons_dir: %w", err)
+			}
+		}
+		icons[name] = b
+	}
+	return icons, nil
+}
+
+func iconHandler(name string, icon []byte) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", iconFiles[name])
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(iconsLifeDuration.Seconds())))
+		w.Write(icon)
+	})
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIcons(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "favicon.svg"), []byte("<svg/>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	icons, err := loadIcons(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(icons) != len(iconFiles) {
+		t.Fatalf("want all %d icons, got %d", len(iconFiles), len(icons))
+	}
+	if string(icons["favicon.svg"]) != "<svg/>" {
+		t.Errorf("want the favicon.svg of icons_dir, got %q", icons["favicon.svg"])
+	}
+	if !bytes.HasPrefix(icons["apple-touch-icon.png"], []byte("\x89PNG")) {
+		t.Error("want the built-in apple-touch-icon.png where icons_dir has none")
+	}
+	if !bytes.HasPrefix(icons["favicon.ico"], []byte{0, 0, 1, 0}) {
+		t.Error("want the built-in favicon.ico to be an icon")
+	}
+
+	rec := httptest.NewRecorder()
+	iconHandler("favicon.ico", icons["favicon.ico"]).ServeHTTP(rec, httptest.NewRequest("GET", "/favicon.ico", nil))
+	if rec.Code != 200 || rec.Header().Get("Content-Type") != "image/x-icon" || !bytes.Equal(rec.Body.Bytes(), icons["favicon.ico"]) {
+		t.Errorf("want the icon as image/x-icon, got %d as %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	if _, err := loadIcons(filepath.Join(dir, "favicon.svg")); err == nil {
+		t.Error("want an error for an icons_dir that is a file")
+	}
+}
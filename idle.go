@@ -0,0 +1,70 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// idleness puts background refreshes off while nobody visits the instance,
+// so one left running overnight stops polling the HN API. Once no request
+// came for after, the cache is refreshed every at most, or not at all if it
+// is 0, and the next visitor's request refreshes it as it expires.
+type idleness struct {
+	after time.Duration
+	every time.Duration
+
+	// lastRequest is the unix nano time of the last request
+	lastRequest atomic.Int64
+	// idle is guarded by cachMutex
+	idle bool
+}
+
+func newIdleness(after, every time.Duration) *idleness {
+	i := &idleness{after: after, every: every}
+	i.lastRequest.Store(time.Now().UnixNano())
+	return i
+}
+
+// handler notes the requests to h. The version page and /healthz don't
+// count, they are what monitoring and load balancers poll.
+func (i *idleness) handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != versionPath && r.URL.Path != healthPath {
+			i.lastRequest.Store(time.Now().UnixNano())
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// quiet reports whether no request came in for after, leaving the state
+// skip keeps alone.
+func (i *idleness) quiet(now time.Time) bool {
+	return i != nil && now.Sub(time.Unix(0, i.lastRequest.Load())) >= i.after
+}
+
+// skip reports if the background refresh due at now is put off, given the
+// cache was last refreshed at refreshedAt.
+func (i *idleness) skip(now, refreshedAt time.Time) bool {
+	if i == nil {
+		return false
+	}
+	quiet := now.Sub(time.Unix(0, i.lastRequest.Load()))
+	if quiet < i.after {
+		if i.idle {
+			log.Print("requests came in again, refreshing as scheduled")
+			i.idle = false
+		}
+		return false
+	}
+	if !i.idle {
+		if i.every > 0 {
+			log.Printf("no requests for %s, refreshing every %s until the next one", quiet.Round(time.Second), i.every)
+		} else {
+			log.Printf("no requests for %s, refreshing on the next one", quiet.Round(time.Second))
+		}
+		i.idle = true
+	}
+	return i.every <= 0 || now.Sub(refreshedAt) < i.every
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestIdleness_Skip(t *testing.T) {
+	now := time.Now()
+	i := newIdleness(30*time.Minute, time.Hour)
+	if i.skip(now, now.Add(-time.Minute)) {
+		t.Error("right after a request: want the refresh")
+	}
+
+	i.lastRequest.Store(now.Add(-time.Hour).UnixNano())
+	if !i.skip(now, now.Add(-time.Minute)) {
+		t.Error("idle, refreshed a minute ago: want it skipped")
+	}
+	if i.skip(now, now.Add(-2*time.Hour)) {
+		t.Error("idle, refreshed -idle_refresh ago: want the refresh")
+	}
+
+	h := i.handler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", versionPath, nil))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", healthPath, nil))
+	if !i.skip(time.Now(), time.Now()) {
+		t.Error("after a version and health request: want it skipped still")
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if i.skip(time.Now(), time.Now()) || i.idle {
+		t.Error("after a visit: want refreshes resumed")
+	}
+
+	paused := newIdleness(time.Minute, 0)
+	paused.lastRequest.Store(now.Add(-time.Hour).UnixNano())
+	if !paused.skip(now, now.Add(-24*time.Hour)) {
+		t.Error("idle without -idle_refresh: want all refreshes skipped")
+	}
+	if (*idleness)(nil).skip(now, now) {
+		t.Error("disabled: want the refresh")
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// acePrefix starts the labels of internationalized domains in punycode.
+const acePrefix = "xn--"
+
+// the parameters of punycode, RFC 3492
+const (
+	punyBase        = 36
+	punyTMin        = 1
+	punyTMax        = 26
+	punySkew        = 38
+	punyDamp        = 700
+	punyInitialBias = 72
+	punyInitialN    = 128
+)
+
+var errPunycode = errors.New("invalid punycode")
+
+// lookalikes are the letters of other scripts than Latin that pass for Latin
+// ones, a label made of nothing else spells a Latin word.
+var lookalikes = map[*unicode.RangeTable]string{
+	unicode.Cyrillic: "аысԁеԍһіюјӏорԗԛѕԝхуъьҽпгѵѡ",
+	unicode.Greek:    "αικνορτυχ",
+}
+
+// latinLookalikes are the Latin letters beyond ASCII that pass for ASCII
+// ones.
+const latinLookalikes = "ıȷɑɡɩʟᴏꞮ"
+
+// scripts are those a label may be written in. Han, Hiragana, Katakana and
+// Hangul go together, and with Latin, as Chinese, Japanese and Korean names
+// do.
+var scripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"latin", unicode.Latin}, {"cyrillic", unicode.Cyrillic}, {"greek", unicode.Greek},
+	{"armenian", unicode.Armenian}, {"georgian", unicode.Georgian}, {"hebrew", unicode.Hebrew},
+	{"arabic", unicode.Arabic}, {"thai", unicode.Thai}, {"devanagari", unicode.Devanagari},
+	{"bengali", unicode.Bengali}, {"tamil", unicode.Tamil},
+	{"cjk", unicode.Han}, {"cjk", unicode.Hiragana}, {"cjk", unicode.Katakana}, {"cjk", unicode.Hangul},
+}
+
+// displayHost returns the host of a story to show, with its labels in
+// Unicode unless one of them could pass for another name: mixes scripts,
+// spells Latin with the letters of another, has marks or symbols, or isn't
+// valid punycode. Such a host is shown in punycode and lookalike is set.
+func displayHost(host string) (display string, lookalike bool) {
+	labels := strings.Split(host, ".")
+	unicodeTLD := false
+	if tld := labels[len(labels)-1]; strings.HasPrefix(strings.ToLower(tld), acePrefix) || !isASCII(tld) {
+		unicodeTLD = true
+	}
+	decoded := make([]string, len(labels))
+	international := false
+	for i, label := range labels {
+		u, err := unicodeLabel(label)
+		if err != nil {
+			return host, true
+		}
+		if u != label || !isASCII(u) {
+			international = true
+		}
+		if !isASCII(u) && !safeLabel(u, unicodeTLD) {
+			lookalike = true
+		}
+		decoded[i] = u
+	}
+	if !international {
+		return host, false
+	}
+	if lookalike {
+		return asciiHost(host), true
+	}
+	return strings.Join(decoded, "."), false
+}
+
+// asciiHost returns host with its Unicode labels in punycode, lower case,
+// the form hosts are compared in. It is host as it is if that fails.
+func asciiHost(host string) string {
+	labels := strings.Split(strings.ToLower(host), ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		encoded, err := punyEncode(label)
+		if err != nil {
+			return host
+		}
+		labels[i] = acePrefix + encoded
+	}
+	return strings.Join(labels, ".")
+}
+
+// unicodeLabel decodes a label in punycode and lower cases the others.
+func unicodeLabel(label string) (string, error) {
+	label = strings.ToLower(label)
+	if !strings.HasPrefix(label, acePrefix) {
+		return label, nil
+	}
+	return punyDecode(label[len(acePrefix):])
+}
+
+// safeLabel reports whether a label in Unicode reads as what it is. Under a
+// TLD in Unicode itself whole labels of lookalikes are fine, the TLD gives
+// away the script.
+func safeLabel(label string, unicodeTLD bool) bool {
+	script := ""
+	latin, cjk := false, false
+	var table *unicode.RangeTable
+	allLookalikes := true
+	for _, r := range label {
+		if r == '-' || r >= '0' && r <= '9' {
+			continue
+		}
+		if !unicode.IsLetter(r) {
+			return false
+		}
+		if strings.ContainsRune(latinLookalikes, r) {
+			return false
+		}
+		name, t := scriptOf(r)
+		switch name {
+		case "":
+			return false
+		case "latin":
+			latin = true
+			continue
+		case "cjk":
+			cjk = true
+		}
+		if script != "" && script != name {
+			return false
+		}
+		script, table = name, t
+		if !strings.ContainsRune(lookalikes[table], r) {
+			allLookalikes = false
+		}
+	}
+	if latin && script != "" && !cjk {
+		return false
+	}
+	if _, ok := lookalikes[table]; ok && allLookalikes && !unicodeTLD {
+		return false
+	}
+	return true
+}
+
+func scriptOf(r rune) (string, *unicode.RangeTable) {
+	for _, s := range scripts {
+		if unicode.Is(s.table, r) {
+			return s.name, s.table
+		}
+	}
+	return "", nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func punyAdapt(delta, numPoints int, first bool) int {
+	if first {
+		delta /= punyDamp
+	} else {
+		delta /= 2
+	}
+	delta += delta / numPoints
+	k := 0
+	for delta > (punyBase-punyTMin)*punyTMax/2 {
+		delta /= punyBase - punyTMin
+		k += punyBase
+	}
+	return k + (punyBase-punyTMin+1)*delta/(delta+punySkew)
+}
+
+func punyDigit(d int) byte {
+	if d < 26 {
+		return byte('a' + d)
+	}
+	return byte('0' + d - 26)
+}
+
+func punyThreshold(k, bias int) int {
+	switch {
+	case k <= bias:
+		return punyTMin
+	case k >= bias+punyTMax:
+		return punyTMax
+	}
+	return k - bias
+}
+
+// punyDecode decodes a label in punycode, without its acePrefix.
+func punyDecode(s string) (string, error) {
+	var output []rune
+	if i := strings.LastIndexByte(s, '-'); i >= 0 {
+		for _, r := range s[:i] {
+			if r >= utf8.RuneSelf {
+				return "", errPunycode
+			}
+			output = append(output, r)
+		}
+		s = s[i+1:]
+	}
+	n, bias := punyInitialN, punyInitialBias
+	for i, pos := 0, 0; pos < len(s); {
+		oldI, w := i, 1
+		for k := punyBase; ; k += punyBase {
+			if pos == len(s) {
+				return "", errPunycode
+			}
+			c := s[pos]
+			pos++
+			var digit int
+			switch {
+			case c >= 'a' && c <= 'z':
+				digit = int(c - 'a')
+			case c >= 'A' && c <= 'Z':
+				digit = int(c - 'A')
+			case c >= '0' && c <= '9':
+				digit = int(c-'0') + 26
+			default:
+				return "", errPunycode
+			}
+			i += digit * w
+			if i < 0 || i > utf8.MaxRune {
+				return "", errPunycode
+			}
+			t := punyThreshold(k, bias)
+			if digit < t {
+				break
+			}
+			w *= punyBase - t
+			if w > utf8.MaxRune {
+				return "", errPunycode
+			}
+		}
+		bias = punyAdapt(i-oldI, len(output)+1, oldI == 0)
+		n += i / (len(output) + 1)
+		if n > utf8.MaxRune || n < punyInitialN {
+			return "", errPunycode
+		}
+		i %= len(output) + 1
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = rune(n)
+		i++
+	}
+	return string(output), nil
+}
+
+// punyEncode encodes a label in punycode, without the acePrefix.
+func punyEncode(s string) (string, error) {
+	runes := []rune(s)
+	var out []byte
+	for _, r := range runes {
+		if r < utf8.RuneSelf {
+			out = append(out, byte(r))
+		}
+	}
+	basic := len(out)
+	handled := basic
+	if basic > 0 {
+		out = append(out, '-')
+	}
+	n, bias, delta := punyInitialN, punyInitialBias, 0
+	for handled < len(runes) {
+		m := int(utf8.MaxRune) + 1
+		for _, r := range runes {
+			if int(r) >= n && int(r) < m {
+				m = int(r)
+			}
+		}
+		delta += (m - n) * (handled + 1)
+		if delta < 0 {
+			return "", errPunycode
+		}
+		n = m
+		for _, r := range runes {
+			if int(r) < n {
+				delta++
+			}
+			if int(r) != n {
+				continue
+			}
+			q := delta
+			for k := punyBase; ; k += punyBase {
+				t := punyThreshold(k, bias)
+				if q < t {
+					break
+				}
+				out = append(out, punyDigit(t+(q-t)%(punyBase-t)))
+				q = (q - t) / (punyBase - t)
+			}
+			out = append(out, punyDigit(q))
+			bias = punyAdapt(delta, handled+1, handled == basic)
+			delta = 0
+			handled++
+		}
+		delta++
+		n++
+	}
+	return string(out), nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import "testing"
+
+func TestPunycode(t *testing.T) {
+	tests := []struct{ unicode, ascii string }{
+		{"bücher", "bcher-kva"},
+		{"münchen", "mnchen-3ya"},
+		{"пример", "e1afmkfd"},
+		{"例え", "r8jz45g"},
+		{"аррӏе", "80ak6aa92e"},
+	}
+	for _, tt := range tests {
+		if got, err := punyEncode(tt.unicode); err != nil || got != tt.ascii {
+			t.Errorf("punyEncode(%q): want %q, got %q, %v", tt.unicode, tt.ascii, got, err)
+		}
+		if got, err := punyDecode(tt.ascii); err != nil || got != tt.unicode {
+			t.Errorf("punyDecode(%q): want %q, got %q, %v", tt.ascii, tt.unicode, got, err)
+		}
+	}
+	if _, err := punyDecode("a-!"); err == nil {
+		t.Errorf("punyDecode: want an error for a symbol")
+	}
+}
+
+func TestDisplayHost(t *testing.T) {
+	tests := []struct {
+		host, want string
+		lookalike  bool
+	}{
+		{"example.com", "example.com", false},
+		{"xn--bcher-kva.example", "bücher.example", false},
+		{"bücher.example", "bücher.example", false},
+		{"xn--e1afmkfd.xn--p1ai", "пример.рф", false},
+		{"xn--r8jz45g.jp", "例え.jp", false},
+		// Cyrillic letters that spell apple
+		{"xn--80ak6aa92e.com", "xn--80ak6aa92e.com", true},
+		{"аррӏе.com", "xn--80ak6aa92e.com", true},
+		// a Latin p and a Cyrillic а
+		{"pаypal.com", "xn--pypal-4ve.com", true},
+		// not punycode
+		{"xn--a-!.com", "xn--a-!.com", true},
+	}
+	for _, tt := range tests {
+		got, lookalike := displayHost(tt.host)
+		if got != tt.want || lookalike != tt.lookalike {
+			t.Errorf("displayHost(%q): want %q %t, got %q %t", tt.host, tt.want, tt.lookalike, got, lookalike)
+		}
+	}
+}
+
+func TestFilters_IDN(t *testing.T) {
+	f, err := newFilters(config{BlockDomains: "xn--bcher-kva.example, пример.рф"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"bücher.example", "www.bücher.example", "xn--e1afmkfd.xn--p1ai", "пример.рф"} {
+		if !f.domainBlocked(host) {
+			t.Errorf("%s: want it blocked in either form", host)
+		}
+	}
+	if !onDomain("blog.bücher.example", "xn--bcher-kva.example") {
+		t.Errorf("onDomain: want the punycode domain to match the Unicode host")
+	}
+}
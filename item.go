@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neghoda/quiet_hn/reader"
+)
+
+const itemPath = "/item"
+
+var (
+	paragraphBreak = regexp.MustCompile(`(?i)<p>`)
+	anyTag         = regexp.MustCompile(`<[^>]*>`)
+)
+
+type itemTemplateData struct {
+	Story item
+	// Text is the text of the story with the formatting of HN, Paragraphs
+	// the same as plain text
+	Text       template.HTML
+	Paragraphs []string
+	pageData
+}
+
+// itemHandler renders the detail page of a story, which is where text posts
+// link to.
+func itemHandler(c *cach, cfg config, tpls *templates) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		story, ok := c.lookup(id)
+		if !ok {
+			hnItem, err := hnClient.GetItemContext(r.Context(), id)
+			if errors.Is(err, context.DeadlineExceeded) {
+				storiesError(w, err)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Failed to load the story", http.StatusBadGateway)
+				return
+			}
+			story = parseHNItem(hnItem)
+			// stories that left the front page get their abstract on a
+			// reload
+			if c.papers != nil {
+				fetched := []item{story}
+				c.papers.annotate(fetched)
+				story = fetched[0]
+			}
+		}
+		if story.ID != id || !isStory(story) && !(cfg.ShowJobs && isJob(story)) {
+			http.NotFound(w, r)
+			return
+		}
+		if a := sessionOf(r); a != nil {
+			if err := cfg.accounts.MarkRead(a.user.ID, id, time.Now()); err != nil {
+				log.Printf("failed to mark story %d read for %s: %s", id, a.user.Name, err)
+			}
+			marked := []item{story}
+			cfg.markStories(r, marked)
+			story = marked[0]
+		}
+		data := itemTemplateData{
+			Story:      story,
+			Text:       template.HTML(reader.SanitizeHN(story.Text)),
+			Paragraphs: paragraphs(story.Text),
+			pageData:   cfg.pageData(r, start),
+		}
+		cfg.sharedCaching(w, r, itemKeys(id)...)
+		err = tpls.execute(w, "item.gohtml", data)
+		if err != nil {
+			uncached(w)
+			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// paragraphs turns the HTML of an item text into plain text paragraphs.
+func paragraphs(text string) []string {
+	var ret []string
+	for _, p := range paragraphBreak.Split(text, -1) {
+		p = strings.TrimSpace(html.UnescapeString(anyTag.ReplaceAllString(p, "")))
+		if p != "" {
+			ret = append(ret, p)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const jobsPath = "/jobs"
+
+// jobsLifeDuration is how long the jobs page is cached, job ads come and go
+// a lot slower than stories.
+const jobsLifeDuration = 10 * time.Minute
+
+// jobsCach holds the current job ads for the jobs page.
+type jobsCach struct {
+	mutex      sync.Mutex
+	numJobs    int
+	filters    *filters
+	jobs       []item
+	expiration time.Time
+}
+
+func newJobsCach(numJobs int, filters *filters) *jobsCach {
+	return &jobsCach{numJobs: numJobs, filters: filters}
+}
+
+func (j *jobsCach) get(ctx context.Context) ([]item, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if time.Now().Before(j.expiration) {
+		return j.jobs, nil
+	}
+	ids, err := hnClient.JobItemsContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	jobs, _ := fetchItems(ctx, hnSource{}, ids, j.numJobs, j.filters.keep, isJob, nil)
+	// don't keep the ads that were cut short for long
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	j.jobs = jobs
+	j.expiration = time.Now().Add(jobsLifeDuration)
+	return j.jobs, nil
+}
+
+// jobsHandler lists the current job ads, newest first.
+func jobsHandler(j *jobsCach, cfg config, tpls *templates) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		jobs, err := j.get(r.Context())
+		if errors.Is(err, context.DeadlineExceeded) {
+			storiesError(w, err)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to load the job ads", http.StatusInternalServerError)
+			return
+		}
+		data := templateData{
+			Stories:  view{TextPosts: true}.apply(jobs, len(jobs)),
+			Jobs:     true,
+			ShowJobs: true,
+			pageData: cfg.pageData(r, start),
+		}
+		err = tpls.execute(w, "index.gohtml", data)
+		if err != nil {
+			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+			return
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The schema.org structured data of the pages, as JSON-LD for
+// <script type="application/ld+json">, so search engines and reader apps
+// don't have to scrape the markup. encoding/json escapes <, > and &, the
+// script can't be closed from a title.
+
+type ldPerson struct {
+	Type string `json:"@type"`
+	Name string `json:"name"`
+}
+
+type ldArticle struct {
+	Context       string    `json:"@context,omitempty"`
+	Type          string    `json:"@type"`
+	Headline      string    `json:"headline"`
+	URL           string    `json:"url"`
+	Page          string    `json:"mainEntityOfPage,omitempty"`
+	DiscussionURL string    `json:"discussionUrl"`
+	Published     string    `json:"datePublished,omitempty"`
+	Author        *ldPerson `json:"author,omitempty"`
+	Comments      int       `json:"commentCount"`
+	Description   string    `json:"description,omitempty"`
+	Image         string    `json:"image,omitempty"`
+	Keywords      string    `json:"keywords,omitempty"`
+}
+
+type ldListItem struct {
+	Type     string    `json:"@type"`
+	Position int       `json:"position"`
+	Item     ldArticle `json:"item"`
+}
+
+type ldItemList struct {
+	Context  string       `json:"@context"`
+	Type     string       `json:"@type"`
+	Name     string       `json:"name"`
+	URL      string       `json:"url"`
+	Elements []ldListItem `json:"itemListElement"`
+}
+
+// absoluteURL makes the links of the instance itself, like the detail pages
+// of text posts, absolute with the base URL of brand.
+func absoluteURL(brand branding, link string) string {
+	if strings.HasPrefix(link, "/") {
+		return brand.URL + link
+	}
+	return link
+}
+
+func storyLD(brand branding, s item) ldArticle {
+	a := ldArticle{
+		Type:          "Article",
+		Headline:      s.Title,
+		URL:           absoluteURL(brand, s.Link()),
+		DiscussionURL: s.CommentsURL(),
+		Comments:      s.Descendants,
+		Description:   s.Description,
+		Image:         s.Image,
+		Keywords:      strings.Join(s.Tags, ","),
+	}
+	if s.Time != 0 {
+		a.Published = s.Posted().UTC().Format(time.RFC3339)
+	}
+	if s.By != "" {
+		a.Author = &ldPerson{Type: "Person", Name: s.By}
+	}
+	return a
+}
+
+func marshalLD(v any) template.JS {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return template.JS(b)
+}
+
+// StructuredData is the stories of the page as a schema.org ItemList of
+// Articles, in their order.
+func (d templateData) StructuredData() template.JS {
+	list := ldItemList{Context: "https://schema.org", Type: "ItemList", Name: d.Brand.Title, URL: d.Brand.URL + "/", Elements: []ldListItem{}}
+	if d.Tag != "" {
+		list.URL = d.Brand.URL + "/tag/" + url.PathEscape(d.Tag)
+	}
+	for i, s := range d.Stories {
+		list.Elements = append(list.Elements, ldListItem{Type: "ListItem", Position: i + 1, Item: storyLD(d.Brand, s)})
+	}
+	return marshalLD(list)
+}
+
+// StructuredData is the story as a schema.org Article, whose page is this
+// one.
+func (d itemTemplateData) StructuredData() template.JS {
+	a := storyLD(d.Brand, d.Story)
+	a.Context = "https://schema.org"
+	a.Page = fmt.Sprintf("%s%s?id=%d", d.Brand.URL, itemPath, d.Story.ID)
+	return marshalLD(a)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var ldScript = regexp.MustCompile(`(?s)<script type="application/ld\+json">(.*?)</script>`)
+
+func TestStructuredData(t *testing.T) {
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{Lang: "en", CookieSecret: "secret", PublicURL: "https://quiet.example"}
+	req := httptest.NewRequest("GET", "/", nil)
+	story := testStory(1, "Go </script> tips", "https://a.com/x", 10)
+	story.By, story.Descendants = "pg", 4
+	text := testStory(2, "Ask HN: Why?", "", 3)
+
+	rec := httptest.NewRecorder()
+	data := templateData{Stories: []item{story, text}, pageData: cfg.pageData(req, time.Now())}
+	if err := tpls.execute(rec, "index.gohtml", data); err != nil {
+		t.Fatal(err)
+	}
+	m := ldScript.FindStringSubmatch(rec.Body.String())
+	if m == nil {
+		t.Fatalf("want a JSON-LD script on the front page, got %s", rec.Body.String())
+	}
+	var list ldItemList
+	if err := json.Unmarshal([]byte(m[1]), &list); err != nil {
+		t.Fatalf("want valid JSON, got %v in %s", err, m[1])
+	}
+	if list.Type != "ItemList" || len(list.Elements) != 2 || list.URL != "https://quiet.example/" {
+		t.Fatalf("want an ItemList of the 2 stories, got %+v", list)
+	}
+	first, second := list.Elements[0], list.Elements[1]
+	if first.Position != 1 || first.Item.Headline != "Go </script> tips" || first.Item.URL != "https://a.com/x" || first.Item.Author == nil || first.Item.Author.Name != "pg" || first.Item.Comments != 4 || first.Item.DiscussionURL != discussionURL(1) {
+		t.Errorf("want the first story as an Article, got %+v", first)
+	}
+	if second.Item.URL != "https://quiet.example/item?id=2" {
+		t.Errorf("want the text post to link to its absolute detail page, got %q", second.Item.URL)
+	}
+
+	rec = httptest.NewRecorder()
+	if err := tpls.execute(rec, "item.gohtml", itemTemplateData{Story: story, pageData: cfg.pageData(req, time.Now())}); err != nil {
+		t.Fatal(err)
+	}
+	m = ldScript.FindStringSubmatch(rec.Body.String())
+	if m == nil {
+		t.Fatalf("want a JSON-LD script on the item page, got %s", rec.Body.String())
+	}
+	var article ldArticle
+	if err := json.Unmarshal([]byte(m[1]), &article); err != nil {
+		t.Fatalf("want valid JSON, got %v in %s", err, m[1])
+	}
+	if article.Context != "https://schema.org" || article.Type != "Article" || article.Page != "https://quiet.example/item?id=1" {
+		t.Errorf("want the story as the Article of the page, got %+v", article)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// karmaLifeDuration is how long the karma of a user is cached. It changes
+// slowly, and the same people submit many of the top stories.
+const karmaLifeDuration = 6 * time.Hour
+
+type karmaCach struct {
+	mutex   sync.Mutex
+	entries map[string]karmaEntry
+}
+
+type karmaEntry struct {
+	karma      int
+	expiration time.Time
+}
+
+func newKarmaCach() *karmaCach {
+	return &karmaCach{entries: make(map[string]karmaEntry)}
+}
+
+// get returns the karma of a user, fetching it if it isn't cached.
+func (k *karmaCach) get(user string) (int, error) {
+	k.mutex.Lock()
+	e, ok := k.entries[user]
+	k.mutex.Unlock()
+	if ok && time.Now().Before(e.expiration) {
+		return e.karma, nil
+	}
+	u, err := hnClient.GetUser(user)
+	if err != nil {
+		return 0, err
+	}
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	for name, e := range k.entries {
+		if time.Now().After(e.expiration) {
+			delete(k.entries, name)
+		}
+	}
+	k.entries[user] = karmaEntry{karma: u.Karma, expiration: time.Now().Add(karmaLifeDuration)}
+	return u.Karma, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// lambdaClient talks to the runtime API of AWS Lambda. Waiting for the next
+// invocation takes as long as there is none, so it has no timeout.
+var lambdaClient = &http.Client{}
+
+// lambdaEvent is the part of an invocation through a function URL or an API
+// Gateway HTTP API, payload version 2.0, that makes the request.
+type lambdaEvent struct {
+	RawPath         string            `json:"rawPath"`
+	RawQueryString  string            `json:"rawQueryString"`
+	Cookies         []string          `json:"cookies"`
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+	RequestContext  struct {
+		DomainName string `json:"domainName"`
+		HTTP       struct {
+			Method   string `json:"method"`
+			SourceIP string `json:"sourceIp"`
+		} `json:"http"`
+	} `json:"requestContext"`
+}
+
+type lambdaResponse struct {
+	StatusCode      int               `json:"statusCode"`
+	Headers         map[string]string `json:"headers"`
+	Cookies         []string          `json:"cookies,omitempty"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded"`
+}
+
+// serveLambda answers the invocations of the Lambda runtime API at api with
+// h, one at a time, as Lambda hands them out. It only returns when the
+// runtime API fails.
+func serveLambda(api string, h http.Handler) error {
+	base := "http://" + api + "/2018-06-01/runtime/invocation/"
+	for {
+		resp, err := lambdaClient.Get(base + "next")
+		if err != nil {
+			return fmt.Errorf("lambda: %w", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("lambda: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("lambda: unexpected status %s", resp.Status)
+		}
+		id := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+		ctx, cancel := invocationContext(resp.Header)
+		out, err := invokeLambda(ctx, h, body)
+		cancel()
+		if err != nil {
+			b, _ := json.Marshal(map[string]string{"errorMessage": err.Error(), "errorType": "InvalidEvent"})
+			err = lambdaPost(base+id+"/error", b)
+		} else {
+			err = lambdaPost(base+id+"/response", out)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// invocationContext ends when the invocation times out.
+func invocationContext(header http.Header) (context.Context, context.CancelFunc) {
+	if ms, err := strconv.ParseInt(header.Get("Lambda-Runtime-Deadline-Ms"), 10, 64); err == nil {
+		return context.WithDeadline(context.Background(), time.UnixMilli(ms))
+	}
+	return context.WithCancel(context.Background())
+}
+
+// invokeLambda serves the request of an invocation and returns the response
+// for the runtime API.
+func invokeLambda(ctx context.Context, h http.Handler, event []byte) ([]byte, error) {
+	var ev lambdaEvent
+	if err := json.Unmarshal(event, &ev); err != nil {
+		return nil, err
+	}
+	if ev.RequestContext.HTTP.Method == "" {
+		return nil, errors.New("not an HTTP invocation of payload version 2.0")
+	}
+	body := []byte(ev.Body)
+	if ev.IsBase64Encoded {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(ev.Body); err != nil {
+			return nil, err
+		}
+	}
+	target := ev.RawPath
+	if ev.RawQueryString != "" {
+		target += "?" + ev.RawQueryString
+	}
+	r, err := http.NewRequestWithContext(ctx, ev.RequestContext.HTTP.Method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range ev.Headers {
+		r.Header.Set(k, v)
+	}
+	if len(ev.Cookies) > 0 {
+		r.Header.Set("Cookie", strings.Join(ev.Cookies, "; "))
+	}
+	r.Host = ev.RequestContext.DomainName
+	if host := ev.Headers["host"]; host != "" {
+		r.Host = host
+	}
+	r.RemoteAddr = ev.RequestContext.HTTP.SourceIP + ":0"
+	r.RequestURI = target
+
+	w := &lambdaWriter{header: make(http.Header)}
+	h.ServeHTTP(w, r)
+	ret := lambdaResponse{StatusCode: w.status, Headers: make(map[string]string), Cookies: w.header.Values("Set-Cookie")}
+	if ret.StatusCode == 0 {
+		ret.StatusCode = http.StatusOK
+	}
+	for k, v := range w.header {
+		if k != "Set-Cookie" {
+			ret.Headers[k] = strings.Join(v, ", ")
+		}
+	}
+	if utf8.Valid(w.body.Bytes()) {
+		ret.Body = w.body.String()
+	} else {
+		ret.Body, ret.IsBase64Encoded = base64.StdEncoding.EncodeToString(w.body.Bytes()), true
+	}
+	return json.Marshal(ret)
+}
+
+func lambdaPost(url string, body []byte) error {
+	resp, err := lambdaClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("lambda: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("lambda: unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// lambdaWriter keeps the response of an invocation, which Lambda takes in
+// one piece.
+type lambdaWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *lambdaWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *lambdaWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *lambdaWriter) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServeLambda(t *testing.T) {
+	events := []string{
+		`{"version":"2.0","rawPath":"/hello","rawQueryString":"name=go","cookies":["a=1","b=2"],"headers":{"host":"fn.example"},
+			"requestContext":{"domainName":"fn.example","http":{"method":"POST","sourceIp":"192.0.2.1"}},"body":"aGk=","isBase64Encoded":true}`,
+		`{"not":"http"}`,
+	}
+	responses := make(map[string]string)
+	runtime := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/2018-06-01/runtime/invocation/")
+		if path == "next" {
+			if len(responses) == len(events) {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			id := []string{"one", "two"}[len(responses)]
+			w.Header().Set("Lambda-Runtime-Aws-Request-Id", id)
+			w.Header().Set("Lambda-Runtime-Deadline-Ms", "99999999999999")
+			io.WriteString(w, events[len(responses)])
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		responses[path] = string(b)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer runtime.Close()
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		a, _ := r.Cookie("b")
+		http.SetCookie(w, &http.Cookie{Name: "seen", Value: "1"})
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, r.Method+" "+r.Host+r.URL.String()+" "+string(body)+" "+a.Value)
+	})
+	if err := serveLambda(strings.TrimPrefix(runtime.URL, "http://"), h); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("runtime failure: want the error, got %v", err)
+	}
+
+	var got lambdaResponse
+	if err := json.Unmarshal([]byte(responses["one/response"]), &got); err != nil {
+		t.Fatalf("response: want JSON, got %q", responses["one/response"])
+	}
+	if got.StatusCode != http.StatusCreated || got.Body != "POST fn.example/hello?name=go hi 2" || got.Headers["Content-Type"] != "text/plain" {
+		t.Errorf("response: want the request served, got %+v", got)
+	}
+	if len(got.Cookies) != 1 || got.Cookies[0] != "seen=1" {
+		t.Errorf("cookies: want seen=1, got %v", got.Cookies)
+	}
+	if !strings.Contains(responses["two/error"], "payload version 2.0") {
+		t.Errorf("invalid event: want an error, got %q", responses["two/error"])
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	outPath = "/out/"
+	// shortPath and commentsPath are the permalinks of a story and of its
+	// discussion, to share
+	shortPath    = "/s/"
+	commentsPath = "/c/"
+)
+
+// trackingParams are the query parameters that only tell a site where a
+// visitor came from, they are removed from story URLs. Parameters starting
+// with utm_ are too.
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "dclid": true, "gbraid": true, "wbraid": true,
+	"msclkid": true, "yclid": true, "twclid": true, "igshid": true, "mc_cid": true,
+	"mc_eid": true, "_hsenc": true, "_hsmi": true, "mkt_tok": true, "ref_src": true,
+}
+
+// stripTracking removes the trackingParams from the query of a URL and
+// keeps the rest of it as it is, in order.
+func stripTracking(rawURL string) string {
+	base, query, ok := strings.Cut(rawURL, "?")
+	if !ok {
+		return rawURL
+	}
+	query, fragment, hasFragment := strings.Cut(query, "#")
+	var kept []string
+	for _, param := range strings.Split(query, "&") {
+		key, _, _ := strings.Cut(param, "=")
+		if key, err := url.QueryUnescape(key); err == nil && (trackingParams[strings.ToLower(key)] || strings.HasPrefix(strings.ToLower(key), "utm_")) {
+			continue
+		}
+		kept = append(kept, param)
+	}
+	if len(kept) > 0 {
+		base += "?" + strings.Join(kept, "&")
+	}
+	if hasFragment {
+		base += "#" + fragment
+	}
+	return base
+}
+
+// outHandler redirects /out/{id} and /s/{id} to the link of the story, with
+// ?source= for a story of another source than HN, telling the browser
+// not to send the page it came from along. With -click_stats the click is
+// counted in the archive, for the stories of the front page. caches are
+// those of cfg.sourceNames, in order.
+func outHandler(caches []*cach, cfg config) http.HandlerFunc {
+	names := cfg.sourceNames()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, s, ok, err := findStory(r, caches, names)
+		if err != nil {
+			http.Error(w, "Failed to load the story", http.StatusBadGateway)
+			return
+		}
+		if ok && s.URL == "" && strings.HasPrefix(r.URL.Path, shortPath) {
+			// the permalink of a text post is its detail page, /out/ is
+			// only for links
+			http.Redirect(w, r, s.Link(), http.StatusFound)
+			return
+		}
+		u, err := url.Parse(s.URL)
+		if !ok || err != nil || u.Scheme != "http" && u.Scheme != "https" {
+			http.NotFound(w, r)
+			return
+		}
+		id := s.ID
+		if cfg.ClickStats && c != nil && c.archive != nil && isClick(r) {
+			if err := c.archive.Click(id, time.Now()); err != nil {
+				log.Printf("failed to count a click: %s", err)
+			}
+		}
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		http.Redirect(w, r, s.Link(), http.StatusFound)
+	})
+}
+
+// commentsHandler redirects /c/{id} to the discussion of the story, with
+// ?source= for a story of another source than HN.
+func commentsHandler(caches []*cach, cfg config) http.HandlerFunc {
+	names := cfg.sourceNames()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := pathID(r)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if r.FormValue("source") == "" {
+			// the discussion of an HN story is where it is, on the front
+			// page or not
+			http.Redirect(w, r, discussionURL(id), http.StatusFound)
+			return
+		}
+		_, s, ok, err := findStory(r, caches, names)
+		if err != nil || !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.Redirect(w, r, s.CommentsURL(), http.StatusFound)
+	})
+}
+
+// pathID is the id of a story in the path of /out/{id}, /s/{id} and
+// /c/{id}.
+func pathID(r *http.Request) (int, error) {
+	_, id, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	return strconv.Atoi(id)
+}
+
+// findStory returns the story of the id in the path, of ?source= or HN,
+// and the cache of the source it is in. A story of HN that left the front
+// page is fetched from HN, ok is false if there is no such story.
+func findStory(r *http.Request, caches []*cach, names []string) (c *cach, s item, ok bool, err error) {
+	id, err := pathID(r)
+	if err != nil {
+		return nil, item{}, false, nil
+	}
+	source := r.FormValue("source")
+	for i, name := range names {
+		if name == source || source == "" && name == "hn" {
+			c = caches[i]
+		}
+	}
+	if c != nil {
+		s, ok = c.lookup(id)
+	}
+	// a story that left the front page is still on HN
+	if !ok && source == "" {
+		hnItem, err := fetchItem(r.Context(), hnSource{}, id)
+		if err != nil {
+			return c, item{}, false, err
+		}
+		s, ok = parseHNItem(hnItem), hnItem.ID == id
+	}
+	return c, s, ok, nil
+}
+
+// isClick is false for the requests of browsers preloading a link nobody
+// may follow.
+func isClick(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	for _, h := range []string{"Sec-Purpose", "Purpose", "X-Moz", "X-Purpose"} {
+		if strings.Contains(strings.ToLower(r.Header.Get(h)), "prefetch") {
+			return false
+		}
+	}
+	return true
+}
+
+// Href is where the title of the story links to: its Link, or with
+// -out_links the redirect to it through /out.
+func (s storyData) Href() string {
+	if !s.OutLinks || s.URL == "" {
+		return s.Link()
+	}
+	href := outPath + strconv.Itoa(s.ID)
+	if s.Source != "" {
+		href += "?source=" + url.QueryEscape(s.Source)
+	}
+	return href
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neghoda/quiet_hn/archive"
+)
+
+func TestStripTracking(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"https://example.com/a", "https://example.com/a"},
+		{"https://example.com/a?id=1&utm_source=hn&UTM_Medium=x", "https://example.com/a?id=1"},
+		{"https://example.com/a?fbclid=abc", "https://example.com/a"},
+		{"https://example.com/a?b=2&a=1&gclid=x#top", "https://example.com/a?b=2&a=1#top"},
+		{"https://example.com/a?q=a%20b&ref_src=twsrc", "https://example.com/a?q=a%20b"},
+	}
+	for _, tt := range tests {
+		if got := stripTracking(tt.in); got != tt.want {
+			t.Errorf("%s: want %s, got %s", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestOutHandler(t *testing.T) {
+	setupHN(t, map[int]string{
+		1: storyJSON(1),
+		2: storyJSON(2),
+		3: `{"id":3,"type":"story","title":"Ask HN","text":"?"}`,
+	})
+	f, err := newFilters(config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCach(1, f, cachOptions{})
+	c.forceRefresh()
+	other := newCach(1, f, cachOptions{})
+	other.source = fakeSource{{ID: 1, Type: "story", Title: "Elsewhere", URL: "https://example.org/1"}}
+	other.forceRefresh()
+	h := outHandler([]*cach{c, other}, config{Sources: "hn,lobsters"})
+
+	tests := []struct {
+		path string
+		code int
+		want string
+	}{
+		{"/out/1", http.StatusFound, "https://example.com/1"},
+		// not in the cache, fetched from HN
+		{"/out/2", http.StatusFound, "https://example.com/2"},
+		{"/out/1?source=lobsters", http.StatusFound, "https://example.org/1"},
+		{"/out/3", http.StatusNotFound, ""},
+		{"/out/x", http.StatusNotFound, ""},
+		{"/out/2?source=lobsters", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", tt.path, nil))
+		if rec.Code != tt.code || rec.Header().Get("Location") != tt.want {
+			t.Errorf("%s: want %d to %q, got %d to %q", tt.path, tt.code, tt.want, rec.Code, rec.Header().Get("Location"))
+		}
+		if tt.code == http.StatusFound && rec.Header().Get("Referrer-Policy") != "no-referrer" {
+			t.Errorf("%s: want no referrer", tt.path)
+		}
+	}
+}
+
+func TestPermalinks(t *testing.T) {
+	setupHN(t, map[int]string{
+		1: storyJSON(1),
+		3: `{"id":3,"type":"story","title":"Ask HN","text":"?"}`,
+	})
+	f, err := newFilters(config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCach(1, f, cachOptions{})
+	other := newCach(1, f, cachOptions{})
+	other.source = fakeSource{{ID: 1, Type: "story", Title: "Elsewhere", URL: "https://example.org/1"}}
+	other.forceRefresh()
+	// a foreign source links to the discussion on its site
+	other.cashedItems[0].Comments = "https://example.org/c/1"
+	cfg := config{Sources: "hn,lobsters"}
+	out, comments := outHandler([]*cach{c, other}, cfg), commentsHandler([]*cach{c, other}, cfg)
+
+	tests := []struct {
+		h    http.HandlerFunc
+		path string
+		code int
+		want string
+	}{
+		{out, "/s/1", http.StatusFound, "https://example.com/1"},
+		{out, "/s/3", http.StatusFound, "/item?id=3"},
+		{out, "/s/1?source=lobsters", http.StatusFound, "https://example.org/1"},
+		{out, "/s/", http.StatusNotFound, ""},
+		{comments, "/c/1", http.StatusFound, "https://news.ycombinator.com/item?id=1"},
+		{comments, "/c/1?source=lobsters", http.StatusFound, "https://example.org/c/1"},
+		{comments, "/c/2?source=lobsters", http.StatusNotFound, ""},
+		{comments, "/c/x", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		tt.h(rec, httptest.NewRequest("GET", tt.path, nil))
+		if rec.Code != tt.code || rec.Header().Get("Location") != tt.want {
+			t.Errorf("%s: want %d to %q, got %d to %q", tt.path, tt.code, tt.want, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+}
+
+func TestOutHandler_ClickStats(t *testing.T) {
+	setupHN(t, map[int]string{1: storyJSON(1), 2: storyJSON(2)})
+	a, err := archive.Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	f, err := newFilters(config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCach(2, f, cachOptions{archive: a, reposts: &reposts{archive: a}, trends: &trends{archive: a}})
+	c.forceRefresh()
+	cfg := config{Sources: "hn", ClickStats: true, NumStories: 10}
+	h := outHandler([]*cach{c}, cfg)
+	for _, r := range []*http.Request{
+		httptest.NewRequest("GET", "/out/2", nil),
+		httptest.NewRequest("GET", "/out/2", nil),
+		httptest.NewRequest("GET", "/out/1", nil),
+		httptest.NewRequest("HEAD", "/out/1", nil),
+	} {
+		h(httptest.NewRecorder(), r)
+	}
+	prefetch := httptest.NewRequest("GET", "/out/1", nil)
+	prefetch.Header.Set("Sec-Purpose", "prefetch")
+	h(httptest.NewRecorder(), prefetch)
+
+	clicked, err := a.MostClicked(time.Now().Add(-time.Hour), time.Now(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for _, s := range clicked {
+		got = append(got, s.ID, s.Clicks)
+	}
+	if len(got) != 4 || got[0] != 2 || got[1] != 2 || got[2] != 1 || got[3] != 1 {
+		t.Errorf("clicks: want [2 2 1 1], got %v", got)
+	}
+
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	topHandler(a, cfg, tpls)(rec, httptest.NewRequest("GET", "/top/clicked", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Most clicked this week") {
+		t.Errorf("/top/clicked: want the page, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	topHandler(a, config{}, tpls)(rec, httptest.NewRequest("GET", "/top/clicked", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("without click_stats: want 404, got %d", rec.Code)
+	}
+}
+
+func TestStoryData_Href(t *testing.T) {
+	s := testStory(7, "Title", "https://example.com/7", 1)
+	if got := (pageData{}).Story(s).Href(); got != "https://example.com/7" {
+		t.Errorf("plain: want the URL, got %s", got)
+	}
+	d := pageData{OutLinks: true}
+	if got := d.Story(s).Href(); got != "/out/7" {
+		t.Errorf("out links: want /out/7, got %s", got)
+	}
+	s.Source = "lobsters"
+	if got := d.Story(s).Href(); got != "/out/7?source=lobsters" {
+		t.Errorf("other source: want the source, got %s", got)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+const litePath = "/lite"
+
+type liteTemplateData struct {
+	Stories []item
+	pageData
+}
+
+// liteHandler renders the front page as small as it gets, for slow
+// connections and text browsers: the titles, hosts, points and comments of
+// the stories and hardly any style.
+func liteHandler(c *cach, cfg config, tpls *templates) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		stories, err := c.getTopStories(r.Context(), cfg.view(r))
+		if err != nil {
+			storiesError(w, err)
+			return
+		}
+		data := liteTemplateData{Stories: stories, pageData: cfg.pageData(r, start)}
+		if err := tpls.execute(w, "lite.gohtml", data); err != nil {
+			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+		}
+	})
+}
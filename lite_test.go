@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLiteHandler(t *testing.T) {
+	setupHN(t, map[int]string{1: storyJSON(1), 2: storyJSON(2)})
+	f, err := newFilters(config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCach(2, f, cachOptions{})
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	liteHandler(c, config{Lang: "en", NumStories: 2}, tpls)(rec, httptest.NewRequest("GET", litePath, nil))
+	body := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(body, `<a href="https://example.com/2">Story 2</a>`) {
+		t.Fatalf("want the stories, got %d: %s", rec.Code, body)
+	}
+	// none of the layout
+	if strings.Contains(body, "<footer") || strings.Contains(body, "--muted") {
+		t.Errorf("want the lite page without the layout, got %s", body)
+	}
+	if len(body) > 2048 {
+		t.Errorf("want a page of less than 2 KiB for two stories, got %d bytes", len(body))
+	}
+}
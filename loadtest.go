@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// loadtestCommand sends requests at a steady rate to a running instance, or
+// to the handlers of the server run in process, and reports the latencies and
+// errors, to check an instance holds up to a spike of visitors before it gets
+// one.
+func loadtestCommand(args []string) error {
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	rate := fs.Int("rate", 100, "the requests sent a second")
+	duration := fs.Duration("duration", 10*time.Second, "how long to send requests for")
+	target := fs.String("url", "", "the URL of a running instance, like http://localhost:3000 (the handlers of the server are run in process if empty)")
+	paths := fs.String("paths", "/", "a comma separated list of the paths requested in turn, like /,/rss")
+	timeout := fs.Duration("timeout", 10*time.Second, "how long a request may take before it counts as failed")
+	cfg := parseFlags(fs, args)
+	if *rate <= 0 || *duration <= 0 {
+		return errors.New("loadtest: -rate and -duration must be positive")
+	}
+	base := strings.TrimSuffix(*target, "/")
+	if base == "" {
+		if err := cfg.validate(); err != nil {
+			return err
+		}
+		srv, stop, err := inProcessServer(cfg)
+		if err != nil {
+			return err
+		}
+		defer stop()
+		base = srv.URL
+	}
+	var urls []string
+	for _, p := range strings.Split(*paths, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			urls = append(urls, base+"/"+strings.TrimPrefix(p, "/"))
+		}
+	}
+	fmt.Fprintf(os.Stderr, "sending %d requests a second to %s for %s\n", *rate, base, *duration)
+	client := &http.Client{
+		Timeout:   *timeout,
+		Transport: &http.Transport{MaxIdleConnsPerHost: *rate, ForceAttemptHTTP2: true},
+	}
+	loadtest(client, urls, *rate, *duration).write(os.Stdout)
+	return nil
+}
+
+// inProcessServer serves the pages of the server the way serveCommand does,
+// with the cache warmed up and refreshed in the background.
+func inProcessServer(cfg config) (*httptest.Server, func(), error) {
+	if cfg.CookieSecret == "" {
+		cfg.CookieSecret = randomSecret()
+	}
+	tpls, err := loadTemplates(cfg.TemplatesDir, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := newFilters(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := cachOptions{feeds: newFeedCach()}
+	if !cfg.Diagnostics {
+		opts.pages = newPageCach()
+	}
+	if cfg.ShedLatency > 0 {
+		opts.shed = &shedder{latency: cfg.ShedLatency, maxInterval: cfg.ShedMaxInterval}
+	}
+	c := newCach(cfg.NumStories, f, opts)
+	c.lifeDuration = cfg.CacheTTL
+	if _, err := c.getTopStories(context.Background(), cfg.defaultView()); err != nil {
+		return nil, nil, err
+	}
+	jobs := newScheduler()
+	jobs.add("refresh", mustParseSchedule(cfg.RefreshSchedule), false, func(time.Time) { c.updateCach() })
+	jobs.start()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handler(c, cfg, tpls))
+	mux.HandleFunc(tagPath, handler(c, cfg, tpls))
+	mux.HandleFunc(itemPath, itemHandler(c, cfg, tpls))
+	mux.HandleFunc(rssPath, rssHandler(c, cfg))
+	mux.HandleFunc(atomPath, atomHandler(c, cfg))
+	mux.HandleFunc(jsonFeedPath, jsonFeedHandler(c, cfg))
+	srv := httptest.NewServer(mux)
+	return srv, func() {
+		srv.Close()
+		jobs.shutdown(context.Background())
+	}, nil
+}
+
+// loadReport sums up the requests of a load test.
+type loadReport struct {
+	took      time.Duration
+	latencies []time.Duration
+	statuses  map[int]int
+	// failed counts the requests without a response, errors counts them by
+	// what went wrong
+	failed int
+	errors map[string]int
+}
+
+// loadtest requests the urls in turn, rate times a second for duration,
+// whether or not the earlier requests are done, as visitors would.
+func loadtest(client *http.Client, urls []string, rate int, duration time.Duration) loadReport {
+	report := loadReport{statuses: make(map[int]int), errors: make(map[string]int)}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	interval := time.Second / time.Duration(rate)
+	start := time.Now()
+	for i := 0; ; i++ {
+		// each request has its own due time, unlike ticks which are
+		// dropped, so the rate holds when the loop falls behind
+		due := start.Add(time.Duration(i) * interval)
+		if due.Sub(start) >= duration {
+			break
+		}
+		time.Sleep(time.Until(due))
+		wg.Add(1)
+		go func(url string) {
+			defer wg.Done()
+			sent := time.Now()
+			resp, err := client.Get(url)
+			if err == nil {
+				_, err = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}
+			took := time.Since(sent)
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				report.failed++
+				report.errors[errorKind(err)]++
+				return
+			}
+			report.latencies = append(report.latencies, took)
+			report.statuses[resp.StatusCode]++
+		}(urls[i%len(urls)])
+	}
+	wg.Wait()
+	report.took = time.Since(start)
+	return report
+}
+
+// errorKind shortens an error to what the requests that failed alike have in
+// common, leaving out the URL.
+func errorKind(err error) string {
+	msg := err.Error()
+	if i := strings.LastIndex(msg, ": "); i >= 0 {
+		msg = msg[i+2:]
+	}
+	return msg
+}
+
+// requests returns the number of requests sent.
+func (r loadReport) requests() int {
+	return len(r.latencies) + r.failed
+}
+
+// errorRate returns the share of the requests that failed or got a server
+// error.
+func (r loadReport) errorRate() float64 {
+	if r.requests() == 0 {
+		return 0
+	}
+	errs := r.failed
+	for status, n := range r.statuses {
+		if status >= 500 {
+			errs += n
+		}
+	}
+	return float64(errs) / float64(r.requests())
+}
+
+// percentile returns the latency p of the requests that got a response are
+// below, p from 0 to 100.
+func (r loadReport) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(r.latencies)
+	slices.Sort(sorted)
+	i := int(p/100*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+func (r loadReport) write(w io.Writer) {
+	fmt.Fprintf(w, "requests  %d in %s, %.1f/s\n", r.requests(), r.took.Round(time.Millisecond), float64(r.requests())/r.took.Seconds())
+	fmt.Fprintf(w, "errors    %.2f%%\n", 100*r.errorRate())
+	fmt.Fprintf(w, "latency   p50 %s  p90 %s  p99 %s  max %s\n",
+		r.percentile(50).Round(time.Microsecond), r.percentile(90).Round(time.Microsecond),
+		r.percentile(99).Round(time.Microsecond), r.percentile(100).Round(time.Microsecond))
+	for _, status := range slices.Sorted(maps.Keys(r.statuses)) {
+		fmt.Fprintf(w, "status    %d %s: %d\n", status, http.StatusText(status), r.statuses[status])
+	}
+	for _, kind := range slices.Sorted(maps.Keys(r.errors)) {
+		fmt.Fprintf(w, "failed    %s: %d\n", kind, r.errors[kind])
+	}
+}
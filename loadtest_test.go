@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadtest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken" {
+			http.Error(w, "broken", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+	r := loadtest(srv.Client(), []string{srv.URL + "/", srv.URL + "/broken"}, 200, 100*time.Millisecond)
+	if n := r.requests(); n != 20 {
+		t.Errorf("requests: want 20, got %d", n)
+	}
+	if r.statuses[200] != 10 || r.statuses[500] != 10 {
+		t.Errorf("statuses: want 10 of 200 and 500, got %v", r.statuses)
+	}
+	if rate := r.errorRate(); rate != 0.5 {
+		t.Errorf("error rate: want 0.5, got %v", rate)
+	}
+	var out strings.Builder
+	r.write(&out)
+	if !strings.Contains(out.String(), "status    500 Internal Server Error: 10") {
+		t.Errorf("report: want the server errors listed, got\n%s", out.String())
+	}
+}
+
+func TestLoadReport_Percentile(t *testing.T) {
+	r := loadReport{}
+	for i := 100; i >= 1; i-- {
+		r.latencies = append(r.latencies, time.Duration(i)*time.Millisecond)
+	}
+	for p, want := range map[float64]time.Duration{50: 50 * time.Millisecond, 99: 99 * time.Millisecond, 100: 100 * time.Millisecond, 0: time.Millisecond} {
+		if got := r.percentile(p); got != want {
+			t.Errorf("p%v: want %v, got %v", p, want, got)
+		}
+	}
+	if got := (loadReport{}).percentile(50); got != 0 {
+		t.Errorf("no requests: want 0, got %v", got)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/neghoda/quiet_hn/hn"
+)
+
+// lobstersURL is where the lobsters source gets its stories, tests point it
+// elsewhere.
+var lobstersURL = "https://lobste.rs"
+
+// lobsters is the source of the stories on lobste.rs. Its short ids are
+// base 36 numbers, which make the ids of the items.
+type lobsters struct {
+	mutex sync.Mutex
+	// stories are the ones of the last front page, which has all there is
+	// to know about them
+	stories map[int]hn.Item
+}
+
+func newLobsters() *lobsters {
+	return &lobsters{stories: make(map[int]hn.Item)}
+}
+
+// lobstersStory is a story of the lobste.rs JSON API.
+type lobstersStory struct {
+	ShortID      string    `json:"short_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Title        string    `json:"title"`
+	URL          string    `json:"url"`
+	Score        int       `json:"score"`
+	CommentCount int       `json:"comment_count"`
+	Description  string    `json:"description"`
+	// Submitter is a name in newer versions of the API and an object with
+	// the name in older ones
+	Submitter json.RawMessage `json:"submitter_user"`
+}
+
+func (s lobstersStory) item() (hn.Item, error) {
+	id, err := strconv.ParseInt(s.ShortID, 36, 64)
+	if err != nil {
+		return hn.Item{}, fmt.Errorf("lobsters story %q: %w", s.ShortID, err)
+	}
+	var by string
+	if json.Unmarshal(s.Submitter, &by) != nil {
+		var user struct {
+			Username string `json:"username"`
+		}
+		json.Unmarshal(s.Submitter, &user)
+		by = user.Username
+	}
+	return hn.Item{
+		ID:          int(id),
+		Type:        "story",
+		By:          by,
+		Title:       s.Title,
+		URL:         s.URL,
+		Text:        s.Description,
+		Score:       s.Score,
+		Descendants: s.CommentCount,
+		Time:        int(s.CreatedAt.Unix()),
+	}, nil
+}
+
+func (l *lobsters) TopIDs(ctx context.Context) ([]int, error) {
+	var page []lobstersStory
+	if err := getJSON(ctx, lobstersURL+"/hottest.json", &page); err != nil {
+		return nil, fmt.Errorf("lobsters: %w", err)
+	}
+	stories := make(map[int]hn.Item, len(page))
+	ids := make([]int, 0, len(page))
+	for _, s := range page {
+		it, err := s.item()
+		if err != nil {
+			return nil, err
+		}
+		stories[it.ID] = it
+		ids = append(ids, it.ID)
+	}
+	l.mutex.Lock()
+	l.stories = stories
+	l.mutex.Unlock()
+	return ids, nil
+}
+
+func (l *lobsters) GetItem(ctx context.Context, id int) (hn.Item, error) {
+	l.mutex.Lock()
+	it, ok := l.stories[id]
+	l.mutex.Unlock()
+	if ok {
+		return it, nil
+	}
+	var s lobstersStory
+	if err := getJSON(ctx, lobstersURL+"/s/"+strconv.FormatInt(int64(id), 36)+".json", &s); err != nil {
+		return hn.Item{}, fmt.Errorf("lobsters: %w", err)
+	}
+	return s.item()
+}
+
+func (l *lobsters) name() string {
+	return "lobsters"
+}
+
+func (l *lobsters) commentsURL(id int) string {
+	return lobstersURL + "/s/" + strconv.FormatInt(int64(id), 36)
+}
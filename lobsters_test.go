@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLobsters(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/hottest.json":
+			fmt.Fprint(w, `[
+				{"short_id":"abc123","created_at":"2024-05-01T12:00:00.000-05:00","title":"A link","url":"https://example.com/a","score":12,"comment_count":3,"submitter_user":"alice"},
+				{"short_id":"x9","created_at":"2024-05-01T13:00:00.000-05:00","title":"Ask: why?","url":"","score":5,"comment_count":1,"submitter_user":{"username":"bob"}}
+			]`)
+		case "/s/zz.json":
+			fmt.Fprint(w, `{"short_id":"zz","title":"Older","url":"https://example.com/zz","submitter_user":"carol"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	old := lobstersURL
+	lobstersURL = server.URL
+	defer func() { lobstersURL = old }()
+
+	l := newLobsters()
+	stories, _, err := fetchTopStories(context.Background(), l, 2, func(item) bool { return true }, nil)
+	if err != nil {
+		t.Fatalf("fetchTopStories() received an error: %s", err.Error())
+	}
+	if len(stories) != 2 {
+		t.Fatalf("stories: want the link and the text post, got %+v", stories)
+	}
+	if s := stories[0]; s.ID != 623698779 || s.By != "alice" || s.Descendants != 3 || s.Source != "lobsters" || s.CommentsURL() != server.URL+"/s/abc123" {
+		t.Errorf("link: want story abc123 of lobsters, got %+v", s)
+	}
+	if s := stories[1]; s.By != "bob" || s.Link() != server.URL+"/s/x9" {
+		t.Errorf("text post: want it linked to its discussion, got %+v and %s", s, s.Link())
+	}
+
+	// stories off the front page are asked for
+	if it, err := l.GetItem(context.Background(), 35*36+35); err != nil || it.Title != "Older" || it.By != "carol" {
+		t.Errorf("GetItem(zz): want the older story, got %+v and %v", it, err)
+	}
+}
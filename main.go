@@ -1,162 +1,1164 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"html/template"
 	"log"
 	"net/http"
 	"net/url"
-	"sort"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/neghoda/quiet_hn/accounts"
+	"github.com/neghoda/quiet_hn/archive"
+	"github.com/neghoda/quiet_hn/cron"
 	"github.com/neghoda/quiet_hn/hn"
+	"github.com/neghoda/quiet_hn/i18n"
 )
 
-const cachLifeDuration = 10 * time.Second
+const (
+	// cachLifeDuration is the default of -cache_ttl
+	cachLifeDuration = 10 * time.Second
+	// shutdownTimeout bounds how long requests and jobs in progress are
+	// waited for on shutdown
+	shutdownTimeout = 10 * time.Second
+	// refreshTimeout bounds a refresh, whether or not a request waits for it
+	refreshTimeout = 30 * time.Second
+	// itemRetries is how often an item that failed to load is asked for
+	// again, waiting itemRetryDelay longer each time
+	itemRetries    = 2
+	itemRetryDelay = 50 * time.Millisecond
+)
 
 type cach struct {
+	// cashedItems are in the order of -rank
 	cashedItems  []item
 	expiration   time.Time
 	cachMutex    sync.Mutex
 	numStories   int
 	lifeDuration time.Duration
+	filters      *filters
+	source       source
+	cachOptions
+
+	// dataMutex guards the fields below and the cached items, so readers
+	// don't have to wait on cachMutex while a refresh is running
+	dataMutex     sync.RWMutex
+	refreshedAt   time.Time
+	fetchDuration time.Duration
+	// lastFetch counts the item requests of the last refresh, lastErr is
+	// the last one that failed, at lastErrAt, and degraded is set while
+	// the shedder backs off
+	lastFetch fetchStats
+	lastErr   error
+	lastErrAt time.Time
+	degraded  bool
+	// failures counts the refreshes in a row that kept the stories there
+	// were
+	failures int
+	// outage is set while the breaker around the HN API is open and
+	// refreshes are skipped
+	outage bool
+	// history is the last refreshHistory refreshes, oldest first
+	history []refreshRecord
+}
+
+// cachOptions are the optional parts of a cache, each one is nil when it is
+// not enabled.
+type cachOptions struct {
+	previews *previewCach
+	badges   *badgeCach
+	repos    *repoCach
+	papers   *paperCach
+	links    *linkChecker
+	tags     *tagger
+	archive  *archive.Store
+	reposts  *reposts
+	trends   *trends
+	texts    *textIndexer
+	// synopses is set with -summarize_url or -summarize_command
+	synopses *synopses
+	order    *order
+	daily    *daily
+	watch    *watcher
+	poster   *poster
+	pages    *pageCach
+	feeds    *feedCach
+	shed     *shedder
+	idle     *idleness
+	snapshot *snapshot
+
+	// translations is set with -translate_to
+	translations *translations
+}
+
+// cachStats describes the cache at the time a request was served.
+type cachStats struct {
+	Hit           bool
+	Age           time.Duration
+	FetchDuration time.Duration
+	Stories       int
+	// refreshedAt is when the stories were fetched
+	refreshedAt time.Time
 }
 
 func main() {
-	// parse flags
-	var port, numStories int
-	flag.IntVar(&port, "port", 3000, "the port to start the web server on")
-	flag.IntVar(&numStories, "num_stories", 30, "the number of top stories to display")
-	flag.Parse()
+	run, args := serveCommand, os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		if args[0] == "help" {
+			usage(os.Stdout)
+			return
+		}
+		command, ok := commands[args[0]]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+			usage(os.Stderr)
+			os.Exit(2)
+		}
+		run, args = command.run, args[1:]
+	}
+	if err := run(args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// serveCommand runs the web server until it is interrupted, it is what a bare
+// "quiet_hn" or "quiet_hn -port 8080" runs as well.
+func serveCommand(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	showVersion := fs.Bool("version", false, "print the version and exit")
+	cfg := parseFlags(fs, args)
+	if *showVersion {
+		printVersion()
+		return nil
+	}
+	if err := cfg.validate(); err != nil {
+		return err
+	}
 
-	tpl := template.Must(template.ParseFiles("./index.gohtml"))
+	if cfg.CookieSecret == "" {
+		cfg.CookieSecret = randomSecret()
+		log.Print("no -cookie_secret given, visitor settings are lost on restart")
+	}
 
-	http.HandleFunc("/", handler(numStories, tpl))
+	tpls, err := loadTemplates(cfg.TemplatesDir, cfg.Dev)
+	if err != nil {
+		if !cfg.Dev {
+			log.Fatal(err)
+		}
+		// keep going, the error shows up in the browser until it is fixed
+		log.Print(err)
+	}
+	if cfg.Accounts != "" {
+		if cfg.accounts, err = accounts.Open(cfg.Accounts); err != nil {
+			log.Fatal(err)
+		}
+		cfg.accounts.SessionTTL = cfg.SessionTTL
+		if cfg.oauth, err = cfg.oauthProviders(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	jobs := newScheduler()
+	// the site has a mux of its own, the debug endpoints register on the
+	// default one
+	mux := http.NewServeMux()
+	var opts cachOptions
+	if cfg.Previews {
+		opts.previews = newPreviewCach()
+		mux.HandleFunc("/img", imageHandler(opts.previews))
+	}
+	if cfg.Badges {
+		opts.badges = newBadgeCach()
+	}
+	if cfg.GitHubRepos {
+		opts.repos = newRepoCach(cfg.GitHubToken)
+	}
+	if cfg.Arxiv {
+		opts.papers = newPaperCach()
+	}
+	if cfg.CheckLinks > 0 {
+		opts.links = newLinkChecker(cfg.CheckLinks)
+	}
+	if t := newTranslator(cfg); t != nil {
+		opts.translations = newTranslations(t, cfg.TranslateTo)
+	}
+	f, err := newFilters(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if cfg.TagRules != "" {
+		if opts.tags, err = newTagger(cfg.TagRules); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if cfg.Archive != "" {
+		if opts.archive, err = archive.Open(cfg.Archive); err != nil {
+			log.Fatal(err)
+		}
+		opts.archive.SnapshotEvery = cfg.SnapshotEvery
+		opts.reposts = &reposts{archive: opts.archive, window: cfg.RepostWindow}
+		opts.trends = &trends{archive: opts.archive}
+		mux.HandleFunc(sparkPath, sparkHandler(opts.archive))
+		mux.HandleFunc(searchPath, searchHandler(opts.archive, cfg, tpls))
+		mux.HandleFunc(topPath, topHandler(opts.archive, cfg, tpls))
+		mux.HandleFunc(statsPath, statsHandler(&statsCach{archive: opts.archive}, cfg, tpls))
+		if cfg.IndexText {
+			opts.texts = newTextIndexer(opts.archive, cfg.ReadMaxBytes)
+		}
+		if s := newSummarizer(cfg); s != nil {
+			opts.synopses = newSynopses(opts.archive, s, cfg.ReadMaxBytes)
+		}
+		if cfg.Retention > 0 {
+			a := opts.archive
+			jobs.add("prune", mustParseSchedule(cfg.PruneSchedule), false, func(time.Time) {
+				prune(a, cfg.Retention, cfg.VacuumEvery)
+			})
+		}
+		mux.HandleFunc(pastPath, pastHandler(opts.archive, cfg, tpls))
+		mux.HandleFunc(strings.TrimSuffix(pastPath, "/"), pastHandler(opts.archive, cfg, tpls))
+	}
+	if cfg.WatchRules != "" {
+		if opts.watch, err = newWatcher(cfg); err != nil {
+			log.Fatal(err)
+		}
+		if opts.archive != nil {
+			if err := opts.watch.backfill(opts.archive); err != nil {
+				log.Printf("failed to fill the watch rule feeds from the archive: %s", err)
+			}
+		}
+		mux.HandleFunc(rulePath, ruleFeedHandler(opts.watch, cfg))
+	}
+	if cfg.MastodonServer != "" || cfg.BlueskyHandle != "" {
+		if opts.poster, err = newPoster(cfg); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if opts.order, err = newOrder(cfg); err != nil {
+		log.Fatal(err)
+	}
+	if cfg.DailyAt != "" {
+		if opts.daily, err = newDaily(cfg.DailyAt, cfg.DailyStories); err != nil {
+			log.Fatal(err)
+		}
+	}
+	// diagnostics and templates reloaded in development mode differ on
+	// every request
+	if !cfg.Dev && !cfg.Diagnostics {
+		opts.pages = newPageCach()
+	}
+	opts.feeds = newFeedCach()
+	if cfg.ShedLatency > 0 {
+		opts.shed = &shedder{latency: cfg.ShedLatency, maxInterval: cfg.ShedMaxInterval}
+	}
+	if cfg.BreakerErrorRate > 0 {
+		hnClient.Breaker = &hn.Breaker{ErrorRate: cfg.BreakerErrorRate, Latency: cfg.BreakerLatency, Cooldown: cfg.BreakerCooldown}
+	}
+	if cfg.IdleAfter > 0 {
+		opts.idle = newIdleness(cfg.IdleAfter, cfg.IdleRefresh)
+	}
+	if cfg.Snapshot != "" {
+		opts.snapshot = &snapshot{path: cfg.Snapshot}
+	}
+	c := newCach(cfg.NumStories, f, opts)
+	c.lifeDuration = cfg.CacheTTL
+	if err := c.restore(); err != nil {
+		log.Printf("failed to restore the snapshot: %s", err)
+	}
+	jobs.add("refresh", mustParseSchedule(cfg.RefreshSchedule), true, func(time.Time) { c.updateCach() })
+	bySource := make(map[string]http.Handler)
+	var caches []*cach
+	for i, name := range cfg.sourceNames() {
+		src, err := sourceKinds[name](cfg)
+		if err != nil {
+			log.Fatalf("source %s: %s", name, err)
+		}
+		sc := c
+		if i == 0 {
+			c.source = src
+		} else {
+			// the archive, the watch rules and the poster keep to the
+			// stories of the front page
+			sopts := cachOptions{
+				tags: opts.tags, badges: opts.badges, repos: opts.repos, papers: opts.papers, links: opts.links,
+				translations: opts.translations, order: opts.order,
+			}
+			if opts.pages != nil {
+				sopts.pages = newPageCach()
+			}
+			sc = newCach(cfg.NumStories, f, sopts)
+			sc.source = src
+			sc.lifeDuration = cfg.CacheTTL
+			jobs.add("refresh "+name, mustParseSchedule(cfg.RefreshSchedule), true, func(time.Time) { sc.updateCach() })
+		}
+		caches = append(caches, sc)
+		if name == "hn" && cfg.CountsEvery > 0 {
+			jobs.add("counts", cron.Every(cfg.CountsEvery), false, func(time.Time) {
+				ctx, cancel := context.WithTimeout(context.Background(), countsTimeout)
+				defer cancel()
+				if _, err := sc.refreshCounts(ctx); err != nil {
+					log.Printf("failed to refresh the counts: %s", err)
+				}
+			})
+		}
+		bySource[name] = handler(sc, cfg, tpls)
+		mux.Handle("/"+name, bySource[name])
+	}
+	if len(caches) > 1 {
+		mux.HandleFunc(allPath, mergedHandler(caches, cfg, tpls))
+	}
+	if cfg.outLinks() {
+		mux.HandleFunc(outPath, outHandler(caches, cfg))
+	}
+	mux.HandleFunc(shortPath, outHandler(caches, cfg))
+	mux.HandleFunc(commentsPath, commentsHandler(caches, cfg))
+	// a CGI process is gone before anyone edits a list
+	if len(cfg.listFiles()) > 0 && cfg.Mode != "cgi" {
+		// the stories there are went through the lists before
+		stopWatch, err := f.watch(func() { refreshAll(caches) })
+		if err != nil {
+			log.Printf("failed to watch the filter lists, they are reloaded on refresh instead: %s", err)
+		} else {
+			defer stopWatch()
+		}
+	}
+	if cfg.Hiring {
+		h := newHiring()
+		jobs.add("hiring", cron.Every(hiringEvery), true, func(time.Time) { refreshHiring(h) })
+		mux.HandleFunc(hiringPath, hiringHandler(h, cfg, tpls))
+		mux.HandleFunc(hiringRSSPath, hiringFeedHandler(h, cfg))
+	}
+	if cfg.AdminPassword != "" {
+		live := &liveConfig{cfg: cfg, fs: fs, caches: caches, filters: f, jobs: jobs}
+		mux.HandleFunc(adminPath, adminHandler(live, cfg, tpls))
+		mux.HandleFunc(adminConfigPath, adminConfigHandler(live, cfg))
+		mux.HandleFunc(debugCachePath, debugCacheHandler(caches, cfg))
+	}
+	mux.HandleFunc("/", sourceHandler(bySource, handler(c, cfg, tpls)))
+	mux.HandleFunc("/print", printHandler(c, cfg, tpls))
+	mux.HandleFunc(litePath, liteHandler(c, cfg, tpls))
+	mux.HandleFunc("/read", readHandler(cfg, tpls))
+	mux.HandleFunc(tagPath, handler(c, cfg, tpls))
+	mux.HandleFunc(itemPath, itemHandler(c, cfg, tpls))
+	mux.HandleFunc(rssPath, rssHandler(c, cfg))
+	mux.HandleFunc(atomPath, atomHandler(c, cfg))
+	mux.HandleFunc(jsonFeedPath, jsonFeedHandler(c, cfg))
+	mux.HandleFunc(settingsPath, settingsHandler(cfg, tpls))
+	mux.HandleFunc(themesPath, themesHandler())
+	if cfg.accounts != nil {
+		mux.HandleFunc(loginPath, loginHandler(cfg, tpls, false))
+		mux.HandleFunc(logoutPath, logoutHandler(cfg))
+		mux.HandleFunc(bookmarksPath, bookmarksHandler(c, cfg, tpls))
+		mux.HandleFunc(bookmarksAPIPath, bookmarksAPIHandler(cfg))
+		if cfg.Signup {
+			mux.HandleFunc(signupPath, loginHandler(cfg, tpls, true))
+		}
+		for _, p := range cfg.oauth {
+			mux.HandleFunc(loginPath+"/"+p.name, oauthLoginHandler(cfg, p))
+			mux.HandleFunc(loginPath+"/"+p.name+"/callback", oauthCallbackHandler(cfg, p))
+		}
+	}
+	mux.HandleFunc(versionPath, versionHandler())
+	mux.HandleFunc(healthPath, healthHandler(caches, cfg))
+	robots, err := cfg.robotsTxt()
+	if err != nil {
+		log.Fatal(err)
+	}
+	mux.HandleFunc(robotsPath, robotsHandler(robots))
+	icons, err := loadIcons(cfg.IconsDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for name, icon := range icons {
+		mux.HandleFunc("/"+name, iconHandler(name, icon))
+	}
+	if cfg.ShowJobs {
+		mux.HandleFunc(jobsPath, jobsHandler(newJobsCach(cfg.NumStories, f), cfg, tpls))
+	}
+	if cfg.ShowGallery {
+		p := opts.previews
+		if p == nil {
+			p = newPreviewCach()
+			mux.HandleFunc("/img", imageHandler(p))
+		}
+		mux.HandleFunc(galleryPath, galleryHandler(newGalleryCach(cfg.NumStories, f, p), cfg, tpls))
+	}
+	if cfg.DigestSchedule != "" {
+		d := &digest{
+			numStories: cfg.DigestStories,
+			stories:    func() ([]item, error) { return c.getTopStories(context.Background(), cfg.defaultView()) },
+			targets:    cfg.digestTargets(),
+		}
+		jobs.add("digest", mustParseSchedule(cfg.DigestSchedule), false, func(at time.Time) {
+			if err := d.send(at); err != nil {
+				log.Printf("failed to send the digest: %s", err)
+			}
+		})
+	}
 
 	// Start the server
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
+	// a CGI process is gone after its request, the jobs would only hold
+	// it up
+	if cfg.Mode != "cgi" {
+		jobs.start()
+	}
+	var h http.Handler = cfg.withAccounts(mux)
+	if cfg.RequestTimeout > 0 {
+		h = withTimeout(h, cfg.RequestTimeout)
+	}
+	if cfg.noindex() {
+		h = withNoindex(h)
+	}
+	if opts.idle != nil {
+		h = opts.idle.handler(h)
+	}
+	server, err := newServer(cfg, h)
+	if err != nil {
+		log.Fatal(err)
+	}
+	served := make(chan error, 1)
+	go func() { served <- server.serve() }()
+	var debug *http.Server
+	if cfg.DebugAddr != "" {
+		publishVars(c)
+		debug = &http.Server{Addr: cfg.DebugAddr, Handler: debugHandler(cfg.DebugToken)}
+		go func() {
+			if err := debug.ListenAndServe(); err != http.ErrServerClosed {
+				log.Fatal(err)
+			}
+		}()
+	}
+
+	// stop gracefully, letting the requests and jobs in progress finish
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	select {
+	case <-stop:
+		log.Print("shutting down")
+	case err := <-served:
+		// only the request of a CGI process ends without a signal
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.stop(ctx); err != nil {
+		log.Printf("failed to stop the server: %s", err)
+	}
+	if debug != nil {
+		debug.Shutdown(ctx)
+	}
+	if err := jobs.shutdown(ctx); err != nil {
+		log.Printf("failed to wait for the jobs: %s", err)
+	}
+	if opts.archive != nil {
+		opts.archive.Close()
+	}
+	if cfg.accounts != nil {
+		cfg.accounts.Close()
+	}
+	return nil
 }
 
-func handler(numStories int, tpl *template.Template) http.HandlerFunc {
-	c := cach{
+// mustParseSchedule parses a schedule that validate already checked.
+func mustParseSchedule(expr string) *cron.Schedule {
+	s, err := cron.Parse(expr)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// newCach returns a cache of the top numStories stories of HN, or of another
+// source once it is set. The refresh job of the scheduler keeps it fresh in
+// the background.
+func newCach(numStories int, filters *filters, opts cachOptions) *cach {
+	return &cach{
 		expiration:   time.Now(),
 		numStories:   numStories,
 		lifeDuration: cachLifeDuration,
+		filters:      filters,
+		source:       hnSource{},
+		cachOptions:  opts,
 	}
-	ticker := time.NewTicker(cachLifeDuration / 2)
-	go func() {
-		for {
-			c.updateCach()
-			<-ticker.C
-		}
-	}()
+}
+
+func handler(c *cach, cfg config, tpls *templates) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		stories, err := c.getTopStories()
-		if err != nil {
-			http.Error(w, "Failed to load top stories", http.StatusInternalServerError)
+		v := cfg.view(r)
+		if v.Tag != "" && !c.tags.has(v.Tag) {
+			http.NotFound(w, r)
+			return
 		}
-		data := templateData{
-			Stories: stories,
-			Time:    time.Now().Sub(start),
+		cards := c.previews != nil && r.URL.Query().Get("view") == "cards"
+		if key, ok := c.pages.key(cfg, r, v, cards); ok {
+			if err := c.ready(r.Context()); err != nil {
+				storiesError(w, err)
+				return
+			}
+			if page, ok := c.pages.get(key, c.refreshed()); ok {
+				cfg.sharedCaching(w, r, frontPageKeys(v.Tag)...)
+				writeHTML(w, page)
+				return
+			}
+			// keep the request to render the variant again after the
+			// next refresh
+			r := r.Clone(context.Background())
+			render := func() ([]byte, time.Time, error) {
+				data, stats, err := indexData(c, cfg, r, v, cards, time.Now())
+				if err != nil {
+					return nil, time.Time{}, err
+				}
+				page, err := tpls.render("index.gohtml", data)
+				return page, stats.refreshedAt, err
+			}
+			data, stats, err := indexData(c, cfg, r, v, cards, start)
+			if err != nil {
+				storiesError(w, err)
+				return
+			}
+			page, err := tpls.render("index.gohtml", data)
+			if err != nil {
+				http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+				return
+			}
+			c.pages.put(key, &renderedPage{body: page, refreshedAt: stats.refreshedAt, render: render, used: true})
+			cfg.sharedCaching(w, r, frontPageKeys(v.Tag)...)
+			writeHTML(w, page)
+			return
 		}
-		err = tpl.Execute(w, data)
+		data, _, err := indexData(c, cfg, r, v, cards, start)
 		if err != nil {
+			storiesError(w, err)
+			return
+		}
+		cfg.sharedCaching(w, r, frontPageKeys(v.Tag)...)
+		err = tpls.execute(w, "index.gohtml", data)
+		if err != nil {
+			uncached(w)
 			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
 			return
 		}
 	})
 }
 
-func (c *cach) getTopStories() ([]item, error) {
-	if !c.cachExpired() {
-		return c.cashedItems, nil
+// indexData returns what the front page shows for the view.
+func indexData(c *cach, cfg config, r *http.Request, v view, cards bool, start time.Time) (templateData, cachStats, error) {
+	stories, stats, err := c.getTopStoriesWithStats(r.Context(), v)
+	if err != nil {
+		return templateData{}, stats, err
+	}
+	data := templateData{
+		Stories:  stories,
+		Tag:      v.Tag,
+		Daily:    c.dailySnapshot(),
+		ShowJobs: cfg.ShowJobs,
+		Archive:  c.archive != nil,
+		Refresh:  refreshInterval(r, cfg.Refresh),
+		pageData: cfg.pageData(r, start),
+	}
+	cfg.markStories(r, data.Stories)
+	data.Cards = cards
+	data.ShowGallery = cfg.ShowGallery
+	data.Outage = c.outageSince()
+	if v.GroupHosts {
+		data.Groups = groupStories(data.Stories)
+	}
+	if cfg.Diagnostics {
+		data.Diagnostics = &stats
+	}
+	return data, stats, nil
+}
+
+func (c *cach) getTopStories(ctx context.Context, v view) ([]item, error) {
+	stories, _, err := c.getTopStoriesWithStats(ctx, v)
+	return stories, err
+}
+
+func (c *cach) getTopStoriesWithStats(ctx context.Context, v view) ([]item, cachStats, error) {
+	hit := !c.cachExpired()
+	if err := c.ready(ctx); err != nil {
+		return nil, cachStats{}, err
+	}
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+	var stories []item
+	if c.daily != nil {
+		stories = v.apply(c.daily.stories, len(c.daily.stories))
+	} else {
+		stories = v.apply(c.cashedItems, c.numStories)
 	}
-	c.updateCach()
-	return c.cashedItems, nil
+	stats := cachStats{
+		Hit:           hit,
+		Age:           time.Since(c.refreshedAt).Round(time.Second),
+		FetchDuration: c.fetchDuration.Round(time.Millisecond),
+		Stories:       len(stories),
+		refreshedAt:   c.refreshedAt,
+	}
+	return stories, stats, nil
+}
+
+// outage describes the outage of the HN API the front page is served
+// through, the stories are from Refreshed and the API is tried again at
+// Retry.
+type outage struct {
+	Refreshed time.Time
+	Retry     time.Time
+}
+
+// breakerOpen reports whether the cache is of HN and the breaker around
+// the HN API is open.
+func (c *cach) breakerOpen() bool {
+	_, ok := c.source.(hnSource)
+	return ok && hnClient.Breaker.Open()
+}
+
+// outageSince returns the outage of the HN API, nil while there is none.
+func (c *cach) outageSince() *outage {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+	if !c.outage {
+		return nil
+	}
+	return &outage{Refreshed: c.refreshedAt, Retry: hnClient.Breaker.OpenUntil()}
 }
 
+// refreshed returns when the cache was last refreshed.
+func (c *cach) refreshed() time.Time {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+	return c.refreshedAt
+}
+
+// dailySnapshot describes the snapshot the front page shows in the -daily_at
+// mode, it is nil otherwise.
+func (c *cach) dailySnapshot() *dailySnapshot {
+	if c.daily == nil {
+		return nil
+	}
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+	return &dailySnapshot{Taken: c.daily.takenAt, Next: c.daily.next(time.Now())}
+}
+
+// lookup returns the cached story with the given id.
+func (c *cach) lookup(id int) (item, bool) {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
+	for _, s := range c.cashedItems {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return item{}, false
+}
+
+// updateCach refreshes the cache, unless refreshes are put off while the HN
+// API is degraded or nobody visits.
 func (c *cach) updateCach() {
 	c.cachMutex.Lock()
 	defer c.cachMutex.Unlock()
-	tempCach, err := fetchTopStories(c.numStories)
+	now := time.Now()
+	if !c.shed.waiting(now) && !c.idle.skip(now, c.refreshed()) {
+		c.refresh()
+	}
+}
+
+// ready refreshes the cache if it expired, waiting for it until ctx is done.
+// The refresh goes on for the requests after, and the stories there are get
+// served meanwhile, so it only fails while there are none yet.
+func (c *cach) ready(ctx context.Context) error {
+	if !c.cachExpired() {
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		c.updateExpiredCach()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		c.dataMutex.RLock()
+		defer c.dataMutex.RUnlock()
+		if len(c.cashedItems) > 0 {
+			return nil
+		}
+		return ctx.Err()
+	}
+}
+
+// updateExpiredCach refreshes the cache unless another request refreshed it
+// while this one waited for the lock.
+func (c *cach) updateExpiredCach() {
+	c.cachMutex.Lock()
+	defer c.cachMutex.Unlock()
+	if c.cachExpired() {
+		c.refresh()
+	}
+}
+
+// refresh fetches the stories again, cachMutex must be held.
+func (c *cach) refresh() {
+	// there is no point in asking the HN API while the breaker is open, the
+	// stories there are stay until it lets a request through again
+	if c.breakerOpen() {
+		c.dataMutex.Lock()
+		c.expiration = hnClient.Breaker.OpenUntil()
+		first := !c.outage
+		c.outage = true
+		c.recordRefresh(refreshRecord{At: time.Now(), Skipped: true})
+		c.dataMutex.Unlock()
+		if first && c.pages != nil {
+			c.pages.rerender()
+		}
+		return
+	}
+	if err := c.filters.reload(); err != nil {
+		log.Printf("failed to reload filters: %s", err)
+	}
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), refreshTimeout)
+	defer cancel()
+	// fetch some stories more than shown, to fill the gaps visitors' own
+	// filters leave on their front page
+	tempCach, stats, err := fetchTopStories(ctx, c.source, c.numStories+c.shed.overfetch(c.numStories), c.filters.keep, c.lookup)
+	fetchDuration := time.Since(start)
+	stats.duration = fetchDuration
+	debugf("refresh took %s: %d items fetched, %d failed, %d filtered, %d retries, the list in %s, the slowest item in %s",
+		fetchDuration.Round(time.Millisecond), stats.requests, stats.failed, stats.filtered, stats.retries,
+		stats.latency.Round(time.Millisecond), stats.slowest.Round(time.Millisecond))
+	lifeDuration, failed := c.shed.record(fetchDuration, stats, err, c.lifeDuration)
+	c.dataMutex.Lock()
+	c.lastFetch, c.degraded = stats, c.shed != nil && c.shed.degraded > 0
 	if err != nil {
+		c.lastErr, c.lastErrAt = err, time.Now()
+	}
+	// keep serving the stories there are, and don't retry on every request
+	stale := failed && len(c.cashedItems) > 0
+	if err != nil || stale {
+		c.expiration = time.Now().Add(lifeDuration)
+		c.failures++
+	} else {
+		c.failures = 0
+	}
+	c.recordRefresh(newRefreshRecord(start, stats, len(tempCach), err, stale))
+	c.dataMutex.Unlock()
+	if err != nil || stale {
 		return
 	}
-	c.expiration = time.Now().Add(c.lifeDuration)
-	c.cashedItems = tempCach
+	if c.tags != nil {
+		c.tags.annotate(tempCach)
+	}
+	if c.archive != nil {
+		record(c.archive, tempCach, time.Now())
+		c.reposts.annotate(tempCach)
+		c.trends.annotate(tempCach)
+		if c.texts != nil {
+			c.texts.index(tempCach)
+		}
+		if c.synopses != nil {
+			c.synopses.annotate(tempCach)
+		}
+	}
+	if c.previews != nil {
+		c.previews.annotate(tempCach)
+	}
+	if c.badges != nil {
+		c.badges.annotate(tempCach)
+	}
+	if c.repos != nil {
+		c.repos.annotate(tempCach)
+	}
+	if c.papers != nil {
+		c.papers.annotate(tempCach)
+	}
+	if c.translations != nil {
+		c.translations.annotate(tempCach)
+	}
+	if c.links != nil {
+		c.links.annotate(tempCach)
+	}
+	if c.watch != nil {
+		c.watch.check(tempCach)
+	}
+	if c.poster != nil {
+		c.poster.check(tempCach)
+	}
+	// rank once a refresh rather than on every request
+	sorted := c.order.sort(tempCach)
+	c.dataMutex.Lock()
+	annotateMoves(sorted, c.cashedItems)
+	c.expiration = time.Now().Add(lifeDuration)
+	c.cashedItems = sorted
+	c.refreshedAt = time.Now()
+	c.outage = false
+	c.fetchDuration = fetchDuration
+	if c.daily != nil && c.daily.due(c.refreshedAt) {
+		c.daily.take(sorted, c.refreshedAt)
+	}
+	c.dataMutex.Unlock()
+	if c.pages != nil {
+		c.pages.rerender()
+	}
+	if c.snapshot != nil {
+		if err := c.snapshot.save(sorted, c.refreshed()); err != nil {
+			log.Printf("failed to save the snapshot: %s", err)
+		}
+	}
 }
 
 func (c *cach) cachExpired() bool {
+	c.dataMutex.RLock()
+	defer c.dataMutex.RUnlock()
 	return time.Now().After(c.expiration)
 }
 
-func fetchTopStories(numStories int) ([]item, error) {
-	var client hn.Client
-	ids, err := client.TopItems()
+// hnClient makes the requests to the HN API, all of them share the
+// connections of its transport.
+var hnClient hn.Client
+
+// fetchTopStories returns the top stories of src that keep lets through, in
+// the order they have there, until it has numStories links among them. Text posts
+// found on the way are included, so views with and without them can both be
+// served from the result. Items are fetched concurrently in batches, a little
+// more than needed each time to make up for filtered ones.
+func fetchTopStories(ctx context.Context, src source, numStories int, keep func(item) bool, stale func(id int) (item, bool)) ([]item, fetchStats, error) {
+	start := time.Now()
+	ids, err := src.TopIDs(ctx)
+	latency := time.Since(start)
 	if err != nil {
-		return nil, err
+		return nil, fetchStats{latency: latency}, err
 	}
+	stories, stats := fetchItems(ctx, src, ids, numStories, keep, isStoryLink, stale)
+	stats.latency = latency
+	return stories, stats, nil
+}
+
+// fetchItems fetches the items of src with the given ids that keep lets through, in
+// order, until numStories of them are counted. Items keep their rank on HN:
+// an item that fails to load even when asked again is replaced by its stale
+// copy, if there is one, or leaves its slot empty, only items that are no
+// story to show are made up for with the ones after.
+func fetchItems(ctx context.Context, src source, ids []int, numStories int, keep, counted func(item) bool, stale func(id int) (item, bool)) ([]item, fetchStats) {
 	var stories []item
+	var stats fetchStats
+	var links int
 	type result struct {
 		idx   int
 		item  item
+		keep  bool
 		error error
+		// took is how long the item took to fetch, retries included
+		took    time.Duration
+		retries int
 	}
-	resChan := make(chan result)
-	wanted := numStories * 5 / 4
-	for i := 0; i < wanted; i++ {
-		go func(id int, idx int) {
-			hnItem, err := client.GetItem(id)
-			if err != nil {
-				resChan <- result{error: err}
+	for next := 0; links < numStories && next < len(ids); {
+		wanted := (numStories - links) * 5 / 4
+		if wanted < 1 {
+			wanted = 1
+		}
+		end := next + wanted
+		if end > len(ids) {
+			end = len(ids)
+		}
+		resChan := make(chan result)
+		for i := next; i < end; i++ {
+			go func(id int, idx int) {
+				start := time.Now()
+				hnItem, retries, err := fetchItemRetries(ctx, src, id)
+				took := time.Since(start)
+				if err != nil {
+					resChan <- result{idx: idx, error: err, took: took, retries: retries}
+					return
+				}
+				// filter here, some filters have to look things up too
+				item := parseHNItem(hnItem)
+				if f, ok := src.(foreign); ok {
+					item.Source, item.Comments = f.name(), f.commentsURL(hnItem.ID)
+				}
+				resChan <- result{idx: idx, item: item, keep: keep(item), took: took, retries: retries}
+			}(ids[i], i-next)
+		}
+		results := make([]result, end-next)
+		for range results {
+			res := <-resChan
+			results[res.idx] = res
+			stats.requests++
+			stats.retries += res.retries
+			stats.slowest = max(stats.slowest, res.took)
+			if res.error != nil {
+				stats.failed++
+			}
+		}
+		for i, res := range results {
+			if links == numStories {
+				break
+			}
+			if res.error != nil {
+				s, ok := item{}, false
+				if stale != nil {
+					s, ok = stale(ids[next+i])
+				}
+				if !ok {
+					// the slot stays taken, so the front page ends at
+					// the rank HN's does
+					links++
+					continue
+				}
+				res.item, res.keep = s, keep(s)
+			}
+			if !res.keep {
+				stats.filtered++
+				continue
 			}
-			resChan <- result{idx: idx, item: parseHNItem(hnItem)}
-		}(ids[i], i)
+			res.item.HNRank = next + i + 1
+			if counted(res.item) {
+				links++
+			}
+			stories = append(stories, res.item)
+		}
+		next = end
 	}
-	results := make([]result, 0, numStories)
-	for len(results) < numStories {
-		res := <-resChan
-		if res.error != nil {
-			continue
+	return stories, stats
+}
+
+// fetchItem fetches an item of src, asking again up to itemRetries times when
+// it fails.
+func fetchItem(ctx context.Context, src source, id int) (hn.Item, error) {
+	hnItem, _, err := fetchItemRetries(ctx, src, id)
+	return hnItem, err
+}
+
+// fetchItemRetries is fetchItem, returning the number of times it asked
+// again too.
+func fetchItemRetries(ctx context.Context, src source, id int) (hn.Item, int, error) {
+	var err error
+	for attempt := 0; attempt <= itemRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * itemRetryDelay):
+			case <-ctx.Done():
+				return hn.Item{}, attempt - 1, ctx.Err()
+			}
 		}
-		if isStoryLink(res.item) {
-			results = append(results, res)
+		var hnItem hn.Item
+		if hnItem, err = src.GetItem(ctx, id); err == nil {
+			return hnItem, attempt, nil
 		}
 	}
+	return hn.Item{}, itemRetries, err
+}
 
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].idx < results[j].idx
-	})
-	for _, v := range results {
-		stories = append(stories, v.item)
+// refreshInterval returns the auto-refresh interval in seconds requested by
+// ?refresh=N, falling back to the configured default. 0 means no refresh.
+func refreshInterval(r *http.Request, def int) int {
+	refresh := def
+	if v := r.URL.Query().Get("refresh"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return def
+		}
+		refresh = n
 	}
-	return stories, nil
+	if refresh <= 0 {
+		return 0
+	}
+	if refresh < minRefresh {
+		return minRefresh
+	}
+	return refresh
+}
+
+// locale returns the catalog for ?lang= if it names a bundled locale, or the
+// best match for the Accept-Language header otherwise.
+func locale(r *http.Request, def string) *i18n.Locale {
+	if l := i18n.Lookup(r.URL.Query().Get("lang")); l != nil {
+		return l
+	}
+	return i18n.Negotiate(r.Header.Get("Accept-Language"), def)
+}
+
+func isStory(item item) bool {
+	return item.Type == "story"
+}
+
+func isJob(item item) bool {
+	return item.Type == "job"
 }
 
 func isStoryLink(item item) bool {
-	return item.Type == "story" && item.URL != ""
+	return isStory(item) && item.URL != ""
 }
 
 func parseHNItem(hnItem hn.Item) item {
-	ret := item{Item: hnItem}
-	url, err := url.Parse(ret.URL)
-	if err == nil {
-		ret.Host = strings.TrimPrefix(url.Hostname(), "www.")
+	hnItem.URL = stripTracking(hnItem.URL)
+	// the host stays the one of the site, for the filters and to show
+	host, lookalike := displayHost(hostOf(hnItem.URL))
+	site := hostLabels.label(host, hnItem.URL)
+	hnItem.URL = linkRewrites.rewrite(hnItem.URL)
+	return item{Item: hnItem, Host: host, Site: site, Lookalike: lookalike}
+}
+
+func hostOf(rawURL string) string {
+	url, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
 	}
-	return ret
+	return strings.TrimPrefix(url.Hostname(), "www.")
 }
 
-// item is the same as the hn.Item, but adds the Host field
+// item is the same as the hn.Item, but adds the Host field, the position on
+// HN and on the quiet front page, the link preview used by the cards view and the tags
+// from -tag_rules, where it was on the front page before, how fast it is
+// gaining points and comments and how it moved since the last refresh
 type item struct {
 	hn.Item
-	Host string
+	HNRank      int
+	Rank        int
+	Host        string
+	Image       string
+	Description string
+	// Site labels the site of the story, which is Host but for the tenant of
+	// a site of many like user.github.io or medium.com/@user
+	Site string
+	// Lookalike is set when the host could pass for another, then Host is
+	// in punycode
+	Lookalike bool
+	// Badge is pdf, video or audio when the link opens such a file
+	Badge string
+	// Repo is the GitHub repository the story links to, with -github_repos
+	Repo *repo
+	// Abstract is the abstract of the arXiv paper the story links to, with
+	// -arxiv
+	Abstract string
+	// Synopsis is the summary of the article written by the summarizer of
+	// -summarize_url or -summarize_command
+	Synopsis string
+	// Translation is the title in the language of -translate_to, nil if it
+	// is in that language already
+	Translation *translation
+	// Dead is set with -check_links when the link is gone, it links to the
+	// copy of the Wayback Machine instead
+	Dead   bool
+	Tags   []string
+	Repost *repost
+	Trend  *trend
+	// Move is how the story moved since the refresh before, nil if it
+	// stayed where it was
+	Move *move
+	// Source is the name of the source of a story from elsewhere than HN,
+	// Comments the page of its discussion there
+	Source   string
+	Comments string
+	// Saved and Read are set for the visitor logged in, on the copies made
+	// for them
+	Saved bool
+	Read  bool
+}
+
+// Link returns the URL a story links to, which is its local detail page for
+// text posts of HN and their discussion for the ones of other sources, and
+// the copy of the Wayback Machine for a link that is gone.
+func (i item) Link() string {
+	if i.URL == "" {
+		if i.Comments != "" {
+			return i.Comments
+		}
+		return fmt.Sprintf("%s?id=%d", itemPath, i.ID)
+	}
+	if i.Dead {
+		return i.ArchiveURL()
+	}
+	return i.URL
+}
+
+// CommentsURL returns the page of the discussion of the story.
+func (i item) CommentsURL() string {
+	if i.Comments != "" {
+		return i.Comments
+	}
+	return discussionURL(i.ID)
+}
+
+// Posted returns the time the story was submitted.
+func (i item) Posted() time.Time {
+	return time.Unix(int64(i.Time), 0)
 }
 
 type templateData struct {
 	Stories []item
-	Time    time.Duration
+	// Groups are the Stories grouped by site with -group_hosts, nil without
+	Groups  []storyGroup
+	Refresh int
+	// Tag is set on the page of a tag
+	Tag string
+	// Daily is set in the -daily_at mode
+	Daily *dailySnapshot
+	// Jobs is true on the jobs page, ShowJobs if there is one, ShowGallery
+	// if there is a Show HN gallery
+	Jobs        bool
+	ShowJobs    bool
+	ShowGallery bool
+	// Archive is true if there are past front pages
+	Archive bool
+	// Outage is set while the HN API is down and the stories are those of
+	// the last refresh before
+	Outage *outage
+	pageData
+	// Diagnostics is only set with -diagnostics
+	Diagnostics *cachStats
+}
+
+// storyData is what the story partial is executed with.
+type storyData struct {
+	item
+	Cards   bool
+	Labeled bool
+	Static  bool
+	L       *i18n.Locale
+
+	// the fields of the story the partial shows are copied up, text/template
+	// looks fields promoted from embedded structs up by reflection on every
+	// use, with allocations
+	ID          int
+	Rank        int
+	Title       string
+	URL         string
+	Host        string
+	Site        string
+	Lookalike   bool
+	Type        string
+	Score       int
+	Descendants int
+	Image       string
+	Description string
+	Badge       string
+	Repo        *repo
+	Abstract    string
+	Synopsis    string
+	Translation *translation
+	Dead        bool
+	Tags        []string
+	Repost      *repost
+	Trend       *trend
+	Move        *move
+	Saved       bool
+	Read        bool
+	Source      string
+	// Account is set when a visitor is logged in and the story is one of
+	// HN, so it can be saved
+	Account bool
+	// NewTab and OutLinks are the settings of the page
+	NewTab   bool
+	OutLinks bool
 }
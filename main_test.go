@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hnTransport sends the requests meant for the HN API to a test server.
+type hnTransport struct {
+	server *url.URL
+	next   http.RoundTripper
+}
+
+func (t hnTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host = t.server.Scheme, t.server.Host
+	r.URL.Path = strings.TrimPrefix(r.URL.Path, "/v0")
+	return t.next.RoundTrip(r)
+}
+
+// setupHN serves the items, keyed by id, as the HN API does, with their ids
+// in order as the top stories. An id mapped to "" fails to decode.
+func setupHN(t *testing.T, items map[int]string) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/topstories.json" || r.URL.Path == "/showstories.json" {
+			json.NewEncoder(w).Encode(slices.Sorted(maps.Keys(items)))
+			return
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/item/"), ".json"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, items[id])
+	}))
+	u, _ := url.Parse(server.URL)
+	old := hnClient
+	hnClient.HTTPClient = &http.Client{Transport: hnTransport{server: u, next: http.DefaultTransport}}
+	t.Cleanup(func() {
+		hnClient = old
+		server.Close()
+	})
+}
+
+func storyJSON(id int) string {
+	return fmt.Sprintf(`{"id":%d,"type":"story","title":"Story %[1]d","url":"https://example.com/%[1]d"}`, id)
+}
+
+func TestFetchItems(t *testing.T) {
+	items := map[int]string{
+		1: storyJSON(1), 2: storyJSON(2), 3: storyJSON(3), 4: storyJSON(4), 5: storyJSON(5),
+		6: storyJSON(6), 7: storyJSON(7), 8: storyJSON(8), 9: storyJSON(9), 10: storyJSON(10),
+		// an Ask HN, which doesn't count toward the stories
+		11: `{"id":11,"type":"story","title":"Ask HN: 11","text":"?"}`,
+		12: `{"id":12,"type":"job","title":"Job 12","url":"https://example.com/12"}`,
+		13: `oops`,
+	}
+	setupHN(t, items)
+	keepAll := func(item) bool { return true }
+	tests := []struct {
+		name       string
+		ids        []int
+		numStories int
+		keep       func(item) bool
+		stale      func(id int) (item, bool)
+		want       []int
+		wantRanks  []int
+	}{
+		{"cutoff", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 4, keepAll, nil, []int{1, 2, 3, 4}, []int{1, 2, 3, 4}},
+		{"fewer ids", []int{1, 2}, 4, keepAll, nil, []int{1, 2}, []int{1, 2}},
+		{"filtered topped up", []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}, 3,
+			func(i item) bool { return i.ID != 2 && i.ID != 3 && i.ID != 4 && i.ID != 5 }, nil,
+			[]int{1, 6, 7}, []int{1, 6, 7}},
+		{"failed keeps its slot", []int{1, 13, 2, 3}, 3, keepAll, nil, []int{1, 2}, []int{1, 3}},
+		{"failed replaced by its stale copy", []int{1, 13, 2, 3}, 3, keepAll,
+			func(id int) (item, bool) { return testStory(id, "Stale", "https://example.com/stale", 1), id == 13 },
+			[]int{1, 13, 2}, []int{1, 2, 3}},
+		{"not counted", []int{11, 1, 12, 2, 3}, 2, keepAll, nil, []int{11, 1, 12, 2}, []int{1, 2, 3, 4}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := fetchItems(context.Background(), hnSource{}, tt.ids, tt.numStories, tt.keep, isStoryLink, tt.stale)
+			var ids, ranks []int
+			for _, s := range got {
+				ids, ranks = append(ids, s.ID), append(ranks, s.HNRank)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+				t.Errorf("ids: want %v, got %v", tt.want, ids)
+			}
+			if fmt.Sprint(ranks) != fmt.Sprint(tt.wantRanks) {
+				t.Errorf("ranks: want %v, got %v", tt.wantRanks, ranks)
+			}
+		})
+	}
+}
+
+func TestFetchItem_Retry(t *testing.T) {
+	var mutex sync.Mutex
+	requests := make(map[int]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/item/"), ".json"))
+		mutex.Lock()
+		requests[id]++
+		n := requests[id]
+		mutex.Unlock()
+		// item 1 fails once, item 2 always
+		if id == 2 || n == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, storyJSON(id))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	old := hnClient
+	hnClient.HTTPClient = &http.Client{Transport: hnTransport{server: u, next: http.DefaultTransport}}
+	defer func() { hnClient = old }()
+
+	if it, err := fetchItem(context.Background(), hnSource{}, 1); err != nil || it.ID != 1 {
+		t.Errorf("item failing once: want it, got %v %v", it.ID, err)
+	}
+	if _, err := fetchItem(context.Background(), hnSource{}, 2); err == nil {
+		t.Error("item always failing: want an error, got none")
+	}
+	if requests[2] != itemRetries+1 {
+		t.Errorf("requests of the failing item: want %d, got %d", itemRetries+1, requests[2])
+	}
+
+	// 3 and 4 fail once, 2 every time, and 4 is filtered
+	_, stats := fetchItems(context.Background(), hnSource{}, []int{2, 3, 4}, 3, func(i item) bool { return i.ID != 4 }, isStoryLink, nil)
+	if stats.requests != 3 || stats.failed != 1 || stats.filtered != 1 || stats.retries != itemRetries+2 {
+		t.Errorf("stats: want 3 items, 1 failed, 1 filtered and %d retries, got %+v", itemRetries+2, stats)
+	}
+	if stats.slowest < time.Duration(itemRetries)*itemRetryDelay {
+		t.Errorf("stats: want the slowest item to take the delays of its retries, got %s", stats.slowest)
+	}
+}
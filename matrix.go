@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/neghoda/quiet_hn/i18n"
+)
+
+// matrixRoom sends messages to a Matrix room as the user of an access
+// token, who must have joined it.
+type matrixRoom struct {
+	homeserver string
+	token      string
+	room       string
+	brand      branding
+	locale     *i18n.Locale
+}
+
+func (cfg config) matrixRoom(room string) matrixRoom {
+	return matrixRoom{
+		homeserver: cfg.MatrixHomeserver,
+		token:      cfg.MatrixToken,
+		room:       room,
+		brand:      cfg.brand(nil),
+		locale:     i18n.Lookup(cfg.Lang),
+	}
+}
+
+// matrixMessage is an m.notice, the message type of bots, with an HTML
+// version for the clients that render it.
+type matrixMessage struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format"`
+	FormattedBody string `json:"formatted_body"`
+}
+
+// send sends a message. Messages with the same transaction id are only
+// sent once, so a retry doesn't repeat one.
+func (m matrixRoom) send(txn, text, formatted string) error {
+	b, err := json.Marshal(matrixMessage{MsgType: "m.notice", Body: text, Format: "org.matrix.custom.html", FormattedBody: formatted})
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+m.token)
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimSuffix(m.homeserver, "/"), url.PathEscape(m.room), url.PathEscape(txn))
+	return send(http.MethodPut, endpoint, "application/json", header, b, nil)
+}
+
+// ping checks that the user of the token has joined the room.
+func (m matrixRoom) ping() error {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+m.token)
+	return get(fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/joined_members",
+		strings.TrimSuffix(m.homeserver, "/"), url.PathEscape(m.room)), header)
+}
+
+func (m matrixRoom) target() string { return "matrix room " + m.room }
+
+// matrixLine describes a story as text and as HTML.
+func matrixLine(l *i18n.Locale, s item) (string, string) {
+	d := newDigestLine(l, s)
+	text, formatted := d.Title, fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(d.Link), html.EscapeString(d.Title))
+	if d.Host != "" {
+		text += " (" + d.Host + ")"
+		formatted += " (" + html.EscapeString(d.Host) + ")"
+	}
+	text += " " + d.Link + " · " + d.Points + " · " + d.Comments + ": " + d.Discussion
+	formatted += fmt.Sprintf(` · %s · <a href="%s">%s</a>`, html.EscapeString(d.Points), html.EscapeString(d.Discussion), html.EscapeString(d.Comments))
+	return text, formatted
+}
+
+func (m matrixRoom) notify(rule string, s item) error {
+	text, formatted := matrixLine(m.locale, s)
+	return m.send(fmt.Sprintf("watch-%s-%d", rule, s.ID),
+		rule+": "+text, "<b>"+html.EscapeString(rule)+"</b>: "+formatted)
+}
+
+func (m matrixRoom) sendDigest(stories []item, at time.Time) error {
+	title := m.locale.T("digest_subject", m.brand.Title, at.Format(dateLayout))
+	text, formatted := []string{title}, []string{"<b>" + html.EscapeString(title) + "</b><ol>"}
+	for i, s := range stories {
+		t, f := matrixLine(m.locale, s)
+		text = append(text, fmt.Sprintf("%d. %s", i+1, t))
+		formatted = append(formatted, "<li>"+f+"</li>")
+	}
+	formatted = append(formatted, "</ol>")
+	return m.send(fmt.Sprintf("digest-%d", at.Unix()), strings.Join(text, "\n"), strings.Join(formatted, ""))
+}
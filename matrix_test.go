@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neghoda/quiet_hn/hn"
+	"github.com/neghoda/quiet_hn/i18n"
+)
+
+func TestMatrixRoom_Notify(t *testing.T) {
+	var got matrixMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("method: want %s, got %s", http.MethodPut, r.Method)
+		}
+		want := "/_matrix/client/v3/rooms/%21room:example.org/send/m.room.message/watch-go-1"
+		if r.URL.EscapedPath() != want {
+			t.Errorf("path: want %s, got %s", want, r.URL.EscapedPath())
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer token" {
+			t.Errorf("Authorization: want %q, got %q", "Bearer token", auth)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"event_id":"$1"}`))
+	}))
+	defer server.Close()
+
+	m := matrixRoom{homeserver: server.URL + "/", token: "token", room: "!room:example.org", locale: i18n.Lookup("en")}
+	s := parseHNItem(hn.Item{ID: 1, Title: "Go <generics>", URL: "https://go.dev/blog", Score: 10, Descendants: 2})
+	if err := m.notify("go", s); err != nil {
+		t.Fatalf("notify: %s", err)
+	}
+	if got.MsgType != "m.notice" || !strings.HasPrefix(got.Body, "go: Go <generics> (go.dev) https://go.dev/blog") {
+		t.Errorf("body: got %+v", got)
+	}
+	if !strings.Contains(got.FormattedBody, `<a href="https://go.dev/blog">Go &lt;generics&gt;</a>`) {
+		t.Errorf("formatted body: want the title escaped, got %q", got.FormattedBody)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const allPath = "/all"
+
+// mergeStrategies are the values of -merge: round-robin takes the top story
+// of each source in turn, score ranks stories by their score over the mean
+// score of their source, so a quieter source isn't drowned out.
+var mergeStrategies = []string{"round-robin", "score"}
+
+// mergedHandler serves the front page of all sources at once, each story
+// labeled with its source. Stories linking to the same page are shown once,
+// where the first of them would be.
+func mergedHandler(caches []*cach, cfg config, tpls *templates) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		v := cfg.view(r)
+		lists := make([][]item, len(caches))
+		errs := make([]error, len(caches))
+		var wg sync.WaitGroup
+		for i, c := range caches {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				lists[i], errs[i] = c.getTopStories(r.Context(), v)
+			}()
+		}
+		wg.Wait()
+		// a source that is down leaves the others to show
+		var ok [][]item
+		for i, err := range errs {
+			if err == nil {
+				ok = append(ok, lists[i])
+			}
+		}
+		if len(ok) == 0 {
+			storiesError(w, errs[0])
+			return
+		}
+		n := cfg.NumStories
+		if v.numStories > 0 {
+			n = min(n, v.numStories)
+		}
+		data := templateData{
+			Stories:  mergeStories(ok, cfg.Merge, n),
+			ShowJobs: cfg.ShowJobs,
+			Archive:  caches[0].archive != nil,
+			Refresh:  refreshInterval(r, cfg.Refresh),
+			pageData: cfg.pageData(r, start),
+		}
+		data.Labeled = true
+		data.ShowGallery = cfg.ShowGallery
+		data.Outage = caches[0].outageSince()
+		cfg.markStories(r, data.Stories)
+		if v.GroupHosts {
+			data.Groups = groupStories(data.Stories)
+		}
+		cfg.sharedCaching(w, r, frontPageKeys("")...)
+		if err := tpls.execute(w, "index.gohtml", data); err != nil {
+			uncached(w)
+			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// mergeStories merges the front pages of the sources into one of n stories
+// at most, by strategy, and ranks them from 1.
+func mergeStories(lists [][]item, strategy string, n int) []item {
+	merged := roundRobin(lists)
+	if strategy == "score" {
+		weighted := make([][]float64, len(lists))
+		for i, list := range lists {
+			var total int
+			for _, s := range list {
+				total += s.Score
+			}
+			mean := max(float64(total)/float64(max(len(list), 1)), 1)
+			for _, s := range list {
+				weighted[i] = append(weighted[i], float64(s.Score)/mean)
+			}
+		}
+		weights := roundRobin(weighted)
+		idx := make([]int, len(merged))
+		for i := range idx {
+			idx[i] = i
+		}
+		sort.SliceStable(idx, func(a, b int) bool { return weights[idx[a]] > weights[idx[b]] })
+		sorted := make([]item, len(merged))
+		for i, k := range idx {
+			sorted[i] = merged[k]
+		}
+		merged = sorted
+	}
+	seen := make(map[string]bool)
+	ret := make([]item, 0, n)
+	for _, s := range merged {
+		if len(ret) == n {
+			break
+		}
+		if key := sameLink(s.URL); key != "" {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		s.Rank = len(ret) + 1
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+// roundRobin returns the elements of the lists one of each in turn.
+func roundRobin[T any](lists [][]T) []T {
+	var ret []T
+	for i := 0; ; i++ {
+		added := false
+		for _, list := range lists {
+			if i < len(list) {
+				ret = append(ret, list[i])
+				added = true
+			}
+		}
+		if !added {
+			return ret
+		}
+	}
+}
+
+// sameLink returns what two links to the same page have in common: the
+// host without "www." and the path without a trailing slash, with the
+// query. It is empty for text posts.
+func sameLink(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	key := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") + strings.TrimSuffix(u.EscapedPath(), "/")
+	if u.RawQuery != "" {
+		key += "?" + u.RawQuery
+	}
+	return key
+}
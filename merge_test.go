@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeStories(t *testing.T) {
+	top := []item{testStory(1, "HN 1", "https://example.com/a", 500), testStory(2, "HN 2", "https://example.com/b", 300), testStory(3, "HN 3", "https://example.com/c", 100)}
+	lob := []item{testStory(10, "Lobsters 1", "https://www.example.com/b/", 20), testStory(11, "Lobsters 2", "https://example.org/d", 10)}
+	tests := []struct {
+		strategy string
+		n        int
+		want     []int
+	}{
+		// story 2 links to the page of story 10, which comes first
+		{"round-robin", 10, []int{1, 10, 11, 3}},
+		{"round-robin", 2, []int{1, 10}},
+		// the means are 300 and 15
+		{"score", 10, []int{1, 10, 11, 3}},
+	}
+	for _, tt := range tests {
+		var got []int
+		for i, s := range mergeStories([][]item{top, lob}, tt.strategy, tt.n) {
+			got = append(got, s.ID)
+			if s.Rank != i+1 {
+				t.Errorf("%s: want story %d ranked %d, got %d", tt.strategy, s.ID, i+1, s.Rank)
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s of %d: want %v, got %v", tt.strategy, tt.n, tt.want, got)
+		}
+	}
+
+	// a quiet source isn't drowned out by the scores of a busy one
+	lob[1].Score = 40
+	var got []int
+	for _, s := range mergeStories([][]item{top, lob}, "score", 3) {
+		got = append(got, s.ID)
+	}
+	if want := []int{1, 11, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("score: want %v, got %v", want, got)
+	}
+}
+
+func TestSameLink(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"https://www.Example.com/a/", "http://example.com/a", true},
+		{"https://example.com/a#top", "https://example.com/a", true},
+		{"https://example.com/a?p=1", "https://example.com/a?p=2", false},
+		{"https://example.com/a", "https://example.org/a", false},
+	}
+	for _, tt := range tests {
+		if got := sameLink(tt.a) == sameLink(tt.b); got != tt.same {
+			t.Errorf("%s and %s: want same %v, got %v", tt.a, tt.b, tt.same, got)
+		}
+	}
+	if sameLink("") != "" {
+		t.Error("text post: want no link")
+	}
+}
+
+func TestMergedHandler(t *testing.T) {
+	setupHN(t, map[int]string{1: storyJSON(1)})
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{CookieSecret: "secret", Lang: "en", NumStories: 5, Merge: "round-robin"}
+	f, err := newFilters(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := newCach(cfg.NumStories, f, cachOptions{})
+	other := newCach(cfg.NumStories, f, cachOptions{})
+	other.source = fakeSource{{ID: 7, Type: "story", Title: "Elsewhere", URL: "https://example.org/7"}}
+	down := newCach(cfg.NumStories, f, cachOptions{})
+	down.source = brokenSource{}
+
+	rec := httptest.NewRecorder()
+	mergedHandler([]*cach{def, other, down}, cfg, tpls)(rec, httptest.NewRequest("GET", allPath, nil))
+	body := rec.Body.String()
+	if !strings.Contains(body, "Story 1") || !strings.Contains(body, "Elsewhere") {
+		t.Errorf("all: want the stories of both sources that are up, got %d", rec.Code)
+	}
+	if !strings.Contains(body, `<span class="tag source">hn</span>`) {
+		t.Error("all: want the HN stories labeled")
+	}
+}
+
+// brokenSource is a source that is down.
+type brokenSource struct{ fakeSource }
+
+func (brokenSource) TopIDs(context.Context) ([]int, error) {
+	return nil, errors.New("down")
+}
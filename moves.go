@@ -0,0 +1,33 @@
+package main
+
+// move is how a story moved on the front page since the refresh before: Up
+// or Down so many places, or New to it.
+type move struct {
+	New  bool
+	Up   int
+	Down int
+}
+
+// annotateMoves sets the move of the stories of a refresh, in the order of
+// -rank, that aren't where they were in the stories of the refresh before.
+// The first refresh has nothing to compare with and moves none.
+func annotateMoves(stories, before []item) {
+	if len(before) == 0 {
+		return
+	}
+	was := make(map[int]int, len(before))
+	for i, s := range before {
+		was[s.ID] = i
+	}
+	for i, s := range stories {
+		j, ok := was[s.ID]
+		switch {
+		case !ok:
+			stories[i].Move = &move{New: true}
+		case j > i:
+			stories[i].Move = &move{Up: j - i}
+		case j < i:
+			stories[i].Move = &move{Down: i - j}
+		}
+	}
+}
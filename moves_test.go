@@ -0,0 +1,32 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnnotateMoves(t *testing.T) {
+	stories := func(ids ...int) []item {
+		var ret []item
+		for _, id := range ids {
+			ret = append(ret, testStory(id, "", "", 0))
+		}
+		return ret
+	}
+	first := stories(1, 2, 3)
+	annotateMoves(first, nil)
+	for _, s := range first {
+		if s.Move != nil {
+			t.Errorf("first refresh: want %d not moved, got %+v", s.ID, s.Move)
+		}
+	}
+
+	next := stories(3, 1, 4, 2)
+	annotateMoves(next, first)
+	want := []*move{{Up: 2}, {Down: 1}, {New: true}, {Down: 2}}
+	for i, s := range next {
+		if !reflect.DeepEqual(s.Move, want[i]) {
+			t.Errorf("%d: want %+v, got %+v", s.ID, want[i], s.Move)
+		}
+	}
+}
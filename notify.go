@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"time"
+)
+
+// notifyTimeout bounds each notification request.
+const notifyTimeout = 10 * time.Second
+
+var notifyClient = &http.Client{Timeout: notifyTimeout}
+
+// notifier delivers the stories that match a watch rule.
+type notifier interface {
+	notify(rule string, s item) error
+}
+
+// pinger is a notifier, digest target or account that can check that it is
+// set up right without sending anything, for check-config -ping.
+type pinger interface {
+	ping() error
+	// target describes what is pinged, without its secrets
+	target() string
+}
+
+// get fetches url and fails unless the response is a success.
+func get(url string, header http.Header) error {
+	return send(http.MethodGet, url, "", header, nil, nil)
+}
+
+// webhookNotifier POSTs a JSON description of each story to a URL.
+type webhookNotifier struct {
+	url string
+}
+
+// webhookPayload is the body of a webhook request.
+type webhookPayload struct {
+	Rule       string    `json:"rule"`
+	ID         int       `json:"id"`
+	Title      string    `json:"title"`
+	URL        string    `json:"url"`
+	Host       string    `json:"host,omitempty"`
+	By         string    `json:"by"`
+	Score      int       `json:"score"`
+	Comments   int       `json:"comments"`
+	Posted     time.Time `json:"posted"`
+	Discussion string    `json:"discussion_url"`
+}
+
+func (n webhookNotifier) notify(rule string, s item) error {
+	link := s.URL
+	if link == "" {
+		link = s.CommentsURL()
+	}
+	return postJSON(n.url, webhookPayload{
+		Rule:       rule,
+		ID:         s.ID,
+		Title:      s.Title,
+		URL:        link,
+		Host:       s.Host,
+		By:         s.By,
+		Score:      s.Score,
+		Comments:   s.Descendants,
+		Posted:     s.Posted().UTC(),
+		Discussion: s.CommentsURL(),
+	})
+}
+
+// postJSON posts v as JSON to url and fails unless the response is a
+// success.
+func postJSON(url string, v interface{}) error {
+	return postJSONWith(url, nil, v)
+}
+
+// postJSONWith is postJSON with extra request headers.
+func postJSONWith(url string, header http.Header, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return post(url, "application/json", header, b, nil)
+}
+
+// postForm posts the values as a form to url and fails unless the response
+// is a success.
+func postForm(url string, values neturl.Values) error {
+	return post(url, "application/x-www-form-urlencoded", nil, []byte(values.Encode()), nil)
+}
+
+// post posts the body to url and decodes the JSON response into out, unless
+// it is nil.
+func post(url, contentType string, header http.Header, body []byte, out interface{}) error {
+	return send(http.MethodPost, url, contentType, header, body, out)
+}
+
+// send is post with another method.
+func send(method, url, contentType string, header http.Header, body []byte, out interface{}) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neghoda/quiet_hn/accounts"
+)
+
+const (
+	oauthStateCookie = "oauth_state"
+	// oauthStateTTL is how long a visitor has to log in at the provider
+	oauthStateTTL = 10 * time.Minute
+)
+
+// githubAPI and githubLogin are where GitHub logins go, tests point them
+// elsewhere.
+var (
+	githubAPI   = "https://api.github.com"
+	githubLogin = "https://github.com"
+)
+
+// oauthProvider is a service visitors log in with instead of a password of
+// this instance, through the OAuth 2 authorization code flow with PKCE.
+type oauthProvider struct {
+	// name is the path of the provider under /login/ and what its
+	// identities are kept under, label what the login button says
+	name  string
+	label string
+
+	clientID     string
+	clientSecret string
+	authURL      string
+	tokenURL     string
+	scope        string
+	// identify looks up who the access token belongs to
+	identify func(token string) (identity, error)
+}
+
+// identity is a user of a provider. subject identifies them for good, name
+// is what their account is named after and names are what -oauth_allow may
+// list them by. email is the address the provider checked is theirs, the
+// only name an @domain of -oauth_allow matches.
+type identity struct {
+	subject string
+	name    string
+	names   []string
+	email   string
+}
+
+// loginProvider is a provider on the login page.
+type loginProvider struct {
+	Path  string
+	Label string
+}
+
+// oauthProviders returns the providers set up by the flags. The issuer of
+// -oidc_issuer is asked for its endpoints.
+func (cfg config) oauthProviders() ([]*oauthProvider, error) {
+	var ret []*oauthProvider
+	if cfg.GitHubClientID != "" {
+		ret = append(ret, &oauthProvider{
+			name:         "github",
+			label:        "GitHub",
+			clientID:     cfg.GitHubClientID,
+			clientSecret: cfg.GitHubClientSecret,
+			authURL:      githubLogin + "/login/oauth/authorize",
+			tokenURL:     githubLogin + "/login/oauth/access_token",
+			scope:        "read:user",
+			identify:     githubIdentity,
+		})
+	}
+	if cfg.OIDCIssuer != "" {
+		p, err := discoverOIDC(strings.TrimSuffix(cfg.OIDCIssuer, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("oidc_issuer: %w", err)
+		}
+		p.label, p.clientID, p.clientSecret = cfg.OIDCLabel, cfg.OIDCClientID, cfg.OIDCClientSecret
+		ret = append(ret, p)
+	}
+	return ret, nil
+}
+
+func githubIdentity(token string) (identity, error) {
+	var user struct {
+		ID    int64  `json:"id"`
+		Login string `json:"login"`
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+token)
+	header.Set("Accept", "application/vnd.github+json")
+	if err := send(http.MethodGet, githubAPI+"/user", "", header, nil, &user); err != nil {
+		return identity{}, fmt.Errorf("github user: %w", err)
+	}
+	if user.ID == 0 {
+		return identity{}, errors.New("github user: no id")
+	}
+	return identity{subject: strconv.FormatInt(user.ID, 10), name: user.Login, names: []string{user.Login}}, nil
+}
+
+// discoverOIDC sets up an OpenID Connect provider from the configuration the
+// issuer publishes. Who logged in comes from its userinfo endpoint, which
+// saves checking the signature of ID tokens.
+func discoverOIDC(issuer string) (*oauthProvider, error) {
+	var meta struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	}
+	if err := send(http.MethodGet, issuer+"/.well-known/openid-configuration", "", nil, nil, &meta); err != nil {
+		return nil, err
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.UserinfoEndpoint == "" {
+		return nil, errors.New("the issuer has no authorization, token or userinfo endpoint")
+	}
+	return &oauthProvider{
+		name:     "oidc",
+		authURL:  meta.AuthorizationEndpoint,
+		tokenURL: meta.TokenEndpoint,
+		scope:    "openid profile email",
+		identify: func(token string) (identity, error) {
+			var info struct {
+				Sub               string `json:"sub"`
+				PreferredUsername string `json:"preferred_username"`
+				Email             string `json:"email"`
+				EmailVerified     *bool  `json:"email_verified"`
+			}
+			header := http.Header{}
+			header.Set("Authorization", "Bearer "+token)
+			if err := send(http.MethodGet, meta.UserinfoEndpoint, "", header, nil, &info); err != nil {
+				return identity{}, fmt.Errorf("oidc userinfo: %w", err)
+			}
+			if info.Sub == "" {
+				return identity{}, errors.New("oidc userinfo: no sub")
+			}
+			id := identity{subject: info.Sub, name: info.PreferredUsername}
+			if info.PreferredUsername != "" {
+				id.names = append(id.names, info.PreferredUsername)
+			}
+			// an address the provider didn't say it checked says nothing
+			// about who logged in
+			if info.Email != "" && info.EmailVerified != nil && *info.EmailVerified {
+				id.names = append(id.names, info.Email)
+				id.email = info.Email
+				if id.name == "" {
+					id.name, _, _ = strings.Cut(info.Email, "@")
+				}
+			}
+			return id, nil
+		},
+	}, nil
+}
+
+// allowed reports whether a new identity gets an account: with -signup
+// anyone does, otherwise only the names and email domains of -oauth_allow.
+// A domain only matches the verified email, a username may look like an
+// address of any domain.
+func (cfg config) allowed(id identity) bool {
+	if cfg.Signup {
+		return true
+	}
+	for _, entry := range strings.Split(cfg.OAuthAllow, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.HasPrefix(entry, "@") {
+			if id.email != "" && strings.HasSuffix(strings.ToLower(id.email), strings.ToLower(entry)) {
+				return true
+			}
+			continue
+		}
+		for _, name := range id.names {
+			if strings.EqualFold(name, entry) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// redirectURL is where the provider sends the visitor back to.
+func (p *oauthProvider) redirectURL(cfg config, r *http.Request) string {
+	return cfg.brand(r).URL + loginPath + "/" + p.name + "/callback"
+}
+
+// oauthLoginHandler sends the visitor to the provider, with a state and
+// PKCE verifier kept in a signed cookie to check the way back against.
+func oauthLoginHandler(cfg config, p *oauthProvider) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state, verifier := randomToken(), randomToken()
+		value := state + "." + verifier
+		http.SetCookie(w, &http.Cookie{
+			Name:     oauthStateCookie,
+			Value:    value + "." + cfg.sign(value),
+			Path:     loginPath + "/" + p.name,
+			MaxAge:   int(oauthStateTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil || strings.HasPrefix(cfg.PublicURL, "https:"),
+			SameSite: http.SameSiteLaxMode,
+		})
+		challenge := sha256.Sum256([]byte(verifier))
+		q := url.Values{
+			"response_type":         {"code"},
+			"client_id":             {p.clientID},
+			"redirect_uri":          {p.redirectURL(cfg, r)},
+			"scope":                 {p.scope},
+			"state":                 {state},
+			"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+			"code_challenge_method": {"S256"},
+		}
+		http.Redirect(w, r, p.authURL+"?"+q.Encode(), http.StatusFound)
+	})
+}
+
+// oauthCallbackHandler logs in the visitor the provider sent back, making
+// their account on their first login if they are allowed one.
+func oauthCallbackHandler(cfg config, p *oauthProvider) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("error") != "" {
+			http.Redirect(w, r, loginPath, http.StatusSeeOther)
+			return
+		}
+		cookie, err := r.Cookie(oauthStateCookie)
+		if err != nil {
+			http.Error(w, "The login expired, try again", http.StatusBadRequest)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: oauthStateCookie, Path: cookie.Path, MaxAge: -1})
+		value, sig, _ := cutLast(cookie.Value, ".")
+		state, verifier, _ := strings.Cut(value, ".")
+		if !hmac.Equal([]byte(sig), []byte(cfg.sign(value))) || !hmac.Equal([]byte(state), []byte(q.Get("state"))) {
+			http.Error(w, "The login expired, try again", http.StatusBadRequest)
+			return
+		}
+		id, err := p.exchange(cfg, r, q.Get("code"), verifier)
+		if err != nil {
+			log.Printf("failed to log in with %s: %s", p.name, err)
+			http.Error(w, "Failed to log in with "+p.label, http.StatusBadGateway)
+			return
+		}
+		u, err := cfg.accounts.Identity(p.name, id.subject)
+		if errors.Is(err, accounts.ErrNoIdentity) {
+			if !cfg.allowed(id) {
+				http.Error(w, "This account is not allowed to log in here", http.StatusForbidden)
+				return
+			}
+			u, err = cfg.accounts.CreateLinked(p.name, id.subject, id.name)
+		}
+		if err == nil {
+			err = cfg.logIn(w, r, u)
+		}
+		if err != nil {
+			log.Printf("failed to log in with %s: %s", p.name, err)
+			http.Error(w, "Failed to log in", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	})
+}
+
+// exchange trades the code the provider sent back for an access token, and
+// the token for the identity of the visitor.
+func (p *oauthProvider) exchange(cfg config, r *http.Request, code, verifier string) (identity, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL(cfg, r)},
+		"client_id":     {p.clientID},
+		"client_secret": {p.clientSecret},
+		"code_verifier": {verifier},
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	header := http.Header{}
+	header.Set("Accept", "application/json")
+	if err := post(p.tokenURL, "application/x-www-form-urlencoded", header, []byte(form.Encode()), &token); err != nil {
+		return identity{}, fmt.Errorf("token: %w", err)
+	}
+	// GitHub answers errors with 200
+	if token.AccessToken == "" {
+		return identity{}, fmt.Errorf("token: %s", token.Error)
+	}
+	return p.identify(token.AccessToken)
+}
+
+// randomToken returns a random string for the URL.
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// cutLast is strings.Cut at the last sep.
+func cutLast(s, sep string) (before, after string, found bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/neghoda/quiet_hn/accounts"
+)
+
+func TestOAuth_GitHub(t *testing.T) {
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login/oauth/access_token":
+			if r.PostFormValue("code") != "good" || r.PostFormValue("code_verifier") == "" {
+				json.NewEncoder(w).Encode(map[string]string{"error": "bad_verification_code"})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "token"})
+		case "/user":
+			if r.Header.Get("Authorization") != "Bearer token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"id": 42, "login": "octocat"})
+		}
+	}))
+	defer github.Close()
+	oldAPI, oldLogin := githubAPI, githubLogin
+	githubAPI, githubLogin = github.URL, github.URL
+	defer func() { githubAPI, githubLogin = oldAPI, oldLogin }()
+
+	store, err := accounts.Open(filepath.Join(t.TempDir(), "accounts.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	cfg := config{CookieSecret: "secret", GitHubClientID: "id", GitHubClientSecret: "secret", OAuthAllow: "OctoCat", SessionTTL: accounts.DefaultSessionTTL, accounts: store}
+	providers, err := cfg.oauthProviders()
+	if err != nil || len(providers) != 1 {
+		t.Fatalf("providers: want github, got %v and %v", providers, err)
+	}
+	p := providers[0]
+
+	rec := httptest.NewRecorder()
+	oauthLoginHandler(cfg, p)(rec, httptest.NewRequest("GET", "http://example.com/login/github", nil))
+	to, _ := url.Parse(rec.Header().Get("Location"))
+	if to.Path != "/login/oauth/authorize" || to.Query().Get("redirect_uri") != "http://example.com/login/github/callback" || to.Query().Get("code_challenge") == "" {
+		t.Errorf("login: want a redirect to the authorization, got %s", to)
+	}
+	state := rec.Result().Cookies()[0]
+
+	callback := func(code, gotState string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "http://example.com/login/github/callback?"+url.Values{"code": {code}, "state": {gotState}}.Encode(), nil)
+		r.AddCookie(state)
+		rec := httptest.NewRecorder()
+		oauthCallbackHandler(cfg, p)(rec, r)
+		return rec
+	}
+	if rec := callback("good", "forged"); rec.Code != http.StatusBadRequest {
+		t.Errorf("wrong state: want %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if rec := callback("bad", to.Query().Get("state")); rec.Code != http.StatusBadGateway {
+		t.Errorf("bad code: want %d, got %d", http.StatusBadGateway, rec.Code)
+	}
+	rec = callback("good", to.Query().Get("state"))
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("callback: want %d, got %d: %s", http.StatusSeeOther, rec.Code, rec.Body.String())
+	}
+	var session *http.Cookie
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == sessionCookie {
+			session = c
+		}
+	}
+	if session == nil {
+		t.Fatal("callback: want a session cookie")
+	}
+	if u, err := store.Session(session.Value); err != nil || u.Name != "octocat" {
+		t.Errorf("session: want octocat, got %+v and %v", u, err)
+	}
+
+	// the second login finds the same account, even if no longer allowed
+	cfg.OAuthAllow = ""
+	if rec := callback("good", to.Query().Get("state")); rec.Code != http.StatusSeeOther {
+		t.Errorf("second login: want %d, got %d", http.StatusSeeOther, rec.Code)
+	}
+}
+
+func TestOAuth_DiscoverOIDC(t *testing.T) {
+	var issuer *httptest.Server
+	issuer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 issuer.URL,
+				"authorization_endpoint": issuer.URL + "/auth",
+				"token_endpoint":         issuer.URL + "/token",
+				"userinfo_endpoint":      issuer.URL + "/userinfo",
+			})
+		case "/userinfo":
+			w.Write([]byte(`{"sub":"abc","email":"jo@team.example","email_verified":true}`))
+		}
+	}))
+	defer issuer.Close()
+	p, err := discoverOIDC(issuer.URL)
+	if err != nil {
+		t.Fatalf("discoverOIDC() received an error: %s", err.Error())
+	}
+	if p.authURL != issuer.URL+"/auth" || p.tokenURL != issuer.URL+"/token" {
+		t.Errorf("endpoints: want the ones of the issuer, got %s and %s", p.authURL, p.tokenURL)
+	}
+	id, err := p.identify("token")
+	if err != nil {
+		t.Fatalf("identify() received an error: %s", err.Error())
+	}
+	if id.subject != "abc" || id.name != "jo" || strings.Join(id.names, ",") != "jo@team.example" || id.email != "jo@team.example" {
+		t.Errorf("identity: want abc named jo, got %+v", id)
+	}
+}
+
+func TestConfig_Allowed(t *testing.T) {
+	jo := identity{names: []string{"jo", "jo@team.example"}, email: "jo@team.example"}
+	// a username made up to look like an address of the domain
+	crafted := identity{names: []string{"x@team.example"}}
+	tests := []struct {
+		id     identity
+		allow  string
+		signup bool
+		want   bool
+	}{
+		{jo, "", true, true},
+		{jo, "", false, false},
+		{jo, "someone, JO", false, true},
+		{jo, "jo@team.example", false, true},
+		{jo, "@team.example", false, true},
+		{jo, "@example", false, false},
+		{jo, "@other.example", false, false},
+		{crafted, "@team.example", false, false},
+		{crafted, "x@team.example", false, true},
+	}
+	for _, tt := range tests {
+		cfg := config{OAuthAllow: tt.allow, Signup: tt.signup}
+		if got := cfg.allowed(tt.id); got != tt.want {
+			t.Errorf("allowed(%v, %q, signup %t): want %v, got %v", tt.id.names, tt.allow, tt.signup, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neghoda/quiet_hn/ranking"
+)
+
+// rankingVars are the variables a -rank formula can use.
+var rankingVars = []string{"rank", "score", "comments", "age", "reputation"}
+
+// order sorts the front page by the -rank formula instead of the HN order.
+type order struct {
+	formula    *ranking.Formula
+	reputation map[string]float64
+}
+
+// newOrder returns the order configured by -rank, or nil to keep the HN
+// order.
+func newOrder(cfg config) (*order, error) {
+	if cfg.Rank == "" {
+		return nil, nil
+	}
+	formula, err := ranking.Parse(cfg.Rank, rankingVars...)
+	if err != nil {
+		return nil, err
+	}
+	o := &order{formula: formula, reputation: make(map[string]float64)}
+	if cfg.DomainReputation == "" {
+		return o, nil
+	}
+	lines, err := readListFile(cfg.DomainReputation)
+	if err != nil {
+		return nil, err
+	}
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s: line %d: want a domain and a number", cfg.DomainReputation, i+1)
+		}
+		weight, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: line %d: %w", cfg.DomainReputation, i+1, err)
+		}
+		o.reputation[strings.TrimPrefix(strings.ToLower(fields[0]), "www.")] = weight
+	}
+	return o, nil
+}
+
+// sort returns the stories ordered by the formula, highest first. Stories
+// with the same value keep their HN order. A nil order returns stories as
+// they are.
+func (o *order) sort(stories []item) []item {
+	if o == nil {
+		return stories
+	}
+	now := time.Now()
+	values := make(map[int]float64, len(stories))
+	for _, s := range stories {
+		values[s.ID] = o.formula.Eval(ranking.Vars{
+			"rank":       float64(s.HNRank),
+			"score":      float64(s.Score),
+			"comments":   float64(s.Descendants),
+			"age":        now.Sub(s.Posted()).Hours(),
+			"reputation": o.domainReputation(s.Host),
+		})
+	}
+	sorted := append([]item(nil), stories...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return values[sorted[i].ID] > values[sorted[j].ID]
+	})
+	return sorted
+}
+
+// domainReputation returns the weight of the host or its closest parent
+// domain listed in the -domain_reputation file, 0 if there is none.
+func (o *order) domainReputation(host string) float64 {
+	host = strings.ToLower(host)
+	for host != "" {
+		if w, ok := o.reputation[host]; ok {
+			return w
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return 0
+}
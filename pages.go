@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxPages bounds the variants kept, the host and query string come from
+// the visitor.
+const maxPages = 64
+
+// pageKey is a variant of the front page: the view a visitor asks for and
+// what the layout takes from the request.
+type pageKey struct {
+	textPosts   bool
+	tag         string
+	excludeTags string
+	hideReposts bool
+	groupHosts  bool
+	lang        string
+	theme       string
+	zone        string
+	baseURL     string
+	cards       bool
+	refresh     int
+	numStories  int
+	sort        string
+}
+
+// pageCach keeps the front page rendered, for each variant asked for, so
+// most requests only copy bytes instead of executing the template. A page is
+// only served for the refresh it was rendered from. After each refresh the
+// variants asked for since the one before are rendered again in the
+// background, the others are dropped.
+type pageCach struct {
+	mutex sync.Mutex
+	pages map[pageKey]*renderedPage
+}
+
+// renderedPage is a variant of the front page, render renders it again.
+type renderedPage struct {
+	body []byte
+	// refreshedAt is the refresh of the cache the page shows
+	refreshedAt time.Time
+	render      func() ([]byte, time.Time, error)
+	// used is set when the page was asked for since the last refresh
+	used bool
+}
+
+func newPageCach() *pageCach {
+	return &pageCach{pages: make(map[pageKey]*renderedPage)}
+}
+
+// key returns the variant the request asks for, and false when the page is
+// personal to the visitor and has to be rendered for them.
+func (p *pageCach) key(cfg config, r *http.Request, v view, cards bool) (pageKey, bool) {
+	if p == nil || v.filters != nil || sessionOf(r) != nil {
+		return pageKey{}, false
+	}
+	s := cfg.settings(r)
+	// the feed links carry the settings
+	if s.Feeds {
+		return pageKey{}, false
+	}
+	return pageKey{
+		textPosts:   v.TextPosts,
+		tag:         v.Tag,
+		excludeTags: strings.Join(v.ExcludeTags, ","),
+		hideReposts: v.HideReposts,
+		groupHosts:  v.GroupHosts,
+		lang:        locale(r, cfg.Lang).Tag,
+		theme:       s.Theme,
+		zone:        cfg.zone(s).String(),
+		baseURL:     cfg.brand(r).URL,
+		cards:       cards,
+		refresh:     refreshInterval(r, cfg.Refresh),
+		numStories:  v.numStories,
+		sort:        v.sort,
+	}, true
+}
+
+// get returns the page of the variant if it was rendered from the refresh
+// at refreshedAt.
+func (p *pageCach) get(k pageKey, refreshedAt time.Time) ([]byte, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	page, ok := p.pages[k]
+	if !ok || !page.refreshedAt.Equal(refreshedAt) {
+		return nil, false
+	}
+	page.used = true
+	return page.body, true
+}
+
+// put keeps a page, unless a newer one is kept already or there are
+// maxPages others.
+func (p *pageCach) put(k pageKey, page *renderedPage) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	old, ok := p.pages[k]
+	if ok && old.refreshedAt.After(page.refreshedAt) || !ok && len(p.pages) >= maxPages {
+		return
+	}
+	p.pages[k] = page
+}
+
+// rerender renders the pages asked for since the last refresh again, and
+// drops the rest.
+func (p *pageCach) rerender() {
+	p.mutex.Lock()
+	pages := make(map[pageKey]*renderedPage, len(p.pages))
+	for k, page := range p.pages {
+		if page.used {
+			pages[k] = page
+		} else {
+			delete(p.pages, k)
+		}
+	}
+	p.mutex.Unlock()
+	for k, page := range pages {
+		body, refreshedAt, err := page.render()
+		if err != nil {
+			continue
+		}
+		// a page is not asked for just because it was rendered
+		p.put(k, &renderedPage{body: body, refreshedAt: refreshedAt, render: page.render})
+	}
+}
+
+// renderBuffers are reused between renders, so a page isn't grown into a new
+// buffer every time.
+var renderBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// render executes a page into memory.
+func (t *templates) render(name string, data interface{}) ([]byte, error) {
+	buf := renderBuffers.Get().(*bytes.Buffer)
+	defer renderBuffers.Put(buf)
+	buf.Reset()
+	if err := t.page(name).Execute(buf, data); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+func writeHTML(w http.ResponseWriter, page []byte) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandler_PageCach(t *testing.T) {
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{Lang: "en", SiteTitle: "Quiet", CookieSecret: "secret"}
+	c := newCach(2, nil, cachOptions{pages: newPageCach()})
+	c.cashedItems = []item{testStory(1, "First", "https://a.com/1", 10)}
+	c.refreshedAt, c.expiration = time.Now(), time.Now().Add(time.Hour)
+	h := handler(c, cfg, tpls)
+	get := func(target string) string {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", target, nil))
+		return rec.Body.String()
+	}
+
+	if body := get("/"); !strings.Contains(body, "First") {
+		t.Fatalf("first request: want the story, got %s", body)
+	}
+	// the stories change but the cache was not refreshed, so the page kept
+	// is served
+	c.cashedItems = []item{testStory(2, "Second", "https://a.com/2", 10)}
+	if body := get("/"); !strings.Contains(body, "First") {
+		t.Error("second request: want the page kept")
+	}
+	if body := get("/?lang=de"); !strings.Contains(body, "Second") {
+		t.Error("other language: want a page of its own")
+	}
+
+	c.refreshedAt = time.Now().Add(time.Second)
+	c.pages.rerender()
+	if body := get("/"); !strings.Contains(body, "Second") {
+		t.Error("after a refresh: want the page rendered again")
+	}
+	if n := len(c.pages.pages); n != 2 {
+		t.Errorf("pages: want 2, got %d", n)
+	}
+	// neither was asked for since, so the next refresh drops them
+	c.pages.rerender()
+	c.pages.rerender()
+	if n := len(c.pages.pages); n != 0 {
+		t.Errorf("unused pages: want them dropped, got %d", n)
+	}
+}
+
+// benchCach returns a cache of a full front page for the benchmarks.
+func benchCach(b *testing.B, opts cachOptions) *cach {
+	c := newCach(30, nil, opts)
+	for i := range 45 {
+		s := testStory(i+1, fmt.Sprintf("Story number %d about something", i+1), fmt.Sprintf("https://www.example%d.com/posts/%d", i%7, i), 100+i)
+		s.HNRank, s.By, s.Descendants = i+1, "someone", 42
+		c.cashedItems = append(c.cashedItems, s)
+	}
+	c.refreshedAt, c.expiration = time.Now(), time.Now().Add(time.Hour)
+	return c
+}
+
+func benchmarkHandler(b *testing.B, cfg config, opts cachOptions) {
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	h := handler(benchCach(b, opts), cfg, tpls)
+	r := httptest.NewRequest("GET", "/", nil)
+	b.ReportAllocs()
+	for b.Loop() {
+		h(httptest.NewRecorder(), r)
+	}
+}
+
+func BenchmarkHandler(b *testing.B) {
+	cfg := config{Lang: "en", SiteTitle: "Quiet", CookieSecret: "secret"}
+	b.Run("rendered", func(b *testing.B) { benchmarkHandler(b, cfg, cachOptions{}) })
+	b.Run("kept", func(b *testing.B) { benchmarkHandler(b, cfg, cachOptions{pages: newPageCach()}) })
+	o, err := newOrder(config{Rank: "(score-1)/(age+2)^1.8"})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("ranked", func(b *testing.B) { benchmarkHandler(b, cfg, cachOptions{order: o}) })
+}
+
+func BenchmarkTemplates_Render(b *testing.B) {
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		b.Fatal(err)
+	}
+	cfg := config{Lang: "en", SiteTitle: "Quiet", CookieSecret: "secret"}
+	c := benchCach(b, cachOptions{})
+	data, _, err := indexData(c, cfg, httptest.NewRequest("GET", "/", nil), cfg.defaultView(), false, time.Now())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := tpls.render("index.gohtml", data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/neghoda/quiet_hn/archive"
+	"github.com/neghoda/quiet_hn/hn"
+)
+
+const pastPath = "/past/"
+
+// dateLayout is how days are written in the URLs of past front pages.
+const dateLayout = "2006-01-02"
+
+type pastTemplateData struct {
+	Stories []item
+	Date    time.Time
+	// Prev and Next are the closest days with stories, zero if there are
+	// none
+	Prev, Next time.Time
+	// First and Today bound the date picker
+	First, Today time.Time
+	pageData
+}
+
+// pastHandler shows the quiet front page of a day from the archive, at
+// /past/2024-05-12. /past itself and /past?date= redirect to a day.
+func pastHandler(a *archive.Store, cfg config, tpls *templates) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		date := strings.TrimPrefix(r.URL.Path, pastPath)
+		if date == "" || r.URL.Path == strings.TrimSuffix(pastPath, "/") {
+			date = r.URL.Query().Get("date")
+			if date == "" {
+				date = time.Now().AddDate(0, 0, -1).Format(dateLayout)
+			}
+			http.Redirect(w, r, pastPath+date, http.StatusFound)
+			return
+		}
+		day, err := time.ParseInLocation(dateLayout, date, time.Local)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		end := day.AddDate(0, 0, 1)
+		stories, err := a.Day(day, end, cfg.NumStories)
+		if err != nil {
+			http.Error(w, "Failed to load the archive", http.StatusInternalServerError)
+			return
+		}
+		prev, next, err := a.Around(day, end)
+		if err != nil {
+			http.Error(w, "Failed to load the archive", http.StatusInternalServerError)
+			return
+		}
+		first, err := a.First()
+		if err != nil {
+			http.Error(w, "Failed to load the archive", http.StatusInternalServerError)
+			return
+		}
+		data := pastTemplateData{
+			Date:     day,
+			Prev:     midnight(prev),
+			Next:     midnight(next),
+			First:    midnight(first),
+			Today:    midnight(time.Now()),
+			pageData: cfg.pageData(r, start),
+		}
+		for i, s := range stories {
+			data.Stories = append(data.Stories, archivedItem(s, i+1))
+		}
+		pageLinks(w, data.PrevURL(), data.NextURL())
+		err = tpls.execute(w, "past.gohtml", data)
+		if err != nil {
+			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// PrevURL and NextURL are the pages of Prev and Next, empty if there is no
+// such day.
+func (d pastTemplateData) PrevURL() string { return pastURL(d.Prev) }
+func (d pastTemplateData) NextURL() string { return pastURL(d.Next) }
+
+func pastURL(day time.Time) string {
+	if day.IsZero() {
+		return ""
+	}
+	return pastPath + day.Format(dateLayout)
+}
+
+// pageLinks sends the pages before and after a page as Link headers, which
+// browsers and crawlers can follow before the page is parsed. Either may be
+// empty.
+func pageLinks(w http.ResponseWriter, prev, next string) {
+	if prev != "" {
+		w.Header().Add("Link", "<"+prev+">; rel=\"prev\"")
+	}
+	if next != "" {
+		w.Header().Add("Link", "<"+next+">; rel=\"next\"")
+	}
+}
+
+// archivedItem turns an archived story into an item ranked rank.
+func archivedItem(s archive.Story, rank int) item {
+	it := parseHNItem(hn.Item{
+		ID:          s.ID,
+		Type:        s.Type,
+		Title:       s.Title,
+		URL:         s.URL,
+		By:          s.By,
+		Score:       s.Score,
+		Descendants: s.Comments,
+		Time:        int(s.Posted.Unix()),
+	})
+	it.Rank = rank
+	return it
+}
+
+// midnight returns the start of the local day of t, or the zero time for the
+// zero time.
+func midnight(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	t = t.Local()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
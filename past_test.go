@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neghoda/quiet_hn/archive"
+)
+
+func TestPastHandler_PageLinks(t *testing.T) {
+	a, err := archive.Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	for i, day := range []string{"2026-05-10", "2026-05-12", "2026-05-13"} {
+		at, _ := time.ParseInLocation(dateLayout, day, time.Local)
+		if err := a.Record([]archive.Story{{ID: i + 1, Type: "story", Title: "Story of " + day, URL: "https://example.com/" + day}}, at.Add(12*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := pastHandler(a, config{Lang: "en", NumStories: 10}, tpls)
+	tests := []struct {
+		day   string
+		links []string
+	}{
+		{"2026-05-12", []string{`</past/2026-05-10>; rel="prev"`, `</past/2026-05-13>; rel="next"`}},
+		{"2026-05-10", []string{`</past/2026-05-12>; rel="next"`}},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", pastPath+tt.day, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: want 200, got %d", tt.day, rec.Code)
+		}
+		if got := rec.Header().Values("Link"); strings.Join(got, ", ") != strings.Join(tt.links, ", ") {
+			t.Errorf("%s: want the links %v, got %v", tt.day, tt.links, got)
+		}
+		for _, link := range tt.links {
+			page := link[1:strings.IndexByte(link, '>')]
+			if !strings.Contains(rec.Body.String(), `<link rel="prefetch" href="`+page+`">`) {
+				t.Errorf("%s: want %s prefetched", tt.day, page)
+			}
+		}
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/neghoda/quiet_hn/i18n"
+)
+
+// defaultPostTemplate is the text of a post unless -post_template is set.
+// It is executed with a digestLine.
+const defaultPostTemplate = "{{.Title}}\n{{.Link}}{{if ne .Link .Discussion}}\n\n{{.Discussion}}{{end}}"
+
+// postedFor is how long the ids of posted stories are kept, well past the
+// time a story can be on the front page.
+const postedFor = 30 * 24 * time.Hour
+
+// account is a social media account the poster posts to.
+type account interface {
+	post(text string, s item) error
+	// limit is the length of the longest post the service takes
+	limit() int
+}
+
+// poster posts the new front page stories above a score to social media
+// accounts, one every so often, and never the same story twice.
+type poster struct {
+	accounts []account
+	minScore int
+	every    time.Duration
+	text     *template.Template
+	locale   *i18n.Locale
+	// state is the file the posted ids are kept in, so a restart doesn't
+	// post them again
+	state string
+
+	mutex  sync.Mutex
+	busy   bool
+	last   time.Time
+	posted map[int]time.Time
+}
+
+func newPoster(cfg config) (*poster, error) {
+	text, err := template.New("post").Parse(cfg.PostTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("post_template: %w", err)
+	}
+	p := &poster{
+		minScore: cfg.PostMinScore,
+		every:    cfg.PostEvery,
+		text:     text,
+		locale:   i18n.Lookup(cfg.Lang),
+		state:    cfg.PostState,
+		posted:   make(map[int]time.Time),
+	}
+	if cfg.MastodonServer != "" {
+		p.accounts = append(p.accounts, mastodon{server: strings.TrimSuffix(cfg.MastodonServer, "/"), token: cfg.MastodonToken})
+	}
+	if cfg.BlueskyHandle != "" {
+		p.accounts = append(p.accounts, bluesky{server: strings.TrimSuffix(cfg.BlueskyServer, "/"), handle: cfg.BlueskyHandle, password: cfg.BlueskyPassword})
+	}
+	if p.state == "" {
+		log.Print("no -post_state given, stories may be posted again after a restart")
+		return p, nil
+	}
+	b, err := os.ReadFile(p.state)
+	if os.IsNotExist(err) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &p.posted); err != nil {
+		return nil, fmt.Errorf("%s: %w", p.state, err)
+	}
+	return p, nil
+}
+
+// check posts the first story with enough points that was not posted yet,
+// unless the last post is too recent. Posting happens in the background.
+func (p *poster) check(stories []item) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.busy || time.Since(p.last) < p.every {
+		return
+	}
+	for _, s := range stories {
+		if _, ok := p.posted[s.ID]; ok || s.Score < p.minScore {
+			continue
+		}
+		p.busy = true
+		go p.post(s)
+		return
+	}
+}
+
+func (p *poster) post(s item) {
+	for _, a := range p.accounts {
+		text, err := p.render(s, a.limit())
+		if err == nil {
+			err = a.post(text, s)
+		}
+		if err != nil {
+			log.Printf("failed to post %d: %s", s.ID, err)
+		}
+	}
+	// a story that failed is not retried, the next one is due by then anyway
+	now := time.Now()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.busy, p.last, p.posted[s.ID] = false, now, now
+	for id, t := range p.posted {
+		if now.Sub(t) > postedFor {
+			delete(p.posted, id)
+		}
+	}
+	if err := p.save(); err != nil {
+		log.Printf("failed to save the posted stories: %s", err)
+	}
+}
+
+// render executes the template for a story. The title is shortened if the
+// text is longer than limit.
+func (p *poster) render(s item, limit int) (string, error) {
+	line := newDigestLine(p.locale, s)
+	for {
+		var b bytes.Buffer
+		if err := p.text.Execute(&b, line); err != nil {
+			return "", err
+		}
+		over := utf8.RuneCountInString(b.String()) - limit
+		if over <= 0 {
+			return b.String(), nil
+		}
+		title := []rune(line.Title)
+		if over >= len(title) {
+			return "", fmt.Errorf("the post is %d characters too long", over)
+		}
+		line.Title = string(title[:len(title)-over-1]) + "…"
+	}
+}
+
+// save writes the posted ids to the state file, through a temporary file
+// so a crash doesn't leave half of it.
+func (p *poster) save() error {
+	if p.state == "" {
+		return nil
+	}
+	b, err := json.Marshal(p.posted)
+	if err != nil {
+		return err
+	}
+	tmp := p.state + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.state)
+}
+
+// mastodon posts statuses with an access token of the account.
+type mastodon struct {
+	server string
+	token  string
+}
+
+func (m mastodon) limit() int { return 500 }
+
+func (m mastodon) post(text string, s item) error {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+m.token)
+	// a retried request with the same key doesn't post twice
+	header.Set("Idempotency-Key", fmt.Sprintf("quiet_hn-%d", s.ID))
+	body := url.Values{"status": {text}}.Encode()
+	return post(m.server+"/api/v1/statuses", "application/x-www-form-urlencoded", header, []byte(body), nil)
+}
+
+// ping checks the token with the account it belongs to.
+func (m mastodon) ping() error {
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+m.token)
+	return get(m.server+"/api/v1/accounts/verify_credentials", header)
+}
+
+func (m mastodon) target() string { return "mastodon account on " + m.server }
+
+// bluesky posts with an app password of the account.
+type bluesky struct {
+	server   string
+	handle   string
+	password string
+}
+
+func (b bluesky) limit() int { return 300 }
+
+// blueskyLink finds the links in a post, which Bluesky only makes clickable
+// if they are marked as facets.
+var blueskyLink = regexp.MustCompile(`https?://[^\s]+`)
+
+type blueskySession struct {
+	AccessJwt string `json:"accessJwt"`
+	DID       string `json:"did"`
+}
+
+type blueskyPost struct {
+	Type      string         `json:"$type"`
+	Text      string         `json:"text"`
+	CreatedAt string         `json:"createdAt"`
+	Facets    []blueskyFacet `json:"facets,omitempty"`
+}
+
+type blueskyFacet struct {
+	Index struct {
+		ByteStart int `json:"byteStart"`
+		ByteEnd   int `json:"byteEnd"`
+	} `json:"index"`
+	Features []blueskyFeature `json:"features"`
+}
+
+type blueskyFeature struct {
+	Type string `json:"$type"`
+	URI  string `json:"uri"`
+}
+
+// login creates a session with the app password.
+func (b bluesky) login() (blueskySession, error) {
+	var session blueskySession
+	creds, err := json.Marshal(map[string]string{"identifier": b.handle, "password": b.password})
+	if err != nil {
+		return session, err
+	}
+	if err := post(b.server+"/xrpc/com.atproto.server.createSession", "application/json", nil, creds, &session); err != nil {
+		return session, fmt.Errorf("bluesky login: %w", err)
+	}
+	return session, nil
+}
+
+func (b bluesky) ping() error {
+	_, err := b.login()
+	return err
+}
+
+func (b bluesky) target() string { return "bluesky account " + b.handle }
+
+func (b bluesky) post(text string, s item) error {
+	session, err := b.login()
+	if err != nil {
+		return err
+	}
+	record := blueskyPost{Type: "app.bsky.feed.post", Text: text, CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	for _, loc := range blueskyLink.FindAllStringIndex(text, -1) {
+		var f blueskyFacet
+		f.Index.ByteStart, f.Index.ByteEnd = loc[0], loc[1]
+		f.Features = []blueskyFeature{{Type: "app.bsky.richtext.facet#link", URI: text[loc[0]:loc[1]]}}
+		record.Facets = append(record.Facets, f)
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+session.AccessJwt)
+	return postJSONWith(b.server+"/xrpc/com.atproto.repo.createRecord", header, map[string]interface{}{
+		"repo":       session.DID,
+		"collection": "app.bsky.feed.post",
+		"record":     record,
+	})
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/neghoda/quiet_hn/hn"
+	"github.com/neghoda/quiet_hn/i18n"
+)
+
+func testPoster(text string) *poster {
+	return &poster{text: template.Must(template.New("post").Parse(text)), locale: i18n.Lookup("en")}
+}
+
+func TestPoster_Render(t *testing.T) {
+	p := testPoster(defaultPostTemplate)
+	s := parseHNItem(hn.Item{ID: 1, Title: "Short", URL: "https://example.com/a"})
+	got, err := p.render(s, 500)
+	if err != nil {
+		t.Fatalf("render: %s", err)
+	}
+	want := "Short\nhttps://example.com/a\n\nhttps://news.ycombinator.com/item?id=1"
+	if got != want {
+		t.Errorf("render: want %q, got %q", want, got)
+	}
+
+	s.Title = strings.Repeat("ü", 400)
+	got, err = p.render(s, 300)
+	if err != nil {
+		t.Fatalf("render: %s", err)
+	}
+	if n := utf8.RuneCountInString(got); n != 300 {
+		t.Errorf("length: want %d, got %d", 300, n)
+	}
+	if !strings.HasPrefix(got, "üü") || !strings.Contains(got, "ü…\nhttps://example.com/a") {
+		t.Errorf("render: want a shortened title and the links, got %q", got)
+	}
+
+	// the links alone don't fit
+	if _, err := p.render(s, 20); err == nil {
+		t.Errorf("render: want an error for a post that can't fit")
+	}
+}
+
+func TestBluesky_Post(t *testing.T) {
+	var record blueskyPost
+	mux := http.NewServeMux()
+	mux.HandleFunc("/xrpc/com.atproto.server.createSession", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"accessJwt":"jwt","did":"did:plc:test"}`))
+	})
+	mux.HandleFunc("/xrpc/com.atproto.repo.createRecord", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer jwt" {
+			t.Errorf("Authorization: want %q, got %q", "Bearer jwt", got)
+		}
+		var body struct {
+			Repo   string      `json:"repo"`
+			Record blueskyPost `json:"record"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Repo != "did:plc:test" {
+			t.Errorf("repo: want %q, got %q", "did:plc:test", body.Repo)
+		}
+		record = body.Record
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	text := "Ünïcode — title\nhttps://example.com/ä\n\nhttps://news.ycombinator.com/item?id=1"
+	b := bluesky{server: server.URL, handle: "test.bsky.social", password: "pw"}
+	if err := b.post(text, item{}); err != nil {
+		t.Fatalf("post: %s", err)
+	}
+	if record.Text != text {
+		t.Errorf("text: want %q, got %q", text, record.Text)
+	}
+	links := []string{"https://example.com/ä", "https://news.ycombinator.com/item?id=1"}
+	if len(record.Facets) != len(links) {
+		t.Fatalf("len(facets): want %d, got %d", len(links), len(record.Facets))
+	}
+	for i, f := range record.Facets {
+		// the offsets are in bytes of UTF-8, not in characters
+		if got := text[f.Index.ByteStart:f.Index.ByteEnd]; got != links[i] {
+			t.Errorf("facet %d: want %q, got %q", i, links[i], got)
+		}
+		if f.Features[0].URI != links[i] {
+			t.Errorf("facet %d uri: want %q, got %q", i, links[i], f.Features[0].URI)
+		}
+	}
+}
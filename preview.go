@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neghoda/quiet_hn/reader"
+)
+
+const (
+	previewCachLifeDuration = 6 * time.Hour
+	previewWorkers          = 8
+	previewMaxPageBytes     = 512 << 10
+	previewMaxImageBytes    = 1 << 20
+	imageCachSize           = 200
+)
+
+// previewCach holds the Open Graph metadata of story links and the images
+// they point at, so the cards view never hotlinks third party servers.
+type previewCach struct {
+	previews map[string]preview
+	images   map[string]previewImage
+	mutex    sync.Mutex
+	// busy is held while previews are fetched, refreshes that come along in
+	// the meantime leave theirs to the next batch
+	busy   sync.Mutex
+	client *http.Client
+}
+
+type preview struct {
+	meta       reader.Meta
+	expiration time.Time
+}
+
+type previewImage struct {
+	contentType string
+	data        []byte
+	expiration  time.Time
+}
+
+func newPreviewCach() *previewCach {
+	return &previewCach{
+		previews: make(map[string]preview),
+		images:   make(map[string]previewImage),
+		client:   newReadClient(),
+	}
+}
+
+// annotate fills in the Image and Description of the stories that have a
+// cached preview. The missing and expired ones are fetched in the background
+// with a bounded number of workers, and show up on the next refresh.
+func (p *previewCach) annotate(stories []item) {
+	var missing []string
+	now := time.Now()
+	p.mutex.Lock()
+	for i, s := range stories {
+		if s.URL == "" {
+			continue
+		}
+		cached, ok := p.previews[s.URL]
+		if !ok || now.After(cached.expiration) {
+			missing = append(missing, s.URL)
+		}
+		// an expired preview is still better than none until it is fetched
+		stories[i].Image = cached.meta.Image
+		stories[i].Description = cached.meta.Description
+	}
+	p.mutex.Unlock()
+	if len(missing) == 0 || !p.busy.TryLock() {
+		return
+	}
+	go func() {
+		defer p.busy.Unlock()
+		p.fetchPreviews(missing)
+		p.prune()
+	}()
+}
+
+func (p *previewCach) fetchPreviews(urls []string) {
+	next := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < previewWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rawURL := range next {
+				// failures are cached as empty previews so a broken site
+				// isn't retried on every refresh
+				meta, _ := p.fetchPreview(rawURL)
+				p.mutex.Lock()
+				p.previews[rawURL] = preview{meta: meta, expiration: time.Now().Add(previewCachLifeDuration)}
+				p.mutex.Unlock()
+			}
+		}()
+	}
+	for _, rawURL := range urls {
+		next <- rawURL
+	}
+	close(next)
+	wg.Wait()
+}
+
+func (p *previewCach) fetchPreview(rawURL string) (reader.Meta, error) {
+	var meta reader.Meta
+	resp, err := p.client.Get(rawURL)
+	if err != nil {
+		return meta, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return meta, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return meta, nil
+	}
+	return reader.ExtractMeta(io.LimitReader(resp.Body, previewMaxPageBytes), resp.Request.URL)
+}
+
+// prune drops expired previews and images.
+func (p *previewCach) prune() {
+	now := time.Now()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for k, v := range p.previews {
+		if now.After(v.expiration) {
+			delete(p.previews, k)
+		}
+	}
+	for k, v := range p.images {
+		if now.After(v.expiration) {
+			delete(p.images, k)
+		}
+	}
+}
+
+// knownImage reports whether rawURL is the image of a cached preview. The
+// image endpoint only serves those so it can't be used as an open proxy.
+func (p *previewCach) knownImage(rawURL string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	for _, v := range p.previews {
+		if v.meta.Image == rawURL {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *previewCach) getImage(rawURL string) (previewImage, error) {
+	p.mutex.Lock()
+	cached, ok := p.images[rawURL]
+	p.mutex.Unlock()
+	if ok && time.Now().Before(cached.expiration) {
+		return cached, nil
+	}
+
+	var img previewImage
+	resp, err := p.client.Get(rawURL)
+	if err != nil {
+		return img, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return img, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	img.contentType = resp.Header.Get("Content-Type")
+	// svg can carry scripts, which would run on our origin
+	if !strings.HasPrefix(img.contentType, "image/") || strings.HasPrefix(img.contentType, "image/svg") {
+		return img, fmt.Errorf("unexpected content type %q", img.contentType)
+	}
+	img.data, err = io.ReadAll(io.LimitReader(resp.Body, previewMaxImageBytes+1))
+	if err != nil {
+		return img, err
+	}
+	if len(img.data) > previewMaxImageBytes {
+		return img, fmt.Errorf("image is larger than %d bytes", previewMaxImageBytes)
+	}
+	img.expiration = time.Now().Add(previewCachLifeDuration)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.images) < imageCachSize {
+		p.images[rawURL] = img
+	}
+	return img, nil
+}
+
+func imageHandler(p *previewCach) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("url")
+		if !p.knownImage(target) {
+			http.NotFound(w, r)
+			return
+		}
+		img, err := p.getImage(target)
+		if err != nil {
+			http.Error(w, "Failed to load the image", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", img.contentType)
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(previewCachLifeDuration.Seconds())))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Write(img.data)
+	})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+type printTemplateData struct {
+	Stories []item
+	Date    time.Time
+	pageData
+}
+
+// printHandler renders the current front page as a compact sheet meant for
+// paper rather than the screen.
+func printHandler(c *cach, cfg config, tpls *templates) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		stories, err := c.getTopStories(r.Context(), cfg.view(r))
+		if err != nil {
+			storiesError(w, err)
+			return
+		}
+		data := printTemplateData{
+			Stories:  stories,
+			Date:     time.Now(),
+			pageData: cfg.pageData(r, start),
+		}
+		err = tpls.execute(w, "print.gohtml", data)
+		if err != nil {
+			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+const summaryLength = 200
+
+// Summary returns the description of the story cut down to a couple of lines,
+// breaking at a word boundary.
+func (i item) Summary() string {
+	runes := []rune(i.Description)
+	if len(runes) <= summaryLength {
+		return i.Description
+	}
+	cut := summaryLength
+	for cut > summaryLength/2 && runes[cut] != ' ' {
+		cut--
+	}
+	return strings.TrimRight(string(runes[:cut]), " ,.;:") + "…"
+}
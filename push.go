@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/neghoda/quiet_hn/i18n"
+)
+
+// ntfyServer is where topics given without a server are published.
+const ntfyServer = "https://ntfy.sh"
+
+// pushoverURL is the endpoint of the Pushover message API,
+// pushoverValidateURL the one checking a user key.
+var (
+	pushoverURL         = "https://api.pushover.net/1/messages.json"
+	pushoverValidateURL = "https://api.pushover.net/1/users/validate.json"
+)
+
+// ntfyNotifier publishes each story to an ntfy topic.
+type ntfyNotifier struct {
+	server string
+	topic  string
+	// token is an access token for servers that restrict the topic
+	token  string
+	locale *i18n.Locale
+}
+
+// newNtfyNotifier takes a topic name, published on ntfy.sh, or the URL of
+// a topic on another server.
+func newNtfyNotifier(topic, token string, l *i18n.Locale) ntfyNotifier {
+	n := ntfyNotifier{server: ntfyServer, topic: topic, token: token, locale: l}
+	if i := strings.LastIndex(topic, "/"); i >= 0 {
+		n.server, n.topic = strings.TrimSuffix(topic[:i], "/"), topic[i+1:]
+	}
+	return n
+}
+
+// ntfyMessage is a message published as JSON. Unlike headers, the JSON body
+// takes titles that are not ASCII.
+type ntfyMessage struct {
+	Topic   string       `json:"topic"`
+	Title   string       `json:"title"`
+	Message string       `json:"message"`
+	Click   string       `json:"click"`
+	Tags    []string     `json:"tags"`
+	Actions []ntfyAction `json:"actions"`
+}
+
+type ntfyAction struct {
+	Action string `json:"action"`
+	Label  string `json:"label"`
+	URL    string `json:"url"`
+}
+
+func (n ntfyNotifier) notify(rule string, s item) error {
+	link := s.URL
+	if link == "" {
+		link = s.CommentsURL()
+	}
+	header := http.Header{}
+	if n.token != "" {
+		header.Set("Authorization", "Bearer "+n.token)
+	}
+	return postJSONWith(n.server, header, ntfyMessage{
+		Topic:   n.topic,
+		Title:   s.Title,
+		Message: pushMessage(n.locale, rule, s),
+		Click:   link,
+		Tags:    []string{rule},
+		Actions: []ntfyAction{{Action: "view", Label: n.locale.N("comments", s.Descendants), URL: s.CommentsURL()}},
+	})
+}
+
+// pushoverNotifier sends each story to a Pushover user or group.
+type pushoverNotifier struct {
+	// token is the API token of the application, user the key of the
+	// recipient
+	token  string
+	user   string
+	locale *i18n.Locale
+}
+
+func (n pushoverNotifier) notify(rule string, s item) error {
+	link := s.URL
+	if link == "" {
+		link = s.CommentsURL()
+	}
+	return postForm(pushoverURL, url.Values{
+		"token":     {n.token},
+		"user":      {n.user},
+		"title":     {s.Title},
+		"message":   {pushMessage(n.locale, rule, s)},
+		"url":       {link},
+		"url_title": {or(s.Host, n.locale.N("comments", s.Descendants))},
+	})
+}
+
+// pushMessage is the text under the title of a push notification: the rule
+// that matched and how the story is doing.
+func pushMessage(l *i18n.Locale, rule string, s item) string {
+	return rule + " · " + l.N("points", s.Score) + " · " + l.N("comments", s.Descendants)
+}
+
+// ping checks the token of the application and the key of the user.
+func (n pushoverNotifier) ping() error {
+	return postForm(pushoverValidateURL, url.Values{"token": {n.token}, "user": {n.user}})
+}
+
+func (n pushoverNotifier) target() string { return "pushover" }
+
+// ping checks the token with the account endpoint, or only that the server
+// is up without one.
+func (n ntfyNotifier) ping() error {
+	if n.token == "" {
+		return get(n.server+"/v1/health", nil)
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+n.token)
+	return get(n.server+"/v1/account", header)
+}
+
+func (n ntfyNotifier) target() string { return "ntfy topic " + n.server + "/" + n.topic }
@@ -0,0 +1,311 @@
+// Package ranking evaluates the formulas used to order the front page. A
+// formula is an arithmetic expression over named variables, like
+//
+//	(score - 1) / (age + 2) ^ 1.8
+//
+// It supports numbers, variables, + - * / % ^, parentheses and the
+// functions abs, log, log10, sqrt, min and max.
+package ranking
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Vars are the values of the variables a formula is evaluated with.
+type Vars map[string]float64
+
+// Formula is a parsed formula.
+type Formula struct {
+	src  string
+	root node
+}
+
+// Parse parses src. Only the variables listed in vars may be used in it.
+func Parse(src string, vars ...string) (*Formula, error) {
+	p := &parser{src: src, vars: make(map[string]bool)}
+	for _, v := range vars {
+		p.vars[v] = true
+	}
+	p.next()
+	root, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+	return &Formula{src: src, root: root}, nil
+}
+
+// Eval returns the value of the formula. Variables missing from vars are 0,
+// and a result that is not a number is returned as -Inf, so it sorts last.
+func (f *Formula) Eval(vars Vars) float64 {
+	v := f.root.eval(vars)
+	if math.IsNaN(v) {
+		return math.Inf(-1)
+	}
+	return v
+}
+
+func (f *Formula) String() string {
+	return f.src
+}
+
+type node interface {
+	eval(Vars) float64
+}
+
+type number float64
+
+func (n number) eval(Vars) float64 { return float64(n) }
+
+type variable string
+
+func (v variable) eval(vars Vars) float64 { return vars[string(v)] }
+
+type binary struct {
+	op          byte
+	left, right node
+}
+
+func (b binary) eval(vars Vars) float64 {
+	l, r := b.left.eval(vars), b.right.eval(vars)
+	switch b.op {
+	case '+':
+		return l + r
+	case '-':
+		return l - r
+	case '*':
+		return l * r
+	case '/':
+		return l / r
+	case '%':
+		return math.Mod(l, r)
+	default:
+		return math.Pow(l, r)
+	}
+}
+
+type negate struct{ x node }
+
+func (n negate) eval(vars Vars) float64 { return -n.x.eval(vars) }
+
+type call struct {
+	fn   function
+	args []node
+}
+
+func (c call) eval(vars Vars) float64 {
+	args := make([]float64, len(c.args))
+	for i, a := range c.args {
+		args[i] = a.eval(vars)
+	}
+	return c.fn.apply(args)
+}
+
+type function struct {
+	// arity is the number of arguments, -1 for any number but at least one
+	arity int
+	apply func([]float64) float64
+}
+
+var functions = map[string]function{
+	"abs":   {1, func(a []float64) float64 { return math.Abs(a[0]) }},
+	"log":   {1, func(a []float64) float64 { return math.Log(a[0]) }},
+	"log10": {1, func(a []float64) float64 { return math.Log10(a[0]) }},
+	"sqrt":  {1, func(a []float64) float64 { return math.Sqrt(a[0]) }},
+	"min": {-1, func(a []float64) float64 {
+		m := a[0]
+		for _, v := range a[1:] {
+			m = math.Min(m, v)
+		}
+		return m
+	}},
+	"max": {-1, func(a []float64) float64 {
+		m := a[0]
+		for _, v := range a[1:] {
+			m = math.Max(m, v)
+		}
+		return m
+	}},
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokNumber
+	tokIdent
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+type parser struct {
+	src  string
+	pos  int
+	tok  token
+	vars map[string]bool
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("ranking: column %d: %s", p.tok.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) next() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos == len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return
+	}
+	c := rune(p.src[p.pos])
+	switch {
+	case c >= '0' && c <= '9' || c == '.':
+		for p.pos < len(p.src) && (p.src[p.pos] >= '0' && p.src[p.pos] <= '9' || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		p.tok = token{kind: tokNumber, text: p.src[start:p.pos], pos: start}
+	case unicode.IsLetter(c) || c == '_':
+		for p.pos < len(p.src) && (unicode.IsLetter(rune(p.src[p.pos])) || unicode.IsDigit(rune(p.src[p.pos])) || p.src[p.pos] == '_') {
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, text: p.src[start:p.pos], pos: start}
+	default:
+		p.pos++
+		p.tok = token{kind: tokOp, text: p.src[start:p.pos], pos: start}
+	}
+}
+
+func (p *parser) is(op string) bool {
+	return p.tok.kind == tokOp && p.tok.text == op
+}
+
+// expr = term {("+" | "-") term}
+func (p *parser) expr() (node, error) {
+	left, err := p.term()
+	for err == nil && (p.is("+") || p.is("-")) {
+		op := p.tok.text[0]
+		p.next()
+		var right node
+		right, err = p.term()
+		left = binary{op, left, right}
+	}
+	return left, err
+}
+
+// term = unary {("*" | "/" | "%") unary}
+func (p *parser) term() (node, error) {
+	left, err := p.unary()
+	for err == nil && (p.is("*") || p.is("/") || p.is("%")) {
+		op := p.tok.text[0]
+		p.next()
+		var right node
+		right, err = p.unary()
+		left = binary{op, left, right}
+	}
+	return left, err
+}
+
+// unary = "-" unary | power
+func (p *parser) unary() (node, error) {
+	if p.is("-") {
+		p.next()
+		x, err := p.unary()
+		return negate{x}, err
+	}
+	return p.power()
+}
+
+// power = primary ["^" unary], so 2^3^2 is 2^(3^2) and 2^-1 works
+func (p *parser) power() (node, error) {
+	base, err := p.primary()
+	if err != nil || !p.is("^") {
+		return base, err
+	}
+	p.next()
+	exp, err := p.unary()
+	return binary{'^', base, exp}, err
+}
+
+// primary = number | variable | function "(" expr {"," expr} ")" | "(" expr ")"
+func (p *parser) primary() (node, error) {
+	tok := p.tok
+	switch {
+	case tok.kind == tokNumber:
+		v, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, p.errorf("bad number %q", tok.text)
+		}
+		p.next()
+		return number(v), nil
+	case tok.kind == tokIdent:
+		p.next()
+		if !p.is("(") {
+			if !p.vars[tok.text] {
+				return nil, fmt.Errorf("ranking: column %d: unknown variable %s, want one of %s", tok.pos+1, tok.text, p.varList())
+			}
+			return variable(tok.text), nil
+		}
+		fn, ok := functions[tok.text]
+		if !ok {
+			return nil, fmt.Errorf("ranking: column %d: unknown function %s", tok.pos+1, tok.text)
+		}
+		p.next()
+		var args []node
+		for {
+			arg, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if !p.is(",") {
+				break
+			}
+			p.next()
+		}
+		if !p.is(")") {
+			return nil, p.errorf("want ) after the arguments of %s", tok.text)
+		}
+		p.next()
+		if fn.arity >= 0 && len(args) != fn.arity {
+			return nil, fmt.Errorf("ranking: column %d: %s takes %d argument(s), got %d", tok.pos+1, tok.text, fn.arity, len(args))
+		}
+		return call{fn, args}, nil
+	case p.is("("):
+		p.next()
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.is(")") {
+			return nil, p.errorf("want )")
+		}
+		p.next()
+		return x, nil
+	case tok.kind == tokEOF:
+		return nil, p.errorf("unexpected end of formula")
+	default:
+		return nil, p.errorf("unexpected %q", tok.text)
+	}
+}
+
+func (p *parser) varList() string {
+	var names []string
+	for v := range p.vars {
+		names = append(names, v)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
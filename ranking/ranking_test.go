@@ -0,0 +1,45 @@
+package ranking
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFormula_Eval(t *testing.T) {
+	vars := Vars{"score": 101, "age": 3, "rank": 4}
+	tests := map[string]float64{
+		"score":                     101,
+		"1 + 2 * 3":                 7,
+		"(1 + 2) * 3":               9,
+		"2 ^ 3 ^ 2":                 512,
+		"-2 ^ 2":                    -4,
+		"2 ^ -1":                    0.5,
+		"(score - 1) / (age + 2)^2": 4,
+		"max(rank, 10, age) % 7":    3,
+		"min(score, 5) - sqrt(16)":  1,
+		"log10(score - 1)":          2,
+		"abs(age - rank)":           1,
+	}
+	for src, want := range tests {
+		f, err := Parse(src, "score", "age", "rank")
+		if err != nil {
+			t.Errorf("Parse(%q) received an error: %s", src, err.Error())
+			continue
+		}
+		if got := f.Eval(vars); math.Abs(got-want) > 1e-9 {
+			t.Errorf("Eval(%q): want %v, got %v", src, want, got)
+		}
+	}
+	f, _ := Parse("log(-1)")
+	if got := f.Eval(nil); !math.IsInf(got, -1) {
+		t.Errorf("Eval(log(-1)): want -Inf, got %v", got)
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	for _, src := range []string{"", "score +", "(score", "karma", "nope(1)", "sqrt(1, 2)", "score score", "1..2", "score $ 2"} {
+		if _, err := Parse(src, "score"); err == nil {
+			t.Errorf("Parse(%q): want an error, got none", src)
+		}
+	}
+}
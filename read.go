@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/neghoda/quiet_hn/reader"
+)
+
+const (
+	readCachLifeDuration = time.Hour
+	readCachSize         = 100
+	readTimeout          = 10 * time.Second
+)
+
+var errForbiddenAddr = errors.New("refusing to fetch from a private address")
+
+type readCach struct {
+	entries  map[string]readEntry
+	mutex    sync.Mutex
+	maxBytes int64
+	client   *http.Client
+}
+
+type readEntry struct {
+	article    reader.Article
+	expiration time.Time
+}
+
+type readTemplateData struct {
+	URL     string
+	Host    string
+	Title   string
+	Content template.HTML
+	pageData
+}
+
+func readHandler(cfg config, tpls *templates) http.HandlerFunc {
+	c := readCach{
+		entries:  make(map[string]readEntry),
+		maxBytes: cfg.ReadMaxBytes,
+		client:   newReadClient(),
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		target, err := url.Parse(r.URL.Query().Get("url"))
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			http.Error(w, "A valid http or https url is required", http.StatusBadRequest)
+			return
+		}
+		article, err := c.getArticle(target)
+		if err != nil {
+			http.Error(w, "Failed to load the article", http.StatusBadGateway)
+			return
+		}
+		data := readTemplateData{
+			URL:   target.String(),
+			Host:  hostOf(target.String()),
+			Title: article.Title,
+			// reader.Extract only returns sanitized markup
+			Content:  template.HTML(article.Content),
+			pageData: cfg.pageData(r, start),
+		}
+		err = tpls.execute(w, "read.gohtml", data)
+		if err != nil {
+			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+func (c *readCach) getArticle(target *url.URL) (reader.Article, error) {
+	key := target.String()
+	c.mutex.Lock()
+	entry, ok := c.entries[key]
+	c.mutex.Unlock()
+	if ok && time.Now().Before(entry.expiration) {
+		return entry.article, nil
+	}
+
+	article, err := c.fetchArticle(target)
+	if err != nil {
+		return article, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.entries) >= readCachSize {
+		c.evict()
+	}
+	c.entries[key] = readEntry{
+		article:    article,
+		expiration: time.Now().Add(readCachLifeDuration),
+	}
+	return article, nil
+}
+
+// evict drops expired entries, or the one closest to expiring if nothing has
+// expired yet. The caller must hold the mutex.
+func (c *readCach) evict() {
+	now := time.Now()
+	var oldestKey string
+	var oldest time.Time
+	for k, v := range c.entries {
+		if now.After(v.expiration) {
+			delete(c.entries, k)
+			continue
+		}
+		if oldestKey == "" || v.expiration.Before(oldest) {
+			oldestKey, oldest = k, v.expiration
+		}
+	}
+	if len(c.entries) >= readCachSize {
+		delete(c.entries, oldestKey)
+	}
+}
+
+func (c *readCach) fetchArticle(target *url.URL) (reader.Article, error) {
+	var article reader.Article
+	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return article, err
+	}
+	req.Header.Set("Accept", "text/html")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return article, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return article, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	// resp.Request.URL is the final URL after any redirects
+	return reader.Extract(io.LimitReader(resp.Body, c.maxBytes), resp.Request.URL)
+}
+
+// newReadClient returns a client that won't connect to loopback or private
+// networks, so /read can't be used to poke at the host it runs on.
+func newReadClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: readTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+				ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+				return errForbiddenAddr
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout: readTimeout,
+		Transport: &http.Transport{
+			Proxy:       http.ProxyFromEnvironment,
+			DialContext: dialer.DialContext,
+		},
+	}
+}
@@ -0,0 +1,47 @@
+package reader
+
+import (
+	"io"
+	"net/url"
+	"strings"
+)
+
+// Meta is the preview information a page advertises about itself through
+// Open Graph tags, falling back to the plain description meta tag.
+type Meta struct {
+	Image       string
+	Description string
+}
+
+// ExtractMeta parses the page read from r and returns its preview metadata.
+// A relative image URL is resolved against base, which may be nil.
+func ExtractMeta(r io.Reader, base *url.URL) (Meta, error) {
+	var m Meta
+	doc, err := parse(r)
+	if err != nil {
+		return m, err
+	}
+	var description string
+	doc.walk(func(n *node) {
+		if n.tag != "meta" {
+			return
+		}
+		content := strings.TrimSpace(n.attr("content"))
+		switch {
+		case n.attr("property") == "og:image" && m.Image == "":
+			m.Image = content
+		case n.attr("property") == "og:description" && m.Description == "":
+			m.Description = content
+		case n.attr("name") == "description" && description == "":
+			description = content
+		}
+	})
+	if m.Description == "" {
+		m.Description = description
+	}
+	if m.Image != "" {
+		s := sanitizer{base: base}
+		m.Image, _ = s.link(m.Image)
+	}
+	return m, nil
+}
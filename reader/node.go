@@ -0,0 +1,151 @@
+package reader
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// node is a minimal HTML tree. Text nodes have an empty tag.
+type node struct {
+	tag      string
+	attrs    map[string]string
+	text     string
+	parent   *node
+	children []*node
+}
+
+// rawText matches elements whose content isn't markup and would confuse the
+// tokenizer, like a "<" comparison inside a script.
+var rawText = regexp.MustCompile(`(?is)<(script|style|noscript|template)\b.*?</(script|style|noscript|template)\s*>`)
+
+// parse builds a tree out of sloppy real world HTML. encoding/xml in
+// non-strict mode copes with unquoted attributes, unknown entities and void
+// elements; anything after a hard tokenizer error is dropped and whatever was
+// parsed so far is returned.
+func parse(r io.Reader) (*node, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	src = rawText.ReplaceAll(src, nil)
+
+	dec := xml.NewDecoder(bytes.NewReader(src))
+	dec.Strict = false
+	dec.AutoClose = xml.HTMLAutoClose
+	dec.Entity = xml.HTMLEntity
+	dec.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	root := &node{tag: "#document"}
+	cur := root
+	for {
+		tok, err := dec.RawToken()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &node{tag: strings.ToLower(t.Name.Local), parent: cur}
+			// paragraphs don't nest, a new one closes the one that is open
+			// as HN's texts rely on
+			if n.tag == "p" {
+				for p := cur; p != root; p = p.parent {
+					if p.tag == "p" {
+						cur = p.parent
+						break
+					}
+				}
+				n.parent = cur
+			}
+			for _, a := range t.Attr {
+				if n.attrs == nil {
+					n.attrs = make(map[string]string)
+				}
+				n.attrs[strings.ToLower(a.Name.Local)] = a.Value
+			}
+			cur.children = append(cur.children, n)
+			if !isVoid(n.tag) {
+				cur = n
+			}
+		case xml.EndElement:
+			tag := strings.ToLower(t.Name.Local)
+			// close everything up to the matching element, ignoring stray
+			// end tags that were never opened
+			for n := cur; n != root; n = n.parent {
+				if n.tag == tag {
+					cur = n.parent
+					break
+				}
+			}
+		case xml.CharData:
+			cur.children = append(cur.children, &node{text: string(t), parent: cur})
+		}
+	}
+	return root, nil
+}
+
+// block elements separate words in the text content
+var block = map[string]bool{
+	"p": true, "div": true, "br": true, "li": true, "ul": true, "ol": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"blockquote": true, "pre": true, "section": true, "article": true,
+	"td": true, "th": true, "tr": true, "hr": true, "title": true,
+}
+
+func isVoid(tag string) bool {
+	for _, v := range xml.HTMLAutoClose {
+		if v == tag {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *node) attr(key string) string {
+	return n.attrs[key]
+}
+
+func (n *node) remove(child *node) {
+	for i, c := range n.children {
+		if c == child {
+			n.children = append(n.children[:i], n.children[i+1:]...)
+			return
+		}
+	}
+}
+
+// walk calls fn for n and every element below it.
+func (n *node) walk(fn func(*node)) {
+	if n.tag != "" {
+		fn(n)
+	}
+	for _, c := range n.children {
+		c.walk(fn)
+	}
+}
+
+// textContent returns the text below n with whitespace collapsed.
+func (n *node) textContent() string {
+	var sb strings.Builder
+	var collect func(*node)
+	collect = func(n *node) {
+		if n.tag == "" {
+			sb.WriteString(n.text)
+		}
+		if block[n.tag] {
+			sb.WriteByte(' ')
+		}
+		for _, c := range n.children {
+			collect(c)
+		}
+		if block[n.tag] {
+			sb.WriteByte(' ')
+		}
+	}
+	collect(n)
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
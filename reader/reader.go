@@ -0,0 +1,175 @@
+// Package reader implements a small readability style extractor that turns a
+// full article page into a title and a sanitized chunk of body HTML.
+package reader
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrNoContent is returned when no block of the page looks like an article.
+var ErrNoContent = errors.New("reader: no readable content found")
+
+// Article is the readable part of a web page.
+type Article struct {
+	Title string
+	// Content is sanitized HTML that only contains a small set of text
+	// formatting elements, so it is safe to render as is.
+	Content string
+	// Text is the plain text of Content, mostly useful for length checks and
+	// short descriptions.
+	Text string
+}
+
+var (
+	positiveHint = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|story|text`)
+	negativeHint = regexp.MustCompile(`(?i)ad-|banner|comment|footer|masthead|menu|meta|nav|promo|related|share|sidebar|social|sponsor|widget`)
+)
+
+// elements that never contain article text
+var stripped = map[string]bool{
+	"script":   true,
+	"style":    true,
+	"noscript": true,
+	"template": true,
+	"iframe":   true,
+	"form":     true,
+	"button":   true,
+	"nav":      true,
+	"aside":    true,
+	"header":   true,
+	"footer":   true,
+	"svg":      true,
+	"object":   true,
+	"embed":    true,
+	"head":     true,
+}
+
+// Extract parses the page read from r and returns its readable content.
+// Relative links are resolved against base, which may be nil.
+func Extract(r io.Reader, base *url.URL) (Article, error) {
+	var art Article
+	doc, err := parse(r)
+	if err != nil {
+		return art, err
+	}
+	art.Title = title(doc)
+	clean(doc)
+
+	scores := make(map[*node]float64)
+	doc.walk(func(n *node) {
+		if n.tag != "p" && n.tag != "pre" && n.tag != "blockquote" {
+			return
+		}
+		text := n.textContent()
+		if len(text) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + minFloat(float64(len(text))/100, 3)
+		if parent := n.parent; parent != nil {
+			scores[parent] += score
+			if grand := parent.parent; grand != nil {
+				scores[grand] += score / 2
+			}
+		}
+	})
+
+	var best *node
+	var bestScore float64
+	for n, score := range scores {
+		score = score*(1-linkDensity(n)) + hintWeight(n)
+		if best == nil || score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	if best == nil {
+		return art, ErrNoContent
+	}
+
+	var buf bytes.Buffer
+	s := sanitizer{base: base}
+	s.children(&buf, best)
+	art.Content = buf.String()
+	art.Text = best.textContent()
+	return art, nil
+}
+
+func title(doc *node) string {
+	var t, og string
+	doc.walk(func(n *node) {
+		switch n.tag {
+		case "title":
+			if t == "" {
+				t = n.textContent()
+			}
+		case "meta":
+			if n.attr("property") == "og:title" && og == "" {
+				og = strings.TrimSpace(n.attr("content"))
+			}
+		}
+	})
+	if og != "" {
+		return og
+	}
+	return t
+}
+
+// clean removes elements that can't be part of the article, including any
+// element whose class or id looks like page furniture.
+func clean(n *node) {
+	for _, c := range append([]*node(nil), n.children...) {
+		switch {
+		case c.tag == "":
+		case stripped[c.tag]:
+			n.remove(c)
+		case c.tag != "body" && c.tag != "html" && hintWeight(c) < 0:
+			n.remove(c)
+		default:
+			clean(c)
+		}
+	}
+}
+
+func hintWeight(n *node) float64 {
+	var w float64
+	for _, v := range []string{n.attr("class"), n.attr("id")} {
+		if v == "" {
+			continue
+		}
+		if negativeHint.MatchString(v) {
+			w -= 25
+		}
+		if positiveHint.MatchString(v) {
+			w += 25
+		}
+	}
+	if n.tag == "article" || n.tag == "main" {
+		w += 25
+	}
+	return w
+}
+
+func linkDensity(n *node) float64 {
+	total := len(n.textContent())
+	if total == 0 {
+		return 0
+	}
+	var links int
+	n.walk(func(c *node) {
+		if c.tag == "a" {
+			links += len(c.textContent())
+		}
+	})
+	return float64(links) / float64(total)
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
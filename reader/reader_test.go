@@ -0,0 +1,77 @@
+package reader
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const testPage = `<!doctype html>
+<html>
+<head>
+  <title>Fallback Title</title>
+  <meta property="og:title" content="Test Article">
+  <script>trackEverything()</script>
+</head>
+<body>
+  <nav><a href="/">Home</a> <a href="/about">About</a></nav>
+  <div class="sidebar"><p>Subscribe to our newsletter, today, now, please, thanks.</p></div>
+  <div class="post-content">
+    <h1>Test Article</h1>
+    <p>The first paragraph has enough text, with a few commas, to be scored as content.</p>
+    <p onclick="evil()">A second paragraph links to <a href="/other" style="color:red">another page</a> and <a href="javascript:alert(1)">nowhere</a>.</p>
+    <img src="https://tracker.example/pixel.gif">
+  </div>
+  <footer><p>Copyright, all rights reserved, forever and ever.</p></footer>
+</body>
+</html>`
+
+func TestExtract(t *testing.T) {
+	base, _ := url.Parse("https://example.com/posts/1")
+	art, err := Extract(strings.NewReader(testPage), base)
+	if err != nil {
+		t.Fatalf("Extract() received an error: %s", err.Error())
+	}
+	if art.Title != "Test Article" {
+		t.Errorf("art.Title: want %s, got %s", "Test Article", art.Title)
+	}
+	for _, want := range []string{
+		"<h2>Test Article</h2>",
+		"<p>The first paragraph",
+		`<a href="https://example.com/other" rel="nofollow noopener noreferrer">another page</a>`,
+	} {
+		if !strings.Contains(art.Content, want) {
+			t.Errorf("art.Content: want it to contain %q, got %s", want, art.Content)
+		}
+	}
+	for _, unwanted := range []string{"script", "onclick", "style", "javascript", "<img", "newsletter", "Copyright", "About"} {
+		if strings.Contains(art.Content, unwanted) {
+			t.Errorf("art.Content: should not contain %q, got %s", unwanted, art.Content)
+		}
+	}
+}
+
+func TestExtract_noContent(t *testing.T) {
+	_, err := Extract(strings.NewReader("<html><body><p>Too short.</p></body></html>"), nil)
+	if err != ErrNoContent {
+		t.Errorf("Extract() error: want %v, got %v", ErrNoContent, err)
+	}
+}
+
+func TestExtractMeta(t *testing.T) {
+	base, _ := url.Parse("https://example.com/posts/1")
+	page := `<html><head>
+<meta name="description" content="Plain description">
+<meta property="og:image" content="/images/cover.png">
+</head><body></body></html>`
+	m, err := ExtractMeta(strings.NewReader(page), base)
+	if err != nil {
+		t.Fatalf("ExtractMeta() received an error: %s", err.Error())
+	}
+	if m.Image != "https://example.com/images/cover.png" {
+		t.Errorf("m.Image: want %s, got %s", "https://example.com/images/cover.png", m.Image)
+	}
+	if m.Description != "Plain description" {
+		t.Errorf("m.Description: want %s, got %s", "Plain description", m.Description)
+	}
+}
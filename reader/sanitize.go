@@ -0,0 +1,112 @@
+package reader
+
+import (
+	"bytes"
+	"html"
+	"net/url"
+	"strings"
+)
+
+// allowed lists the elements kept in the output. Anything else is unwrapped,
+// so its text survives but the markup and attributes do not.
+var allowed = map[string]bool{
+	"p":          true,
+	"br":         true,
+	"hr":         true,
+	"a":          true,
+	"em":         true,
+	"i":          true,
+	"strong":     true,
+	"b":          true,
+	"blockquote": true,
+	"pre":        true,
+	"code":       true,
+	"ul":         true,
+	"ol":         true,
+	"li":         true,
+	"h2":         true,
+	"h3":         true,
+	"h4":         true,
+	"h5":         true,
+	"h6":         true,
+}
+
+// hnAllowed lists the elements HN puts in item texts and user abouts.
+var hnAllowed = map[string]bool{"p": true, "i": true, "a": true, "pre": true, "code": true}
+
+// SanitizeHN returns the HTML of an HN item text or user about with only the
+// markup HN makes itself kept: paragraphs, italics, code and links to http(s)
+// URLs. It is safe to render as is.
+func SanitizeHN(text string) string {
+	doc, _ := parse(strings.NewReader(text))
+	var buf bytes.Buffer
+	sanitizer{allowed: hnAllowed}.children(&buf, doc)
+	return buf.String()
+}
+
+type sanitizer struct {
+	base *url.URL
+	// allowed overrides the elements kept when set
+	allowed map[string]bool
+}
+
+func (s sanitizer) render(buf *bytes.Buffer, n *node) {
+	if n.tag == "" {
+		buf.WriteString(html.EscapeString(n.text))
+		return
+	}
+	if stripped[n.tag] {
+		return
+	}
+	tag := n.tag
+	if tag == "h1" {
+		// the page already has a heading for the article title
+		tag = "h2"
+	}
+	if keep := s.allowed; keep == nil && !allowed[tag] || keep != nil && !keep[tag] {
+		s.children(buf, n)
+		return
+	}
+	if tag == "a" {
+		href, ok := s.link(n.attr("href"))
+		if !ok {
+			s.children(buf, n)
+			return
+		}
+		buf.WriteString(`<a href="`)
+		buf.WriteString(html.EscapeString(href))
+		buf.WriteString(`" rel="nofollow noopener noreferrer">`)
+	} else {
+		buf.WriteString("<" + tag + ">")
+	}
+	if isVoid(tag) {
+		return
+	}
+	s.children(buf, n)
+	buf.WriteString("</" + tag + ">")
+}
+
+func (s sanitizer) children(buf *bytes.Buffer, n *node) {
+	for _, c := range n.children {
+		s.render(buf, c)
+	}
+}
+
+// link resolves href against the page URL and only accepts http(s) targets.
+func (s sanitizer) link(href string) (string, bool) {
+	href = strings.TrimSpace(href)
+	if href == "" {
+		return "", false
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	if s.base != nil {
+		u = s.base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", false
+	}
+	return u.String(), true
+}
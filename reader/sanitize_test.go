@@ -0,0 +1,25 @@
+package reader
+
+import "testing"
+
+func TestSanitizeHN(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"paragraphs", "First<p>Second &amp; more<p>Third", "First<p>Second &amp; more</p><p>Third</p>"},
+		{"italics and code", "<i>so</i> <pre><code>  x := 1\n</code></pre>", "<i>so</i> <pre><code>  x := 1\n</code></pre>"},
+		{"link", `see <a href="https://example.com/a?b=1&amp;c=2" rel="nofollow" onclick="x()">this</a>`, `see <a href="https://example.com/a?b=1&amp;c=2" rel="nofollow noopener noreferrer">this</a>`},
+		{"script link", `<a href="javascript:alert(1)">x</a>`, `x`},
+		{"script", `a<script>alert("x")</script>b`, "ab"},
+		{"other tags", `<b onmouseover="x()">bold</b><img src=x onerror=alert(1)>`, "bold"},
+		{"attributes", `<p class="x" style="color:red">text`, "<p>text</p>"},
+		{"unclosed", `<i><a href="http://a.com">x`, `<i><a href="http://a.com" rel="nofollow noopener noreferrer">x</a></i>`},
+		{"stray close", "x</i></p></div>", "x"},
+		{"escaped text", "1 &lt; 2 &quot;quoted&quot; &#x27;", "1 &lt; 2 &#34;quoted&#34; &#39;"},
+	}
+	for _, tt := range tests {
+		if got := SanitizeHN(tt.text); got != tt.want {
+			t.Errorf("%s: want %q, got %q", tt.name, tt.want, got)
+		}
+	}
+}
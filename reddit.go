@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/neghoda/quiet_hn/hn"
+)
+
+// redditURL is where the reddit source gets its posts, tests point it
+// elsewhere.
+var redditURL = "https://www.reddit.com"
+
+// subredditName matches the names reddit allows for subreddits.
+var subredditName = regexp.MustCompile(`^[A-Za-z0-9_]{2,21}$`)
+
+// reddit is the source of the hot posts of -subreddits, mixed the way
+// reddit mixes a multireddit. Post ids are base 36 numbers, which make the
+// ids of the items.
+type reddit struct {
+	subreddits []string
+	mutex      sync.Mutex
+	// posts are the ones of the last listing, which has all there is to
+	// know about them
+	posts map[int]hn.Item
+}
+
+func newReddit(subreddits []string) *reddit {
+	return &reddit{subreddits: subreddits, posts: make(map[int]hn.Item)}
+}
+
+// subreddits returns the subreddits of -subreddits, without "r/".
+func (cfg config) subreddits() []string {
+	var ret []string
+	for _, name := range strings.Split(cfg.Subreddits, ",") {
+		if name = strings.TrimPrefix(strings.TrimSpace(name), "r/"); name != "" {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+// redditListing is a listing of posts of the reddit JSON API.
+type redditListing struct {
+	Data struct {
+		Children []struct {
+			Data redditPost `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+type redditPost struct {
+	ID          string  `json:"id"`
+	Title       string  `json:"title"`
+	URL         string  `json:"url"`
+	Permalink   string  `json:"permalink"`
+	Author      string  `json:"author"`
+	Score       int     `json:"score"`
+	NumComments int     `json:"num_comments"`
+	CreatedUTC  float64 `json:"created_utc"`
+	IsSelf      bool    `json:"is_self"`
+	Selftext    string  `json:"selftext_html"`
+	Stickied    bool    `json:"stickied"`
+	Over18      bool    `json:"over_18"`
+}
+
+func (p redditPost) item() (hn.Item, error) {
+	id, err := strconv.ParseInt(p.ID, 36, 64)
+	if err != nil {
+		return hn.Item{}, fmt.Errorf("reddit post %q: %w", p.ID, err)
+	}
+	it := hn.Item{
+		ID:          int(id),
+		Type:        "story",
+		By:          p.Author,
+		Title:       p.Title,
+		URL:         p.URL,
+		Score:       p.Score,
+		Descendants: p.NumComments,
+		Time:        int(p.CreatedUTC),
+	}
+	// the URL of a self post is its own discussion
+	if p.IsSelf {
+		it.URL, it.Text = "", p.Selftext
+	}
+	return it, nil
+}
+
+func (rd *reddit) TopIDs(ctx context.Context) ([]int, error) {
+	var listing redditListing
+	if err := getJSON(ctx, redditURL+"/r/"+strings.Join(rd.subreddits, "+")+"/hot.json?limit=100&raw_json=1", &listing); err != nil {
+		return nil, fmt.Errorf("reddit: %w", err)
+	}
+	posts := make(map[int]hn.Item, len(listing.Data.Children))
+	ids := make([]int, 0, len(listing.Data.Children))
+	for _, child := range listing.Data.Children {
+		// pinned announcements of the moderators stay on top for days,
+		// and NSFW posts are no quiet reading
+		if child.Data.Stickied || child.Data.Over18 {
+			continue
+		}
+		it, err := child.Data.item()
+		if err != nil {
+			return nil, err
+		}
+		posts[it.ID] = it
+		ids = append(ids, it.ID)
+	}
+	rd.mutex.Lock()
+	rd.posts = posts
+	rd.mutex.Unlock()
+	return ids, nil
+}
+
+func (rd *reddit) GetItem(ctx context.Context, id int) (hn.Item, error) {
+	rd.mutex.Lock()
+	it, ok := rd.posts[id]
+	rd.mutex.Unlock()
+	if ok {
+		return it, nil
+	}
+	var listing redditListing
+	if err := getJSON(ctx, redditURL+"/by_id/t3_"+strconv.FormatInt(int64(id), 36)+".json?raw_json=1", &listing); err != nil {
+		return hn.Item{}, fmt.Errorf("reddit: %w", err)
+	}
+	if len(listing.Data.Children) == 0 {
+		return hn.Item{}, fmt.Errorf("reddit: no post %s", strconv.FormatInt(int64(id), 36))
+	}
+	return listing.Data.Children[0].Data.item()
+}
+
+func (rd *reddit) name() string {
+	return "reddit"
+}
+
+// commentsURL links to the post by its id alone, reddit redirects it to the
+// permalink.
+func (rd *reddit) commentsURL(id int) string {
+	return redditURL + "/comments/" + strconv.FormatInt(int64(id), 36)
+}
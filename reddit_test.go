@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReddit(t *testing.T) {
+	var listed string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/r/programming+golang/hot.json":
+			listed = r.Header.Get("User-Agent")
+			fmt.Fprint(w, `{"data":{"children":[
+				{"kind":"t3","data":{"id":"mod","title":"Weekly thread","url":"https://example.com/mod","stickied":true}},
+				{"kind":"t3","data":{"id":"1abc","title":"A link","url":"https://example.com/a","author":"alice","score":120,"num_comments":30,"created_utc":1714582800.0}},
+				{"kind":"t3","data":{"id":"1abd","title":"Ask: why?","url":"https://www.reddit.com/r/golang/comments/1abd/why/","is_self":true,"selftext_html":"<p>why</p>","score":5}},
+				{"kind":"t3","data":{"id":"1abe","title":"Not safe","url":"https://example.com/nsfw","over_18":true}}
+			]}}`)
+		case "/by_id/t3_zz.json":
+			fmt.Fprint(w, `{"data":{"children":[{"kind":"t3","data":{"id":"zz","title":"Older","url":"https://example.com/zz"}}]}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	old := redditURL
+	redditURL = server.URL
+	defer func() { redditURL = old }()
+
+	rd := newReddit(config{Subreddits: "programming, r/golang"}.subreddits())
+	stories, _, err := fetchTopStories(context.Background(), rd, 5, func(item) bool { return true }, nil)
+	if err != nil {
+		t.Fatalf("fetchTopStories() received an error: %s", err.Error())
+	}
+	if listed == "" || listed == "Go-http-client/1.1" {
+		t.Errorf("user agent: want one of quiet_hn, got %q", listed)
+	}
+	if len(stories) != 2 {
+		t.Fatalf("stories: want the link and the self post without the pinned and NSFW ones, got %+v", stories)
+	}
+	if s := stories[0]; s.Title != "A link" || s.By != "alice" || s.Score != 120 || s.Descendants != 30 || s.Source != "reddit" || s.CommentsURL() != server.URL+"/comments/1abc" {
+		t.Errorf("link: want post 1abc of reddit, got %+v", s)
+	}
+	if s := stories[1]; s.URL != "" || s.Text != "<p>why</p>" || s.Link() != server.URL+"/comments/1abd" {
+		t.Errorf("self post: want it linked to its discussion, got %+v", s)
+	}
+
+	if it, err := rd.GetItem(context.Background(), 35*36+35); err != nil || it.Title != "Older" {
+		t.Errorf("GetItem(zz): want the older post, got %+v and %v", it, err)
+	}
+}
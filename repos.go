@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	repoCachLifeDuration = 6 * time.Hour
+	// repoRetryAfter is how long a repository GitHub didn't answer for is
+	// left alone, which is mostly the rate limit running out
+	repoRetryAfter = 30 * time.Minute
+	repoWorkers    = 4
+)
+
+// repo is the summary of a GitHub repository shown under the title of a
+// story linking to it.
+type repo struct {
+	// Name is owner/name
+	Name        string
+	Stars       int
+	Language    string
+	Description string
+}
+
+// ShortStars is the number of stars like GitHub shows it, 1.2k for 1234.
+func (r *repo) ShortStars() string {
+	switch {
+	case r.Stars >= 1000000:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(r.Stars)/1000000), ".0") + "m"
+	case r.Stars >= 1000:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(r.Stars)/1000), ".0") + "k"
+	}
+	return fmt.Sprint(r.Stars)
+}
+
+// repoCach holds the repositories of the stories linking to GitHub, from
+// its API, with -github_token if there is one for a higher rate limit.
+type repoCach struct {
+	repos map[string]cachedRepo
+	mutex sync.Mutex
+	// busy is held while repositories are fetched, refreshes that come
+	// along in the meantime leave theirs to the next batch
+	busy  sync.Mutex
+	token string
+}
+
+type cachedRepo struct {
+	// repo is nil for a repository that failed to load
+	repo       *repo
+	expiration time.Time
+}
+
+func newRepoCach(token string) *repoCach {
+	return &repoCach{repos: make(map[string]cachedRepo), token: token}
+}
+
+// githubReserved are the first path segments of github.com that are no
+// user or organization.
+var githubReserved = map[string]bool{
+	"about": true, "collections": true, "enterprise": true, "explore": true, "features": true,
+	"marketplace": true, "orgs": true, "pricing": true, "settings": true, "sponsors": true,
+	"topics": true, "trending": true,
+}
+
+// githubRepo returns the owner/name of the repository a story links to,
+// anywhere in it, empty if it doesn't link to one on GitHub.
+func githubRepo(s item) string {
+	if s.Host != "github.com" {
+		return ""
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] == "" || parts[1] == "" || githubReserved[strings.ToLower(parts[0])] {
+		return ""
+	}
+	return strings.ToLower(parts[0] + "/" + strings.TrimSuffix(parts[1], ".git"))
+}
+
+// annotate sets the Repo of the stories linking to a cached repository. The
+// missing and expired ones are fetched in the background, and show up on
+// the next refresh.
+func (c *repoCach) annotate(stories []item) {
+	var missing []string
+	now := time.Now()
+	c.mutex.Lock()
+	for i, s := range stories {
+		name := githubRepo(s)
+		if name == "" {
+			continue
+		}
+		cached, ok := c.repos[name]
+		if !ok || now.After(cached.expiration) {
+			missing = append(missing, name)
+		}
+		stories[i].Repo = cached.repo
+	}
+	c.mutex.Unlock()
+	if len(missing) == 0 || !c.busy.TryLock() {
+		return
+	}
+	go func() {
+		defer c.busy.Unlock()
+		c.fetchRepos(missing)
+		c.prune()
+	}()
+}
+
+func (c *repoCach) fetchRepos(names []string) {
+	next := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < repoWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range next {
+				cached := cachedRepo{expiration: time.Now().Add(repoCachLifeDuration)}
+				r, err := c.fetchRepo(name)
+				if err != nil {
+					cached.expiration = time.Now().Add(repoRetryAfter)
+				} else {
+					cached.repo = r
+				}
+				c.mutex.Lock()
+				c.repos[name] = cached
+				c.mutex.Unlock()
+			}
+		}()
+	}
+	for _, name := range names {
+		next <- name
+	}
+	close(next)
+	wg.Wait()
+}
+
+func (c *repoCach) fetchRepo(name string) (*repo, error) {
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github+json")
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
+	}
+	var r struct {
+		FullName    string `json:"full_name"`
+		Stars       int    `json:"stargazers_count"`
+		Language    string `json:"language"`
+		Description string `json:"description"`
+	}
+	if err := send(http.MethodGet, githubAPI+"/repos/"+name, "", header, nil, &r); err != nil {
+		return nil, fmt.Errorf("github repo %s: %w", name, err)
+	}
+	return &repo{Name: r.FullName, Stars: r.Stars, Language: r.Language, Description: r.Description}, nil
+}
+
+// prune drops the expired repositories.
+func (c *repoCach) prune() {
+	now := time.Now()
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for k, v := range c.repos {
+		if now.After(v.expiration) {
+			delete(c.repos, k)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGithubRepo(t *testing.T) {
+	tests := map[string]string{
+		"https://github.com/Golang/Go":                   "golang/go",
+		"https://www.github.com/a/b.git":                 "a/b",
+		"https://github.com/a/b/blob/main/README.md#top": "a/b",
+		"https://github.com/a":                           "",
+		"https://github.com/topics/go":                   "",
+		"https://gist.github.com/a/b":                    "",
+		"https://example.com/a/b":                        "",
+	}
+	for link, want := range tests {
+		if got := githubRepo(testStory(1, "Title", link, 1)); got != want {
+			t.Errorf("%s: want %q, got %q", link, want, got)
+		}
+	}
+}
+
+func TestRepo_ShortStars(t *testing.T) {
+	for stars, want := range map[int]string{7: "7", 1000: "1k", 1234: "1.2k", 2500000: "2.5m"} {
+		if got := (&repo{Stars: stars}).ShortStars(); got != want {
+			t.Errorf("%d: want %s, got %s", stars, want, got)
+		}
+	}
+}
+
+func TestRepoCach_Annotate(t *testing.T) {
+	github := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("authorization: want the token, got %q", got)
+		}
+		if r.URL.Path != "/repos/golang/go" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"full_name":"golang/go","stargazers_count":1234,"language":"Go","description":"The Go programming language"}`))
+	}))
+	defer github.Close()
+	old := githubAPI
+	githubAPI = github.URL
+	defer func() { githubAPI = old }()
+
+	c := newRepoCach("secret")
+	stories := []item{
+		testStory(1, "Go", "https://github.com/golang/go", 1),
+		testStory(2, "Gone", "https://github.com/gone/away", 1),
+		testStory(3, "Elsewhere", "https://example.com/golang/go", 1),
+	}
+	c.annotate(stories)
+	// the repositories are fetched in the background, for the next refresh
+	c.busy.Lock()
+	c.busy.Unlock()
+	if stories[0].Repo != nil {
+		t.Errorf("first refresh: want no repo yet, got %+v", stories[0].Repo)
+	}
+	c.annotate(stories)
+	if r := stories[0].Repo; r == nil || r.Name != "golang/go" || r.Stars != 1234 || r.Language != "Go" {
+		t.Errorf("second refresh: want golang/go, got %+v", r)
+	}
+	if stories[1].Repo != nil || stories[2].Repo != nil {
+		t.Errorf("other stories: want no repo, got %+v and %+v", stories[1].Repo, stories[2].Repo)
+	}
+}
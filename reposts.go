@@ -0,0 +1,57 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/neghoda/quiet_hn/archive"
+)
+
+// repost points to the earlier front page appearance of a story.
+type repost struct {
+	ID   int
+	Seen time.Time
+}
+
+// reposts finds stories that were on the front page before under another
+// ID.
+type reposts struct {
+	archive *archive.Store
+	window  time.Duration
+}
+
+// annotate marks the stories seen within the window before.
+func (r *reposts) annotate(stories []item) {
+	since := time.Now().Add(-r.window)
+	for i, s := range stories {
+		earlier, ok, err := r.archive.Earlier(s.ID, s.URL, s.Title, since)
+		if err != nil {
+			log.Printf("failed to look up reposts of %d: %s", s.ID, err)
+			return
+		}
+		if ok {
+			stories[i].Repost = &repost{ID: earlier.ID, Seen: earlier.LastSeen}
+		}
+	}
+}
+
+// record adds the stories of a cache refresh to the archive.
+func record(a *archive.Store, stories []item, at time.Time) {
+	seen := make([]archive.Story, len(stories))
+	for i, s := range stories {
+		seen[i] = archive.Story{
+			ID:       s.ID,
+			Type:     s.Type,
+			Title:    s.Title,
+			URL:      s.URL,
+			By:       s.By,
+			Posted:   s.Posted(),
+			Score:    s.Score,
+			Comments: s.Descendants,
+			Rank:     i + 1,
+		}
+	}
+	if err := a.Record(seen, at); err != nil {
+		log.Printf("failed to archive the front page: %s", err)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/neghoda/quiet_hn/archive"
+)
+
+// prune deletes what is past the retention from the archive, and vacuums
+// it at most every vacuumEvery, if that is not 0, once rows were pruned.
+// The last vacuum is kept in the archive, so restarts don't put it off. It
+// is the prune job of the scheduler.
+func prune(a *archive.Store, retention, vacuumEvery time.Duration) {
+	n, err := a.Prune(time.Now().Add(-retention))
+	if err != nil {
+		log.Printf("failed to prune the archive: %s", err)
+	} else if n > 0 {
+		log.Printf("pruned %d stories from the archive", n)
+	}
+	if vacuumEvery <= 0 {
+		return
+	}
+	vacuumed, pruned, err := a.Vacuumed()
+	if err != nil {
+		log.Printf("failed to look up the last vacuum of the archive: %s", err)
+	} else if pruned > 0 && time.Since(vacuumed) >= vacuumEvery {
+		if err := a.Vacuum(); err != nil {
+			log.Printf("failed to vacuum the archive: %s", err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// linkRewrites are the frontends of -rewrite_links, which parseHNItem sends
+// the links of their sites to. parseFlags sets them.
+var linkRewrites rewrites
+
+// rewrites map the domains of sites to the base URLs of frontends for them.
+type rewrites map[string]*url.URL
+
+// parseRewrites parses a list like "youtube.com=yewtu.be,
+// twitter.com=https://nitter.net", a frontend without a scheme is served
+// over https.
+func parseRewrites(list string) (rewrites, error) {
+	r := make(rewrites)
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		domain, frontend, ok := strings.Cut(entry, "=")
+		domain = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "www.")
+		frontend = strings.TrimSpace(frontend)
+		if !ok || domain == "" || frontend == "" {
+			return nil, fmt.Errorf("rewrite_links: %q is not a domain=frontend pair", entry)
+		}
+		if !strings.Contains(frontend, "://") {
+			frontend = "https://" + frontend
+		}
+		u, err := url.Parse(frontend)
+		if err != nil || u.Host == "" || u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("rewrite_links: %q is not the URL of a frontend", frontend)
+		}
+		u.Path = strings.TrimSuffix(u.Path, "/")
+		r[domain] = u
+	}
+	return r, nil
+}
+
+// rewrite returns a link to a site of r, or one of its subdomains, on its
+// frontend, with the same path and query. Other links are left as they are.
+func (r rewrites) rewrite(rawURL string) string {
+	if len(r) == 0 || rawURL == "" {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "http" && u.Scheme != "https" {
+		return rawURL
+	}
+	for host := strings.ToLower(u.Hostname()); host != ""; {
+		if frontend, ok := r[host]; ok {
+			u.Scheme, u.Host, u.User = frontend.Scheme, frontend.Host, nil
+			u.Path, u.RawPath = frontend.Path+u.Path, ""
+			return u.String()
+		}
+		i := strings.IndexByte(host, '.')
+		if i < 0 {
+			break
+		}
+		host = host[i+1:]
+	}
+	return rawURL
+}
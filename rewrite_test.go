@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/neghoda/quiet_hn/hn"
+)
+
+func TestRewrites(t *testing.T) {
+	r, err := parseRewrites("youtube.com=yewtu.be, www.twitter.com=http://nitter.example/, reddit.com=https://redlib.example/r/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ in, want string }{
+		{"https://www.youtube.com/watch?v=abc", "https://yewtu.be/watch?v=abc"},
+		{"https://m.youtube.com/watch?v=abc#t=1", "https://yewtu.be/watch?v=abc#t=1"},
+		{"https://twitter.com/user/status/1", "http://nitter.example/user/status/1"},
+		{"https://old.reddit.com/r/golang/", "https://redlib.example/r/r/golang/"},
+		{"https://notyoutube.com/watch", "https://notyoutube.com/watch"},
+		{"https://example.com/youtube.com", "https://example.com/youtube.com"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := r.rewrite(tt.in); got != tt.want {
+			t.Errorf("%s: want %s, got %s", tt.in, tt.want, got)
+		}
+	}
+	for _, list := range []string{"youtube.com", "=yewtu.be", "youtube.com=ftp://yewtu.be"} {
+		if _, err := parseRewrites(list); err == nil {
+			t.Errorf("%s: want an error", list)
+		}
+	}
+}
+
+func TestParseHNItem_Rewrite(t *testing.T) {
+	old := linkRewrites
+	t.Cleanup(func() { linkRewrites = old })
+	linkRewrites, _ = parseRewrites("youtube.com=yewtu.be")
+	i := parseHNItem(hn.Item{URL: "https://www.youtube.com/watch?v=abc&utm_source=hn"})
+	if i.URL != "https://yewtu.be/watch?v=abc" {
+		t.Errorf("url: want https://yewtu.be/watch?v=abc, got %s", i.URL)
+	}
+	if i.Host != "youtube.com" {
+		t.Errorf("host: want youtube.com, got %s", i.Host)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+const robotsPath = "/robots.txt"
+
+// crawlPaths are the pages there is nothing to index on, redirects and
+// pages of the visitor, which an indexed instance still keeps crawlers off.
+var crawlPaths = []string{adminPath, debugCachePath, outPath, shortPath, commentsPath, settingsPath, loginPath, bookmarksPath, "/img"}
+
+// noindex reports whether the instance asks search engines not to index it.
+func (cfg config) noindex() bool {
+	return cfg.Robots == "noindex"
+}
+
+// robotsTxt returns the robots.txt of the instance: the -robots_file, or
+// one disallowing the crawlPaths, or everything with -robots noindex.
+func (cfg config) robotsTxt() ([]byte, error) {
+	if cfg.RobotsFile != "" {
+		return os.ReadFile(cfg.RobotsFile)
+	}
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	if cfg.noindex() {
+		b.WriteString("Disallow: /\n")
+		return []byte(b.String()), nil
+	}
+	for _, p := range crawlPaths {
+		b.WriteString("Disallow: " + p + "\n")
+	}
+	return []byte(b.String()), nil
+}
+
+func robotsHandler(robots []byte) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		w.Write(robots)
+	})
+}
+
+// withNoindex tells search engines not to index or follow any response,
+// the ones robots.txt doesn't keep them from, like links from elsewhere,
+// and those that aren't pages, like the feeds.
+func withNoindex(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRobots(t *testing.T) {
+	index, err := config{Robots: "index"}.robotsTxt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(index), "Disallow: /admin\n") || strings.Contains(string(index), "Disallow: /\n") {
+		t.Errorf("index: want the admin disallowed and the rest allowed, got %q", index)
+	}
+	noindex, err := config{Robots: "noindex"}.robotsTxt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(noindex) != "User-agent: *\nDisallow: /\n" {
+		t.Errorf("noindex: want everything disallowed, got %q", noindex)
+	}
+	file := filepath.Join(t.TempDir(), "robots.txt")
+	if err := os.WriteFile(file, []byte("User-agent: GPTBot\nDisallow: /\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	custom, err := config{Robots: "noindex", RobotsFile: file}.robotsTxt()
+	if err != nil || string(custom) != "User-agent: GPTBot\nDisallow: /\n" {
+		t.Errorf("robots_file: want the file as it is, got %q, %v", custom, err)
+	}
+	if err := (config{Sources: "hn", NumStories: 1, Robots: "nofollow"}).validate(); err == nil {
+		t.Error("want an error for an unknown robots value")
+	}
+
+	rec := httptest.NewRecorder()
+	robotsHandler(noindex).ServeHTTP(rec, httptest.NewRequest("GET", robotsPath, nil))
+	if rec.Body.String() != string(noindex) || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("want robots.txt as plain text, got %q as %q", rec.Body.String(), rec.Header().Get("Content-Type"))
+	}
+
+	rec = httptest.NewRecorder()
+	withNoindex(http.NotFoundHandler()).ServeHTTP(rec, httptest.NewRequest("GET", "/rss", nil))
+	if got := rec.Header().Get("X-Robots-Tag"); got != "noindex, nofollow" {
+		t.Errorf("want X-Robots-Tag on every response, got %q", got)
+	}
+
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, robots := range []string{"index", "noindex"} {
+		cfg := config{Lang: "en", CookieSecret: "secret", Robots: robots}
+		rec := httptest.NewRecorder()
+		data := templateData{pageData: cfg.pageData(httptest.NewRequest("GET", "/", nil), time.Now())}
+		if err := tpls.execute(rec, "index.gohtml", data); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Contains(rec.Body.String(), `<meta name="robots" content="noindex, nofollow">`); got != (robots == "noindex") {
+			t.Errorf("%s: want the robots meta tag %t, got %t", robots, robots == "noindex", got)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/neghoda/quiet_hn/cron"
+)
+
+// scheduler runs the background jobs of the server, each on its own cron
+// schedule, until it is stopped. A job doesn't run twice at the same time,
+// if it is still busy when due again it runs at the next time after.
+type scheduler struct {
+	jobs []*job
+	stop chan struct{}
+	wg   sync.WaitGroup
+	// mutex guards the schedules of the jobs, which can change while they
+	// run
+	mutex sync.Mutex
+}
+
+type job struct {
+	name     string
+	schedule *cron.Schedule
+	// rescheduled wakes the loop of the job up when its schedule changed
+	rescheduled chan struct{}
+	// atStart runs the job as soon as the scheduler starts too
+	atStart bool
+	// run is given the time the job was due at
+	run func(at time.Time)
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{stop: make(chan struct{})}
+}
+
+// add adds a job, before the scheduler is started.
+func (s *scheduler) add(name string, schedule *cron.Schedule, atStart bool, run func(at time.Time)) {
+	s.jobs = append(s.jobs, &job{name: name, schedule: schedule, rescheduled: make(chan struct{}, 1), atStart: atStart, run: run})
+}
+
+// reschedule puts the job called name on a new schedule, from its next run
+// on. It reports whether there is such a job.
+func (s *scheduler) reschedule(name string, schedule *cron.Schedule) bool {
+	for _, j := range s.jobs {
+		if j.name != name {
+			continue
+		}
+		s.mutex.Lock()
+		j.schedule = schedule
+		s.mutex.Unlock()
+		select {
+		case j.rescheduled <- struct{}{}:
+		default:
+		}
+		return true
+	}
+	return false
+}
+
+func (s *scheduler) start() {
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(j)
+	}
+}
+
+func (s *scheduler) loop(j *job) {
+	defer s.wg.Done()
+	if j.atStart {
+		j.run(time.Now())
+	}
+	for {
+		s.mutex.Lock()
+		schedule := j.schedule
+		s.mutex.Unlock()
+		next := schedule.Next(time.Now())
+		if next.IsZero() {
+			log.Printf("the schedule %s of %s never fires", schedule, j.name)
+			// a new schedule may fire
+			select {
+			case <-s.stop:
+				return
+			case <-j.rescheduled:
+				continue
+			}
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-j.rescheduled:
+			timer.Stop()
+		case <-timer.C:
+			j.run(next)
+		}
+	}
+}
+
+// shutdown stops scheduling jobs and waits for the running ones to finish,
+// or for ctx to be done.
+func (s *scheduler) shutdown(ctx context.Context) error {
+	close(s.stop)
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
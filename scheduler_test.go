@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/neghoda/quiet_hn/cron"
+)
+
+func TestScheduler(t *testing.T) {
+	s := newScheduler()
+	started, finished := make(chan bool, 1), make(chan bool, 1)
+	s.add("slow", cron.Every(time.Hour), true, func(time.Time) {
+		started <- true
+		time.Sleep(50 * time.Millisecond)
+		finished <- true
+	})
+	ran := false
+	s.add("later", cron.Every(time.Hour), false, func(time.Time) { ran = true })
+	s.start()
+	<-started
+
+	// shutdown waits for the job that is running
+	if err := s.shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %s", err)
+	}
+	select {
+	case <-finished:
+	default:
+		t.Errorf("shutdown: want the running job finished")
+	}
+	if ran {
+		t.Errorf("later: want it not run before it is due")
+	}
+}
+
+func TestScheduler_ShutdownTimeout(t *testing.T) {
+	s := newScheduler()
+	started := make(chan bool)
+	s.add("stuck", cron.Every(time.Hour), true, func(time.Time) {
+		started <- true
+		time.Sleep(time.Second)
+	})
+	s.start()
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("shutdown: want %v, got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestScheduler_Reschedule(t *testing.T) {
+	s := newScheduler()
+	ran := make(chan bool, 1)
+	s.add("job", cron.Every(time.Hour), false, func(time.Time) {
+		select {
+		case ran <- true:
+		default:
+		}
+	})
+	s.start()
+	defer s.shutdown(context.Background())
+	if s.reschedule("nope", cron.Every(time.Millisecond)) {
+		t.Errorf("nope: want no such job")
+	}
+	if !s.reschedule("job", cron.Every(10*time.Millisecond)) {
+		t.Fatalf("job: want it rescheduled")
+	}
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Errorf("job: want it run on the new schedule")
+	}
+}
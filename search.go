@@ -0,0 +1,130 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neghoda/quiet_hn/archive"
+)
+
+const searchPath = "/archive/search"
+
+const (
+	// maxIndexedText caps the article text kept for searches, the start of
+	// an article is where most of what it is about is
+	maxIndexedText = 20000
+	// indexedFor is how long a story that was indexed is remembered, well
+	// past the time stories spend on the front page
+	indexedFor = 7 * 24 * time.Hour
+)
+
+type searchTemplateData struct {
+	Query   string
+	Stories []item
+	pageData
+}
+
+// searchHandler finds stories in the archive by their title or text, at
+// /archive/search?q=.
+func searchHandler(a *archive.Store, cfg config, tpls *templates) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		data := searchTemplateData{Query: strings.TrimSpace(r.URL.Query().Get("q"))}
+		if data.Query != "" {
+			results, err := a.Search(data.Query, cfg.NumStories)
+			if err != nil {
+				http.Error(w, "Failed to search the archive", http.StatusInternalServerError)
+				return
+			}
+			for i, res := range results {
+				it := archivedItem(res.Story, i+1)
+				it.Description = res.Snippet
+				data.Stories = append(data.Stories, it)
+			}
+		}
+		data.pageData = cfg.pageData(r, start)
+		// results are shown like cards, with the matching text as
+		// description and their age
+		data.Cards = true
+		err := tpls.execute(w, "search.gohtml", data)
+		if err != nil {
+			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// textIndexer fetches the articles of new stories in the background and
+// adds their text to the search index of the archive.
+type textIndexer struct {
+	archive *archive.Store
+	read    *readCach
+	// busy is held while a batch is fetched, refreshes that come along in
+	// the meantime leave their stories to the next one
+	busy  sync.Mutex
+	mutex sync.Mutex
+	// done is when each story was indexed
+	done map[int]time.Time
+}
+
+func newTextIndexer(a *archive.Store, maxBytes int64) *textIndexer {
+	return &textIndexer{
+		archive: a,
+		read:    &readCach{maxBytes: maxBytes, client: newReadClient()},
+		done:    make(map[int]time.Time),
+	}
+}
+
+// index starts fetching the articles of the stories that were not indexed
+// yet, unless it is still busy with the last ones.
+func (x *textIndexer) index(stories []item) {
+	var todo []item
+	now := time.Now()
+	x.mutex.Lock()
+	for id, t := range x.done {
+		if now.Sub(t) > indexedFor {
+			delete(x.done, id)
+		}
+	}
+	for _, s := range stories {
+		if _, ok := x.done[s.ID]; s.URL != "" && !ok {
+			todo = append(todo, s)
+		}
+	}
+	x.mutex.Unlock()
+	if len(todo) == 0 || !x.busy.TryLock() {
+		return
+	}
+	go func() {
+		defer x.busy.Unlock()
+		for _, s := range todo {
+			x.indexStory(s)
+		}
+	}()
+}
+
+func (x *textIndexer) indexStory(s item) {
+	// a story is only tried once, pages that fail to load rarely get better
+	x.mutex.Lock()
+	x.done[s.ID] = time.Now()
+	x.mutex.Unlock()
+	target, err := url.Parse(s.URL)
+	if err != nil {
+		return
+	}
+	article, err := x.read.fetchArticle(target)
+	if err != nil {
+		return
+	}
+	text := article.Text
+	if len(text) > maxIndexedText {
+		text = strings.ToValidUTF8(text[:maxIndexedText], "")
+	}
+	if err := x.archive.SetText(s.ID, text); err != nil {
+		log.Printf("failed to index the text of %d: %s", s.ID, err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/cgi"
+	"net/http/fcgi"
+	"os"
+)
+
+// modes are the values of -mode, the ways requests reach quiet_hn: http
+// listens on -port, fcgi takes FastCGI requests on -port or, with -port 0,
+// on the socket the web server passes as stdin, cgi serves the one request
+// of a CGI process and lambda the invocations of AWS Lambda function URLs
+// and HTTP APIs.
+var modes = []string{"http", "fcgi", "cgi", "lambda"}
+
+// server serves requests the way -mode says until it is stopped.
+type server struct {
+	// serve blocks until the server fails or, for cgi, the request is
+	// served
+	serve func() error
+	// stop lets the requests in progress finish
+	stop func(ctx context.Context) error
+}
+
+func newServer(cfg config, h http.Handler) (server, error) {
+	switch cfg.Mode {
+	case "fcgi":
+		var l net.Listener
+		if cfg.Port != 0 {
+			var err error
+			if l, err = net.Listen("tcp", fmt.Sprintf(":%d", cfg.Port)); err != nil {
+				return server{}, err
+			}
+		}
+		return server{
+			serve: func() error { return fcgi.Serve(l, h) },
+			stop: func(context.Context) error {
+				if l == nil {
+					return os.Stdin.Close()
+				}
+				return l.Close()
+			},
+		}, nil
+	case "cgi":
+		return server{
+			serve: func() error { return cgi.Serve(h) },
+			stop:  func(context.Context) error { return nil },
+		}, nil
+	case "lambda":
+		api := os.Getenv("AWS_LAMBDA_RUNTIME_API")
+		if api == "" {
+			return server{}, errors.New("-mode lambda needs $AWS_LAMBDA_RUNTIME_API, which Lambda sets")
+		}
+		return server{
+			serve: func() error { return serveLambda(api, h) },
+			// Lambda freezes the process between invocations, there
+			// is nothing in progress to wait for
+			stop: func(context.Context) error { return nil },
+		}, nil
+	}
+	s := &http.Server{Addr: fmt.Sprintf(":%d", cfg.Port), Handler: h}
+	return server{
+		serve: func() error {
+			if err := s.ListenAndServe(); err != http.ErrServerClosed {
+				return err
+			}
+			return nil
+		},
+		stop: s.Shutdown,
+	}, nil
+}
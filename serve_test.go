@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestServer_CGI(t *testing.T) {
+	for k, v := range map[string]string{
+		"GATEWAY_INTERFACE": "CGI/1.1",
+		"REQUEST_METHOD":    "GET",
+		"SERVER_PROTOCOL":   "HTTP/1.1",
+		"HTTP_HOST":         "example.com",
+		"REQUEST_URI":       "/hello?name=go",
+		"SCRIPT_NAME":       "",
+	} {
+		t.Setenv(k, v)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	s, err := newServer(config{Mode: "cgi"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hi "+r.URL.Query().Get("name"))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the request is served and the process can go
+	if err := s.serve(); err != nil {
+		t.Fatalf("serve() received an error: %s", err.Error())
+	}
+	w.Close()
+	out, _ := io.ReadAll(r)
+	if !strings.HasPrefix(string(out), "Status: 200 OK\r\n") || !strings.HasSuffix(string(out), "\r\n\r\nhi go") {
+		t.Errorf("cgi: want the response on stdout, got %q", out)
+	}
+}
+
+func TestServer_Stop(t *testing.T) {
+	// -port 0 would take the FastCGI socket of the web server on stdin
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	for _, mode := range []string{"http", "fcgi"} {
+		s, err := newServer(config{Mode: mode, Port: port}, http.NotFoundHandler())
+		if err != nil {
+			t.Fatalf("%s: %s", mode, err)
+		}
+		served := make(chan error, 1)
+		go func() { served <- s.serve() }()
+		if err := s.stop(context.Background()); err != nil {
+			t.Errorf("%s: stop() received an error: %s", mode, err.Error())
+		}
+		<-served
+	}
+	t.Setenv("AWS_LAMBDA_RUNTIME_API", "")
+	if _, err := newServer(config{Mode: "lambda"}, http.NotFoundHandler()); err == nil {
+		t.Error("lambda outside of Lambda: want an error")
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	settingsPath   = "/settings"
+	settingsCookie = "settings"
+
+	// maxSettingsEntries caps the muted domains and words, and
+	// maxSettingsCookie the encoded cookie, which browsers silently drop
+	// past 4KB
+	maxSettingsEntries = 50
+	maxSettingsCookie  = 3800
+
+	// settingsVersion is the version of the settings cookie written, it
+	// comes first in the cookie so older ones can be read on
+	settingsVersion = 2
+)
+
+// themes are the color schemes a visitor can pick, the empty one is the
+// default light scheme. The styledThemes come with a stylesheet.
+var themes = []string{"", "dark", "auto", "contrast", "large", "dyslexic"}
+
+// sortOrders are the orders a visitor can pick for the front page, the empty
+// one keeps the order of the instance.
+var sortOrders = []string{"", "score", "comments", "new"}
+
+// settings are the preferences of a visitor. They are kept in a cookie that
+// is signed with -cookie_secret, so they are applied on top of the shared
+// cache without having to be stored on the server.
+type settings struct {
+	MutedDomains []string `json:"d,omitempty"`
+	MutedWords   []string `json:"w,omitempty"`
+	MinScore     int      `json:"s,omitempty"`
+	Theme        string   `json:"t,omitempty"`
+	// NumStories shows fewer stories than the instance does, 0 all of them
+	NumStories int `json:"n,omitempty"`
+	// Sort is one of sortOrders
+	Sort string `json:"o,omitempty"`
+	// Feeds applies the settings to the feeds too, through feed links that
+	// carry them
+	Feeds bool `json:"f,omitempty"`
+	// TimeZone is the IANA time zone the times are shown in, empty for the
+	// one of the instance
+	TimeZone string `json:"z,omitempty"`
+}
+
+type settingsTemplateData struct {
+	Settings   settings
+	Themes     []string
+	SortOrders []string
+	// MaxStories is the number of stories the instance shows
+	MaxStories int
+	// InstanceZone is the time zone of the instance, shown for an empty one
+	InstanceZone string
+	// Error is the entry that could not be saved, if any
+	Error string
+	// TooLarge is set when the settings don't fit in a cookie
+	TooLarge bool
+	pageData
+}
+
+// empty reports whether s filters nothing.
+func (s settings) empty() bool {
+	return len(s.MutedDomains) == 0 && len(s.MutedWords) == 0 && s.MinScore <= 0
+}
+
+// unset reports whether s is all defaults, so there is no cookie to keep.
+func (s settings) unset() bool {
+	return s.empty() && s.Theme == "" && s.NumStories == 0 && s.Sort == "" && !s.Feeds && s.TimeZone == ""
+}
+
+// filters returns the filters described by s. The mute words were checked
+// when the settings were saved, so entries that don't compile are skipped.
+func (s settings) filters() *filters {
+	// job ads in the shared cache are there because the instance shows them
+	f := &filters{blockedDomains: make(map[string]bool), minScore: s.MinScore, showJobs: true}
+	for _, d := range s.MutedDomains {
+		f.blockDomain(d)
+	}
+	for _, w := range s.MutedWords {
+		if re, err := compileMute(w); err == nil {
+			f.muted = append(f.muted, re)
+		}
+	}
+	return f
+}
+
+// settings returns the settings of the visitor, or the zero value if the
+// cookie is missing or was not signed by us. Feed readers don't keep cookies,
+// so the settings can come in the ?settings= query of a feed link as well.
+func (cfg config) settings(r *http.Request) settings {
+	if a := sessionOf(r); a != nil {
+		return a.settings
+	}
+	value := r.URL.Query().Get(settingsCookie)
+	if cookie, err := r.Cookie(settingsCookie); err == nil {
+		value = cookie.Value
+	}
+	s, _ := cfg.decodeSettings(value)
+	return s
+}
+
+// decodeSettings reads a signed cookie value. Cookies from before versions
+// were written are version 1, which has a part of the fields of version 2 and
+// reads the same.
+func (cfg config) decodeSettings(value string) (settings, bool) {
+	var s settings
+	i := strings.LastIndexByte(value, '.')
+	if i < 0 || !hmac.Equal([]byte(value[i+1:]), []byte(cfg.sign(value[:i]))) {
+		return s, false
+	}
+	payload, version := value[:i], 1
+	if v, rest, ok := strings.Cut(payload, "."); ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return s, false
+		}
+		payload, version = rest, n
+	}
+	if version > settingsVersion {
+		return s, false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return settings{}, false
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return settings{}, false
+	}
+	return s, true
+}
+
+func (cfg config) sign(payload string) string {
+	mac := hmac.New(sha256.New, []byte(cfg.CookieSecret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (cfg config) saveSettings(w http.ResponseWriter, r *http.Request, s settings) {
+	cookie := &http.Cookie{
+		Name:     settingsCookie,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if s.unset() {
+		cookie.MaxAge = -1
+	} else {
+		cookie.Value = cfg.encodeSettings(s)
+		cookie.Expires = time.Now().AddDate(1, 0, 0)
+	}
+	http.SetCookie(w, cookie)
+}
+
+// encodeSettings returns the signed cookie value of s, like
+// "2.<base64 JSON>.<signature>".
+func (cfg config) encodeSettings(s settings) string {
+	b, _ := json.Marshal(s)
+	payload := strconv.Itoa(settingsVersion) + "." + base64.RawURLEncoding.EncodeToString(b)
+	return payload + "." + cfg.sign(payload)
+}
+
+// feedQuery returns the query of the feed links that carry the settings of
+// the visitor, if they asked for it.
+func (cfg config) feedQuery(s settings) string {
+	if !s.Feeds {
+		return ""
+	}
+	return "?" + url.Values{settingsCookie: {cfg.encodeSettings(s)}}.Encode()
+}
+
+// randomSecret returns a key for signing cookies, for when -cookie_secret is
+// not set.
+func randomSecret() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// settingsHandler shows the settings form and saves it.
+func settingsHandler(cfg config, tpls *templates) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		data := settingsTemplateData{Settings: cfg.settings(r), Themes: themes, SortOrders: sortOrders, MaxStories: cfg.NumStories}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost:
+			if !sameOrigin(r) {
+				http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+				return
+			}
+			s, bad := parseSettings(r)
+			if r.PostFormValue("reset") != "" {
+				s, bad = settings{}, ""
+			}
+			// profiles are held to the size of a cookie too, feed links
+			// carry the settings
+			tooLarge := len(cfg.encodeSettings(s)) > maxSettingsCookie
+			if bad == "" && !tooLarge {
+				if a := sessionOf(r); a != nil {
+					if err := cfg.saveProfileSettings(a, s); err != nil {
+						log.Printf("failed to save the settings of %s: %s", a.user.Name, err)
+						http.Error(w, "Failed to save the settings", http.StatusInternalServerError)
+						return
+					}
+				} else {
+					cfg.saveSettings(w, r, s)
+				}
+				http.Redirect(w, r, "/", http.StatusSeeOther)
+				return
+			}
+			data.Settings, data.Error, data.TooLarge = s, bad, tooLarge
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		data.pageData = cfg.pageData(r, start)
+		data.Theme = data.Settings.Theme
+		data.Zone = cfg.zone(data.Settings)
+		data.InstanceZone = time.Now().In(cfg.zone(settings{})).Format("MST, -07:00")
+		err := tpls.execute(w, "settings.gohtml", data)
+		if err != nil {
+			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// parseSettings reads the settings form. If a muted word does not compile it
+// is returned along with the settings, so the form can be shown again.
+func parseSettings(r *http.Request) (settings, string) {
+	s := settings{
+		MutedDomains: formLines(r.PostFormValue("domains")),
+		MutedWords:   formLines(r.PostFormValue("words")),
+	}
+	s.MinScore, _ = strconv.Atoi(strings.TrimSpace(r.PostFormValue("min_score")))
+	if s.MinScore < 0 {
+		s.MinScore = 0
+	}
+	s.NumStories, _ = strconv.Atoi(strings.TrimSpace(r.PostFormValue("num_stories")))
+	if s.NumStories < 0 {
+		s.NumStories = 0
+	}
+	for _, t := range themes {
+		if r.PostFormValue("theme") == t {
+			s.Theme = t
+		}
+	}
+	for _, o := range sortOrders {
+		if r.PostFormValue("sort") == o {
+			s.Sort = o
+		}
+	}
+	s.Feeds = r.PostFormValue("feeds") != ""
+	// a zone that doesn't exist is dropped like a number out of range
+	if tz := strings.TrimSpace(r.PostFormValue("tz")); tz != "" {
+		if _, err := loadZone(tz); err == nil {
+			s.TimeZone = tz
+		}
+	}
+	for _, w := range s.MutedWords {
+		if _, err := compileMute(w); err != nil {
+			return s, w
+		}
+	}
+	return s, ""
+}
+
+// formLines returns the trimmed, non-empty lines of a textarea.
+func formLines(v string) []string {
+	var lines []string
+	for _, line := range strings.Split(v, "\n") {
+		if line = strings.TrimSpace(line); line != "" && len(lines) < maxSettingsEntries {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// sameOrigin reports whether a form was posted from this site. Browsers send
+// Origin with every POST, requests without one don't come from a browser.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// withSettings returns a request carrying the cookie of the response.
+func withSettings(rec *httptest.ResponseRecorder) *http.Request {
+	r := httptest.NewRequest("GET", "/", nil)
+	for _, c := range rec.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	return r
+}
+
+func TestConfig_Settings(t *testing.T) {
+	cfg := config{CookieSecret: "secret"}
+	want := settings{MutedDomains: []string{"example.com"}, MutedWords: []string{"crypto"}, MinScore: 10, Theme: "dark", NumStories: 10, Sort: "comments", Feeds: true}
+	rec := httptest.NewRecorder()
+	cfg.saveSettings(rec, httptest.NewRequest("POST", "/settings", nil), want)
+	if got := cfg.settings(withSettings(rec)); !reflect.DeepEqual(got, want) {
+		t.Errorf("round trip: want %+v, got %+v", want, got)
+	}
+
+	value := rec.Result().Cookies()[0].Value
+	i := strings.LastIndexByte(value, '.')
+	payload, sig := value[:i], value[i+1:]
+	other := cfg.encodeSettings(settings{MinScore: 1000})
+	otherPayload := other[:strings.LastIndexByte(other, '.')]
+	_, b64, _ := strings.Cut(payload, ".")
+	tests := []struct {
+		name  string
+		cfg   config
+		value string
+	}{
+		{"tampered payload", cfg, otherPayload + "." + sig},
+		{"tampered signature", cfg, payload + "." + strings.ToUpper(sig)},
+		{"no signature", cfg, payload},
+		{"wrong secret", config{CookieSecret: "other"}, value},
+		{"newer version", cfg, "3." + b64 + "." + cfg.sign("3."+b64)},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.AddCookie(&http.Cookie{Name: settingsCookie, Value: tt.value})
+		if got := tt.cfg.settings(r); !reflect.DeepEqual(got, settings{}) {
+			t.Errorf("%s: want no settings, got %+v", tt.name, got)
+		}
+	}
+}
+
+func TestConfig_Settings_Versions(t *testing.T) {
+	cfg := config{CookieSecret: "secret"}
+	// the cookies written before they had a version
+	v1 := base64.RawURLEncoding.EncodeToString([]byte(`{"d":["example.com"],"t":"dark"}`))
+	r := httptest.NewRequest("GET", "/", nil)
+	r.AddCookie(&http.Cookie{Name: settingsCookie, Value: v1 + "." + cfg.sign(v1)})
+	want := settings{MutedDomains: []string{"example.com"}, Theme: "dark"}
+	if got := cfg.settings(r); !reflect.DeepEqual(got, want) {
+		t.Errorf("version 1: want %+v, got %+v", want, got)
+	}
+
+	want = settings{Sort: "new", Feeds: true}
+	query := cfg.feedQuery(want)
+	r = httptest.NewRequest("GET", "/rss"+query, nil)
+	if got := cfg.settings(r); !reflect.DeepEqual(got, want) {
+		t.Errorf("feed query: want %+v, got %+v", want, got)
+	}
+	if got := cfg.feedQuery(settings{Sort: "new"}); got != "" {
+		t.Errorf("feed query without feeds: want none, got %q", got)
+	}
+}
+
+func TestView_Apply_Settings(t *testing.T) {
+	stories := []item{testStory(1, "a", "https://a.example.com", 10), testStory(2, "b", "https://b.example.com", 30), testStory(3, "c", "https://c.example.com", 20)}
+	stories[0].Descendants, stories[1].Descendants, stories[2].Descendants = 5, 1, 9
+	tests := []struct {
+		name       string
+		numStories int
+		sort       string
+		want       []int
+	}{
+		{"defaults", 0, "", []int{1, 2, 3}},
+		{"fewer stories", 2, "", []int{1, 2}},
+		{"more than the instance", 10, "", []int{1, 2, 3}},
+		{"by score", 0, "score", []int{2, 3, 1}},
+		{"by comments", 0, "comments", []int{3, 1, 2}},
+		{"first two by score", 2, "score", []int{2, 1}},
+	}
+	for _, tt := range tests {
+		v := view{numStories: tt.numStories, sort: tt.sort}
+		got := v.apply(stories, 3)
+		var ids []int
+		for i, s := range got {
+			ids = append(ids, s.ID)
+			if s.Rank != i+1 {
+				t.Errorf("%s: want rank %d, got %d", tt.name, i+1, s.Rank)
+			}
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("%s: want %v, got %v", tt.name, tt.want, ids)
+		}
+	}
+}
+
+func TestSettingsHandler(t *testing.T) {
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{CookieSecret: "secret", Lang: "en"}
+	post := func(form url.Values, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "http://example.com/settings", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		rec := httptest.NewRecorder()
+		settingsHandler(cfg, tpls)(rec, r)
+		return rec
+	}
+
+	rec := post(url.Values{"domains": {"example.com\n\n  www.test.org "}}, "http://example.com")
+	if rec.Code != http.StatusSeeOther {
+		t.Errorf("status: want %d, got %d", http.StatusSeeOther, rec.Code)
+	}
+	want := []string{"example.com", "www.test.org"}
+	if got := cfg.settings(withSettings(rec)).MutedDomains; !reflect.DeepEqual(got, want) {
+		t.Errorf("domains: want %v, got %v", want, got)
+	}
+
+	if rec := post(url.Values{"domains": {"example.com"}}, "http://evil.example"); rec.Code != http.StatusForbidden {
+		t.Errorf("cross origin status: want %d, got %d", http.StatusForbidden, rec.Code)
+	}
+
+	long := strings.Repeat(strings.Repeat("x", 200)+"\n", 30)
+	rec = post(url.Values{"words": {long}}, "")
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("too large status: want %d, got %d", http.StatusBadRequest, rec.Code)
+	}
+	if len(rec.Result().Cookies()) != 0 {
+		t.Errorf("too large: want no cookie, got %v", rec.Result().Cookies())
+	}
+	if !strings.Contains(rec.Body.String(), "too long to be saved") {
+		t.Errorf("too large: want the error in the form")
+	}
+}
+
+func TestConfig_Zone(t *testing.T) {
+	if _, err := time.LoadLocation("Asia/Tokyo"); err != nil {
+		t.Skip("no time zone database:", err)
+	}
+	cfg := config{CookieSecret: "secret", TZ: "Europe/Berlin"}
+	form := func(tz string) *http.Request {
+		r := httptest.NewRequest("POST", "/settings", strings.NewReader(url.Values{"tz": {tz}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return r
+	}
+	tests := []struct{ tz, want string }{
+		{"Asia/Tokyo", "Asia/Tokyo"},
+		{"", "Europe/Berlin"},
+		// dropped
+		{"Mars/Olympus_Mons", "Europe/Berlin"},
+	}
+	for _, tt := range tests {
+		s, _ := parseSettings(form(tt.tz))
+		rec := httptest.NewRecorder()
+		cfg.saveSettings(rec, httptest.NewRequest("POST", "/settings", nil), s)
+		d := cfg.pageData(withSettings(rec), time.Now())
+		if got := d.Zone.String(); got != tt.want {
+			t.Errorf("%q: want %s, got %s", tt.tz, tt.want, got)
+		}
+	}
+	d := pageData{Zone: cfg.zone(settings{TimeZone: "Asia/Tokyo"})}
+	if got := d.Local(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)).Format("15:04 MST"); got != "09:00 JST" {
+		t.Errorf("Local: want 09:00 JST, got %s", got)
+	}
+	if err := (config{NumStories: 1, Sources: "hn", TZ: "Nowhere/Town"}).validate(); err == nil || !strings.HasPrefix(err.Error(), "tz:") {
+		t.Errorf("validate: want an error for an unknown -tz, got %v", err)
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"http://example.com", true},
+		{"https://example.com", true},
+		{"http://example.com.evil.org", false},
+		{"http://evil.org", false},
+		{"null", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("POST", "http://example.com/settings", nil)
+		if tt.origin != "" {
+			r.Header.Set("Origin", tt.origin)
+		}
+		if got := sameOrigin(r); got != tt.want {
+			t.Errorf("sameOrigin(%q): want %v, got %v", tt.origin, tt.want, got)
+		}
+	}
+}
+
+func TestThemeStyles(t *testing.T) {
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{CookieSecret: "secret", Lang: "en"}
+	for _, theme := range themes {
+		rec := httptest.NewRecorder()
+		cfg.saveSettings(rec, httptest.NewRequest("POST", "/settings", nil), settings{Theme: theme})
+		page := httptest.NewRecorder()
+		settingsHandler(cfg, tpls)(page, withSettings(rec))
+		link := `<link rel="stylesheet" href="/themes/` + theme + `.css?v=`
+		if got, want := strings.Contains(page.Body.String(), link), slices.Contains(styledThemes, theme); got != want {
+			t.Errorf("%q: want a stylesheet %t, got %t", theme, want, got)
+		}
+		if theme == "" {
+			continue
+		}
+		if !strings.Contains(page.Body.String(), `<option value="`+theme+`" selected>`) {
+			t.Errorf("%q: want it selected in the settings", theme)
+		}
+	}
+
+	h := themesHandler()
+	for path, code := range map[string]int{"/themes/contrast.css": http.StatusOK, "/themes/dyslexic.css": http.StatusOK, "/themes/dark.css": http.StatusNotFound, "/themes/": http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != code {
+			t.Errorf("%s: want %d, got %d", path, code, rec.Code)
+		}
+		if code == http.StatusOK && rec.Header().Get("Content-Type") != "text/css; charset=utf-8" {
+			t.Errorf("%s: want a stylesheet, got %s", path, rec.Header().Get("Content-Type"))
+		}
+	}
+}
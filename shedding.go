@@ -0,0 +1,86 @@
+package main
+
+import (
+	"log"
+	"time"
+)
+
+// maxFailedItems is the share of failed item requests from which a refresh
+// counts as failing.
+const maxFailedItems = 0.2
+
+// fetchStats counts the item requests of a fetch.
+type fetchStats struct {
+	requests int
+	failed   int
+	// filtered counts the items the filters left out, retries the times
+	// an item was asked for again
+	filtered int
+	retries  int
+	// latency is how long the list of stories took to come, slowest the
+	// item that took longest, and duration the whole fetch
+	latency  time.Duration
+	slowest  time.Duration
+	duration time.Duration
+}
+
+// shedder backs off from the HN API while it is slow or failing: refreshes
+// come further apart, each one fetches no more stories than shown, and the
+// stories of the last good refresh are served meanwhile. The first healthy
+// refresh ends it.
+type shedder struct {
+	// latency is how long a refresh may take before it counts as slow,
+	// maxInterval how far apart refreshes get at most
+	latency     time.Duration
+	maxInterval time.Duration
+
+	// degraded counts the refreshes in a row that were slow or failed, it
+	// and retryAt are guarded by cachMutex
+	degraded int
+	retryAt  time.Time
+}
+
+// overfetch returns how many stories more than numStories a refresh
+// fetches, to fill the gaps visitors' own filters leave.
+func (s *shedder) overfetch(numStories int) int {
+	if s != nil && s.degraded > 0 {
+		return 0
+	}
+	return numStories / 2
+}
+
+// waiting reports if refreshes are put off until the API recovers.
+func (s *shedder) waiting(now time.Time) bool {
+	return s != nil && now.Before(s.retryAt)
+}
+
+// record takes the outcome of a refresh and returns how long its stories
+// are served, and if it failed so the stories that are there should stay.
+func (s *shedder) record(took time.Duration, stats fetchStats, err error, lifeDuration time.Duration) (time.Duration, bool) {
+	failing := err != nil || stats.requests > 0 && float64(stats.failed) > maxFailedItems*float64(stats.requests)
+	if s == nil {
+		return lifeDuration, err != nil
+	}
+	if !failing && took <= s.latency {
+		if s.degraded > 0 {
+			log.Printf("the HN API recovered after %d degraded refreshes", s.degraded)
+		}
+		s.degraded, s.retryAt = 0, time.Time{}
+		return lifeDuration, false
+	}
+	s.degraded++
+	interval := lifeDuration << min(s.degraded, 16)
+	if interval > s.maxInterval {
+		interval = s.maxInterval
+	}
+	s.retryAt = time.Now().Add(interval)
+	switch {
+	case err != nil:
+		log.Printf("refresh failed, retrying in %s: %s", interval, err)
+	case failing:
+		log.Printf("refresh lost %d of %d items, retrying in %s", stats.failed, stats.requests, interval)
+	default:
+		log.Printf("refresh took %s, refreshing every %s until the HN API is faster", took.Round(time.Millisecond), interval)
+	}
+	return interval, failing
+}
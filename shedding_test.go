@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/neghoda/quiet_hn/hn"
+)
+
+func TestShedder_Record(t *testing.T) {
+	s := &shedder{latency: time.Second, maxInterval: time.Minute}
+	life := 10 * time.Second
+
+	if d, failed := s.record(time.Millisecond, fetchStats{requests: 10}, nil, life); d != life || failed {
+		t.Errorf("healthy refresh: want %v false, got %v %v", life, d, failed)
+	}
+	if n := s.overfetch(30); n != 15 {
+		t.Errorf("healthy overfetch: want 15, got %d", n)
+	}
+
+	if d, failed := s.record(2*time.Second, fetchStats{requests: 10}, nil, life); d != 20*time.Second || failed {
+		t.Errorf("slow refresh: want 20s false, got %v %v", d, failed)
+	}
+	if !s.waiting(time.Now()) {
+		t.Errorf("waiting after a slow refresh: want true, got false")
+	}
+	if n := s.overfetch(30); n != 0 {
+		t.Errorf("degraded overfetch: want 0, got %d", n)
+	}
+	if d, failed := s.record(time.Millisecond, fetchStats{requests: 10, failed: 3}, nil, life); d != 40*time.Second || !failed {
+		t.Errorf("lossy refresh: want 40s true, got %v %v", d, failed)
+	}
+	if d, failed := s.record(time.Millisecond, fetchStats{}, errors.New("down"), life); d != time.Minute || !failed {
+		t.Errorf("failed refresh: want the 1m cap true, got %v %v", d, failed)
+	}
+
+	if d, failed := s.record(time.Millisecond, fetchStats{requests: 10, failed: 2}, nil, life); d != life || failed {
+		t.Errorf("recovered refresh: want %v false, got %v %v", life, d, failed)
+	}
+	if s.waiting(time.Now()) {
+		t.Errorf("waiting after recovering: want false, got true")
+	}
+}
+
+func TestShedder_Nil(t *testing.T) {
+	var s *shedder
+	if d, failed := s.record(time.Hour, fetchStats{requests: 10, failed: 10}, nil, time.Second); d != time.Second || failed {
+		t.Errorf("record: want 1s false, got %v %v", d, failed)
+	}
+	if d, failed := s.record(0, fetchStats{}, errors.New("down"), time.Second); d != time.Second || !failed {
+		t.Errorf("record with an error: want 1s true, got %v %v", d, failed)
+	}
+	if s.waiting(time.Now()) {
+		t.Errorf("waiting: want false, got true")
+	}
+	if n := s.overfetch(30); n != 15 {
+		t.Errorf("overfetch: want 15, got %d", n)
+	}
+}
+
+func TestCach_Breaker(t *testing.T) {
+	var requests, down atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if down.Load() == 1 {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/topstories.json" {
+			fmt.Fprint(w, "[1]")
+			return
+		}
+		fmt.Fprint(w, storyJSON(1))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	old := hnClient
+	hnClient.HTTPClient = &http.Client{Transport: hnTransport{server: u, next: http.DefaultTransport}}
+	// the list and the item went through, the failing list opens it
+	hnClient.Breaker = &hn.Breaker{ErrorRate: 0.3, MinRequests: 1, Cooldown: time.Hour}
+	defer func() { hnClient = old }()
+
+	f, err := newFilters(config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCach(1, f, cachOptions{})
+	c.forceRefresh()
+	if c.outageSince() != nil {
+		t.Fatal("want no outage while the API answers")
+	}
+	down.Store(1)
+	c.forceRefresh()
+	if !hnClient.Breaker.Open() {
+		t.Fatal("want the breaker open after the refresh failed")
+	}
+	before := requests.Load()
+	c.forceRefresh()
+	if got := requests.Load() - before; got != 0 {
+		t.Errorf("open: want the refresh skipped, got %d requests", got)
+	}
+	o := c.outageSince()
+	if o == nil || o.Refreshed.IsZero() || o.Retry.IsZero() {
+		t.Fatalf("open: want the outage with the time of the stories, got %+v", o)
+	}
+
+	cfg := config{Lang: "en", CookieSecret: "secret"}
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _, err := indexData(c, cfg, httptest.NewRequest("GET", "/", nil), cfg.defaultView(), false, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data.Stories) != 1 || data.Outage == nil {
+		t.Fatalf("open: want the stories there are and the outage, got %d and %+v", len(data.Stories), data.Outage)
+	}
+	rec := httptest.NewRecorder()
+	if err := tpls.execute(rec, "index.gohtml", data); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rec.Body.String(), "Hacker News isn&#39;t answering right now") {
+		t.Error("open: want the front page to tell about the outage")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// defaultHostLabels are the sites of many tenants -host_labels knows by
+// default: blog hosts whose subdomains are the blogs, and code and writing
+// sites whose first path segment is the user.
+const defaultHostLabels = "*.github.io,*.gitlab.io,*.substack.com,*.medium.com,*.blogspot.com,*.wordpress.com,*.tumblr.com,*.neocities.org,*.bearblog.dev,*.netlify.app,*.vercel.app,*.pages.dev,*.herokuapp.com,github.com/*,gitlab.com/*,codeberg.org/*,medium.com/*,dev.to/*,git.sr.ht/*"
+
+// hostLabels are the rules of -host_labels, which parseHNItem labels the
+// sites of stories with. parseFlags sets them.
+var hostLabels, _ = parseHostLabels(defaultHostLabels)
+
+// labelRules tell the tenant of a site of many apart: the subdomain right
+// under a domain of tenants, or the first path segment on a domain of paths.
+type labelRules struct {
+	tenants map[string]bool
+	paths   map[string]bool
+}
+
+// parseHostLabels parses a list like "*.github.io, medium.com/*".
+func parseHostLabels(list string) (labelRules, error) {
+	rules := labelRules{tenants: make(map[string]bool), paths: make(map[string]bool)}
+	for _, entry := range strings.Split(list, ",") {
+		if entry = strings.ToLower(strings.TrimSpace(entry)); entry == "" {
+			continue
+		}
+		if domain, ok := strings.CutPrefix(entry, "*."); ok && domain != "" && !strings.Contains(domain, "/") {
+			rules.tenants[asciiHost(domain)] = true
+			continue
+		}
+		if domain, ok := strings.CutSuffix(entry, "/*"); ok && domain != "" && !strings.Contains(domain, "/") {
+			rules.paths[asciiHost(strings.TrimPrefix(domain, "www."))] = true
+			continue
+		}
+		return labelRules{}, fmt.Errorf("host_labels: %q is neither *.domain nor domain/*", entry)
+	}
+	return rules, nil
+}
+
+// label returns the label of the site of a story, its host as shown, which
+// for a site of the rules is the one of the tenant: user.github.io for
+// a.user.github.io, medium.com/@user for medium.com/@user/a-post.
+func (l labelRules) label(host, rawURL string) string {
+	ascii := asciiHost(host)
+	labels := strings.Split(ascii, ".")
+	shown := strings.Split(host, ".")
+	if len(labels) == len(shown) {
+		for i := 1; i < len(labels)-1; i++ {
+			if l.tenants[strings.Join(labels[i:], ".")] {
+				return strings.Join(shown[i-1:], ".")
+			}
+		}
+	}
+	if !l.paths[ascii] {
+		return host
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return host
+	}
+	segment, _, _ := strings.Cut(strings.TrimPrefix(u.EscapedPath(), "/"), "/")
+	if segment == "" {
+		return host
+	}
+	return host + "/" + segment
+}
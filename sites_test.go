@@ -0,0 +1,49 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/neghoda/quiet_hn/hn"
+)
+
+func TestLabelRules(t *testing.T) {
+	rules, err := parseHostLabels(defaultHostLabels + ", *.bücher.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ url, want string }{
+		{"https://user.github.io/post", "user.github.io"},
+		{"https://docs.user.github.io/post", "user.github.io"},
+		{"https://github.io/", "github.io"},
+		{"https://github.com/golang/go/issues/1", "github.com/golang"},
+		{"https://github.com/", "github.com"},
+		{"https://medium.com/@someone/a-post-123", "medium.com/@someone"},
+		{"https://www.medium.com/@someone/a-post-123", "medium.com/@someone"},
+		{"https://news.substack.com/p/issue", "news.substack.com"},
+		{"https://blog.example.com/post", "blog.example.com"},
+		{"https://a.b.xn--bcher-kva.example/", "b.bücher.example"},
+	}
+	for _, tt := range tests {
+		host, _ := displayHost(hostOf(tt.url))
+		if got := rules.label(host, tt.url); got != tt.want {
+			t.Errorf("%s: want %s, got %s", tt.url, tt.want, got)
+		}
+	}
+	for _, list := range []string{"github.io", "*.", "medium.com/@*", "a/b/*"} {
+		if _, err := parseHostLabels(list); err == nil {
+			t.Errorf("%q: want an error", list)
+		}
+	}
+}
+
+func TestParseHNItem_Site(t *testing.T) {
+	s := parseHNItem(hn.Item{ID: 1, Type: "story", URL: "https://user.github.io/post"})
+	if s.Host != "user.github.io" || s.Site != "user.github.io" {
+		t.Errorf("github pages: want the host as the site, got %q %q", s.Host, s.Site)
+	}
+	s = parseHNItem(hn.Item{ID: 1, Type: "story", URL: "https://github.com/golang/go"})
+	// the filters and the GitHub annotations go by the host
+	if s.Host != "github.com" || s.Site != "github.com/golang" {
+		t.Errorf("github: want github.com labeled github.com/golang, got %q %q", s.Host, s.Site)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// snapshotMaxAge is how old a snapshot can be and still fill the front page
+// after a start, on platforms that stop idle instances a fresh start is the
+// normal case and a page of a little while ago beats waiting for HN.
+const snapshotMaxAge = time.Hour
+
+// snapshot is the file of -snapshot, which keeps the stories of the last
+// refresh across restarts.
+type snapshot struct {
+	path string
+}
+
+type snapshotData struct {
+	RefreshedAt time.Time `json:"refreshed_at"`
+	Stories     []item    `json:"stories"`
+}
+
+// save writes the stories of a refresh, through a temporary file so a crash
+// doesn't leave half of it.
+func (s *snapshot) save(stories []item, refreshedAt time.Time) error {
+	b, err := json.Marshal(snapshotData{RefreshedAt: refreshedAt, Stories: stories})
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// load returns the stories of the snapshot, none if there is none yet or it
+// is older than snapshotMaxAge.
+func (s *snapshot) load(now time.Time) ([]item, time.Time, error) {
+	b, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	var data snapshotData
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, time.Time{}, err
+	}
+	if now.Sub(data.RefreshedAt) > snapshotMaxAge {
+		return nil, time.Time{}, nil
+	}
+	return data.Stories, data.RefreshedAt, nil
+}
+
+// restore fills the cache from its snapshot, served for one -cache_ttl while
+// the first refresh runs.
+func (c *cach) restore() error {
+	if c.snapshot == nil {
+		return nil
+	}
+	stories, refreshedAt, err := c.snapshot.load(time.Now())
+	if err != nil || stories == nil {
+		return err
+	}
+	c.dataMutex.Lock()
+	defer c.dataMutex.Unlock()
+	c.cashedItems = stories
+	c.refreshedAt = refreshedAt
+	c.expiration = time.Now().Add(c.lifeDuration)
+	return nil
+}
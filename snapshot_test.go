@@ -0,0 +1,34 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	s := &snapshot{path: filepath.Join(t.TempDir(), "snapshot.json")}
+	c := newCach(2, nil, cachOptions{snapshot: s})
+	if err := c.restore(); err != nil || !c.cachExpired() {
+		t.Errorf("no snapshot: want the cache expired, got %v", err)
+	}
+
+	at := time.Now().Add(-10 * time.Minute).Truncate(time.Second)
+	if err := s.save([]item{testStory(1, "Story 1", "https://example.com/1", 10)}, at); err != nil {
+		t.Fatalf("save() received an error: %s", err.Error())
+	}
+	c = newCach(2, nil, cachOptions{snapshot: s})
+	if err := c.restore(); err != nil {
+		t.Fatalf("restore() received an error: %s", err.Error())
+	}
+	if c.cachExpired() || !c.refreshed().Equal(at) {
+		t.Errorf("restored: want the snapshot of %s served, got refreshed %s", at, c.refreshed())
+	}
+	if s, ok := c.lookup(1); !ok || s.Title != "Story 1" || s.Host != "example.com" {
+		t.Errorf("restored: want story 1, got %+v", s)
+	}
+
+	if stories, _, _ := s.load(at.Add(snapshotMaxAge + time.Second)); stories != nil {
+		t.Errorf("old snapshot: want it left out, got %v", stories)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/neghoda/quiet_hn/hn"
+)
+
+// sourceTimeout bounds each request to a source other than HN.
+const sourceTimeout = 10 * time.Second
+
+var sourceClient = &http.Client{Timeout: sourceTimeout}
+
+// source is where the stories of a front page come from. HN is one, the
+// others map their posts to HN items, so filters, ranking and the templates
+// don't tell them apart.
+type source interface {
+	// TopIDs returns the ids of the stories on the front page of the
+	// source, top first.
+	TopIDs(ctx context.Context) ([]int, error)
+	// GetItem returns the story with the id.
+	GetItem(ctx context.Context, id int) (hn.Item, error)
+}
+
+// foreign is a source other than HN. Its stories are labeled with its name
+// and link to their comments on its site.
+type foreign interface {
+	name() string
+	commentsURL(id int) string
+}
+
+// hnSource is the HN API, through hnClient.
+type hnSource struct{}
+
+func (hnSource) TopIDs(ctx context.Context) ([]int, error) {
+	return hnClient.TopItemsContext(ctx)
+}
+
+func (hnSource) GetItem(ctx context.Context, id int) (hn.Item, error) {
+	return hnClient.GetItemContext(ctx, id)
+}
+
+// sourceKinds are the sources -sources can list, by name.
+var sourceKinds = map[string]func(cfg config) (source, error){
+	"hn":       func(config) (source, error) { return hnSource{}, nil },
+	"lobsters": func(config) (source, error) { return newLobsters(), nil },
+	"reddit":   func(cfg config) (source, error) { return newReddit(cfg.subreddits()), nil },
+}
+
+// sourceNames returns the sources of -sources, the front page first.
+func (cfg config) sourceNames() []string {
+	var ret []string
+	for _, name := range strings.Split(cfg.Sources, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
+
+// sourceKindNames returns the names of sourceKinds, sorted.
+func sourceKindNames() []string {
+	return slices.Sorted(maps.Keys(sourceKinds))
+}
+
+// validateSources checks that -sources lists known sources, each once.
+func (cfg config) validateSources() error {
+	names := cfg.sourceNames()
+	if len(names) == 0 {
+		return errors.New("sources can't be empty")
+	}
+	for i, name := range names {
+		if _, ok := sourceKinds[name]; !ok {
+			return fmt.Errorf("sources: unknown source %q, there are %s", name, strings.Join(sourceKindNames(), ", "))
+		}
+		if slices.Contains(names[:i], name) {
+			return fmt.Errorf("sources: %s is listed twice", name)
+		}
+	}
+	if slices.Contains(names, "reddit") {
+		subreddits := cfg.subreddits()
+		if len(subreddits) == 0 {
+			return errors.New("subreddits can't be empty with the reddit source")
+		}
+		for _, name := range subreddits {
+			if !subredditName.MatchString(name) {
+				return fmt.Errorf("subreddits: %q is no subreddit name", name)
+			}
+		}
+	}
+	return nil
+}
+
+// sourceHandler serves the front page of the source ?source= names, with
+// its own cache, and the default one otherwise.
+func sourceHandler(bySource map[string]http.Handler, def http.Handler) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("source")
+		if name == "" {
+			def.ServeHTTP(w, r)
+			return
+		}
+		h, ok := bySource[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// getJSON decodes what url answers into out, failing unless it is a success.
+func getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	// some sites turn away the default agent of Go
+	req.Header.Set("User-Agent", "quiet_hn/"+build().Version)
+	req.Header.Set("Accept", "application/json")
+	resp, err := sourceClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/neghoda/quiet_hn/hn"
+)
+
+// fakeSource is a source of fixed stories, in order.
+type fakeSource []hn.Item
+
+func (s fakeSource) TopIDs(context.Context) ([]int, error) {
+	ids := make([]int, len(s))
+	for i, it := range s {
+		ids[i] = it.ID
+	}
+	return ids, nil
+}
+
+func (s fakeSource) GetItem(_ context.Context, id int) (hn.Item, error) {
+	for _, it := range s {
+		if it.ID == id {
+			return it, nil
+		}
+	}
+	return hn.Item{}, errors.New("no such item")
+}
+
+func TestSourceHandler(t *testing.T) {
+	setupHN(t, map[int]string{1: storyJSON(1)})
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{CookieSecret: "secret", Lang: "en", NumStories: 1}
+	f, err := newFilters(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def := newCach(cfg.NumStories, f, cachOptions{})
+	other := newCach(cfg.NumStories, f, cachOptions{})
+	other.source = fakeSource{{ID: 7, Type: "story", Title: "Elsewhere", URL: "https://example.org/7"}}
+	h := sourceHandler(map[string]http.Handler{"other": handler(other, cfg, tpls)}, handler(def, cfg, tpls))
+
+	tests := []struct {
+		query string
+		code  int
+		want  string
+	}{
+		{"", http.StatusOK, "Story 1"},
+		{"?source=other", http.StatusOK, "Elsewhere"},
+		{"?source=nope", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", "/"+tt.query, nil))
+		if rec.Code != tt.code || !strings.Contains(rec.Body.String(), tt.want) {
+			t.Errorf("%q: want %d with %q, got %d", tt.query, tt.code, tt.want, rec.Code)
+		}
+	}
+}
+
+func TestConfig_ValidateSources(t *testing.T) {
+	tests := []struct {
+		sources string
+		ok      bool
+	}{
+		{"hn", true},
+		{" hn ,", true},
+		{"", false},
+		{"hn,hn", false},
+		{"hn,digg", false},
+		{"hn,reddit", true},
+	}
+	for _, tt := range tests {
+		err := config{Sources: tt.sources, Subreddits: "programming"}.validateSources()
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: want ok %v, got %v", tt.sources, tt.ok, err)
+		}
+	}
+}
+
+func TestConfig_ValidateSubreddits(t *testing.T) {
+	for subreddits, ok := range map[string]bool{"programming, r/golang": true, "": false, "a": false, "no spaces": false} {
+		err := config{Sources: "hn,reddit", Subreddits: subreddits}.validateSources()
+		if (err == nil) != ok {
+			t.Errorf("%q: want ok %v, got %v", subreddits, ok, err)
+		}
+	}
+}
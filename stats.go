@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/neghoda/quiet_hn/archive"
+)
+
+const statsPath = "/stats"
+
+const (
+	// statsLifeDuration is how long the figures are cached, they go over the
+	// whole archive
+	statsLifeDuration = 10 * time.Minute
+	// statsTop is the number of domains and submitters listed
+	statsTop = 15
+
+	// the size of the bar charts, in pixels
+	chartWidth, chartHeight = 480, 120
+)
+
+// statsCach holds the figures of the archive for the stats page.
+type statsCach struct {
+	mutex      sync.Mutex
+	archive    *archive.Store
+	stats      archive.Stats
+	expiration time.Time
+}
+
+func (s *statsCach) get() (archive.Stats, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if time.Now().Before(s.expiration) {
+		return s.stats, nil
+	}
+	stats, err := s.archive.Stats(statsTop, time.Local)
+	if err != nil {
+		return stats, err
+	}
+	s.stats, s.expiration = stats, time.Now().Add(statsLifeDuration)
+	return stats, nil
+}
+
+type statsTemplateData struct {
+	archive.Stats
+	// Hours and Weekdays are the bars of the charts of Stats.Hours and
+	// Stats.Weekdays
+	Hours    []bar
+	Weekdays []bar
+	// Width and Height are the size of the bars of the charts, their labels
+	// go below at LabelY
+	Width, Height, LabelY int
+	pageData
+}
+
+// bar is one bar of a chart. Label is a locale key for weekdays and the
+// hour for hours.
+type bar struct {
+	Label  string
+	Value  string
+	X, Y   float64
+	Width  float64
+	Height float64
+	// Center is where the label goes
+	Center float64
+}
+
+// bars lays out values as the bars of a chart of the given size, the
+// highest one filling its height.
+func bars(values []float64, labels []string, format string, width, height int) []bar {
+	highest := 0.0
+	for _, v := range values {
+		if v > highest {
+			highest = v
+		}
+	}
+	step := float64(width) / float64(len(values))
+	b := make([]bar, len(values))
+	for i, v := range values {
+		h := 0.0
+		if highest > 0 {
+			h = v / highest * float64(height)
+		}
+		b[i] = bar{
+			Label:  labels[i],
+			Value:  fmt.Sprintf(format, v),
+			X:      tenths(float64(i) * step),
+			Y:      tenths(float64(height) - h),
+			Width:  tenths(step - 2),
+			Height: tenths(h),
+			Center: tenths((float64(i) + 0.5) * step),
+		}
+	}
+	return b
+}
+
+// statsHandler shows figures about the archived stories: the top domains
+// and submitters, when stories are submitted and how they score by day.
+func statsHandler(s *statsCach, cfg config, tpls *templates) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		stats, err := s.get()
+		if err != nil {
+			http.Error(w, "Failed to load the archive", http.StatusInternalServerError)
+			return
+		}
+		hours, hourLabels := make([]float64, 24), make([]string, 24)
+		for h, n := range stats.Hours {
+			hours[h], hourLabels[h] = float64(n), fmt.Sprintf("%02d", h)
+		}
+		// weeks start on Monday on the chart
+		days, dayLabels := make([]float64, 7), make([]string, 7)
+		for i := range days {
+			d := time.Weekday((i + 1) % 7)
+			days[i], dayLabels[i] = stats.Weekdays[d], "weekday_"+fmt.Sprint(int(d))
+		}
+		data := statsTemplateData{
+			Stats:    stats,
+			Hours:    bars(hours, hourLabels, "%.0f", chartWidth, chartHeight),
+			Weekdays: bars(days, dayLabels, "%.1f", chartWidth, chartHeight),
+			Width:    chartWidth,
+			Height:   chartHeight,
+			LabelY:   chartHeight + 14,
+			pageData: cfg.pageData(r, start),
+		}
+		err = tpls.execute(w, "stats.gohtml", data)
+		if err != nil {
+			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// tenths rounds a coordinate, more precision only makes the markup longer.
+func tenths(x float64) float64 {
+	return math.Round(x*10) / 10
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neghoda/quiet_hn/archive"
+)
+
+const (
+	// summaryTimeout bounds the summary of one article, models take a while
+	summaryTimeout = 2 * time.Minute
+	// maxSummarizedText caps the article text handed to the summarizer
+	maxSummarizedText = 16000
+	// maxSummary caps what is kept of a summary, in case the model rambles
+	maxSummary = 600
+	// summarizedFor is how long a story that was tried is remembered, so
+	// articles that fail aren't tried on every refresh
+	summarizedFor = 7 * 24 * time.Hour
+)
+
+// summaryPrompt is what models are asked to do with an article.
+const summaryPrompt = "Summarize the article the user sends in two plain sentences, without any introduction."
+
+// summarizer writes a short summary of an article.
+type summarizer interface {
+	summarize(ctx context.Context, title, text string) (string, error)
+}
+
+var summaryClient = &http.Client{Timeout: summaryTimeout}
+
+// openAISummarizer asks a model of an OpenAI-compatible chat completions
+// API, like the one of OpenAI, Ollama or llama.cpp.
+type openAISummarizer struct {
+	// url is the base URL of the API, like https://api.openai.com/v1
+	url   string
+	token string
+	model string
+}
+
+func (s openAISummarizer) summarize(ctx context.Context, title, text string) (string, error) {
+	b, err := json.Marshal(map[string]any{
+		"model": s.model,
+		"messages": []map[string]string{
+			{"role": "system", "content": summaryPrompt},
+			{"role": "user", "content": title + "\n\n" + text},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(s.url, "/")+"/chat/completions", bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+	resp, err := summaryClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var completion struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return "", err
+	}
+	if len(completion.Choices) == 0 {
+		return "", errors.New("no completion")
+	}
+	return completion.Choices[0].Message.Content, nil
+}
+
+// commandSummarizer runs a local command with the title and the text of
+// the article on its stdin, separated by a blank line, and takes what it
+// prints as the summary.
+type commandSummarizer struct {
+	args []string
+}
+
+func (s commandSummarizer) summarize(ctx context.Context, title, text string) (string, error) {
+	cmd := exec.CommandContext(ctx, s.args[0], s.args[1:]...)
+	cmd.Stdin = strings.NewReader(title + "\n\n" + text)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w: %s", s.args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// newSummarizer returns the summarizer of -summarize_url or
+// -summarize_command, nil if there is none.
+func newSummarizer(cfg config) summarizer {
+	switch {
+	case cfg.SummarizeURL != "":
+		return openAISummarizer{url: cfg.SummarizeURL, token: cfg.SummarizeToken, model: cfg.SummarizeModel}
+	case cfg.SummarizeCommand != "":
+		return commandSummarizer{args: strings.Fields(cfg.SummarizeCommand)}
+	}
+	return nil
+}
+
+// synopses writes summaries of the articles of new stories in the
+// background and keeps them in the archive.
+type synopses struct {
+	archive    *archive.Store
+	summarizer summarizer
+	read       *readCach
+	// busy is held while a batch is summarized, refreshes that come along
+	// in the meantime leave their stories to the next one
+	busy  sync.Mutex
+	mutex sync.Mutex
+	// tried is when each story was last tried
+	tried map[int]time.Time
+}
+
+func newSynopses(a *archive.Store, s summarizer, maxBytes int64) *synopses {
+	return &synopses{
+		archive:    a,
+		summarizer: s,
+		read:       &readCach{maxBytes: maxBytes, client: newReadClient()},
+		tried:      make(map[int]time.Time),
+	}
+}
+
+// annotate sets the Synopsis of the stories that have a summary in the
+// archive, and starts summarizing the ones that don't, which show up on the
+// next refresh.
+func (s *synopses) annotate(stories []item) {
+	ids := make([]int, 0, len(stories))
+	for _, st := range stories {
+		if st.URL != "" {
+			ids = append(ids, st.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	kept, err := s.archive.Summaries(ids)
+	if err != nil {
+		log.Printf("failed to load the summaries: %s", err)
+		return
+	}
+	var todo []item
+	now := time.Now()
+	s.mutex.Lock()
+	for id, t := range s.tried {
+		if now.Sub(t) > summarizedFor {
+			delete(s.tried, id)
+		}
+	}
+	for i, st := range stories {
+		if summary, ok := kept[st.ID]; ok {
+			stories[i].Synopsis = summary
+		} else if _, ok := s.tried[st.ID]; st.URL != "" && !ok {
+			todo = append(todo, st)
+		}
+	}
+	s.mutex.Unlock()
+	if len(todo) == 0 || !s.busy.TryLock() {
+		return
+	}
+	go func() {
+		defer s.busy.Unlock()
+		for _, st := range todo {
+			s.summarizeStory(st)
+		}
+	}()
+}
+
+func (s *synopses) summarizeStory(st item) {
+	s.mutex.Lock()
+	s.tried[st.ID] = time.Now()
+	s.mutex.Unlock()
+	target, err := url.Parse(st.URL)
+	if err != nil {
+		return
+	}
+	article, err := s.read.fetchArticle(target)
+	if err != nil || strings.TrimSpace(article.Text) == "" {
+		return
+	}
+	text := article.Text
+	if len(text) > maxSummarizedText {
+		text = strings.ToValidUTF8(text[:maxSummarizedText], "")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), summaryTimeout)
+	defer cancel()
+	summary, err := s.summarizer.summarize(ctx, st.Title, text)
+	if err != nil {
+		log.Printf("failed to summarize %d: %s", st.ID, err)
+		return
+	}
+	summary = strings.Join(strings.Fields(summary), " ")
+	if len(summary) > maxSummary {
+		summary = strings.ToValidUTF8(summary[:maxSummary], "") + "…"
+	}
+	if summary == "" {
+		return
+	}
+	if err := s.archive.SetSummary(st.ID, summary); err != nil {
+		log.Printf("failed to keep the summary of %d: %s", st.ID, err)
+	}
+}
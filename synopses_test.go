@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/neghoda/quiet_hn/archive"
+)
+
+func TestOpenAISummarizer(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("request: want the completions with the token, got %s %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var req struct {
+			Model    string `json:"model"`
+			Messages []struct{ Role, Content string }
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.Model != "small" || len(req.Messages) != 2 || req.Messages[1].Content != "Title\n\nText" {
+			t.Errorf("body: want the model and the article, got %+v", req)
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"It says things."}}]}`))
+	}))
+	defer api.Close()
+	s := openAISummarizer{url: api.URL + "/v1/", token: "key", model: "small"}
+	got, err := s.summarize(context.Background(), "Title", "Text")
+	if err != nil || got != "It says things." {
+		t.Errorf("summary: want It says things., got %q, %v", got, err)
+	}
+}
+
+func TestCommandSummarizer(t *testing.T) {
+	s := commandSummarizer{args: []string{"tr", "a-z", "A-Z"}}
+	got, err := s.summarize(context.Background(), "Title", "text")
+	if err != nil || got != "TITLE\n\nTEXT" {
+		t.Errorf("summary: want the output, got %q, %v", got, err)
+	}
+	if _, err := (commandSummarizer{args: []string{"false"}}).summarize(context.Background(), "", ""); err == nil {
+		t.Error("failing command: want an error")
+	}
+}
+
+// fakeSummarizer summarizes an article by its first words.
+type fakeSummarizer struct{}
+
+func (fakeSummarizer) summarize(_ context.Context, title, text string) (string, error) {
+	return title + ": " + strings.Join(strings.Fields(text)[:3], " ") + ".", nil
+}
+
+func TestSynopses_Annotate(t *testing.T) {
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><article><p>The article has words enough to be read, and more of them, many more of them than that.</p></article></body></html>`))
+	}))
+	defer site.Close()
+	a, err := archive.Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	stories := []item{testStory(1, "Story", site.URL+"/a", 1), testStory(2, "Ask HN", "", 1)}
+	record(a, stories, time.Now())
+	s := newSynopses(a, fakeSummarizer{}, 1<<20)
+	s.read.client = site.Client()
+	s.annotate(stories)
+	// the articles are summarized in the background, for the next refresh
+	s.busy.Lock()
+	s.busy.Unlock()
+	s.annotate(stories)
+	if want := "Story: The article has."; stories[0].Synopsis != want {
+		t.Errorf("synopsis: want %q, got %q", want, stories[0].Synopsis)
+	}
+	if stories[1].Synopsis != "" {
+		t.Errorf("text post: want no synopsis, got %q", stories[1].Synopsis)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const tagPath = "/tag/"
+
+// tagName is what a tag may look like, it ends up in URLs.
+var tagName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// tagger tags stories by the rules of the -tag_rules file. Every line of the
+// file is a tag followed by a pattern: a title keyword, a /regexp/ or
+// site:domain, which matches the domain and its subdomains.
+//
+//	# tag     pattern
+//	ai        llm
+//	ai        /gpt-?[0-9]/
+//	security  site:krebsonsecurity.com
+type tagger struct {
+	rules []tagRule
+	tags  map[string]bool
+}
+
+type tagRule struct {
+	tag    string
+	title  *regexp.Regexp
+	domain string
+}
+
+func newTagger(path string) (*tagger, error) {
+	lines, err := readListFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &tagger{tags: make(map[string]bool)}
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%s: rule %d: want a tag and a pattern", path, i+1)
+		}
+		rule := tagRule{tag: strings.ToLower(fields[0])}
+		if !tagName.MatchString(rule.tag) {
+			return nil, fmt.Errorf("%s: rule %d: tags may only contain a-z, 0-9 and -", path, i+1)
+		}
+		pattern := strings.Join(fields[1:], " ")
+		if strings.HasPrefix(pattern, "site:") {
+			rule.domain = strings.TrimPrefix(strings.ToLower(pattern[len("site:"):]), "www.")
+		} else if rule.title, err = compileMute(pattern); err != nil {
+			return nil, fmt.Errorf("%s: rule %d: %w", path, i+1, err)
+		}
+		t.rules = append(t.rules, rule)
+		t.tags[rule.tag] = true
+	}
+	return t, nil
+}
+
+// annotate sets the tags of the stories.
+func (t *tagger) annotate(stories []item) {
+	for i := range stories {
+		stories[i].Tags = t.match(stories[i])
+	}
+}
+
+// match returns the sorted tags of the rules that match a story.
+func (t *tagger) match(story item) []string {
+	matched := make(map[string]bool)
+	for _, rule := range t.rules {
+		if matched[rule.tag] {
+			continue
+		}
+		if rule.title != nil && rule.title.MatchString(story.Title) ||
+			rule.domain != "" && onDomain(story.Host, rule.domain) {
+			matched[rule.tag] = true
+		}
+	}
+	var tags []string
+	for tag := range matched {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// has reports whether any rule assigns tag, a nil tagger knows no tags.
+func (t *tagger) has(tag string) bool {
+	return t != nil && t.tags[tag]
+}
+
+// onDomain reports whether host is domain or one of its subdomains.
+func onDomain(host, domain string) bool {
+	host, domain = asciiHost(host), asciiHost(domain)
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+func hasTag(story item, tag string) bool {
+	for _, t := range story.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neghoda/quiet_hn/i18n"
+)
+
+// defaultTemplates are used for every file missing from -templates_dir. See
+// templates/README.md for the blocks and data each page provides.
+//
+//go:embed templates/*.gohtml
+var defaultTemplates embed.FS
+
+const layoutTemplate = "layout.gohtml"
+
+// pageTemplates are the pages the server renders. Every other file is a
+// partial that gets parsed along with each page.
+var pageTemplates = []string{"index.gohtml", "read.gohtml", "print.gohtml", "item.gohtml", "settings.gohtml", "past.gohtml", "search.gohtml", "stats.gohtml", "top.gohtml", "login.gohtml", "bookmarks.gohtml", "admin.gohtml", "hiring.gohtml", "gallery.gohtml", "lite.gohtml"}
+
+// pageData holds the fields every page gets, the page data types embed it.
+type pageData struct {
+	L     *i18n.Locale
+	Brand branding
+	Theme string
+	// Zone is the time zone of the visitor, see Local
+	Zone *time.Location
+	Time time.Duration
+	// Cards is set when the stories are shown as cards, with their
+	// description and age
+	Cards bool
+	// Labeled is set when the stories come from several sources, each
+	// labeled with its own
+	Labeled bool
+	// Static is set for pages written by the generate command, which have no
+	// server behind them for settings and reader mode
+	Static bool
+	// Version is the version of quiet_hn serving the page
+	Version string
+	// FeedQuery is added to the feed links, it carries the settings of a
+	// visitor who wants them in their feeds
+	FeedQuery string
+	// Accounts is set when visitors can log in, Account is the name of the
+	// one who is
+	Accounts bool
+	Account  string
+	// NewTab opens the links of the stories in a new tab, OutLinks sends
+	// them through /out, but not on static pages, which have no server
+	// behind them to redirect
+	NewTab   bool
+	OutLinks bool
+	// NoIndex asks search engines not to index the page, with -robots
+	// noindex
+	NoIndex bool
+
+	stream *stream
+}
+
+// stream is the response a page is executed into, so the page can send
+// what it has so far before the slower parts are rendered.
+type stream struct {
+	w http.ResponseWriter
+}
+
+// Flush sends the page written so far to the browser, which can start on
+// the styles and header while the stories are rendered. Pages rendered into
+// memory have nothing to flush.
+func (d pageData) Flush() string {
+	if d.stream != nil && d.stream.w != nil {
+		if f, ok := d.stream.w.(http.Flusher); ok {
+			f.Flush()
+		}
+	}
+	return ""
+}
+
+func (d pageData) pageStream() *stream { return d.stream }
+
+// startedWriter records when the response started, after which the status
+// can't change anymore.
+type startedWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *startedWriter) Write(b []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *startedWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.started = true
+		f.Flush()
+	}
+}
+
+// Story wraps a story for the story partial, which has no access to the rest
+// of the page data.
+func (d pageData) Story(i item) storyData {
+	return storyData{
+		item: i, Cards: d.Cards, Labeled: d.Labeled, Static: d.Static, L: d.L,
+		ID: i.ID, Rank: i.Rank, Title: i.Title, URL: i.URL, Host: i.Host, Site: i.Site, Lookalike: i.Lookalike, Type: i.Type,
+		Score: i.Score, Descendants: i.Descendants, Image: i.Image, Description: i.Description, Badge: i.Badge, Repo: i.Repo, Abstract: i.Abstract, Synopsis: i.Synopsis, Translation: i.Translation, Dead: i.Dead,
+		Tags: i.Tags, Repost: i.Repost, Trend: i.Trend, Move: i.Move, Saved: i.Saved, Read: i.Read,
+		Source: i.Source, Account: d.Account != "" && i.Source == "",
+		NewTab: d.NewTab, OutLinks: d.OutLinks,
+	}
+}
+
+// outLinks is true when the stories link through /out, which -click_stats
+// counts the clicks in.
+func (cfg config) outLinks() bool {
+	return cfg.OutLinks || cfg.ClickStats
+}
+
+// pageData returns the common fields of a page that took since start to
+// build.
+func (cfg config) pageData(r *http.Request, start time.Time) pageData {
+	s := cfg.settings(r)
+	d := pageData{
+		L:         locale(r, cfg.Lang),
+		Brand:     cfg.brand(r),
+		Theme:     s.Theme,
+		Zone:      cfg.zone(s),
+		Time:      time.Now().Sub(start),
+		Static:    cfg.static,
+		Version:   version(),
+		FeedQuery: cfg.feedQuery(s),
+		Accounts:  cfg.accounts != nil && !cfg.static,
+		NewTab:    cfg.NewTab,
+		OutLinks:  cfg.outLinks() && !cfg.static,
+		stream:    &stream{},
+	}
+	d.NoIndex = cfg.noindex()
+	if a := sessionOf(r); a != nil {
+		d.Account = a.user.Name
+	}
+	return d
+}
+
+type templates struct {
+	dir string
+	dev bool
+	// mutex guards pages, which the admin dashboard can parse again
+	mutex sync.RWMutex
+	pages map[string]*template.Template
+}
+
+// loadTemplates parses all pages, preferring files in dir over the embedded
+// defaults. dir may be empty to only use the defaults. In development mode
+// the pages are parsed again on every request, so edits show up on reload.
+func loadTemplates(dir string, dev bool) (*templates, error) {
+	pages, err := parsePages(dir)
+	return &templates{dir: dir, dev: dev, pages: pages}, err
+}
+
+// execute renders the page called name to w, the page is sent as it is
+// written. An error is only returned while nothing was sent, after that the
+// status is out and the page just ends where it failed. In development mode
+// problems are shown in the browser instead, and the returned error is
+// always nil.
+func (t *templates) execute(w http.ResponseWriter, name string, data interface{}) error {
+	if !t.dev {
+		sw := &startedWriter{ResponseWriter: w}
+		if d, ok := data.(interface{ pageStream() *stream }); ok && d.pageStream() != nil {
+			d.pageStream().w = sw
+		}
+		err := t.page(name).Execute(sw, data)
+		if err != nil && sw.started {
+			log.Printf("template error in %s after the response started: %s", name, err)
+			return nil
+		}
+		return err
+	}
+	pages, err := parsePages(t.dir)
+	if err != nil {
+		templateError(w, err)
+		return nil
+	}
+	// buffer the output so a failure halfway through doesn't leave a broken
+	// page behind the error
+	var buf bytes.Buffer
+	if err := pages[name].Execute(&buf, data); err != nil {
+		templateError(w, err)
+		return nil
+	}
+	buf.WriteTo(w)
+	return nil
+}
+
+// page returns the parsed page called name.
+func (t *templates) page(name string) *template.Template {
+	t.mutex.RLock()
+	defer t.mutex.RUnlock()
+	return t.pages[name]
+}
+
+// reload parses the pages again, so edits to -templates_dir show without a
+// restart. The pages there are stay if they don't parse.
+func (t *templates) reload() error {
+	pages, err := parsePages(t.dir)
+	if err != nil {
+		return err
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.pages = pages
+	return nil
+}
+
+func templateError(w http.ResponseWriter, err error) {
+	log.Printf("template error: %s", err)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, "<!doctype html>\n<title>Template error</title>\n<h1>Template error</h1>\n<pre>%s</pre>\n", html.EscapeString(err.Error()))
+}
+
+func parsePages(dir string) (map[string]*template.Template, error) {
+	sources, err := templateSources(dir)
+	if err != nil {
+		return nil, err
+	}
+	var partials []string
+	for name := range sources {
+		if name != layoutTemplate && !isPage(name) {
+			partials = append(partials, name)
+		}
+	}
+
+	pages := make(map[string]*template.Template)
+	for _, page := range pageTemplates {
+		// the layout is the root template, pages and partials fill in and
+		// override its blocks
+		t, err := template.New(layoutTemplate).Funcs(templateFuncs).Parse(sources[layoutTemplate])
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range append([]string{page}, partials...) {
+			if _, err := t.New(name).Parse(sources[name]); err != nil {
+				return nil, err
+			}
+		}
+		pages[page] = t
+	}
+	return pages, nil
+}
+
+// templateSources returns the source of every template by file name.
+func templateSources(dir string) (map[string]string, error) {
+	sources := make(map[string]string)
+	defaults, err := fs.Glob(defaultTemplates, "templates/*.gohtml")
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range defaults {
+		b, err := defaultTemplates.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		sources[filepath.Base(path)] = string(b)
+	}
+	if dir == "" {
+		return sources, nil
+	}
+	custom, err := filepath.Glob(filepath.Join(dir, "*.gohtml"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range custom {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		sources[filepath.Base(path)] = string(b)
+	}
+	return sources, nil
+}
+
+func isPage(name string) bool {
+	for _, page := range pageTemplates {
+		if strings.EqualFold(page, name) {
+			return true
+		}
+	}
+	return false
+}
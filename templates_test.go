@@ -0,0 +1,54 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTemplates_Execute(t *testing.T) {
+	tpls := &templates{pages: map[string]*template.Template{
+		"streamed": template.Must(template.New("streamed").Parse(`<head></head>{{.Flush}}<body>{{.Missing}}</body>`)),
+		"early":    template.Must(template.New("early").Parse(`{{.Missing}}<head></head>`)),
+	}}
+	cfg := config{Lang: "en", CookieSecret: "secret"}
+	req := httptest.NewRequest("GET", "/", nil)
+
+	rec := httptest.NewRecorder()
+	if err := tpls.execute(rec, "streamed", cfg.pageData(req, time.Now())); err != nil {
+		t.Errorf("failed after the flush: want no error, the status is out already, got %v", err)
+	}
+	if !rec.Flushed || rec.Code != http.StatusOK || rec.Body.String() != "<head></head><body>" {
+		t.Errorf("failed after the flush: want the head flushed with 200, got %t, %d and %q", rec.Flushed, rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	if err := tpls.execute(rec, "early", cfg.pageData(req, time.Now())); err == nil {
+		t.Error("failed before writing: want the error, so the handler can answer with 500")
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("failed before writing: want nothing written, got %q", rec.Body.String())
+	}
+}
+
+func TestPageData_Story(t *testing.T) {
+	s := testStory(7, "Title", "https://a.com/x", 12)
+	s.Rank, s.Descendants, s.Tags = 3, 4, []string{"go"}
+	s.Image, s.Description = "https://a.com/i.png", "About it"
+	s.Repost, s.Trend = &repost{}, &trend{}
+	d := pageData{}.Story(s)
+	// the fields copied up have to match the ones of the story they shadow
+	v, promoted := reflect.ValueOf(d), reflect.ValueOf(d.item)
+	for i := range v.NumField() {
+		f := v.Type().Field(i)
+		if f.Anonymous || !f.IsExported() {
+			continue
+		}
+		if p := promoted.FieldByName(f.Name); p.IsValid() && !reflect.DeepEqual(v.Field(i).Interface(), p.Interface()) {
+			t.Errorf("%s: want %v, got %v", f.Name, p.Interface(), v.Field(i).Interface())
+		}
+	}
+}
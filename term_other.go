@@ -0,0 +1,16 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func rawTerminal(f *os.File) (func(), error) {
+	return nil, errors.New("the terminal of this platform is not supported")
+}
+
+func terminalSize(f *os.File) (int, int) {
+	return 80, 24
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const themesPath = "/themes/"
+
+// themeStyles are the stylesheets of the themes the layout has no colors
+// for, served at /themes/{name}.css.
+//
+//go:embed templates/themes/*.css
+var themeStyles embed.FS
+
+// themeStylesLifeDuration is how long browsers keep a theme stylesheet, the
+// layout links it with the version so a new one is fetched after an upgrade.
+const themeStylesLifeDuration = 7 * 24 * time.Hour
+
+// styledThemes are the themes with a stylesheet of their own.
+var styledThemes = []string{"contrast", "large", "dyslexic"}
+
+// ThemeStyle returns the stylesheet of the theme of the visitor, empty for
+// the ones there is none for.
+func (d pageData) ThemeStyle() string {
+	if d.Static || !slices.Contains(styledThemes, d.Theme) {
+		return ""
+	}
+	return fmt.Sprintf("%s%s.css?v=%s", themesPath, d.Theme, d.Version)
+}
+
+func themesHandler() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, themesPath), ".css")
+		if !ok || !slices.Contains(styledThemes, name) {
+			http.NotFound(w, r)
+			return
+		}
+		b, err := themeStyles.ReadFile("templates/themes/" + name + ".css")
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/css; charset=utf-8")
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(themeStylesLifeDuration.Seconds())))
+		w.Write(b)
+	})
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// withTimeout gives each request until timeout to be served, after which the
+// handlers stop waiting on the HN API.
+func withTimeout(h http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// storiesError answers a request the stories couldn't be loaded for, telling
+// the visitor to come back when the HN API was too slow rather than leaving
+// the connection hanging.
+func storiesError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		http.Error(w, "Hacker News took too long to answer, try again in a moment", http.StatusGatewayTimeout)
+		return
+	}
+	http.Error(w, "Failed to load top stories", http.StatusInternalServerError)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithTimeout_ColdCach(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/topstories.json" {
+			// hang like an API that's down, until the test is done
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+			fmt.Fprint(w, "[1]")
+			return
+		}
+		fmt.Fprint(w, storyJSON(1))
+	}))
+	defer server.Close()
+	u, _ := url.Parse(server.URL)
+	old := hnClient
+	hnClient.HTTPClient = &http.Client{Transport: hnTransport{server: u, next: http.DefaultTransport}}
+	defer func() { hnClient = old }()
+
+	tpls, err := loadTemplates("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config{Lang: "en", SiteTitle: "Quiet", CookieSecret: "secret"}
+	f, err := newFilters(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCach(2, f, cachOptions{pages: newPageCach(), feeds: newFeedCach()})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handler(c, cfg, tpls))
+	mux.HandleFunc(rssPath, rssHandler(c, cfg))
+
+	for _, path := range []string{"/", rssPath} {
+		rec := httptest.NewRecorder()
+		start := time.Now()
+		withTimeout(mux, 50*time.Millisecond).ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		if rec.Code != http.StatusGatewayTimeout {
+			t.Errorf("%s with a hanging API: want %d, got %d", path, http.StatusGatewayTimeout, rec.Code)
+		}
+		if took := time.Since(start); took > time.Second {
+			t.Errorf("%s with a hanging API: want an answer at the timeout, took %s", path, took)
+		}
+	}
+
+	close(release)
+	rec := httptest.NewRecorder()
+	withTimeout(mux, 5*time.Second).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Story 1") {
+		t.Errorf("once the API answers: want the story, got %d %s", rec.Code, rec.Body.String())
+	}
+}
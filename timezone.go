@@ -0,0 +1,45 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// zones caches the locations loaded by name, loading one reads the zoneinfo
+// database.
+var zones sync.Map
+
+// loadZone returns the IANA time zone called name, like Europe/Kyiv.
+func loadZone(name string) (*time.Location, error) {
+	if loc, ok := zones.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	zones.Store(name, loc)
+	return loc, nil
+}
+
+// zone is the time zone the times on the pages of a visitor are shown in:
+// the one of their settings, -tz or the one of the server.
+func (cfg config) zone(s settings) *time.Location {
+	for _, name := range []string{s.TimeZone, cfg.TZ} {
+		if name == "" {
+			continue
+		}
+		if loc, err := loadZone(name); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// Local returns t in the time zone of the visitor.
+func (d pageData) Local(t time.Time) time.Time {
+	if d.Zone == nil {
+		return t
+	}
+	return t.In(d.Zone)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/neghoda/quiet_hn/archive"
+)
+
+const topPath = "/top/"
+
+// topPeriods are the windows of the best of pages, by their name in the
+// path.
+var topPeriods = map[string]time.Duration{
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+}
+
+type topTemplateData struct {
+	Stories []item
+	// Period is week, month or, with ClickStats, clicked
+	Period     string
+	ClickStats bool
+	pageData
+}
+
+// topHandler shows the stories with the highest peak score over the last
+// week or month, at /top/week and /top/month, and with -click_stats the
+// most clicked of the last week at /top/clicked.
+func topHandler(a *archive.Store, cfg config, tpls *templates) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		period := strings.TrimPrefix(r.URL.Path, topPath)
+		var stories []archive.Story
+		var err error
+		if window, ok := topPeriods[period]; ok {
+			stories, err = a.Top(start.Add(-window), start, cfg.NumStories)
+		} else if period == "clicked" && cfg.ClickStats {
+			stories, err = mostClicked(a, start, cfg.NumStories)
+		} else {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to load the archive", http.StatusInternalServerError)
+			return
+		}
+		data := topTemplateData{Period: period, ClickStats: cfg.ClickStats, pageData: cfg.pageData(r, start)}
+		// the age of the stories matters here, cards show it
+		data.Cards = true
+		for i, s := range stories {
+			data.Stories = append(data.Stories, archivedItem(s, i+1))
+		}
+		err = tpls.execute(w, "top.gohtml", data)
+		if err != nil {
+			http.Error(w, "Failed to process the template", http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// mostClicked returns the n stories clicked most over the week before now.
+func mostClicked(a *archive.Store, now time.Time, n int) ([]archive.Story, error) {
+	clicked, err := a.MostClicked(now.Add(-topPeriods["week"]), now, n)
+	stories := make([]archive.Story, len(clicked))
+	for i, c := range clicked {
+		stories[i] = c.Story
+	}
+	return stories, err
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	translationCachLifeDuration = 7 * 24 * time.Hour
+	// translateTimeout bounds the translations of a refresh, titles that
+	// aren't translated in time are shown as they are until the next one
+	translateTimeout = 10 * time.Second
+)
+
+// translator translates the titles of stories into the language lang, one
+// translation per title, in order.
+type translator interface {
+	translate(ctx context.Context, titles []string, lang string) ([]string, error)
+}
+
+var translateClient = &http.Client{Timeout: translateTimeout}
+
+// libreTranslator uses the API of LibreTranslate at url.
+type libreTranslator struct {
+	url   string
+	token string
+}
+
+func (t libreTranslator) translate(ctx context.Context, titles []string, lang string) ([]string, error) {
+	b, err := json.Marshal(map[string]any{"q": titles, "source": "auto", "target": lang, "format": "text", "api_key": t.token})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(t.url, "/")+"/translate", bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := translateClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var translated struct {
+		TranslatedText []string `json:"translatedText"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&translated); err != nil {
+		return nil, err
+	}
+	return translated.TranslatedText, nil
+}
+
+// commandTranslator runs a local command with the titles on its stdin, one
+// per line, and the language in $TRANSLATE_TO, and takes the lines it
+// prints as their translations.
+type commandTranslator struct {
+	args []string
+}
+
+func (t commandTranslator) translate(ctx context.Context, titles []string, lang string) ([]string, error) {
+	cmd := exec.CommandContext(ctx, t.args[0], t.args[1:]...)
+	cmd.Stdin = strings.NewReader(strings.Join(titles, "\n") + "\n")
+	cmd.Env = append(os.Environ(), "TRANSLATE_TO="+lang)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w: %s", t.args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.Split(strings.TrimSuffix(string(out), "\n"), "\n"), nil
+}
+
+// newTranslator returns the translator of -translate_url or
+// -translate_command, nil if there is none.
+func newTranslator(cfg config) translator {
+	switch {
+	case cfg.TranslateURL != "":
+		return libreTranslator{url: cfg.TranslateURL, token: cfg.TranslateToken}
+	case cfg.TranslateCommand != "":
+		return commandTranslator{args: strings.Fields(cfg.TranslateCommand)}
+	}
+	return nil
+}
+
+// translation is the title of a story in the language of -translate_to.
+type translation struct {
+	Title string
+	Lang  string
+}
+
+// translations holds the titles translated into lang, by their original.
+type translations struct {
+	translator translator
+	lang       string
+	mutex      sync.Mutex
+	titles     map[string]cachedTranslation
+}
+
+type cachedTranslation struct {
+	// title is empty when the translation is the title itself
+	title      string
+	expiration time.Time
+}
+
+func newTranslations(t translator, lang string) *translations {
+	return &translations{translator: t, lang: lang, titles: make(map[string]cachedTranslation)}
+}
+
+// annotate sets the Translation of the stories, translating the titles
+// that aren't cached yet in one batch.
+func (t *translations) annotate(stories []item) {
+	var missing []string
+	seen := make(map[string]bool)
+	now := time.Now()
+	t.mutex.Lock()
+	for k, v := range t.titles {
+		if now.After(v.expiration) {
+			delete(t.titles, k)
+		}
+	}
+	for _, s := range stories {
+		if _, ok := t.titles[s.Title]; !ok && !seen[s.Title] {
+			missing = append(missing, s.Title)
+			seen[s.Title] = true
+		}
+	}
+	t.mutex.Unlock()
+	if len(missing) > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), translateTimeout)
+		defer cancel()
+		t.fetchTranslations(ctx, missing)
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for i, s := range stories {
+		if cached := t.titles[s.Title]; cached.title != "" {
+			stories[i].Translation = &translation{Title: cached.title, Lang: t.lang}
+		}
+	}
+}
+
+func (t *translations) fetchTranslations(ctx context.Context, titles []string) {
+	translated, err := t.translator.translate(ctx, titles, t.lang)
+	if err == nil && len(translated) != len(titles) {
+		err = fmt.Errorf("%d translations of %d titles", len(translated), len(titles))
+	}
+	if err != nil {
+		// the titles are tried again on the next refresh
+		log.Printf("failed to translate the titles: %s", err)
+		return
+	}
+	expiration := time.Now().Add(translationCachLifeDuration)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for i, title := range titles {
+		tr := strings.TrimSpace(translated[i])
+		// titles already in the language come back as they are
+		if strings.EqualFold(tr, title) {
+			tr = ""
+		}
+		t.titles[title] = cachedTranslation{title: tr, expiration: expiration}
+	}
+}
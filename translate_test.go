@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLibreTranslator(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Q      []string `json:"q"`
+			Target string   `json:"target"`
+			Key    string   `json:"api_key"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if r.URL.Path != "/translate" || req.Target != "de" || req.Key != "key" || len(req.Q) != 2 {
+			t.Errorf("request: want the titles into de, got %s %+v", r.URL.Path, req)
+		}
+		w.Write([]byte(`{"translatedText":["Hallo","Welt"]}`))
+	}))
+	defer api.Close()
+	got, err := libreTranslator{url: api.URL + "/", token: "key"}.translate(context.Background(), []string{"Hello", "World"}, "de")
+	if err != nil || strings.Join(got, " ") != "Hallo Welt" {
+		t.Errorf("translations: want Hallo Welt, got %q, %v", got, err)
+	}
+}
+
+func TestCommandTranslator(t *testing.T) {
+	tr := commandTranslator{args: []string{"sh", "-c", `while read -r l; do echo "$TRANSLATE_TO $l"; done`}}
+	got, err := tr.translate(context.Background(), []string{"a b", "c"}, "fr")
+	if err != nil || strings.Join(got, "|") != "fr a b|fr c" {
+		t.Errorf("translations: want a line each, got %q, %v", got, err)
+	}
+}
+
+// fakeTranslator prefixes the titles with "xx", unless they have it, and
+// counts the ones it was asked.
+type fakeTranslator struct {
+	asked *int
+	err   error
+}
+
+func (f fakeTranslator) translate(_ context.Context, titles []string, _ string) ([]string, error) {
+	*f.asked += len(titles)
+	out := make([]string, len(titles))
+	for i, title := range titles {
+		out[i] = title
+		if !strings.HasPrefix(title, "xx ") {
+			out[i] = "xx " + title
+		}
+	}
+	return out, f.err
+}
+
+func TestTranslations_Annotate(t *testing.T) {
+	var asked int
+	tr := newTranslations(fakeTranslator{asked: &asked, err: errors.New("down")}, "xx")
+	stories := []item{testStory(1, "Hello", "", 1), testStory(2, "xx Hello", "", 1), testStory(3, "Hello", "", 1)}
+	tr.annotate(stories)
+	if stories[0].Translation != nil {
+		t.Errorf("failed translation: want none, got %+v", stories[0].Translation)
+	}
+	tr.translator = fakeTranslator{asked: &asked}
+	tr.annotate(stories)
+	tr.annotate(stories)
+	if tl := stories[0].Translation; tl == nil || tl.Title != "xx Hello" || tl.Lang != "xx" {
+		t.Errorf("translation: want xx Hello in xx, got %+v", tl)
+	}
+	if stories[1].Translation != nil {
+		t.Errorf("title in the language: want no translation, got %+v", stories[1].Translation)
+	}
+	if asked != 4 {
+		t.Errorf("asked: want 4 titles, the same once and cached after, got %d", asked)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/neghoda/quiet_hn/archive"
+)
+
+const (
+	sparkPath = "/spark"
+
+	// trendWindow is the time over which what a story gained is compared
+	// with what it gained in the same time before
+	trendWindow = time.Hour
+	// sparkWindow is the time a sparkline covers
+	sparkWindow = 24 * time.Hour
+
+	sparkWidth, sparkHeight = 48, 12
+)
+
+// trend tells whether a story is gaining points and comments faster (1) or
+// slower (-1) than in the hour before, or about as fast (0).
+type trend struct {
+	Score    int
+	Comments int
+}
+
+// trends compares the recent snapshots of the stories in the archive.
+type trends struct {
+	archive *archive.Store
+}
+
+// annotate sets the trend of the stories that have snapshots from the last
+// couple of hours.
+func (t *trends) annotate(stories []item) {
+	now := time.Now()
+	recent, err := t.archive.Recent(now.Add(-2*trendWindow - t.archive.SnapshotEvery))
+	if err != nil {
+		log.Printf("failed to look up the trends: %s", err)
+		return
+	}
+	for i, s := range stories {
+		if snapshots := recent[s.ID]; len(snapshots) >= 2 {
+			stories[i].Trend = trendOf(snapshots, now)
+		}
+	}
+}
+
+// trendOf compares what a story gained in the last trendWindow with what it
+// gained in the one before. The trend is steady if the snapshots don't go
+// back that far.
+func trendOf(snapshots []archive.Snapshot, now time.Time) *trend {
+	t := &trend{}
+	before, ok := snapshotAt(snapshots, now.Add(-2*trendWindow))
+	if !ok {
+		return t
+	}
+	middle, _ := snapshotAt(snapshots, now.Add(-trendWindow))
+	last := snapshots[len(snapshots)-1]
+	t.Score = direction(last.Score-middle.Score, middle.Score-before.Score)
+	t.Comments = direction(last.Comments-middle.Comments, middle.Comments-before.Comments)
+	return t
+}
+
+// snapshotAt returns the last snapshot taken at or before t.
+func snapshotAt(snapshots []archive.Snapshot, t time.Time) (archive.Snapshot, bool) {
+	var found archive.Snapshot
+	ok := false
+	for _, sn := range snapshots {
+		if sn.At.After(t) {
+			break
+		}
+		found, ok = sn, true
+	}
+	return found, ok
+}
+
+// direction compares two gains. A difference of less than a quarter, or of
+// a single point, is noise.
+func direction(recent, earlier int) int {
+	margin := earlier / 4
+	if margin < 2 {
+		margin = 2
+	}
+	switch {
+	case recent >= earlier+margin:
+		return 1
+	case recent <= earlier-margin:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// sparkHandler draws the score of a story over the last day as a small SVG
+// line, at /spark?id=123.
+func sparkHandler(a *archive.Store) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, "Missing or invalid id", http.StatusBadRequest)
+			return
+		}
+		snapshots, err := a.Snapshots(id)
+		if err != nil {
+			http.Error(w, "Failed to load the archive", http.StatusInternalServerError)
+			return
+		}
+		since := time.Now().Add(-sparkWindow)
+		for len(snapshots) > 0 && snapshots[0].At.Before(since) {
+			snapshots = snapshots[1:]
+		}
+		if len(snapshots) < 2 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(a.SnapshotEvery.Seconds())))
+		fmt.Fprint(w, sparkline(snapshots))
+	})
+}
+
+// sparkline returns an SVG image of the score in the snapshots, which must
+// be at least two.
+func sparkline(snapshots []archive.Snapshot) string {
+	first, last := snapshots[0].At, snapshots[len(snapshots)-1].At
+	low, high := snapshots[0].Score, snapshots[0].Score
+	for _, sn := range snapshots {
+		if sn.Score < low {
+			low = sn.Score
+		}
+		if sn.Score > high {
+			high = sn.Score
+		}
+	}
+	span, rangeY := last.Sub(first).Seconds(), float64(high-low)
+	points := make([]string, len(snapshots))
+	for i, sn := range snapshots {
+		x, y := 0.0, float64(sparkHeight)/2
+		if span > 0 {
+			x = sn.At.Sub(first).Seconds() / span * sparkWidth
+		}
+		if rangeY > 0 {
+			// leave room for the width of the line at the top and bottom
+			y = 1 + (1-float64(sn.Score-low)/rangeY)*(sparkHeight-2)
+		}
+		points[i] = fmt.Sprintf("%.1f,%.1f", x, y)
+	}
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %[1]d %[2]d">`+
+		`<polyline points="%s" fill="none" stroke="#888" stroke-width="1.5" stroke-linejoin="round"/></svg>`,
+		sparkWidth, sparkHeight, strings.Join(points, " "))
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/neghoda/quiet_hn/hn"
+)
+
+const (
+	// tuiMaxComments and tuiMaxDepth bound how much of a thread the tui
+	// fetches, big threads have thousands of comments.
+	tuiMaxComments = 200
+	tuiMaxDepth    = 6
+)
+
+// tuiCommand browses the front page in the terminal, through the same cache
+// and filters as the server.
+func tuiCommand(args []string) error {
+	cfg := parseFlags(flag.NewFlagSet("tui", flag.ExitOnError), args)
+	if err := cfg.validate(); err != nil {
+		return err
+	}
+	f, err := newFilters(cfg)
+	if err != nil {
+		return err
+	}
+	c := newCach(cfg.NumStories, f, cachOptions{})
+	t := &tui{
+		load:   func() ([]item, error) { return c.getTopStories(context.Background(), cfg.defaultView()) },
+		thread: fetchThread,
+		open:   openBrowser,
+	}
+	t.reload()
+
+	restore, err := rawTerminal(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("tui: %w", err)
+	}
+	defer restore()
+	w := bufio.NewWriter(os.Stdout)
+	// use the alternate screen, so the shell comes back as it was on exit
+	fmt.Fprint(w, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(w, "\x1b[?25h\x1b[?1049l")
+		w.Flush()
+	}()
+	buf := make([]byte, 16)
+	for {
+		t.width, t.height = terminalSize(os.Stdout)
+		t.render(w)
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return err
+		}
+		if t.key(string(buf[:n])) {
+			return nil
+		}
+	}
+}
+
+// tui is the state of the terminal browser: the story list, and the thread
+// of the selected story while it is open.
+type tui struct {
+	load   func() ([]item, error)
+	thread func(s item) []commentLine
+	open   func(url string) error
+
+	stories  []item
+	selected int
+	// lines is the open thread, nil on the story list
+	lines  []commentLine
+	scroll int
+	status string
+
+	width, height int
+}
+
+// commentLine is a comment of a thread, depth is 0 for the replies to the
+// story.
+type commentLine struct {
+	depth      int
+	by         string
+	paragraphs []string
+}
+
+func (t *tui) reload() {
+	stories, err := t.load()
+	if err != nil {
+		t.status = "failed to load the stories: " + err.Error()
+		return
+	}
+	t.stories, t.status = stories, ""
+	if t.selected >= len(t.stories) {
+		t.selected = max(len(t.stories)-1, 0)
+	}
+}
+
+// key handles a key press and reports if the tui should quit.
+func (t *tui) key(k string) bool {
+	if k == "\x03" || k == "q" && t.lines == nil {
+		return true
+	}
+	if t.lines != nil {
+		switch k {
+		case "j", "\x1b[B":
+			t.scroll++
+		case "k", "\x1b[A":
+			t.scroll = max(t.scroll-1, 0)
+		case " ", "\x1b[6~":
+			t.scroll += max(t.height-3, 1)
+		case "b", "\x1b[5~":
+			t.scroll = max(t.scroll-max(t.height-3, 1), 0)
+		case "o", "\r":
+			t.openSelected()
+		case "q", "h", "\x1b", "\x7f":
+			t.lines, t.scroll = nil, 0
+		}
+		return false
+	}
+	switch k {
+	case "j", "\x1b[B":
+		t.selected = min(t.selected+1, max(len(t.stories)-1, 0))
+	case "k", "\x1b[A":
+		t.selected = max(t.selected-1, 0)
+	case "g":
+		t.selected = 0
+	case "G":
+		t.selected = max(len(t.stories)-1, 0)
+	case "o", "\r":
+		t.openSelected()
+	case "c", "l":
+		if len(t.stories) > 0 {
+			t.lines = t.thread(t.stories[t.selected])
+			if t.lines == nil {
+				t.lines = []commentLine{}
+			}
+		}
+	case "r":
+		t.reload()
+	}
+	return false
+}
+
+func (t *tui) openSelected() {
+	if len(t.stories) == 0 {
+		return
+	}
+	s := t.stories[t.selected]
+	link := s.URL
+	if link == "" {
+		link = s.CommentsURL()
+	}
+	if err := t.open(link); err != nil {
+		t.status = "failed to open the link: " + err.Error()
+		return
+	}
+	t.status = "opened " + link
+}
+
+// render draws the whole screen, the story list takes two lines a story.
+func (t *tui) render(w io.Writer) {
+	var rows []string
+	var help string
+	if t.lines == nil {
+		help = "j/k move  o open  c comments  r refresh  q quit"
+		perPage := max((t.height-1)/2, 1)
+		first := t.selected / perPage * perPage
+		for i := first; i < len(t.stories) && i < first+perPage; i++ {
+			s := t.stories[i]
+			title := fmt.Sprintf("%2d. %s", i+1, s.Title)
+			if s.Host != "" {
+				title += " (" + s.Host + ")"
+			}
+			title = truncate(title, t.width)
+			if i == t.selected {
+				title = "\x1b[7m" + title + "\x1b[0m"
+			}
+			rows = append(rows, title, "\x1b[2m"+truncate(fmt.Sprintf("    %d points by %s, %d comments", s.Score, s.By, s.Descendants), t.width)+"\x1b[0m")
+		}
+		if len(t.stories) == 0 {
+			rows = append(rows, "no stories")
+		}
+	} else {
+		help = "j/k scroll  space/b page  o open  q back"
+		s := t.stories[t.selected]
+		all := []string{"\x1b[1m" + truncate(s.Title, t.width) + "\x1b[0m"}
+		for _, p := range paragraphs(s.Text) {
+			all = append(all, wrap(p, t.width, 0)...)
+		}
+		for _, c := range t.lines {
+			all = append(all, "", strings.Repeat("  ", c.depth)+"\x1b[2m"+c.by+"\x1b[0m")
+			for _, p := range c.paragraphs {
+				all = append(all, wrap(p, t.width, 2*c.depth)...)
+			}
+		}
+		if len(t.lines) == 0 {
+			all = append(all, "", "no comments")
+		}
+		t.scroll = min(t.scroll, max(len(all)-(t.height-1), 0))
+		rows = all[t.scroll:min(t.scroll+t.height-1, len(all))]
+	}
+	fmt.Fprint(w, "\x1b[H\x1b[2J")
+	for _, r := range rows {
+		fmt.Fprint(w, r, "\r\n")
+	}
+	status := help
+	if t.status != "" {
+		status = t.status
+	}
+	fmt.Fprintf(w, "\x1b[%d;1H\x1b[7m%s\x1b[0m", max(t.height, 1), truncate(status, t.width))
+}
+
+// truncate shortens s to width runes, ending it with "…" when it is cut.
+func truncate(s string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:width-1]) + "…"
+}
+
+// wrap breaks a paragraph into lines of at most width runes, indented by
+// indent spaces. Words longer than a line are cut.
+func wrap(p string, width, indent int) []string {
+	pad := strings.Repeat(" ", indent)
+	width = max(width-indent, 20)
+	var lines []string
+	var line []rune
+	for _, word := range strings.Fields(p) {
+		w := []rune(word)
+		for len(w) > width {
+			if len(line) > 0 {
+				lines = append(lines, pad+string(line))
+				line = nil
+			}
+			lines = append(lines, pad+string(w[:width]))
+			w = w[width:]
+		}
+		if len(line) > 0 && len(line)+1+len(w) > width {
+			lines = append(lines, pad+string(line))
+			line = nil
+		}
+		if len(line) > 0 {
+			line = append(line, ' ')
+		}
+		line = append(line, w...)
+	}
+	if len(line) > 0 {
+		lines = append(lines, pad+string(line))
+	}
+	return lines
+}
+
+// fetchThread fetches the comments of a story depth first, the replies to a
+// comment concurrently, up to tuiMaxComments of them.
+func fetchThread(s item) []commentLine {
+	return appendThread(nil, s.Kids, 0)
+}
+
+func appendThread(lines []commentLine, ids []int, depth int) []commentLine {
+	if depth >= tuiMaxDepth || len(lines) >= tuiMaxComments {
+		return lines
+	}
+	ids = ids[:min(len(ids), tuiMaxComments-len(lines))]
+	for _, c := range fetchComments(ids) {
+		if len(lines) >= tuiMaxComments {
+			break
+		}
+		lines = append(lines, commentLine{depth: depth, by: c.By, paragraphs: paragraphs(c.Text)})
+		lines = appendThread(lines, c.Kids, depth+1)
+	}
+	return lines
+}
+
+// fetchComments fetches the comments with the given ids concurrently, in
+// order, leaving out the ones that failed or were deleted.
+func fetchComments(ids []int) []hn.Item {
+	type result struct {
+		idx  int
+		item hn.Item
+		err  error
+	}
+	resChan := make(chan result)
+	for i, id := range ids {
+		go func(id int, idx int) {
+			hnItem, err := hnClient.GetItem(id)
+			resChan <- result{idx: idx, item: hnItem, err: err}
+		}(id, i)
+	}
+	results := make([]result, len(ids))
+	for range results {
+		res := <-resChan
+		results[res.idx] = res
+	}
+	var comments []hn.Item
+	for _, res := range results {
+		if res.err != nil || res.item.By == "" {
+			continue
+		}
+		comments = append(comments, res.item)
+	}
+	return comments
+}
+
+// openBrowser opens url with the first command of $BROWSER that starts, a
+// colon separated list where %s stands for the URL, or the opener of the
+// desktop.
+func openBrowser(url string) error {
+	var browsers []string
+	if b := os.Getenv("BROWSER"); b != "" {
+		browsers = strings.Split(b, ":")
+	} else if runtime.GOOS == "darwin" {
+		browsers = []string{"open"}
+	} else {
+		browsers = []string{"xdg-open"}
+	}
+	err := errors.New("no browser, set $BROWSER")
+	for _, b := range browsers {
+		args := strings.Fields(b)
+		if len(args) == 0 {
+			continue
+		}
+		if strings.Contains(b, "%s") {
+			for i := range args {
+				args[i] = strings.ReplaceAll(args[i], "%s", url)
+			}
+		} else {
+			args = append(args, url)
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		if err = cmd.Start(); err == nil {
+			go cmd.Wait()
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	got := wrap("the quick brown fox jumps over the lazy dog", 24, 4)
+	want := []string{"    the quick brown fox", "    jumps over the lazy", "    dog"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrap: want %q, got %q", want, got)
+	}
+	got = wrap(strings.Repeat("x", 45), 20, 0)
+	want = []string{strings.Repeat("x", 20), strings.Repeat("x", 20), strings.Repeat("x", 5)}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrap long word: want %q, got %q", want, got)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("héllo world", 6); got != "héllo…" {
+		t.Errorf("truncate: want %q, got %q", "héllo…", got)
+	}
+	if got := truncate("short", 6); got != "short" {
+		t.Errorf("truncate: want %q, got %q", "short", got)
+	}
+}
+
+func TestTUI_Key(t *testing.T) {
+	var opened []string
+	threads := 0
+	tu := &tui{
+		load: func() ([]item, error) {
+			return []item{testStory(1, "One", "https://a.com/1", 10), testStory(2, "Two", "", 20)}, nil
+		},
+		thread: func(s item) []commentLine {
+			threads++
+			return []commentLine{{by: "pg", paragraphs: []string{"a reply to " + s.Title}}}
+		},
+		open:  func(url string) error { opened = append(opened, url); return nil },
+		width: 80, height: 10,
+	}
+	tu.reload()
+
+	tu.key("k")
+	if tu.selected != 0 {
+		t.Errorf("k at the top: want 0, got %d", tu.selected)
+	}
+	tu.key("\x1b[B")
+	tu.key("j")
+	if tu.selected != 1 {
+		t.Errorf("j at the bottom: want 1, got %d", tu.selected)
+	}
+	tu.key("o")
+	if want := []string{discussionURL(2)}; !reflect.DeepEqual(opened, want) {
+		t.Errorf("open: want %q, got %q", want, opened)
+	}
+
+	tu.key("c")
+	if threads != 1 || len(tu.lines) != 1 {
+		t.Fatalf("comments: want the thread open, got %d fetches and %d lines", threads, len(tu.lines))
+	}
+	var b bytes.Buffer
+	tu.render(&b)
+	if !strings.Contains(b.String(), "a reply to Two") {
+		t.Errorf("render: want the comment in %q", b.String())
+	}
+	if tu.key("q") {
+		t.Error("q in a thread: want back to the list, got quit")
+	}
+	if tu.lines != nil {
+		t.Error("q in a thread: want the thread closed")
+	}
+	if !tu.key("q") {
+		t.Error("q on the list: want quit")
+	}
+
+	tu.load = func() ([]item, error) { return nil, errors.New("down") }
+	tu.key("r")
+	if len(tu.stories) != 2 || !strings.Contains(tu.status, "down") {
+		t.Errorf("failed refresh: want the old stories and the error, got %d stories and %q", len(tu.stories), tu.status)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+const versionPath = "/version"
+
+// The build info can be set at build time, which wins over what the Go
+// toolchain recorded:
+//
+//	go build -ldflags "-X main.buildVersion=v1.2.0 -X main.buildCommit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+var (
+	buildVersion string
+	buildCommit  string
+	buildDate    string
+)
+
+// buildInfo describes the binary that is running.
+type buildInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+	Date    string `json:"date,omitempty"`
+	// Modified is set when the binary was built from a tree with changes
+	// that weren't committed
+	Modified bool   `json:"modified,omitempty"`
+	Go       string `json:"go"`
+}
+
+// build returns the build info from the linker flags, falling back on the
+// module version and the VCS stamp of the toolchain.
+var build = sync.OnceValue(func() buildInfo {
+	b := buildInfo{Version: buildVersion, Commit: buildCommit, Date: buildDate, Go: runtime.Version()}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if b.Version == "" && info.Main.Version != "(devel)" {
+			b.Version = info.Main.Version
+		}
+		for _, s := range info.Settings {
+			switch {
+			case s.Key == "vcs.revision" && b.Commit == "":
+				b.Commit = s.Value
+			case s.Key == "vcs.time" && b.Date == "":
+				b.Date = s.Value
+			case s.Key == "vcs.modified":
+				b.Modified = s.Value == "true"
+			}
+		}
+	}
+	if b.Version == "" {
+		b.Version = "devel"
+	}
+	return b
+})
+
+// version returns the version with the short commit it was built from, if
+// known, like "v1.2.0 (0123456789ab)".
+func version() string {
+	b := build()
+	v := b.Version
+	if len(b.Commit) >= 12 {
+		v += " (" + b.Commit[:12] + ")"
+	} else if b.Commit != "" {
+		v += " (" + b.Commit + ")"
+	}
+	return v
+}
+
+// versionHandler reports the build info as JSON, so a fleet of instances can
+// be checked for the version they run.
+func versionHandler() http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(build()); err != nil {
+			http.Error(w, "Failed to encode the build info", http.StatusInternalServerError)
+		}
+	})
+}
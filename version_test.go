@@ -0,0 +1,23 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+)
+
+func TestVersionHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	versionHandler()(rec, httptest.NewRequest("GET", versionPath, nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("content type: want application/json, got %s", ct)
+	}
+	var got buildInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Version == "" || got.Go != runtime.Version() {
+		t.Errorf("build info: want a version and %s, got %+v", runtime.Version(), got)
+	}
+}
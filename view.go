@@ -0,0 +1,122 @@
+package main
+
+import (
+	"cmp"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// view holds the per-request choices that select which of the cached stories
+// a page shows.
+type view struct {
+	TextPosts bool
+	// Tag limits the view to stories with this tag, on the /tag/ pages
+	Tag         string
+	ExcludeTags []string
+	HideReposts bool
+	// GroupHosts folds the stories that follow one of the same site under it
+	GroupHosts bool
+	// filters holds the visitor's own filters from the settings cookie, nil
+	// if there are none
+	filters *filters
+	// numStories and sort are the story count and order the visitor set,
+	// the zero values keep the ones of the instance
+	numStories int
+	sort       string
+}
+
+// defaultView returns the view of the configured defaults, which is what is
+// shown to visitors that ask for nothing else.
+func (cfg config) defaultView() view {
+	return view{TextPosts: cfg.IncludeTextPosts, HideReposts: cfg.HideReposts, GroupHosts: cfg.GroupHosts}
+}
+
+// view returns the view asked for by the query string, falling back to the
+// configured defaults, and the settings of the visitor.
+func (cfg config) view(r *http.Request) view {
+	v := cfg.defaultView()
+	s := cfg.settings(r)
+	if !s.empty() {
+		v.filters = s.filters()
+	}
+	v.numStories, v.sort = s.NumStories, s.Sort
+	if b, err := strconv.ParseBool(r.URL.Query().Get("text_posts")); err == nil {
+		v.TextPosts = b
+	}
+	if b, err := strconv.ParseBool(r.URL.Query().Get("group_hosts")); err == nil {
+		v.GroupHosts = b
+	}
+	if strings.HasPrefix(r.URL.Path, tagPath) {
+		v.Tag = strings.TrimPrefix(r.URL.Path, tagPath)
+	}
+	for _, tags := range r.URL.Query()["exclude_tag"] {
+		for _, tag := range strings.Split(tags, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				v.ExcludeTags = append(v.ExcludeTags, tag)
+			}
+		}
+	}
+	return v
+}
+
+// apply returns the first n stories of the view, fewer if the visitor asked
+// for fewer, ranked from 1 in the order they asked for. The cached slice is
+// shared between requests, so the result is always a copy.
+func (v view) apply(stories []item, n int) []item {
+	if v.numStories > 0 {
+		n = min(n, v.numStories)
+	}
+	ret := make([]item, 0, n)
+	for _, s := range stories {
+		if len(ret) == n {
+			break
+		}
+		if !v.TextPosts && !isStoryLink(s) && !isJob(s) {
+			continue
+		}
+		if v.filters != nil && !v.filters.keep(s) {
+			continue
+		}
+		if v.Tag != "" && !hasTag(s, v.Tag) || v.excluded(s) || v.HideReposts && s.Repost != nil {
+			continue
+		}
+		s.Rank = len(ret) + 1
+		ret = append(ret, s)
+	}
+	if v.sort != "" {
+		sortStories(ret, v.sort)
+		for i := range ret {
+			ret[i].Rank = i + 1
+		}
+	}
+	return ret
+}
+
+// sortStories orders stories by one of sortOrders, highest first. Stories
+// that tie keep their order.
+func sortStories(stories []item, order string) {
+	var value func(s item) int
+	switch order {
+	case "score":
+		value = func(s item) int { return s.Score }
+	case "comments":
+		value = func(s item) int { return s.Descendants }
+	case "new":
+		value = func(s item) int { return s.Time }
+	default:
+		return
+	}
+	slices.SortStableFunc(stories, func(a, b item) int { return cmp.Compare(value(b), value(a)) })
+}
+
+// excluded reports whether a story has one of the tags the view excludes.
+func (v view) excluded(s item) bool {
+	for _, tag := range v.ExcludeTags {
+		if hasTag(s, tag) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/neghoda/quiet_hn/archive"
+	"github.com/neghoda/quiet_hn/i18n"
+)
+
+const (
+	// watchSeenFor is how long a story that matched a rule is remembered,
+	// well past the time stories spend on the front page
+	watchSeenFor = 7 * 24 * time.Hour
+	// watchFeedSize is the number of stories in the feed of a rule
+	watchFeedSize = 50
+)
+
+// watchRule is a rule from the -watch_rules file. A story matches if its
+// title has one of the keywords, it is on one of the domains and it has at
+// least MinScore points. Empty lists match every story.
+type watchRule struct {
+	Name     string   `json:"name"`
+	Keywords []string `json:"keywords"`
+	Domains  []string `json:"domains"`
+	MinScore int      `json:"min_score"`
+	// Webhook, Slack, Discord, Ntfy, Pushover and Matrix replace the
+	// -watch_ flags of the same name for this rule
+	Webhook  string `json:"webhook"`
+	Slack    string `json:"slack"`
+	Discord  string `json:"discord"`
+	Ntfy     string `json:"ntfy"`
+	Pushover string `json:"pushover"`
+	Matrix   string `json:"matrix"`
+
+	patterns  []*regexp.Regexp
+	notifiers []notifier
+}
+
+// watcher notifies about the stories that match watch rules, once each, when
+// they first show up on the front page.
+type watcher struct {
+	rules []*watchRule
+
+	mutex sync.Mutex
+	// seen is when a rule first matched a story, by rule name and story
+	seen map[string]time.Time
+	// matched is the stories that matched each rule, the last one first
+	matched map[string][]watchMatch
+	// started is false until the stories that were on the front page when
+	// the server started have been seen, they don't count as new
+	started bool
+}
+
+// loadWatchRules reads a JSON list of rules. Keywords are matched like
+// -mute entries, domains include their subdomains.
+func loadWatchRules(path string) ([]*watchRule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*watchRule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	names := make(map[string]bool)
+	for i, r := range rules {
+		if !tagName.MatchString(r.Name) {
+			return nil, fmt.Errorf("%s: rule %d: names may only contain a-z, 0-9 and -", path, i+1)
+		}
+		if names[r.Name] {
+			return nil, fmt.Errorf("%s: rule %d: %s is defined twice", path, i+1, r.Name)
+		}
+		names[r.Name] = true
+		for _, k := range r.Keywords {
+			re, err := compileMute(k)
+			if err != nil {
+				return nil, fmt.Errorf("%s: rule %s: %w", path, r.Name, err)
+			}
+			r.patterns = append(r.patterns, re)
+		}
+		for j, d := range r.Domains {
+			r.Domains[j] = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "www.")
+		}
+	}
+	return rules, nil
+}
+
+func newWatcher(cfg config) (*watcher, error) {
+	rules, err := loadWatchRules(cfg.WatchRules)
+	if err != nil {
+		return nil, err
+	}
+	brand, locale := cfg.brand(nil), i18n.Lookup(cfg.Lang)
+	for _, r := range rules {
+		if url := or(r.Webhook, cfg.WatchWebhook); url != "" {
+			r.notifiers = append(r.notifiers, webhookNotifier{url: url})
+		}
+		if url := or(r.Slack, cfg.WatchSlack); url != "" {
+			r.notifiers = append(r.notifiers, slackWebhook{url: url, brand: brand, locale: locale})
+		}
+		if url := or(r.Discord, cfg.WatchDiscord); url != "" {
+			r.notifiers = append(r.notifiers, discordWebhook{url: url, brand: brand, locale: locale})
+		}
+		if topic := or(r.Ntfy, cfg.WatchNtfy); topic != "" {
+			r.notifiers = append(r.notifiers, newNtfyNotifier(topic, cfg.NtfyToken, locale))
+		}
+		if user := or(r.Pushover, cfg.WatchPushover); user != "" {
+			if cfg.PushoverToken == "" {
+				return nil, fmt.Errorf("%s: rule %s: pushover needs -pushover_token", cfg.WatchRules, r.Name)
+			}
+			r.notifiers = append(r.notifiers, pushoverNotifier{token: cfg.PushoverToken, user: user, locale: locale})
+		}
+		if room := or(r.Matrix, cfg.WatchMatrix); room != "" {
+			if cfg.MatrixHomeserver == "" || cfg.MatrixToken == "" {
+				return nil, fmt.Errorf("%s: rule %s: matrix needs -matrix_homeserver and -matrix_token", cfg.WatchRules, r.Name)
+			}
+			r.notifiers = append(r.notifiers, cfg.matrixRoom(room))
+		}
+	}
+	return &watcher{rules: rules, seen: make(map[string]time.Time), matched: make(map[string][]watchMatch)}, nil
+}
+
+// backfill fills the feeds of the rules with the stories of the archive
+// that matched them when they made it to the front page, so a restart
+// doesn't empty them.
+func (w *watcher) backfill(a *archive.Store) error {
+	stories, err := a.Seen(time.Now().Add(-watchSeenFor))
+	if err != nil {
+		return err
+	}
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	for _, st := range stories {
+		s := archivedItem(st, 0)
+		for _, r := range w.rules {
+			if !r.match(s) {
+				continue
+			}
+			w.seen[fmt.Sprintf("%s/%d", r.Name, s.ID)] = st.FirstSeen
+			w.addToFeed(r, s, st.FirstSeen)
+		}
+	}
+	return nil
+}
+
+// match reports whether a story matches the rule.
+func (r *watchRule) match(s item) bool {
+	if s.Score < r.MinScore {
+		return false
+	}
+	if len(r.Domains) > 0 {
+		on := false
+		for _, d := range r.Domains {
+			on = on || onDomain(s.Host, d)
+		}
+		if !on {
+			return false
+		}
+	}
+	if len(r.patterns) == 0 {
+		return true
+	}
+	for _, re := range r.patterns {
+		if re.MatchString(s.Title) {
+			return true
+		}
+	}
+	return false
+}
+
+// check sends the notifications for the stories that match a rule for the
+// first time. They are sent in the background, so a slow endpoint doesn't
+// hold up the refresh.
+func (w *watcher) check(stories []item) {
+	type match struct {
+		rule  *watchRule
+		story item
+	}
+	var matches []match
+	now := time.Now()
+	w.mutex.Lock()
+	for key, t := range w.seen {
+		if now.Sub(t) > watchSeenFor {
+			delete(w.seen, key)
+		}
+	}
+	for _, r := range w.rules {
+		for _, s := range stories {
+			key := fmt.Sprintf("%s/%d", r.Name, s.ID)
+			if _, ok := w.seen[key]; ok || !r.match(s) {
+				continue
+			}
+			w.seen[key] = now
+			// the stories there at startup are in the feed all the same
+			w.addToFeed(r, s, now)
+			if w.started {
+				matches = append(matches, match{r, s})
+			}
+		}
+	}
+	w.started = true
+	w.mutex.Unlock()
+	if len(matches) == 0 {
+		return
+	}
+	go func() {
+		for _, m := range matches {
+			for _, n := range m.rule.notifiers {
+				if err := n.notify(m.rule.Name, m.story); err != nil {
+					log.Printf("failed to notify about %d for rule %s: %s", m.story.ID, m.rule.Name, err)
+				}
+			}
+		}
+	}()
+}
+
+// watchMatch is a story in the feed of a rule, with when it matched.
+type watchMatch struct {
+	Story item
+	At    time.Time
+}
+
+// addToFeed puts a story first in the feed of a rule, mutex must be held.
+func (w *watcher) addToFeed(r *watchRule, s item, at time.Time) {
+	feed := append([]watchMatch{{Story: s, At: at}}, w.matched[r.Name]...)
+	if len(feed) > watchFeedSize {
+		feed = feed[:watchFeedSize]
+	}
+	w.matched[r.Name] = feed
+}
+
+// feed returns the last stories that matched the rule of the given name, and
+// false if there is no such rule.
+func (w *watcher) feed(name string) ([]watchMatch, bool) {
+	for _, r := range w.rules {
+		if r.Name == name {
+			w.mutex.Lock()
+			defer w.mutex.Unlock()
+			return append([]watchMatch(nil), w.matched[name]...), true
+		}
+	}
+	return nil, false
+}
+
+// or returns the first of the values that is not empty.
+func or(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/neghoda/quiet_hn/archive"
+	"github.com/neghoda/quiet_hn/hn"
+)
+
+func testRules(t *testing.T, rules string) []*watchRule {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := loadWatchRules(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func testStory(id int, title, url string, score int) item {
+	return parseHNItem(hn.Item{ID: id, Type: "story", Title: title, URL: url, Score: score})
+}
+
+func TestWatchRule_Match(t *testing.T) {
+	r := testRules(t, `[{"name":"rust","keywords":["rust","/\\bcve-\\d+/"],"domains":["www.github.com"],"min_score":50}]`)[0]
+	tests := []struct {
+		name  string
+		story item
+		want  bool
+	}{
+		{"all", testStory(1, "Rust 2.0", "https://github.com/a", 50), true},
+		{"subdomain", testStory(1, "Rust 2.0", "https://blog.github.com/a", 50), true},
+		{"regexp", testStory(1, "Fixing CVE-2025 today", "https://github.com/a", 50), true},
+		{"low score", testStory(1, "Rust 2.0", "https://github.com/a", 49), false},
+		{"other domain", testStory(1, "Rust 2.0", "https://notgithub.com/a", 50), false},
+		{"no keyword", testStory(1, "Go 2.0", "https://github.com/a", 50), false},
+		{"part of a word", testStory(1, "Trusty", "https://github.com/a", 50), false},
+	}
+	for _, tt := range tests {
+		if got := r.match(tt.story); got != tt.want {
+			t.Errorf("%s: want %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	empty := testRules(t, `[{"name":"any"}]`)[0]
+	if !empty.match(testStory(1, "Anything", "", 0)) {
+		t.Errorf("empty rule: want a match")
+	}
+}
+
+type fakeNotifier chan string
+
+func (n fakeNotifier) notify(rule string, s item) error {
+	n <- rule + "/" + s.Title
+	return nil
+}
+
+// next returns the next notification, or "" if none comes.
+func (n fakeNotifier) next() string {
+	select {
+	case got := <-n:
+		return got
+	case <-time.After(100 * time.Millisecond):
+		return ""
+	}
+}
+
+func TestWatcher_Check(t *testing.T) {
+	rules := testRules(t, `[{"name":"go","keywords":["go"]}]`)
+	n := make(fakeNotifier, 10)
+	rules[0].notifiers = []notifier{n}
+	w := &watcher{rules: rules, seen: make(map[string]time.Time), matched: make(map[string][]watchMatch)}
+
+	// the front page at startup isn't new
+	w.check([]item{testStory(1, "Go 1", "", 1), testStory(2, "Rust", "", 1)})
+	w.check([]item{testStory(1, "Go 1", "", 1), testStory(3, "Go 3", "", 1)})
+	if got := n.next(); got != "go/Go 3" {
+		t.Errorf("notification: want %q, got %q", "go/Go 3", got)
+	}
+	// each story fires once
+	w.check([]item{testStory(1, "Go 1", "", 1), testStory(3, "Go 3", "", 1), testStory(4, "Go 4", "", 1)})
+	if got := n.next(); got != "go/Go 4" {
+		t.Errorf("notification: want %q, got %q", "go/Go 4", got)
+	}
+	if got := n.next(); got != "" {
+		t.Errorf("notification: want none, got %q", got)
+	}
+
+	feed, ok := w.feed("go")
+	if !ok {
+		t.Fatalf("feed: want the go rule")
+	}
+	var ids []int
+	for _, m := range feed {
+		ids = append(ids, m.Story.ID)
+	}
+	if want := []int{4, 3, 1}; fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("feed: want %v, got %v", want, ids)
+	}
+	if _, ok := w.feed("rust"); ok {
+		t.Errorf("feed: want no rust rule")
+	}
+}
+
+func TestWatcher_Backfill(t *testing.T) {
+	a, err := archive.Open(filepath.Join(t.TempDir(), "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	seen := time.Now().Add(-time.Hour).Truncate(time.Second)
+	a.Record([]archive.Story{{ID: 1, Type: "story", Title: "Go 1"}, {ID: 2, Type: "story", Title: "Rust"}}, seen)
+
+	rules := testRules(t, `[{"name":"go","keywords":["go"]}]`)
+	n := make(fakeNotifier, 10)
+	rules[0].notifiers = []notifier{n}
+	w := &watcher{rules: rules, seen: make(map[string]time.Time), matched: make(map[string][]watchMatch)}
+	if err := w.backfill(a); err != nil {
+		t.Fatalf("backfill: %s", err)
+	}
+	feed, _ := w.feed("go")
+	if len(feed) != 1 || feed[0].Story.ID != 1 || !feed[0].At.Equal(seen) {
+		t.Fatalf("feed: want story 1 at %s, got %+v", seen, feed)
+	}
+	// a story from the archive is not new when it shows up again later
+	w.check([]item{testStory(2, "Rust", "", 1)})
+	w.check([]item{testStory(1, "Go 1", "", 1)})
+	if got := n.next(); got != "" {
+		t.Errorf("notification: want none, got %q", got)
+	}
+}